@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的创建和撤销个人访问令牌操作
+const (
+	auditActionTokenCreate = "admin.token.create"
+	auditActionTokenRevoke = "admin.token.revoke"
+)
+
+// 个人访问令牌保存在数据目录中的文件，只保存令牌的哈希
+const accessTokensFile = "access_tokens.json"
+
+// 个人访问令牌的前缀，便于识别和在代码仓库中扫描泄漏的令牌
+const accessTokenPrefix = "aat_"
+
+// 个人访问令牌的权限范围，令牌只能调用权限范围内的接口
+const (
+	tokenScopeCapture = "capture"
+	tokenScopeChat    = "chat"
+)
+
+var knownTokenScopes = []string{tokenScopeCapture, tokenScopeChat}
+
+// AccessToken 个人访问令牌，供浏览器扩展等客户端调用收集和提问接口
+type AccessToken struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// 令牌的前几个字符，用于在列表中辨认令牌
+	Prefix string `json:"prefix"`
+	// 令牌的 SHA-256，不保存令牌本身
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAccessTokenRequest 创建个人访问令牌的请求
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// 有效期，例如 720h，为空时不过期
+	ExpiresIn string `json:"expires_in"`
+}
+
+var (
+	accessTokensMu sync.Mutex
+	accessTokens   []AccessToken
+)
+
+// loadAccessTokens 启动时读取个人访问令牌
+func loadAccessTokens() {
+	var tokens []AccessToken
+	if err := loadDataFile(accessTokensFile, &tokens); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取个人访问令牌失败", "error", err)
+		}
+		return
+	}
+	accessTokensMu.Lock()
+	accessTokens = tokens
+	accessTokensMu.Unlock()
+}
+
+// saveAccessTokens 保存个人访问令牌，调用方需持有 accessTokensMu
+func saveAccessTokens() error {
+	return saveDataFile(accessTokensFile, accessTokens)
+}
+
+// hashAccessToken 返回令牌的 SHA-256
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// findAccessToken 返回与令牌匹配且没有过期的个人访问令牌
+func findAccessToken(token string, now time.Time) (AccessToken, bool) {
+	if !strings.HasPrefix(token, accessTokenPrefix) {
+		return AccessToken{}, false
+	}
+	hash := hashAccessToken(token)
+	accessTokensMu.Lock()
+	defer accessTokensMu.Unlock()
+	for _, t := range accessTokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+				return AccessToken{}, false
+			}
+			return t, true
+		}
+	}
+	return AccessToken{}, false
+}
+
+// 保存请求令牌权限范围的上下文键，没有携带令牌的请求不设置
+const tokenScopesContextKey = "token_scopes"
+
+// tokenAuth 个人访问令牌认证中间件，应用于令牌可以调用的接口
+// 请求携带 Authorization: Bearer <令牌> 时要求令牌有效且包含 scope，管理令牌同样可以通过；
+// 没有携带令牌时，开启 access_tokens.required 则拒绝，否则按匿名请求处理
+// scope 为空时只认证令牌，由处理函数按操作调用 tokenScopeError 检查权限（用于 GraphQL）
+func tokenAuth(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticateToken(c) {
+			return
+		}
+		if scope != "" {
+			if scopeErr := tokenScopeError(c, scope); scopeErr != nil {
+				recordAudit(c, auditActionAuthFailed, c.FullPath(), scopeErr.Message, scopeErr.Status)
+				respondError(c, scopeErr.Status, scopeErr.localize(requestLocale(c)))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// authenticateToken 认证请求携带的令牌，并在上下文中记录调用方和令牌的权限范围
+// 没有携带令牌时直接返回 true；令牌无效时返回 401 并返回 false
+func authenticateToken(c *gin.Context) bool {
+	cfg := currentConfig()
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return true
+	}
+	user, scopes, ok := lookupToken(cfg, token)
+	if !ok {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "个人访问令牌无效", http.StatusUnauthorized)
+		respondError(c, http.StatusUnauthorized, tr(c, "error.access_token_invalid"))
+		return false
+	}
+	c.Set("user", user)
+	c.Set(tokenScopesContextKey, scopes)
+	return true
+}
+
+// lookupToken 查找令牌对应的调用方和权限范围，管理令牌拥有全部权限；令牌无效时 ok 为 false
+// HTTP 和 gRPC 共用这一规则
+func lookupToken(cfg *Config, token string) (user string, scopes []string, ok bool) {
+	if cfg.Admin.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Admin.Token)) == 1 {
+		return "admin", knownTokenScopes, true
+	}
+	t, ok := findAccessToken(token, time.Now())
+	if !ok {
+		return "", nil, false
+	}
+	return "token:" + t.Name, t.Scopes, true
+}
+
+// tokenScopeError 检查已认证的请求能否调用 scope 范围内的操作，可以调用时返回 nil
+// 没有携带令牌时，开启 access_tokens.required 返回 401，否则按匿名请求放行
+func tokenScopeError(c *gin.Context, scope string) *chatError {
+	v, ok := c.Get(tokenScopesContextKey)
+	scopes, _ := v.([]string)
+	return scopeError(currentConfig(), scopes, ok, scope)
+}
+
+// scopeError 按令牌的权限范围检查能否调用 scope 范围内的操作，authenticated 表示请求携带了有效的令牌
+func scopeError(cfg *Config, scopes []string, authenticated bool, scope string) *chatError {
+	if !authenticated {
+		if cfg.AccessTokens.Required {
+			return newChatError(http.StatusUnauthorized, "error.access_token_required")
+		}
+		return nil
+	}
+	if !containsString(scopes, scope) {
+		return newChatError(http.StatusForbidden, "error.access_token_scope", scope)
+	}
+	return nil
+}
+
+// accessTokensHandler 返回全部个人访问令牌，不包含令牌本身
+func accessTokensHandler(c *gin.Context) {
+	accessTokensMu.Lock()
+	tokens := make([]AccessToken, 0, len(accessTokens))
+	for _, t := range accessTokens {
+		t.Hash = ""
+		tokens = append(tokens, t)
+	}
+	accessTokensMu.Unlock()
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// createAccessTokenHandler 创建个人访问令牌，令牌只在响应中返回这一次
+func createAccessTokenHandler(c *gin.Context) {
+	var req CreateAccessTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Scopes) == 0 {
+		respondError(c, http.StatusBadRequest, tr(c, "error.access_token_scope_invalid", ""))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !containsString(knownTokenScopes, scope) {
+			respondError(c, http.StatusBadRequest, tr(c, "error.access_token_scope_invalid", scope))
+			return
+		}
+	}
+	now := time.Now()
+	t := AccessToken{Name: req.Name, Scopes: req.Scopes, CreatedAt: now}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.expires_in_invalid", req.ExpiresIn))
+			return
+		}
+		expires := now.Add(d)
+		t.ExpiresAt = &expires
+	}
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	token := accessTokenPrefix + hex.EncodeToString(b)
+	id := make([]byte, 6)
+	rand.Read(id)
+	t.ID = hex.EncodeToString(id)
+	t.Prefix = token[:len(accessTokenPrefix)+6]
+	t.Hash = hashAccessToken(token)
+
+	accessTokensMu.Lock()
+	accessTokens = append(accessTokens, t)
+	err := saveAccessTokens()
+	if err != nil {
+		accessTokens = accessTokens[:len(accessTokens)-1]
+	}
+	accessTokensMu.Unlock()
+	if err != nil {
+		requestLogger(c).Error("保存个人访问令牌失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	recordAudit(c, auditActionTokenCreate, "tokens/"+t.ID, fmt.Sprintf("name=%s scopes=%s", t.Name, strings.Join(t.Scopes, ",")), http.StatusOK)
+
+	t.Hash = ""
+	c.JSON(http.StatusOK, gin.H{"token": token, "info": t})
+}
+
+// revokeAccessTokenHandler 撤销个人访问令牌，撤销后立即失效
+func revokeAccessTokenHandler(c *gin.Context) {
+	id := c.Param("id")
+	accessTokensMu.Lock()
+	index := -1
+	for i, t := range accessTokens {
+		if t.ID == id {
+			index = i
+			break
+		}
+	}
+	var err error
+	if index >= 0 {
+		previous := accessTokens
+		accessTokens = append(accessTokens[:index:index], accessTokens[index+1:]...)
+		if err = saveAccessTokens(); err != nil {
+			accessTokens = previous
+		}
+	}
+	accessTokensMu.Unlock()
+
+	if index < 0 {
+		respondError(c, http.StatusNotFound, tr(c, "error.access_token_not_found"))
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("保存个人访问令牌失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	recordAudit(c, auditActionTokenRevoke, "tokens/"+id, "", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{"message": tr(c, "message.access_token_revoked"), "id": id})
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const backupDir = "backups"
+
+// 统计趋势的天数
+const statsTrendDays = 7
+
+// 管理操作的审计事件类型
+const (
+	auditActionAdminCacheClear = "admin.cache.clear"
+	auditActionAdminBackup     = "admin.backup"
+	auditActionAdminReindex    = "admin.reindex"
+)
+
+// TagCount 标签及其使用次数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// DailyCount 按天统计的数量
+type DailyCount struct {
+	Date     string `json:"date"`
+	Requests int    `json:"requests"`
+	Errors   int    `json:"errors"`
+}
+
+// adminStatsHandler 返回管理后台的汇总统计
+func adminStatsHandler(c *gin.Context) {
+	users := map[string]bool{}
+	actions := map[string]int{}
+	trends := map[string]*DailyCount{}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-statsTrendDays+1, 0, 0, 0, 0, now.Location())
+
+	auditMu.Lock()
+	err := readJSONLines(dataPath(auditLogFile), func(line []byte) {
+		var entry AuditEntry
+		if json.Unmarshal(line, &entry) != nil {
+			return
+		}
+		users[entry.User] = true
+		actions[entry.Action]++
+
+		if entry.Timestamp.Before(since) {
+			return
+		}
+		day := entry.Timestamp.In(now.Location()).Format("2006-01-02")
+		trend, ok := trends[day]
+		if !ok {
+			trend = &DailyCount{Date: day}
+			trends[day] = trend
+		}
+		trend.Requests++
+		if entry.Status >= http.StatusBadRequest {
+			trend.Errors++
+		}
+	})
+	auditMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_audit_log"))
+		return
+	}
+
+	errorTrends := make([]DailyCount, 0, statsTrendDays)
+	for i := 0; i < statsTrendDays; i++ {
+		day := since.AddDate(0, 0, i).Format("2006-01-02")
+		if trend, ok := trends[day]; ok {
+			errorTrends = append(errorTrends, *trend)
+		} else {
+			errorTrends = append(errorTrends, DailyCount{Date: day})
+		}
+	}
+
+	userList := make([]string, 0, len(users))
+	for user := range users {
+		userList = append(userList, user)
+	}
+	sort.Strings(userList)
+
+	usageMu.Lock()
+	tokens := usageTotal
+	usageMu.Unlock()
+
+	dataMu.RLock()
+	knowledge := gin.H{"items": len(knowledgeBase), "top_tags": topTags(10)}
+	qaCount := len(recentQAs)
+	dataMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": gin.H{
+			"count": len(userList),
+			"list":  userList,
+		},
+		"requests": gin.H{
+			"chats":         actions[auditActionChat],
+			"by_action":     actions,
+			"since_startup": tokens.Requests,
+		},
+		"tokens":          tokens,
+		"knowledge":       knowledge,
+		"recent_qas":      qaCount,
+		"error_trends":    errorTrends,
+		"cache_hit_ratio": tokens.cacheHitRatio(),
+	})
+}
+
+// topTags 统计知识库中使用最多的标签，调用方需持有 dataMu
+func topTags(n int) []TagCount {
+	counts := map[string]int{}
+	for _, item := range knowledgeBase {
+		for _, tag := range item.Tags {
+			if tag != "" {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > n {
+		tags = tags[:n]
+	}
+	return tags
+}
+
+// adminClearCacheHandler 清空服务端缓存
+func adminClearCacheHandler(c *gin.Context) {
+	invalidateRAGIndex()
+	filterRegexCache.Clear()
+	clearGatewayCache()
+
+	recordAudit(c, auditActionAdminCacheClear, "cache", "", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{"message": tr(c, "message.cache_cleared")})
+}
+
+// adminReindexHandler 重建知识库检索索引
+func adminReindexHandler(c *gin.Context) {
+	count := rebuildRAGIndex()
+
+	recordAudit(c, auditActionAdminReindex, "knowledge", fmt.Sprintf("items=%d", count), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.index_rebuilt"),
+		"items":   count,
+	})
+}
+
+// adminBackupHandler 立即备份数据文件
+func adminBackupHandler(c *gin.Context) {
+	dir, files, err := backupDataFiles()
+	if err != nil {
+		recordAudit(c, auditActionAdminBackup, "data", err.Error(), http.StatusInternalServerError)
+		publishEvent(eventBackupFinished, gin.H{"success": false, "error": err.Error()})
+		respondError(c, http.StatusInternalServerError, tr(c, "error.backup_failed", err))
+		return
+	}
+
+	recordAudit(c, auditActionAdminBackup, "data", dir, http.StatusOK)
+	publishEvent(eventBackupFinished, gin.H{"success": true, "path": dir, "files": files})
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.backup_done"),
+		"path":    dir,
+		"files":   files,
+	})
+}
+
+// backupDataFiles 将数据文件复制到以时间命名的备份目录
+// 配置了 storage.compression 时改为生成压缩的 tar 归档，归档中是解压后的JSON文件，启用加密时归档整体加密
+func backupDataFiles() (string, []string, error) {
+	if store != nil {
+		return "", nil, errors.New("使用数据库存储时请使用数据库自带的备份工具")
+	}
+
+	// 先把变更日志压缩进数据文件，备份才包含最新的数据
+	if err := compactData(); err != nil {
+		return "", nil, err
+	}
+
+	name := time.Now().Format("20060102-150405")
+	if err := os.MkdirAll(dataPath(backupDir), 0755); err != nil {
+		return "", nil, err
+	}
+
+	mode := currentConfig().Storage.Compression
+	if mode != "" && mode != compressionNone {
+		var entries []archiveEntry
+		var files []string
+		for _, file := range []string{knowledgeDataFile, qaDataFile} {
+			data, err := os.ReadFile(findDataFile(file))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return "", nil, err
+			}
+			if data, err = decryptData(data); err != nil {
+				return "", nil, err
+			}
+			if data, err = decompressData(data); err != nil {
+				return "", nil, err
+			}
+			entries = append(entries, archiveEntry{Name: file, Data: data})
+			files = append(files, file)
+		}
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, entries, mode); err != nil {
+			return "", nil, err
+		}
+		// 启用加密时归档整体加密，避免解压后的明文落盘
+		path := filepath.Join(dataPath(backupDir), name+".tar"+compressionExt(mode))
+		data := buf.Bytes()
+		if dataKey != nil {
+			path += ".enc"
+			var err error
+			if data, err = encryptData(data); err != nil {
+				return "", nil, err
+			}
+		}
+		if err := writeFileAtomic(path, data, 0600); err != nil {
+			return "", nil, err
+		}
+		return path, files, nil
+	}
+
+	dir := filepath.Join(dataPath(backupDir), name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+
+	var files []string
+	for _, file := range []string{knowledgeDataFile, qaDataFile} {
+		src := findDataFile(file)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(src))
+		if err := copyFile(src, dst); err != nil {
+			return "", nil, err
+		}
+		files = append(files, dst)
+	}
+	return dir, files, nil
+}
+
+// copyFile 复制单个文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -2,13 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,38 +20,540 @@ import (
 // Config 配置结构体
 type Config struct {
 	API struct {
-		BaseURL string `yaml:"base_url"`
-		APIKey  string `yaml:"api_key"`
+		// openai（默认）或 mock，mock 不访问网络，按 mock 中的配置返回模拟的回答，不需要 base_url 和 api_key
+		Provider  string     `yaml:"provider"`
+		Mock      MockConfig `yaml:"mock"`
+		BaseURL   string     `yaml:"base_url"`
+		APIKey    string     `yaml:"api_key"`
+		APIKeyRef string     `yaml:"-"`
+		// 附加到每个上游请求的请求头和查询参数，例如 OpenRouter 的 HTTP-Referer、X-Title 或企业网关的令牌
+		Headers map[string]string `yaml:"headers"`
+		Query   map[string]string `yaml:"query"`
+		// 多个上游节点（例如多台 vLLM 服务器），按权重轮询，配置后忽略 base_url
+		Endpoints []UpstreamEndpoint `yaml:"endpoints"`
+		// 连续失败 failures 次（默认 3）的节点摘除 cooldown（默认 30s）后再重新尝试
+		Ejection struct {
+			Failures int    `yaml:"failures"`
+			Cooldown string `yaml:"cooldown"`
+		} `yaml:"ejection"`
+		// record 把上游的请求和响应保存到 dir（默认数据目录下的 recordings），replay 只从录制中返回响应
+		Recording struct {
+			Mode string `yaml:"mode"`
+			Dir  string `yaml:"dir"`
+		} `yaml:"recording"`
 	} `yaml:"api"`
 	Server struct {
-		Port string `yaml:"port"`
-		Host string `yaml:"host"`
+		Port        string `yaml:"port"`
+		Host        string `yaml:"host"`
+		WatchConfig bool   `yaml:"watch_config"`
+		AssetsDir   string `yaml:"assets_dir"`
+		Listen      string `yaml:"listen"`
+		SocketMode  string `yaml:"socket_mode"`
+		// HTTPS 默认启用 HTTP/2，H2C 允许明文连接使用 HTTP/2
+		H2C          bool `yaml:"h2c"`
+		DisableHTTP2 bool `yaml:"disable_http2"`
+		// 受信任的反向代理，以及从哪些请求头读取真实客户端IP
+		TrustedProxies  []string `yaml:"trusted_proxies"`
+		RemoteIPHeaders []string `yaml:"remote_ip_headers"`
+		// 是否在 /api/docs 提供 Swagger UI
+		SwaggerUI bool `yaml:"swagger_ui"`
+		// 响应压缩
+		Compression struct {
+			Enabled bool `yaml:"enabled"`
+			MinSize int  `yaml:"min_size"`
+			Level   int  `yaml:"level"`
+		} `yaml:"compression"`
 	} `yaml:"server"`
 	Models struct {
 		Default   string   `yaml:"default"`
 		Available []string `yaml:"available"`
+		// 计算 token 数使用的 tiktoken 编码，未配置的模型按名称识别，无法识别时估算
+		Encodings map[string]string `yaml:"encodings"`
+		// 模型别名，例如 fast: gpt-4o-mini，请求中可以用别名代替实际的模型名
+		Aliases map[string]string `yaml:"aliases"`
+		// 各模型的上下文长度、默认参数、价格和能力，键为实际的模型名
+		Settings map[string]ModelSettings `yaml:"settings"`
+		// 是否在回答中返回推理模型的思考过程，/api/v1/chat 的请求可以用 include_reasoning 覆盖
+		ShowReasoning bool `yaml:"show_reasoning"`
+		// 定期从上游的 /models 接口发现可用的模型，与 available 合并
+		Discover struct {
+			Enabled bool `yaml:"enabled"`
+			// 刷新间隔，默认 1h
+			Interval string `yaml:"interval"`
+			// 只加入匹配这些模式的模型（如 gpt-4o*），为空时加入全部
+			Include []string `yaml:"include"`
+		} `yaml:"discover"`
+		// 定期探测 available 中的模型是否可用，结果在 /api/v1/models 和 /api/v1/status 中返回
+		Probe struct {
+			Enabled bool `yaml:"enabled"`
+			// 探测间隔，默认 5m
+			Interval string `yaml:"interval"`
+			// 单次探测的超时，默认 15s
+			Timeout string `yaml:"timeout"`
+			// completion 发送一次 max_tokens 为 1 的对话请求，models 只查询上游的模型信息，默认 completion
+			Method string `yaml:"method"`
+		} `yaml:"probe"`
 	} `yaml:"models"`
+	// 智能路由：没有指定模型或指定为 auto 的问题由服务端选择模型
+	Router struct {
+		Enabled bool `yaml:"enabled"`
+		// category 先分类再交给该类别对应的模型，cost 选择满足 min_tier 的最便宜的模型，默认 category
+		Mode string `yaml:"mode"`
+		// 分类使用的模型，应选择便宜、快速的模型，默认 models.default
+		Model string `yaml:"model"`
+		// 各类别使用的模型，键为 factual、coding、reasoning，未配置的类别使用 models.default
+		Routes map[string]string `yaml:"routes"`
+		// cost 模式下模型的最低能力等级（models.settings 中的 tier）
+		MinTier int `yaml:"min_tier"`
+		// cost 模式下回答失败时最多换用更强模型的次数，默认 2
+		MaxEscalations int `yaml:"max_escalations"`
+	} `yaml:"router"`
+	// 回答评分：用评审模型为每个回答的相关性、错误风险和幻觉可能打分
+	Judge struct {
+		Enabled bool `yaml:"enabled"`
+		// 评审模型，默认 models.default
+		Model string `yaml:"model"`
+		// 总分（0-10）低于该值时按 action 处理：flag 标记问答记录，regenerate 重新生成，流式回答只能标记
+		Threshold float64 `yaml:"threshold"`
+		Action    string  `yaml:"action"`
+		// regenerate 时最多重新生成的次数，默认 1
+		MaxRegenerations int    `yaml:"max_regenerations"`
+		Timeout          string `yaml:"timeout"`
+	} `yaml:"judge"`
+	// 识别图片中的文字保存为知识库条目：engine 为 vision 时交给支持图片输入的模型，为 tesseract 时调用本地命令
+	OCR struct {
+		Engine string `yaml:"engine"`
+		// vision 使用的模型，默认 models.default
+		Model string `yaml:"model"`
+		// tesseract 的命令路径和识别语言，默认 tesseract、chi_sim+eng
+		Command   string `yaml:"command"`
+		Languages string `yaml:"languages"`
+		// 识别一张图片的超时，默认 60s
+		Timeout string `yaml:"timeout"`
+	} `yaml:"ocr"`
+	// 知识库条目质量评分：添加条目后由模型在后台评分，总分低于 threshold 的条目标记为草稿，不参与检索
+	Quality struct {
+		Enabled bool `yaml:"enabled"`
+		// 评分模型，默认 models.default
+		Model string `yaml:"model"`
+		// 总分（0-10）低于该值时标记为草稿，为 0 时只评分不标记
+		Threshold float64 `yaml:"threshold"`
+		Timeout   string  `yaml:"timeout"`
+	} `yaml:"quality"`
+	// 影子流量：按比例把问题在后台再交给候选模型回答，两个回答都保存下来用于比较，影子回答不会返回给用户
+	Shadow struct {
+		Enabled bool   `yaml:"enabled"`
+		Model   string `yaml:"model"`
+		// 抽样比例，0-1
+		Rate float64 `yaml:"rate"`
+		// 同时进行的影子请求数上限，超出时跳过，默认 4
+		MaxConcurrent int    `yaml:"max_concurrent"`
+		Timeout       string `yaml:"timeout"`
+	} `yaml:"shadow"`
+	// 微调任务：多久从上游同步一次还没有结束的任务的状态，默认 1m
+	Finetune struct {
+		PollInterval string `yaml:"poll_interval"`
+	} `yaml:"finetune"`
+	// 问题主题分析：为问题生成向量并聚类，由模型为每个主题命名，需要配置 embeddings.model
+	Analytics struct {
+		Topics struct {
+			Enabled bool `yaml:"enabled"`
+			// 多久重新分析一次，默认 24h
+			Interval string `yaml:"interval"`
+			// 只分析这段时间内的问题，默认 720h
+			Window string `yaml:"window"`
+			// 主题数，默认 8
+			Clusters int `yaml:"clusters"`
+			// 最多分析的不同问题数，默认 2000，超出时保留最近的问题
+			MaxQuestions int `yaml:"max_questions"`
+			// 为主题命名的模型，为空时使用 models.default
+			Model string `yaml:"model"`
+		} `yaml:"topics"`
+	} `yaml:"analytics"`
+	// 知识库内容复查：定期检查条目中的链接是否失效，并标出长时间没有更新的条目
+	Staleness struct {
+		CheckLinks bool `yaml:"check_links"`
+		// 检查链接的间隔，默认 24h
+		Interval string `yaml:"interval"`
+		// 单个链接的超时，默认 10s
+		Timeout string `yaml:"timeout"`
+		// 超过这段时间的条目需要复查，默认 4320h（180 天），为 0 时不按时间标记
+		MaxAge string `yaml:"max_age"`
+		// 定期让模型复核条目内容是否仍然准确
+		Verify struct {
+			Enabled bool `yaml:"enabled"`
+			// 复核的间隔，默认 24h
+			Interval string `yaml:"interval"`
+			// 每次最多复核的条目数，默认 10
+			MaxItems int `yaml:"max_items"`
+			// 条目复核后多久需要再次复核，默认 720h
+			ReverifyAfter string `yaml:"reverify_after"`
+			// 只复核带有其中任一标签的条目，为空时复核全部条目
+			Tags []string `yaml:"tags"`
+			// 复核使用的模型，为空时使用 models.default
+			Model string `yaml:"model"`
+			// 复核单个条目的超时，默认 60s
+			Timeout string `yaml:"timeout"`
+		} `yaml:"verify"`
+	} `yaml:"staleness"`
+	Prompt struct {
+		System string `yaml:"system"`
+		// 默认的回答语言，例如 en、zh-CN，auto 表示与问题的语言相同，为空时不限制
+		AnswerLanguage string `yaml:"answer_language"`
+		// 按用户设置回答语言，键为审计日志中的用户，例如 admin、slack:U123、email:bob@example.com
+		UserLanguages map[string]string `yaml:"user_languages"`
+		Cache         struct {
+			Enabled bool   `yaml:"enabled"`
+			Mode    string `yaml:"mode"`
+		} `yaml:"cache"`
+	} `yaml:"prompt"`
+	RAG struct {
+		Enabled bool `yaml:"enabled"`
+		TopK    int  `yaml:"top_k"`
+		// 检索到的条目之外最多附加的关联条目数，默认 3，小于 0 时不附加
+		Links int `yaml:"links"`
+		// 第二阶段重排：先按词项匹配取出候选，重排后取前 top_k 条
+		Rerank struct {
+			Enabled bool `yaml:"enabled"`
+			// llm（默认）让对话模型打分，model 调用上游的 /rerank 接口
+			Provider string `yaml:"provider"`
+			// llm 方式为空时使用 models.default，model 方式必须配置
+			Model string `yaml:"model"`
+			// 参与重排的候选数量，默认为 top_k 的 4 倍
+			Candidates int `yaml:"candidates"`
+		} `yaml:"rerank"`
+	} `yaml:"rag"`
+	// 向量接口，供外部工具复用本服务的上游凭据和限流
+	Embeddings struct {
+		// 上游的向量模型，为空时不提供向量接口
+		Model string `yaml:"model"`
+		// 每次发给上游的最多条数，默认 64
+		BatchSize int `yaml:"batch_size"`
+		// 单次请求最多的条数，默认 256
+		MaxInputs int `yaml:"max_inputs"`
+		// 缓存的向量条数，默认 10000，负数表示不缓存
+		CacheSize int `yaml:"cache_size"`
+	} `yaml:"embeddings"`
+	Moderation struct {
+		Enabled  bool     `yaml:"enabled"`
+		Provider string   `yaml:"provider"`
+		Model    string   `yaml:"model"`
+		Action   string   `yaml:"action"`
+		Keywords []string `yaml:"keywords"`
+	} `yaml:"moderation"`
+	PII struct {
+		Enabled bool     `yaml:"enabled"`
+		Types   []string `yaml:"types"`
+	} `yaml:"pii"`
+	InjectionGuard struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"injection_guard"`
+	Filters struct {
+		Rules      []FilterRule            `yaml:"rules"`
+		Workspaces map[string][]FilterRule `yaml:"workspaces"`
+	} `yaml:"filters"`
+	Admin struct {
+		Token    string `yaml:"token"`
+		TokenRef string `yaml:"-"`
+	} `yaml:"admin"`
+	Secrets struct {
+		RefreshInterval string `yaml:"refresh_interval"`
+	} `yaml:"secrets"`
+	Logging struct {
+		Level   string `yaml:"level"`
+		Format  string `yaml:"format"`
+		Console bool   `yaml:"console"`
+		File    struct {
+			Path       string `yaml:"path"`
+			MaxSizeMB  int    `yaml:"max_size_mb"`
+			MaxAgeDays int    `yaml:"max_age_days"`
+			MaxBackups int    `yaml:"max_backups"`
+			Daily      bool   `yaml:"daily"`
+		} `yaml:"file"`
+	} `yaml:"logging"`
+	Pprof struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+	} `yaml:"pprof"`
+	// 功能开关，键为 rag、streaming、tools、moderation、judge、shadow，设为 false 时关闭对应的功能，未配置的默认开启
+	Features map[string]bool `yaml:"features"`
+	// 只读模式：对话和写入返回 503，浏览知识库不受影响；也可以通过 POST /api/v1/admin/maintenance 切换
+	Maintenance struct {
+		ReadOnly bool `yaml:"read_only"`
+		// 返回给客户端的提示，为空时使用默认提示
+		Message string `yaml:"message"`
+	} `yaml:"maintenance"`
+	ErrorReporting struct {
+		Enabled     bool   `yaml:"enabled"`
+		DSN         string `yaml:"dsn"`
+		WebhookURL  string `yaml:"webhook_url"`
+		Environment string `yaml:"environment"`
+	} `yaml:"error_reporting"`
+	Storage struct {
+		DataDir          string `yaml:"data_dir"`
+		Lock             string `yaml:"lock"`
+		Compression      string `yaml:"compression"`
+		EncryptionKey    string `yaml:"encryption_key"`
+		EncryptionKeyRef string `yaml:"-"`
+		Driver           string `yaml:"driver"`
+		DSN              string `yaml:"dsn"`
+		DSNRef           string `yaml:"-"`
+		CompactThreshold int    `yaml:"compact_threshold"`
+		CompactInterval  string `yaml:"compact_interval"`
+		// 删除的知识库条目在回收站中保留的天数，默认 30，小于 0 时不自动清除
+		TrashDays int `yaml:"trash_days"`
+	} `yaml:"storage"`
+	Limits struct {
+		MaxBodyKB       int            `yaml:"max_body_kb"`
+		MaxMessageChars int            `yaml:"max_message_chars"`
+		MaxUploadMB     int            `yaml:"max_upload_mb"`
+		Endpoints       map[string]int `yaml:"endpoints"`
+	} `yaml:"limits"`
+	// 个人访问令牌：required 为 true 时调用收集和提问接口必须携带令牌，否则令牌只用于识别调用方
+	// allowed_origins 中的来源可以跨域调用令牌可以调用的接口，不需要开启 cors
+	AccessTokens struct {
+		Required       bool     `yaml:"required"`
+		AllowedOrigins []string `yaml:"allowed_origins"`
+	} `yaml:"access_tokens"`
+	CORS struct {
+		Enabled          bool     `yaml:"enabled"`
+		AllowedOrigins   []string `yaml:"allowed_origins"`
+		AllowedMethods   []string `yaml:"allowed_methods"`
+		AllowedHeaders   []string `yaml:"allowed_headers"`
+		ExposedHeaders   []string `yaml:"exposed_headers"`
+		AllowCredentials bool     `yaml:"allow_credentials"`
+		MaxAge           int      `yaml:"max_age"`
+	} `yaml:"cors"`
+	GRPC struct {
+		Enabled    bool   `yaml:"enabled"`
+		Listen     string `yaml:"listen"`
+		Reflection bool   `yaml:"reflection"`
+	} `yaml:"grpc"`
+	HTTPS struct {
+		Enabled  bool   `yaml:"enabled"`
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+		HTTPPort string `yaml:"http_port"`
+		ACME     struct {
+			Domains  []string `yaml:"domains"`
+			Email    string   `yaml:"email"`
+			CacheDir string   `yaml:"cache_dir"`
+		} `yaml:"acme"`
+	} `yaml:"https"`
+	Slack struct {
+		Enabled bool `yaml:"enabled"`
+		// events 通过 Events API 回调接收事件，socket 通过 Socket Mode 长连接接收
+		Mode             string `yaml:"mode"`
+		BotToken         string `yaml:"bot_token"`
+		BotTokenRef      string `yaml:"-"`
+		SigningSecret    string `yaml:"signing_secret"`
+		SigningSecretRef string `yaml:"-"`
+		AppToken         string `yaml:"app_token"`
+		AppTokenRef      string `yaml:"-"`
+		// 回答使用的模型，为空时使用 models.default
+		Model string `yaml:"model"`
+		// 添加后把回答保存到知识库的表情，默认 pushpin（📌）
+		SaveReaction string `yaml:"save_reaction"`
+	} `yaml:"slack"`
+	WeCom struct {
+		Enabled bool   `yaml:"enabled"`
+		CorpID  string `yaml:"corp_id"`
+		AgentID int    `yaml:"agent_id"`
+		// 应用的 Secret，用于获取 access_token 发送消息
+		Secret    string `yaml:"secret"`
+		SecretRef string `yaml:"-"`
+		// 回调配置中的 Token 和 EncodingAESKey
+		Token             string `yaml:"token"`
+		TokenRef          string `yaml:"-"`
+		EncodingAESKey    string `yaml:"encoding_aes_key"`
+		EncodingAESKeyRef string `yaml:"-"`
+		Model             string `yaml:"model"`
+		// 回答使用的过滤工作区
+		Workspace string `yaml:"workspace"`
+		// 成员发送该指令时保存上一次的回答，默认“保存”
+		SaveCommand string `yaml:"save_command"`
+	} `yaml:"wecom"`
+	DingTalk struct {
+		Enabled bool `yaml:"enabled"`
+		// outgoing 通过 HTTP 回调接收消息，stream 通过 Stream 模式长连接接收
+		Mode string `yaml:"mode"`
+		// 应用的 AppKey（Client ID），stream 模式需要
+		AppKey string `yaml:"app_key"`
+		// 应用的 AppSecret，用于校验回调签名和建立 Stream 连接
+		AppSecret    string `yaml:"app_secret"`
+		AppSecretRef string `yaml:"-"`
+		Model        string `yaml:"model"`
+		// 回答使用的过滤工作区
+		Workspace string `yaml:"workspace"`
+	} `yaml:"dingtalk"`
+	Email struct {
+		Enabled bool `yaml:"enabled"`
+		// 接收提问的邮箱地址，也是回复邮件的发件人
+		Address string `yaml:"address"`
+		// 检查收件箱的间隔，默认 1m
+		PollInterval string `yaml:"poll_interval"`
+		IMAP         struct {
+			// 服务器地址，使用 TLS 连接，例如 imap.example.com:993
+			Addr string `yaml:"addr"`
+			// 为空时使用 address
+			Username    string `yaml:"username"`
+			Password    string `yaml:"password"`
+			PasswordRef string `yaml:"-"`
+			Mailbox     string `yaml:"mailbox"`
+		} `yaml:"imap"`
+		SMTP struct {
+			// 服务器地址，例如 smtp.example.com:587，服务器支持时使用 STARTTLS
+			Addr string `yaml:"addr"`
+			// 为空时使用 IMAP 的用户名和密码，没有密码时不认证
+			Username    string `yaml:"username"`
+			Password    string `yaml:"password"`
+			PasswordRef string `yaml:"-"`
+		} `yaml:"smtp"`
+		// 允许提问的发件人，以 @ 开头的项表示整个域名，为空时不限制
+		AllowedSenders []string `yaml:"allowed_senders"`
+		Model          string   `yaml:"model"`
+		Workspace      string   `yaml:"workspace"`
+		// 以邮件主题为标题把回答保存到知识库
+		Archive bool `yaml:"archive"`
+	} `yaml:"email"`
+	Batch struct {
+		Concurrency   int `yaml:"concurrency"`
+		RatePerMinute int `yaml:"rate_per_minute"`
+		MaxItems      int `yaml:"max_items"`
+	} `yaml:"batch"`
+	Gateway struct {
+		Enabled bool `yaml:"enabled"`
+		// 转发前是否按知识库检索结果补充上下文
+		RAG bool `yaml:"rag"`
+		// 非流式响应的缓存时间，例如 10m，为空时不缓存
+		CacheTTL string `yaml:"cache_ttl"`
+		// 最多缓存的响应数，超出时淘汰最久没有使用的响应，默认 1000
+		CacheSize int `yaml:"cache_size"`
+		// 流式响应的心跳间隔，上游超过该时间没有返回内容时发送 SSE 注释，默认 15s，为 0 时不发送
+		Heartbeat string       `yaml:"heartbeat"`
+		Keys      []GatewayKey `yaml:"keys"`
+	} `yaml:"gateway"`
+	// 外部插件，在调用模型前后和添加知识库条目前调用
+	Plugins []PluginConfig `yaml:"plugins"`
+	// 事件总线：log 为 true 时把全部事件保存到数据目录的 events.jsonl
+	Events struct {
+		Log bool `yaml:"log"`
+	} `yaml:"events"`
+	// 事件通知的接收地址
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// 入站 Webhook 触发器，地址为 /api/v1/hooks/<name>
+	Hooks []HookConfig `yaml:"hooks"`
+	// 定时执行的提示词
+	Schedules []ScheduleConfig `yaml:"schedules"`
+	// 接口提示和错误信息的语言
+	I18n struct {
+		// zh-CN 或 en，请求没有通过 lang 参数或 Accept-Language 指定语言时使用
+		DefaultLocale string `yaml:"default_locale"`
+	} `yaml:"i18n"`
+	// 定期汇总问答和新增知识生成报告
+	Digest struct {
+		Enabled bool `yaml:"enabled"`
+		// daily 或 weekly
+		Period string `yaml:"period"`
+		// 为空时每天或每周一早上8点运行
+		Cron  string `yaml:"cron"`
+		Model string `yaml:"model"`
+		// 保存到知识库时的标签，默认 digest
+		Tags    []string `yaml:"tags"`
+		Webhook string   `yaml:"webhook"`
+		Email   []string `yaml:"email"`
+	} `yaml:"digest"`
+	// 当前生效的配置档，以及在同一文件中定义的各配置档
+	Profile  string               `yaml:"profile"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
 }
 
 // ChatRequest 聊天请求结构体
 type ChatRequest struct {
-	Message string `json:"message" binding:"required"`
-	Model   string `json:"model"`
+	Message   string `json:"message" binding:"required"`
+	Model     string `json:"model"`
+	Workspace string `json:"workspace"`
+	// 回答使用的语言，例如 en、zh-CN，auto 表示与问题的语言相同
+	Language string `json:"language,omitempty"`
+	// 提问的用户，用于查找 prompt.user_languages 中的语言设置
+	User string `json:"-"`
+	// 是否返回推理模型的思考过程，默认使用 models.show_reasoning
+	IncludeReasoning *bool `json:"include_reasoning,omitempty"`
+	// 重新生成等由服务端选择模型的请求预先填写的路由信息
+	Route *RouteDecision `json:"-"`
 }
 
 // ChatResponse 聊天响应结构体
 type ChatResponse struct {
-	Response string `json:"response"`
-	Model    string `json:"model"`
+	Response string      `json:"response"`
+	Model    string      `json:"model"`
+	RecordID int         `json:"record_id,omitempty"`
+	Usage    *TokenUsage `json:"usage,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	// 由智能路由选择模型时返回分类结果
+	Route *RouteDecision `json:"route,omitempty"`
+	// 推理模型的思考过程，只在请求或配置要求时返回
+	Reasoning string `json:"reasoning,omitempty"`
+	// 开启 judge 时评审模型的评分
+	Judge *JudgeScore `json:"judge,omitempty"`
+	// 耗时，用于区分慢在模型还是本服务
+	Timing *ChatTiming `json:"timing,omitempty"`
+}
+
+// ChatTiming 一次对话的耗时，单位为毫秒
+type ChatTiming struct {
+	TotalMs int64 `json:"total_ms"`
+	// 等待上游的时间：回答，以及智能路由、内容审核、评分和换用模型、重新生成
+	UpstreamMs int64 `json:"upstream_ms"`
+	// 本服务自身的处理时间（总耗时减去等待上游的时间），包括知识库检索和过滤规则
+	ServerMs int64 `json:"server_ms"`
+	// 流式回答时从开始处理到输出第一段内容的时间
+	FirstTokenMs int64 `json:"first_token_ms,omitempty"`
+}
+
+// newChatTiming 根据开始时间、等待上游的时间和输出第一段内容的时间计算耗时
+func newChatTiming(started time.Time, upstream time.Duration, firstToken time.Time) *ChatTiming {
+	total := time.Since(started)
+	timing := &ChatTiming{
+		TotalMs:    total.Milliseconds(),
+		UpstreamMs: upstream.Milliseconds(),
+		ServerMs:   max(total-upstream, 0).Milliseconds(),
+	}
+	if !firstToken.IsZero() {
+		timing.FirstTokenMs = firstToken.Sub(started).Milliseconds()
+	}
+	return timing
+}
+
+// serverTiming 把耗时转换为 Server-Timing 响应头，浏览器的开发者工具可以直接显示
+func serverTiming(t *ChatTiming) string {
+	return fmt.Sprintf("upstream;dur=%d, server;dur=%d, total;dur=%d", t.UpstreamMs, t.ServerMs, t.TotalMs)
+}
+
+// includeReasoning 判断是否返回思考过程，请求没有指定时使用 models.show_reasoning
+func includeReasoning(cfg *Config, requested *bool) bool {
+	if requested != nil {
+		return *requested
+	}
+	return cfg.Models.ShowReasoning
 }
 
 // QARecord 问答记录结构体
 type QARecord struct {
-	ID        int       `json:"id"`
-	Question  string    `json:"question"`
-	Answer    string    `json:"answer"`
-	Model     string    `json:"model"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        int         `json:"id"`
+	Question  string      `json:"question"`
+	Answer    string      `json:"answer"`
+	Model     string      `json:"model"`
+	Timestamp time.Time   `json:"timestamp"`
+	Usage     *TokenUsage `json:"usage,omitempty"`
+	Flagged   bool        `json:"flagged,omitempty"`
+	Flags     []string    `json:"flags,omitempty"`
+	// 由智能路由选择模型时的分类结果
+	Route *RouteDecision `json:"route,omitempty"`
+	// 开启 judge 时评审模型的评分
+	Judge *JudgeScore `json:"judge,omitempty"`
+	// 耗时
+	Timing *ChatTiming `json:"timing,omitempty"`
 }
 
 // KnowledgeItem 知识库条目结构体
@@ -61,146 +564,544 @@ type KnowledgeItem struct {
 	Model     string    `json:"model"`
 	Timestamp time.Time `json:"timestamp"`
 	Tags      []string  `json:"tags"`
+	// 译文对应的原始条目ID和译文的语言
+	SourceID int    `json:"source_id,omitempty"`
+	Language string `json:"language,omitempty"`
+	// 指向其它条目的关联，检索到该条目时一并提供关联的条目
+	Links []KnowledgeLink `json:"links,omitempty"`
+	// 移到回收站的时间，为空表示条目在知识库中
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// 最近一次由模型复核的结果
+	Verification *KnowledgeVerification `json:"verification,omitempty"`
+	// 模型的质量评分，评分过低的条目为草稿，需要编辑或人工确认后才参与检索
+	Quality *KnowledgeQuality `json:"quality,omitempty"`
+	Draft   bool              `json:"draft,omitempty"`
 }
 
 // AddToKnowledgeRequest 添加到知识库请求
 type AddToKnowledgeRequest struct {
-	RecordID int    `json:"record_id" binding:"required"`
-	Title    string `json:"title" binding:"required"`
-	Tags     string `json:"tags"`
+	RecordID int `json:"record_id" binding:"required"`
+	// 为空时根据问答内容自动生成标题
+	Title string `json:"title"`
+	Tags  string `json:"tags"`
+	// 为 true 时把自动提取的关键词追加为标签
+	SuggestTags bool `json:"suggest_tags"`
 }
 
-var config Config
+// 当前生效的配置，热加载时整体替换
+var activeConfig atomic.Pointer[Config]
 var recentQAs []QARecord
 var knowledgeBase []KnowledgeItem
 var nextQAID = 1
 var nextKnowledgeID = 1
 
-// 数据文件路径
+// 配置文件路径，可以通过命令行参数修改
+var configFile = "config.yaml"
+
+// 数据目录，启动时由 resolveDataDir 确定
+var dataDir = legacyDataDir
+
+// 数据文件名，位于数据目录下
 const (
-	knowledgeDataFile = "data/knowledge.json"
-	qaDataFile        = "data/recent_qas.json"
+	knowledgeDataFile = "knowledge.json"
+	qaDataFile        = "recent_qas.json"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	// 解析命令行参数
+	parseFlags()
+
+	// 仅检查配置时不启动服务
+	if checkConfigOnly {
+		checkConfig()
+		return
+	}
+
 	// 加载配置文件
 	loadConfig()
 
+	// 初始化日志
+	setupLogging()
+
+	// 确定数据目录
+	dataDir = resolveDataDir(currentConfig())
+	slog.Info("数据目录", "path", dataDir)
+
 	// 加载持久化数据
 	loadPersistentData()
+	loadFinetuneJobs()
+	loadGoldenDataset()
+	loadTopicReport()
+	loadMaintenanceState()
+	loadAnnouncement()
+	loadStaleReport()
+	loadAccessTokens()
 
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建Gin路由
-	r := gin.Default()
+	r := gin.New()
+	if err := setupTrustedProxies(r, currentConfig()); err != nil {
+		fatal("配置受信任代理失败", "error", err)
+	}
+	r.Use(requestIDMiddleware(), localeMiddleware(), requestLogMiddleware(), recoveryMiddleware(), corsMiddleware(), compressMiddleware(), bodyLimitMiddleware(), maintenanceMiddleware())
 
-	// 静态文件服务
-	r.Static("/static", "./static")
+	// 静态文件服务，页面和静态文件已编译进程序，可通过 server.assets_dir 替换
+	setupAssets(currentConfig())
+	r.StaticFS("/static", staticFS())
 
 	// 主页路由
-	r.GET("/", func(c *gin.Context) {
-		c.Header("Content-Type", "text/html; charset=utf-8")
-		c.File("./templates/index.html")
-	})
+	r.GET("/", servePage("index.html"))
 
 	// index.html 路由
-	r.GET("/index.html", func(c *gin.Context) {
-		c.Header("Content-Type", "text/html; charset=utf-8")
-		c.File("./templates/index.html")
-	})
+	r.GET("/index.html", servePage("index.html"))
+
+	// API路由，/api/v1 为稳定版本，/api 为兼容旧客户端的别名，响应中带有弃用提示
+	adminV1 := registerAPIRoutes(r.Group(apiV1Prefix))
+	adminLegacy := registerAPIRoutes(r.Group(apiLegacyPrefix, deprecatedAPIMiddleware()))
+	setupPprof(adminV1, adminLegacy)
 
-	// API路由
-	api := r.Group("/api")
-	{
-		api.POST("/chat", chatHandler)
-		api.GET("/models", modelsHandler)
-		api.GET("/recent", recentQAsHandler)
-		api.POST("/knowledge/add", addToKnowledgeHandler)
-		api.GET("/knowledge", knowledgeHandler)
-		api.DELETE("/knowledge/:id", deleteKnowledgeHandler)
+	// OpenAPI 文档和 Swagger UI
+	r.GET("/api/openapi.json", openAPIHandler)
+	if currentConfig().Server.SwaggerUI {
+		r.GET("/api/docs", swaggerUIHandler)
 	}
 
+	// OpenAI 兼容接口
+	setupGateway(r)
+
+	// Slack 机器人
+	setupSlack(r, currentConfig())
+
+	// 企业微信应用
+	setupWeCom(r, currentConfig())
+
+	// 钉钉机器人
+	setupDingTalk(r, currentConfig())
+
 	// 知识库页面路由
-	r.GET("/knowledge", func(c *gin.Context) {
-		c.Header("Content-Type", "text/html; charset=utf-8")
-		c.File("./templates/knowledge.html")
-	})
+	r.GET("/knowledge", servePage("knowledge.html"))
 
 	// 启动服务器
-	address := config.Server.Host + config.Server.Port
-	fmt.Printf("服务器启动在: http://%s\n", address)
-	log.Fatal(r.Run(address))
+	cfg := currentConfig()
+	if cfg.Server.WatchConfig {
+		go watchConfigFile()
+	}
+	if interval, err := time.ParseDuration(cfg.Secrets.RefreshInterval); err == nil && interval > 0 {
+		go refreshSecrets(interval)
+	}
+	go compactPeriodically(compactInterval(cfg))
+	go discoverModelsPeriodically()
+	go probeModelsPeriodically()
+	go pollFinetuneJobsPeriodically()
+	go analyzeTopicsPeriodically()
+	go purgeTrashPeriodically()
+	go checkLinksPeriodically()
+	go verifyKnowledgePeriodically()
+	go scoreKnowledgeWorker()
+	startGRPCServer(cfg)
+	startEmailGateway(cfg)
+	startScheduler(cfg)
+
+	if err := runServer(r, cfg); err != nil {
+		fatal("服务器退出", "error", err)
+	}
+}
+
+// currentConfig 返回当前生效的配置
+func currentConfig() *Config {
+	return activeConfig.Load()
 }
 
 // loadConfig 加载配置文件
 func loadConfig() {
-	data, err := ioutil.ReadFile("config.yaml")
+	cfg, err := readConfigFile(configFile)
 	if err != nil {
-		log.Fatalf("读取配置文件失败: %v", err)
+		fatal("加载配置文件失败", "error", err)
 	}
+	activeConfig.Store(cfg)
+}
 
-	err = yaml.Unmarshal(data, &config)
+// readConfigFile 读取并解析配置文件，展开 ${VAR} 引用并应用环境变量覆盖
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("解析配置文件失败: %v", err)
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(expandEnvRefs(data), &cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if err := applyProfile(&cfg, path); err != nil {
+		return nil, err
+	}
+	applyEnvOverrides(&cfg)
+	applyFlagOverrides(&cfg)
+
+	if err := resolveConfigSecrets(&cfg); err != nil {
+		return nil, err
 	}
+
+	if err := validateConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("配置校验失败:\n%w", err)
+	}
+	return &cfg, nil
 }
 
 // chatHandler 处理聊天请求
 func chatHandler(c *gin.Context) {
 	var req ChatRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) || !checkMessageLength(c, req.Message) {
 		return
 	}
 
-	// 如果没有指定模型，使用默认模型
-	if req.Model == "" {
-		req.Model = config.Models.Default
+	// 如果没有指定模型，使用默认模型；别名换成实际的模型；开启智能路由时在处理过程中选择模型
+	if !routeRequested(currentConfig(), req.Model) {
+		req.Model = resolveModel(currentConfig(), req.Model)
+		c.Set("model", req.Model)
 	}
 
-	// 调用OpenAI API
-	response, err := callWithOfficialSDK(req.Message, req.Model)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 工作区和回答语言也可以通过请求头指定
+	if req.Workspace == "" {
+		req.Workspace = c.GetHeader("X-Workspace")
+	}
+	if req.Language == "" {
+		req.Language = c.GetHeader("X-Answer-Language")
+	}
+	if req.Language != "" && !isValidAnswerLanguage(req.Language) {
+		respondError(c, http.StatusBadRequest, tr(c, "error.language_invalid", req.Language))
 		return
 	}
+	req.User = requestUser(c)
+
+	// 生成过程中可以通过 POST /api/v1/chat/<请求ID>/cancel 取消，客户端断开时同样中断上游请求
+	ctx, done := startChatJob(c, req.Model)
+	defer done()
+	resp, record, chatErr := processChat(ctx, req, c.ClientIP())
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			requestLogger(c).Error("调用模型失败", "error", chatErr.Err)
+			reportError(c, "upstream", chatErr.Err, "", map[string]interface{}{"model": req.Model})
+		}
+		if chatErr.Audit {
+			recordAudit(c, auditActionChat, req.Model, chatErr.Message, chatErr.Status)
+		}
+		respondError(c, chatErr.Status, chatErr.localize(requestLocale(c)))
+		return
+	}
+
+	c.Set("model", resp.Model)
+	recordAudit(c, auditActionChat, resp.Model, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+	if resp.Timing != nil {
+		c.Header("Server-Timing", serverTiming(resp.Timing))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// chatError 对话处理失败，Status 为对应的HTTP状态码
+type chatError struct {
+	Status int
+	// 使用默认语言的错误信息
+	Message string
+	// 消息ID和参数，接口按请求的语言重新生成错误信息
+	Key  string
+	Args []interface{}
+	// 需要记录审计日志
+	Audit bool
+	// 上游调用失败时的原始错误，需要上报
+	Err error
+}
+
+// newChatError 按消息ID生成对话错误
+func newChatError(status int, key string, args ...interface{}) *chatError {
+	return &chatError{Status: status, Message: translate(defaultLocale(currentConfig()), key, args...), Key: key, Args: args}
+}
+
+// newCancelledChatError 生成被取消或客户端断开时的错误，需要记录审计日志但不上报
+func newCancelledChatError() *chatError {
+	chatErr := newChatError(statusClientClosedRequest, "error.generation_cancelled")
+	chatErr.Audit = true
+	return chatErr
+}
+
+// localize 返回指定语言的错误信息，上游调用失败时为原始错误
+func (e *chatError) localize(locale string) string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return translate(locale, e.Key, e.Args...)
+}
+
+// processChat 执行一次对话：屏蔽敏感信息、内容审核、调用模型、过滤回复并记录问答，HTTP 和 gRPC 接口共用
+func processChat(ctx context.Context, req ChatRequest, clientIP string) (*ChatResponse, QARecord, *chatError) {
+	return processChatStream(ctx, req, clientIP, nil)
+}
+
+// processChatStream 与 processChat 相同，onDelta 不为空时以流式调用模型，并在收到每段内容时回调
+// 回调收到的是未经过滤的原始内容，最终结果以返回的 ChatResponse 为准
+func processChatStream(ctx context.Context, req ChatRequest, clientIP string, onDelta func(string)) (*ChatResponse, QARecord, *chatError) {
+	cfg := currentConfig()
+	if readOnly(cfg) {
+		return nil, QARecord{}, readOnlyChatError(cfg)
+	}
+	started := time.Now()
+	route := routeRequested(cfg, req.Model)
+	// 关闭 streaming 时改为非流式调用，回答结束后一次返回
+	if !featureEnabled(cfg, featureStreaming) {
+		onDelta = nil
+	}
+	req.Model = resolveModel(cfg, req.Model)
+
+	// 发送到上游和外部插件前屏蔽敏感信息，映射关系只保存在本地
+	upstreamMessage := req.Message
+	var piiMapping PIIMapping
+	if cfg.PII.Enabled {
+		upstreamMessage, piiMapping = redactPII(req.Message)
+	}
+
+	// 外部插件可以改写问题和模型，或者拒绝请求；插件只收到屏蔽后的问题
+	pluginReq := req
+	pluginReq.Message = upstreamMessage
+	if err := runPreChatPlugins(ctx, cfg, &pluginReq); err != nil {
+		return nil, QARecord{}, pluginChatError(err)
+	}
+	req.Model = pluginReq.Model
+	if pluginReq.Message != upstreamMessage {
+		upstreamMessage = pluginReq.Message
+		req.Message = piiMapping.restore(upstreamMessage)
+	}
 
-	// 记录问答到最近记录
-	record := QARecord{
-		ID:        nextQAID,
+	// 智能路由按问题的类别选择模型
+	decision := req.Route
+	var upstream time.Duration
+	if route {
+		start := time.Now()
+		req.Model, decision = routeMessage(ctx, cfg, upstreamMessage)
+		upstream += time.Since(start)
+	}
+
+	// 调用模型前进行内容审核
+	var flags []string
+	if cfg.Moderation.Enabled && featureEnabled(cfg, featureModeration) {
+		start := time.Now()
+		moderation, err := moderateMessage(ctx, upstreamMessage)
+		upstream += time.Since(start)
+		if err != nil {
+			if generationCancelled(ctx) {
+				return nil, QARecord{}, newCancelledChatError()
+			}
+			chatErr := newChatError(http.StatusBadGateway, "error.moderation_failed", err)
+			recordChatFailure(ctx, req, upstreamMessage, chatErr, false)
+			return nil, QARecord{}, chatErr
+		}
+
+		if moderation.Flagged {
+			action := moderationAction()
+			appendModerationLog(ModerationLogEntry{
+				Timestamp:  time.Now(),
+				Action:     action,
+				Provider:   cfg.Moderation.Provider,
+				Model:      req.Model,
+				Message:    upstreamMessage,
+				Categories: moderation.Categories,
+				ClientIP:   clientIP,
+			})
+
+			switch action {
+			case moderationActionBlock:
+				chatErr := newChatError(http.StatusForbidden, "error.moderation_blocked")
+				chatErr.Audit = true
+				return nil, QARecord{}, chatErr
+			case moderationActionFlag:
+				flags = append(flags, moderation.Categories...)
+				if len(flags) == 0 {
+					flags = append(flags, "moderation")
+				}
+			}
+		}
+	}
+
+	// 调用OpenAI API，成本优先的路由在回答失败或被过滤规则拒绝时换用更强的模型重试
+	var attempt *chatAttempt
+	for {
+		var chatErr *chatError
+		attempt, chatErr = answerChat(ctx, cfg, req, upstreamMessage, piiMapping, onDelta)
+		upstream += attempt.Upstream
+		if chatErr == nil {
+			break
+		}
+		next, ok := escalationTarget(cfg, decision, req.Model)
+		if !ok || attempt.Streamed || generationCancelled(ctx) {
+			recordChatFailure(ctx, req, upstreamMessage, chatErr, false)
+			return nil, QARecord{}, chatErr
+		}
+		recordChatFailure(ctx, req, upstreamMessage, chatErr, true)
+		slog.Warn("回答未通过检查，换用更强的模型重试", "model", req.Model, "next", next, "error", chatErr.Message)
+		if attempt.Usage != nil {
+			recordUsage(req.Model, attempt.Usage)
+		}
+		decision.EscalatedFrom = append(decision.EscalatedFrom, req.Model)
+		req.Model = next
+	}
+
+	// 评审模型为回答打分，分数过低时标记或重新生成
+	var judgement *JudgeScore
+	if cfg.Judge.Enabled && featureEnabled(cfg, featureJudge) {
+		start := time.Now()
+		attempt, judgement = judgeAnswer(ctx, cfg, req, upstreamMessage, piiMapping, attempt)
+		upstream += time.Since(start)
+	}
+	answer, filtered, usage := attempt.Answer, attempt.Filtered, attempt.Usage
+	reasoning := ""
+	if includeReasoning(cfg, req.IncludeReasoning) {
+		reasoning = attempt.Reasoning
+	}
+	flags = append(flags, attempt.Flags...)
+
+	// 累计token用量
+	recordUsage(req.Model, usage)
+
+	// 外部插件可以改写回答，或者拒绝返回回答；插件同样只收到屏蔽后的内容
+	pluginReq = req
+	pluginReq.Message = upstreamMessage
+	redactedAnswer := piiMapping.redact(answer)
+	pluginAnswer := redactedAnswer
+	if err := runPostChatPlugins(ctx, pluginReq, &pluginAnswer); err != nil {
+		return nil, QARecord{}, pluginChatError(err)
+	}
+	if pluginAnswer != redactedAnswer {
+		// 插件改写的回答同样要经过过滤规则
+		result := applyResponseFilters(piiMapping.restore(pluginAnswer), req.Workspace)
+		if result.Rejected {
+			chatErr := newChatError(http.StatusForbidden, "error.response_rejected")
+			recordChatFailure(ctx, req, upstreamMessage, chatErr, false)
+			return nil, QARecord{}, chatErr
+		}
+		answer = result.Text
+		filtered.Warnings = append(filtered.Warnings, result.Warnings...)
+		flags = append(flags, result.Warnings...)
+	}
+
+	timing := newChatTiming(started, upstream, attempt.FirstToken)
+
+	// 记录问答到最近记录，保持最多5条
+	record := addQARecord(QARecord{
 		Question:  req.Message,
-		Answer:    response,
+		Answer:    answer,
 		Model:     req.Model,
 		Timestamp: time.Now(),
-	}
+		Usage:     usage,
+		Flagged:   len(flags) > 0,
+		Flags:     flags,
+		Route:     decision,
+		Judge:     judgement,
+		Timing:    timing,
+	})
+	publishEvent(eventChatCompleted, record)
+	startShadow(cfg, req, upstreamMessage, piiMapping, record, time.Duration(timing.TotalMs)*time.Millisecond)
+
+	return &ChatResponse{
+		Response:  answer,
+		Model:     req.Model,
+		RecordID:  record.ID,
+		Usage:     usage,
+		Warnings:  filtered.Warnings,
+		Route:     decision,
+		Reasoning: reasoning,
+		Judge:     judgement,
+		Timing:    timing,
+	}, record, nil
+}
+
+// chatAttempt 用一个模型回答的结果
+type chatAttempt struct {
+	Answer string
+	// 推理模型的思考过程，不经过过滤规则，也不保存到问答记录
+	Reasoning string
+	Filtered  FilterResult
+	Flags     []string
+	// 回复被过滤规则拒绝时同样有用量
+	Usage *TokenUsage
+	// 已经通过 onDelta 输出了内容，此时不能再换模型重试
+	Streamed bool
+	// 等待上游模型的时间和输出第一段内容的时间
+	Upstream   time.Duration
+	FirstToken time.Time
+}
 
-	// 添加到最近记录，保持最多5条
-	recentQAs = append([]QARecord{record}, recentQAs...)
-	if len(recentQAs) > 5 {
-		recentQAs = recentQAs[:5]
+// answerChat 构造消息并调用 req.Model，检查上下文长度、注入指令和过滤规则
+func answerChat(ctx context.Context, cfg *Config, req ChatRequest, message string, piiMapping PIIMapping, onDelta func(string)) (*chatAttempt, *chatError) {
+	attempt := &chatAttempt{}
+	messages := buildChatMessages(ctx, req.Model, message, answerLanguage(cfg, req.Language, req.User))
+	if limit := promptTokenLimit(cfg, req.Model, 0); limit > 0 {
+		if tokens, err := countChatTokens(cfg, req.Model, messages); err == nil && tokens > limit {
+			return attempt, newChatError(http.StatusRequestEntityTooLarge, "error.context_exceeded", tokens, limit)
+		}
+	}
+	var result *ChatResult
+	var err error
+	start := time.Now()
+	if onDelta != nil {
+		result, err = streamChat(ctx, req.Model, messages, func(delta string) {
+			if !attempt.Streamed {
+				attempt.Streamed, attempt.FirstToken = true, time.Now()
+			}
+			onDelta(delta)
+		})
+	} else {
+		result, err = completeChat(ctx, req.Model, messages)
 	}
-	nextQAID++
+	attempt.Upstream = time.Since(start)
+	if err != nil {
+		if generationCancelled(ctx) {
+			return attempt, newCancelledChatError()
+		}
+		return attempt, &chatError{Status: http.StatusInternalServerError, Message: err.Error(), Err: err}
+	}
+	attempt.Usage = newTokenUsage(result.Usage)
+	answer := piiMapping.restore(result.Content)
 
-	// 保存问答数据到文件
-	saveRecentQAs()
+	// 检查回复是否执行了外部内容中注入的指令
+	attempt.Flags = detectInjectionFollowed(answer)
 
-	c.JSON(http.StatusOK, ChatResponse{
-		Response: response,
-		Model:    req.Model,
-	})
+	// 对模型输出执行内容过滤
+	attempt.Filtered = applyResponseFilters(answer, req.Workspace)
+	if attempt.Filtered.Rejected {
+		return attempt, newChatError(http.StatusForbidden, "error.response_rejected")
+	}
+	attempt.Answer = attempt.Filtered.Text
+	attempt.Reasoning = piiMapping.restore(result.Reasoning)
+	attempt.Flags = append(attempt.Flags, attempt.Filtered.Warnings...)
+	return attempt, nil
 }
 
-// modelsHandler 返回可用模型列表
-func modelsHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"default":   config.Models.Default,
-		"available": config.Models.Available,
-	})
+// findQARecord 按ID查找最近的问答记录
+func findQARecord(id int) (QARecord, bool) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, record := range recentQAs {
+		if record.ID == id {
+			return record, true
+		}
+	}
+	return QARecord{}, false
 }
 
 // recentQAsHandler 返回最近5次问答记录
 func recentQAsHandler(c *gin.Context) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
 	c.JSON(http.StatusOK, gin.H{
 		"recent_qas": recentQAs,
 	})
@@ -209,22 +1110,23 @@ func recentQAsHandler(c *gin.Context) {
 // addToKnowledgeHandler 将问答记录添加到知识库
 func addToKnowledgeHandler(c *gin.Context) {
 	var req AddToKnowledgeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// 查找对应的问答记录
 	var sourceRecord *QARecord
+	dataMu.RLock()
 	for _, record := range recentQAs {
 		if record.ID == req.RecordID {
 			sourceRecord = &record
 			break
 		}
 	}
+	dataMu.RUnlock()
 
 	if sourceRecord == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "未找到对应的问答记录"})
+		respondError(c, http.StatusNotFound, tr(c, "error.qa_not_found"))
 		return
 	}
 
@@ -237,36 +1139,65 @@ func addToKnowledgeHandler(c *gin.Context) {
 		}
 	}
 
+	title := strings.TrimSpace(req.Title)
+	if title == "" || req.SuggestTags {
+		title, tags = suggestKnowledgeMeta(c, *sourceRecord, title, tags, req.SuggestTags)
+	}
+
 	// 创建知识库条目
-	knowledgeItem := KnowledgeItem{
-		ID:        nextKnowledgeID,
-		Title:     req.Title,
+	knowledgeItem, err := addKnowledgeItem(KnowledgeItem{
+		Title:     title,
 		Content:   sourceRecord.Answer,
 		Model:     sourceRecord.Model,
 		Timestamp: time.Now(),
 		Tags:      tags,
+	})
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgeAdd, err)
+		return
 	}
 
-	knowledgeBase = append(knowledgeBase, knowledgeItem)
-	nextKnowledgeID++
-
-	// 保存知识库数据到文件
-	saveKnowledgeBase()
+	recordAudit(c, auditActionKnowledgeAdd, fmt.Sprintf("knowledge/%d", knowledgeItem.ID), knowledgeItem.Title, http.StatusOK)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "已成功添加到知识库",
+		"message": tr(c, "message.knowledge_added"),
 		"item":    knowledgeItem,
 	})
 }
 
 // knowledgeHandler 返回知识库内容
 func knowledgeHandler(c *gin.Context) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
 	c.JSON(http.StatusOK, gin.H{
 		"knowledge_base": knowledgeBase,
 	})
 }
 
-// deleteKnowledgeHandler 删除知识库条目
+// knowledgeWriteError 把添加或删除条目失败的原因转换为对话错误：条目不存在返回 404，只读模式返回 503，插件拒绝返回 403
+func knowledgeWriteError(err error) *chatError {
+	switch {
+	case errors.Is(err, errKnowledgeNotFound):
+		return newChatError(http.StatusNotFound, "error.knowledge_not_found")
+	case errors.Is(err, errReadOnly):
+		return readOnlyChatError(currentConfig())
+	}
+	return pluginChatError(err)
+}
+
+// respondKnowledgeWriteError 返回添加或删除条目失败的错误，条目存在时记录审计日志
+func respondKnowledgeWriteError(c *gin.Context, action string, err error) {
+	chatErr := knowledgeWriteError(err)
+	if chatErr.Status != http.StatusNotFound {
+		recordAudit(c, action, "knowledge", chatErr.Message, chatErr.Status)
+	}
+	if chatErr.Status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", maintenanceRetryAfter)
+	}
+	respondError(c, chatErr.Status, chatErr.localize(requestLocale(c)))
+}
+
+// deleteKnowledgeHandler 把知识库条目移到回收站，可以通过 POST /api/v1/knowledge/<ID>/restore 恢复
 func deleteKnowledgeHandler(c *gin.Context) {
 	id := c.Param("id")
 
@@ -274,58 +1205,135 @@ func deleteKnowledgeHandler(c *gin.Context) {
 	var targetID int
 	fmt.Sscanf(id, "%d", &targetID)
 
-	// 查找并删除
-	for i, item := range knowledgeBase {
-		if item.ID == targetID {
-			knowledgeBase = append(knowledgeBase[:i], knowledgeBase[i+1:]...)
-
-			// 保存知识库数据到文件
-			saveKnowledgeBase()
-
-			c.JSON(http.StatusOK, gin.H{"message": "已删除知识库条目"})
-			return
-		}
+	// 查找并移到回收站
+	item, err := trashKnowledgeItem(targetID)
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgeDelete, err)
+		return
 	}
+	target := fmt.Sprintf("knowledge/%d", item.ID)
+	recordAudit(c, auditActionKnowledgeDelete, target, item.Title, http.StatusOK)
+
+	// 撤销即从回收站恢复
+	respondWithUndo(c, gin.H{"message": tr(c, "message.knowledge_deleted")}, undoKindKnowledgeDelete, target, func() error {
+		_, err := restoreKnowledgeItem(item.ID)
+		return err
+	})
+}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "未找到对应的知识库条目"})
+// ChatResult 上游模型调用结果
+type ChatResult struct {
+	Content string
+	// 推理模型返回的 reasoning_content，与最终回答分开
+	Reasoning string
+	Usage     openai.Usage
 }
 
-func callWithOfficialSDK(content, model string) (string, error) {
-	openaiConfig := openai.DefaultConfig(config.API.APIKey)
-	openaiConfig.BaseURL = config.API.BaseURL
+// newOpenAIClient 根据配置创建上游客户端
+func newOpenAIClient() *openai.Client {
+	cfg := currentConfig()
+	openaiConfig := openai.DefaultConfig(cfg.API.APIKey)
+	openaiConfig.BaseURL = upstreamBaseURL(cfg)
+	openaiConfig.HTTPClient = &promptCacheDoer{next: upstreamDoer}
 
-	client := openai.NewClientWithConfig(openaiConfig)
+	return openai.NewClientWithConfig(openaiConfig)
+}
+
+// completeChat 发送一次非流式对话请求
+func completeChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage) (*ChatResult, error) {
+	client := newOpenAIClient()
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a helpful assistant.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: content,
-				},
-			},
-		},
-	)
+	req := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	applyModelDefaults(currentConfig(), &req)
+	resp, err := client.CreateChatCompletion(ctx, req)
 
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("上游未返回任何结果")
 	}
 
 	// 返回AI响应内容
-	return resp.Choices[0].Message.Content, nil
+	return &ChatResult{
+		Content:   resp.Choices[0].Message.Content,
+		Reasoning: resp.Choices[0].Message.ReasoningContent,
+		Usage:     resp.Usage,
+	}, nil
+}
+
+// streamChat 发送一次流式对话请求，每收到一段内容调用一次 onDelta，返回完整内容、思考过程和用量
+// 思考过程不通过 onDelta 输出
+func streamChat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, onDelta func(string)) (*ChatResult, error) {
+	req := openai.ChatCompletionRequest{
+		Model:         model,
+		Messages:      messages,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+	applyModelDefaults(currentConfig(), &req)
+	stream, err := newOpenAIClient().CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var result ChatResult
+	var content, reasoning strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) > 0 {
+			reasoning.WriteString(chunk.Choices[0].Delta.ReasoningContent)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if content.Len() == 0 {
+		return nil, fmt.Errorf("上游未返回任何结果")
+	}
+
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+	return &result, nil
 }
 
 // loadPersistentData 加载持久化数据
 func loadPersistentData() {
-	// 确保data目录存在
-	if err := os.MkdirAll("data", 0755); err != nil {
-		log.Printf("创建data目录失败: %v", err)
+	// 确保数据目录存在
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		slog.Error("创建数据目录失败", "path", dataDir, "error", err)
+	}
+	if err := lockDataDir(currentConfig()); err != nil {
+		fatal("无法使用数据目录", "error", err)
+	}
+	if err := setupDataEncryption(currentConfig()); err != nil {
+		fatal("启用数据加密失败", "error", err)
+	}
+
+	// 使用数据库后端时直接从数据库加载
+	if cfg := currentConfig(); usesDatabase(cfg) {
+		s, err := openStore(cfg)
+		if err != nil {
+			fatal("打开数据库失败", "driver", cfg.Storage.Driver, "error", err)
+		}
+		store = s
+		if err := loadFromStore(); err != nil {
+			fatal("从数据库加载数据失败", "error", err)
+		}
+		return
 	}
 
 	// 加载知识库数据
@@ -333,36 +1341,34 @@ func loadPersistentData() {
 
 	// 加载最近问答数据
 	loadRecentQAs()
+
+	// 重放上次退出前尚未压缩的变更
+	if n := replayJournal(); n > 0 {
+		slog.Info("已重放变更日志", "count", n)
+		if err := compactData(); err != nil {
+			slog.Error("压缩变更日志失败", "error", err)
+		}
+	}
 }
 
 // loadKnowledgeBase 加载知识库数据
 func loadKnowledgeBase() {
-	if _, err := os.Stat(knowledgeDataFile); os.IsNotExist(err) {
-		// 文件不存在，使用空数据
-		knowledgeBase = []KnowledgeItem{}
-		return
-	}
-
-	data, err := ioutil.ReadFile(knowledgeDataFile)
-	if err != nil {
-		log.Printf("读取知识库数据失败: %v", err)
-		knowledgeBase = []KnowledgeItem{}
-		return
-	}
-
 	var items []KnowledgeItem
-	if err := json.Unmarshal(data, &items); err != nil {
-		log.Printf("解析知识库数据失败: %v", err)
+	if err := loadDataFile(knowledgeDataFile, &items); err != nil {
+		if !isNotExist(err) {
+			slog.Error("加载知识库数据失败", "error", err)
+		}
+		// 文件不存在或无法恢复，使用空数据
 		knowledgeBase = []KnowledgeItem{}
 		return
 	}
 
-	knowledgeBase = items
+	knowledgeBase, knowledgeTrash = splitKnowledgeTrash(items)
 
-	// 更新下一个ID
-	if len(knowledgeBase) > 0 {
+	// 更新下一个ID，回收站中条目的ID同样不再分配
+	if len(items) > 0 {
 		maxID := 0
-		for _, item := range knowledgeBase {
+		for _, item := range items {
 			if item.ID > maxID {
 				maxID = item.ID
 			}
@@ -370,27 +1376,17 @@ func loadKnowledgeBase() {
 		nextKnowledgeID = maxID + 1
 	}
 
-	log.Printf("已加载 %d 条知识库记录", len(knowledgeBase))
+	slog.Info("已加载知识库记录", "count", len(knowledgeBase), "trash", len(knowledgeTrash))
 }
 
 // loadRecentQAs 加载最近问答数据
 func loadRecentQAs() {
-	if _, err := os.Stat(qaDataFile); os.IsNotExist(err) {
-		// 文件不存在，使用空数据
-		recentQAs = []QARecord{}
-		return
-	}
-
-	data, err := ioutil.ReadFile(qaDataFile)
-	if err != nil {
-		log.Printf("读取问答数据失败: %v", err)
-		recentQAs = []QARecord{}
-		return
-	}
-
 	var qas []QARecord
-	if err := json.Unmarshal(data, &qas); err != nil {
-		log.Printf("解析问答数据失败: %v", err)
+	if err := loadDataFile(qaDataFile, &qas); err != nil {
+		if !isNotExist(err) {
+			slog.Error("加载问答数据失败", "error", err)
+		}
+		// 文件不存在或无法恢复，使用空数据
 		recentQAs = []QARecord{}
 		return
 	}
@@ -408,31 +1404,5 @@ func loadRecentQAs() {
 		nextQAID = maxID + 1
 	}
 
-	log.Printf("已加载 %d 条问答记录", len(recentQAs))
-}
-
-// saveKnowledgeBase 保存知识库数据
-func saveKnowledgeBase() {
-	data, err := json.MarshalIndent(knowledgeBase, "", "  ")
-	if err != nil {
-		log.Printf("序列化知识库数据失败: %v", err)
-		return
-	}
-
-	if err := ioutil.WriteFile(knowledgeDataFile, data, 0644); err != nil {
-		log.Printf("保存知识库数据失败: %v", err)
-	}
-}
-
-// saveRecentQAs 保存最近问答数据
-func saveRecentQAs() {
-	data, err := json.MarshalIndent(recentQAs, "", "  ")
-	if err != nil {
-		log.Printf("序列化问答数据失败: %v", err)
-		return
-	}
-
-	if err := ioutil.WriteFile(qaDataFile, data, 0644); err != nil {
-		log.Printf("保存问答数据失败: %v", err)
-	}
+	slog.Info("已加载问答记录", "count", len(recentQAs))
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的发布公告操作
+const auditActionAdminAnnouncement = "admin.announcement"
+
+// 公告保存在数据目录中的文件
+const announcementFile = "announcement.json"
+
+// 公告级别，客户端按级别选择显示样式
+const (
+	announcementLevelInfo     = "info"
+	announcementLevelWarning  = "warning"
+	announcementLevelCritical = "critical"
+)
+
+// Announcement 管理员发布的公告，例如“本周因费用原因停用 GPT-4o”，由客户端和内置页面显示
+type Announcement struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+	// 开始和结束显示的时间，为空时不限制
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	// 发布的时间和管理员
+	UpdatedAt time.Time `json:"updated_at"`
+	User      string    `json:"user,omitempty"`
+}
+
+// AnnouncementRequest 发布公告的请求，message 为空时撤下公告
+type AnnouncementRequest struct {
+	Message string `json:"message"`
+	// info（默认）、warning 或 critical
+	Level    string     `json:"level"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+var (
+	announcementMu sync.Mutex
+	// 当前的公告，没有公告时为 nil
+	announcement *Announcement
+)
+
+// loadAnnouncement 启动时读取公告
+func loadAnnouncement() {
+	var a Announcement
+	if err := loadDataFile(announcementFile, &a); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取公告失败", "error", err)
+		}
+		return
+	}
+	if a.Message == "" {
+		return
+	}
+	announcementMu.Lock()
+	announcement = &a
+	announcementMu.Unlock()
+}
+
+// active 判断公告在 now 时是否应当显示
+func (a *Announcement) active(now time.Time) bool {
+	if a == nil {
+		return false
+	}
+	return (a.StartsAt == nil || !now.Before(*a.StartsAt)) && (a.EndsAt == nil || now.Before(*a.EndsAt))
+}
+
+// announcementHandler 返回正在显示的公告，没有公告、还未开始或已经结束时为 null
+func announcementHandler(c *gin.Context) {
+	announcementMu.Lock()
+	a := announcement
+	announcementMu.Unlock()
+	if !a.active(time.Now()) {
+		a = nil
+	}
+	c.JSON(http.StatusOK, gin.H{"announcement": a})
+}
+
+// setAnnouncementHandler 发布或撤下公告，新公告替换原来的公告
+func setAnnouncementHandler(c *gin.Context) {
+	var req AnnouncementRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	level := req.Level
+	if level == "" {
+		level = announcementLevelInfo
+	}
+	switch level {
+	case announcementLevelInfo, announcementLevelWarning, announcementLevelCritical:
+	default:
+		respondError(c, http.StatusBadRequest, tr(c, "error.announcement_level_invalid", req.Level))
+		return
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		respondError(c, http.StatusBadRequest, tr(c, "error.announcement_time_invalid"))
+		return
+	}
+
+	var a *Announcement
+	saved := Announcement{}
+	if message != "" {
+		saved = Announcement{
+			Message:   message,
+			Level:     level,
+			StartsAt:  req.StartsAt,
+			EndsAt:    req.EndsAt,
+			UpdatedAt: time.Now(),
+			User:      requestUser(c),
+		}
+		a = &saved
+	}
+	announcementMu.Lock()
+	err := saveDataFile(announcementFile, saved)
+	if err == nil {
+		announcement = a
+	}
+	announcementMu.Unlock()
+	if err != nil {
+		requestLogger(c).Error("保存公告失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.save_announcement"))
+		return
+	}
+
+	detail := "cleared"
+	if a != nil {
+		detail = fmt.Sprintf("level=%s message=%q", a.Level, truncateRunes(a.Message, 100))
+	}
+	recordAudit(c, auditActionAdminAnnouncement, "announcement", detail, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"announcement": a,
+		"active":       a.active(time.Now()),
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 路径前缀
+const (
+	apiV1Prefix     = "/api/v1"
+	apiLegacyPrefix = "/api"
+)
+
+// 标记请求来自未带版本号的旧路径
+const legacyAPIContextKey = "legacy_api"
+
+// registerAPIRoutes 在指定前缀下注册全部API路由，返回管理接口分组
+func registerAPIRoutes(api *gin.RouterGroup) *gin.RouterGroup {
+	api.POST("/chat", tokenAuth(tokenScopeChat), chatHandler)
+	api.POST("/chat/batch", tokenAuth(tokenScopeChat), chatBatchHandler)
+	api.POST("/chat/regenerate", tokenAuth(tokenScopeChat), regenerateHandler)
+	api.POST("/chat/:job_id/cancel", tokenAuth(tokenScopeChat), cancelChatHandler)
+	api.GET("/models", modelsHandler)
+	api.GET("/usage", usageHandler)
+	api.GET("/version", versionHandler)
+	api.GET("/status", statusHandler)
+	api.GET("/announcement", announcementHandler)
+	api.PUT("/announcement", adminAuth(), setAnnouncementHandler)
+	api.GET("/recent", recentQAsHandler)
+	api.POST("/feedback", feedbackHandler)
+	api.POST("/knowledge/add", tokenAuth(tokenScopeCapture), addToKnowledgeHandler)
+	api.POST("/knowledge/ocr", tokenAuth(tokenScopeCapture), ocrKnowledgeHandler)
+	api.POST("/capture", tokenAuth(tokenScopeCapture), captureHandler)
+	api.GET("/knowledge", knowledgeHandler)
+	api.DELETE("/knowledge/:id", deleteKnowledgeHandler)
+	api.GET("/knowledge/trash", knowledgeTrashHandler)
+	api.GET("/knowledge/stale", staleKnowledgeHandler)
+	api.POST("/knowledge/stale/check", adminAuth(), checkStaleLinksHandler)
+	api.POST("/knowledge/:id/restore", restoreKnowledgeHandler)
+	api.POST("/knowledge/:id/links", addKnowledgeLinkHandler)
+	api.DELETE("/knowledge/:id/links/:target_id", removeKnowledgeLinkHandler)
+	api.DELETE("/knowledge/trash/:id", adminAuth(), purgeKnowledgeHandler)
+	api.POST("/knowledge/:id/translate", tokenAuth(tokenScopeCapture), translateKnowledgeHandler)
+	api.POST("/knowledge/:id/verify", adminAuth(), verifyKnowledgeHandler)
+	api.POST("/knowledge/:id/score", adminAuth(), scoreKnowledgeHandler)
+	api.POST("/knowledge/:id/publish", adminAuth(), publishKnowledgeHandler)
+	api.POST("/summarize", tokenAuth(tokenScopeChat), summarizeHandler)
+	api.POST("/translate", tokenAuth(tokenScopeChat), translateHandler)
+	api.POST("/extract", tokenAuth(tokenScopeChat), extractHandler)
+	api.POST("/embeddings", tokenAuth(tokenScopeChat), embeddingsHandler)
+	api.POST("/rerank", tokenAuth(tokenScopeChat), rerankHandler)
+	api.POST("/tokens/count", tokenAuth(tokenScopeChat), tokenCountHandler)
+	api.GET("/graphql", tokenAuth(""), graphqlHandler)
+	api.POST("/graphql", tokenAuth(""), graphqlHandler)
+	api.POST("/hooks/:name", hookHandler)
+	api.POST("/undo/:token", undoHandler)
+
+	// 管理接口路由
+	analytics := api.Group("/analytics", adminAuth())
+	{
+		analytics.GET("/topics", topicsHandler)
+		analytics.POST("/topics/refresh", refreshTopicsHandler)
+		analytics.GET("/trending", trendingHandler)
+		analytics.POST("/trending/publish", publishTrendingHandler)
+	}
+
+	admin := api.Group("/admin", adminAuth())
+	{
+		admin.GET("/audit", auditLogHandler)
+		admin.GET("/moderation/log", moderationLogHandler)
+		admin.GET("/stats", adminStatsHandler)
+		admin.POST("/cache/clear", adminClearCacheHandler)
+		admin.POST("/backup", adminBackupHandler)
+		admin.POST("/reindex", adminReindexHandler)
+		admin.POST("/reload", adminReloadHandler)
+		admin.GET("/features", featuresHandler)
+		admin.GET("/tokens", accessTokensHandler)
+		admin.POST("/tokens", createAccessTokenHandler)
+		admin.DELETE("/tokens/:id", revokeAccessTokenHandler)
+		admin.GET("/maintenance", maintenanceHandler)
+		admin.POST("/maintenance", setMaintenanceHandler)
+		admin.POST("/models/refresh", adminRefreshModelsHandler)
+		admin.GET("/webhooks/deliveries", webhookDeliveriesHandler)
+		admin.GET("/events", eventsHandler)
+		admin.GET("/events/subscribers", eventSubscribersHandler)
+		admin.GET("/schedules", schedulesHandler)
+		admin.POST("/schedules/:name/run", scheduleRunHandler)
+		admin.GET("/schedules/:name/runs", scheduleRunsHandler)
+		admin.GET("/shadow", shadowHandler)
+		admin.GET("/errors", chatFailuresHandler)
+		admin.GET("/export/finetune", exportFinetuneHandler)
+		admin.POST("/finetune/files", uploadFinetuneFileHandler)
+		admin.POST("/finetune/jobs", createFinetuneJobHandler)
+		admin.GET("/finetune/jobs", finetuneJobsHandler)
+		admin.GET("/finetune/jobs/:id", finetuneJobHandler)
+		admin.POST("/finetune/jobs/:id/cancel", cancelFinetuneJobHandler)
+		admin.GET("/curation/queue", curationQueueHandler)
+		admin.POST("/curation/:record_id", curateHandler)
+		admin.GET("/curation/golden", goldenDatasetHandler)
+		admin.GET("/export/golden", exportGoldenHandler)
+	}
+	return admin
+}
+
+// deprecatedAPIMiddleware 为旧路径 /api 的响应加上弃用提示，并指向 /api/v1 下对应的接口
+// 旧路径只保留一个版本，之后会移除
+func deprecatedAPIMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(legacyAPIContextKey, true)
+		successor := apiV1Prefix + strings.TrimPrefix(c.Request.URL.Path, apiLegacyPrefix)
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+// canonicalAPIRoute 把旧路径转换为 /api/v1 下的路径，其它路径原样返回
+func canonicalAPIRoute(route string) string {
+	if strings.HasPrefix(route, apiLegacyPrefix+"/") && !strings.HasPrefix(route, apiV1Prefix+"/") {
+		return apiV1Prefix + strings.TrimPrefix(route, apiLegacyPrefix)
+	}
+	return route
+}
+
+// errorCodes 各状态码对应的错误码
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusTooManyRequests:       "rate_limited",
+	statusClientClosedRequest:        "cancelled",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "upstream_timeout",
+}
+
+// errorCode 返回状态码对应的错误码
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
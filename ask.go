@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ask 子命令等待回答的最长时间
+const askTimeout = 5 * time.Minute
+
+// 未指定标题时，用问题的前若干个字作为知识库条目标题
+const askTitleRunes = 50
+
+// 通过管道传入的内容最多读取的字节数
+const askMaxStdinBytes = 1 << 20
+
+// ask 子命令的退出码：0 成功，1 提问或保存失败，2 参数错误
+const (
+	askExitFailure = 1
+	askExitUsage   = 2
+)
+
+var askHTTPClient = &http.Client{Timeout: askTimeout}
+
+// askCommand 在终端中提问并把回答输出到标准输出
+// 指定 -server 时通过运行中的服务提问，否则使用相同的配置直接调用模型
+// 没有问题参数，或者指定了 -stdin（也可以用参数 -）时，读取管道或文件重定向的标准输入，
+// 内容作为上下文附加在问题后面
+//
+//	ai-assistant ask [-server http://localhost:8080] [-model ...] [-save] [-tags a,b] [-title ...] "问题"
+//	cat error.log | ai-assistant ask -stdin "解释一下这个错误"
+//	git diff | ai-assistant ask
+func askCommand(args []string) {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	server := fs.String("server", os.Getenv(envPrefix+"SERVER"), "运行中的服务地址，默认读取 AI_ASSISTANT_SERVER 环境变量，为空时直接调用模型")
+	model := fs.String("model", "", "使用的模型，默认为配置中的 models.default")
+	save := fs.Bool("save", false, "把回答保存到知识库")
+	tags := fs.String("tags", "", "保存到知识库时的标签，用逗号分隔")
+	title := fs.String("title", "", "保存到知识库时的标题，默认使用问题开头")
+	withStdin := fs.Bool("stdin", false, "读取标准输入作为上下文附加在问题后面，也可以用参数 - 指定；没有问题参数时自动读取")
+	fs.StringVar(&configFile, "config", configFile, "配置文件路径（直接调用模型时使用）")
+	fs.StringVar(&dataDirFlag, "data-dir", "", "数据目录（直接调用模型时使用）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ai-assistant ask [参数] \"问题\"")
+		fs.PrintDefaults()
+	}
+
+	// 参数可以写在问题前后
+	var words []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		if fs.Arg(0) == "-" {
+			*withStdin = true
+		} else {
+			words = append(words, fs.Arg(0))
+		}
+		args = fs.Args()[1:]
+	}
+	question := strings.TrimSpace(strings.Join(words, " "))
+	// 有问题参数时不读取标准输入，避免在继承了标准输入的脚本或定时任务中意外读取无关的内容
+	var input string
+	var err error
+	if question == "" || *withStdin {
+		if input, err = readStdinContext(*withStdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(askExitUsage)
+		}
+	}
+	if question == "" && input == "" {
+		fs.Usage()
+		os.Exit(askExitUsage)
+	}
+	if *title == "" {
+		*title = askDefaultTitle(question)
+		if question == "" {
+			*title = askDefaultTitle(input)
+		}
+	}
+	message := buildAskMessage(question, input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+
+	if *server != "" {
+		err = askServer(ctx, strings.TrimSuffix(*server, "/"), message, *model, *save, *title, *tags)
+	} else {
+		err = askDirect(ctx, message, *model, *save, *title, *tags)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(askExitFailure)
+	}
+}
+
+// readStdinContext 标准输入是管道或普通文件时读取全部内容，否则返回空；required 为 true 时返回错误
+func readStdinContext(required bool) (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || (info.Mode()&os.ModeNamedPipe == 0 && !info.Mode().IsRegular()) {
+		if required {
+			return "", errors.New("-stdin 要求通过管道或文件重定向提供标准输入")
+		}
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, askMaxStdinBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("读取标准输入失败: %w", err)
+	}
+	if len(data) > askMaxStdinBytes {
+		return "", fmt.Errorf("标准输入内容过大，最多允许 %s", formatBytes(askMaxStdinBytes))
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// buildAskMessage 把标准输入的内容放在代码块中附加到问题后面，只有其中一个时直接使用
+func buildAskMessage(question, input string) string {
+	switch {
+	case input == "":
+		return question
+	case question == "":
+		return input
+	}
+	return question + "\n\n```\n" + input + "\n```"
+}
+
+// askServer 通过运行中的服务提问，需要时再调用添加知识库接口
+func askServer(ctx context.Context, server, question, model string, save bool, title, tags string) error {
+	var resp ChatResponse
+	if err := askPost(ctx, server+apiV1Prefix+"/chat", ChatRequest{Message: question, Model: model}, &resp); err != nil {
+		return err
+	}
+	printAnswer(&resp)
+
+	if !save {
+		return nil
+	}
+	if resp.RecordID == 0 {
+		return errors.New("服务没有返回问答记录ID，无法保存到知识库，请升级服务端")
+	}
+	var added struct {
+		Item KnowledgeItem `json:"item"`
+	}
+	req := AddToKnowledgeRequest{RecordID: resp.RecordID, Title: title, Tags: tags}
+	if err := askPost(ctx, server+apiV1Prefix+"/knowledge/add", req, &added); err != nil {
+		return fmt.Errorf("保存到知识库失败: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "已保存到知识库（ID %d）\n", added.Item.ID)
+	return nil
+}
+
+// askPost 发送JSON请求并解析响应，非200响应返回服务端的错误信息
+func askPost(ctx context.Context, url string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := askHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			return fmt.Errorf("服务返回错误（%d %s）: %s", resp.StatusCode, errResp.Code, errResp.Message)
+		}
+		return fmt.Errorf("服务返回错误: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// askDirect 使用本地配置直接调用模型，与服务端走相同的审核、过滤和问答记录流程
+// 需要独占数据目录，服务正在运行时请改用 -server
+func askDirect(ctx context.Context, question, model string, save bool, title, tags string) error {
+	cfg, closeData, err := openLocalData()
+	if err != nil {
+		return err
+	}
+	defer closeData()
+
+	if max := maxMessageChars(cfg); max > 0 && utf8.RuneCountInString(question) > max {
+		return fmt.Errorf("问题过长，最多允许 %d 个字符", max)
+	}
+
+	resp, record, chatErr := processChat(ctx, ChatRequest{Message: question, Model: model}, "")
+	if chatErr != nil {
+		return errors.New(chatErr.Message)
+	}
+	printAnswer(resp)
+
+	if !save {
+		return nil
+	}
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     title,
+		Content:   record.Answer,
+		Model:     record.Model,
+		Timestamp: time.Now(),
+		Tags:      splitTags(tags),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已保存到知识库（ID %d）\n", item.ID)
+	return nil
+}
+
+// openLocalData 读取配置并加载数据目录，供不经过服务直接调用模型的子命令使用
+// 返回的函数在退出前调用，用于关闭数据库
+func openLocalData() (*Config, func(), error) {
+	cfg, err := readConfigFile(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	activeConfig.Store(cfg)
+	dataDir = resolveDataDir(cfg)
+	loadPersistentData()
+
+	return cfg, func() {
+		if store != nil {
+			store.Close()
+		}
+	}, nil
+}
+
+// printAnswer 回答输出到标准输出，提示信息输出到标准错误，便于在管道中使用
+func printAnswer(resp *ChatResponse) {
+	fmt.Println(resp.Response)
+	for _, w := range resp.Warnings {
+		fmt.Fprintln(os.Stderr, "提示: "+w)
+	}
+}
+
+// askDefaultTitle 截取问题开头作为标题
+func askDefaultTitle(question string) string {
+	question = strings.Join(strings.Fields(question), " ")
+	if utf8.RuneCountInString(question) <= askTitleRunes {
+		return question
+	}
+	return string([]rune(question)[:askTitleRunes]) + "…"
+}
+
+// splitTags 解析逗号分隔的标签
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 编译进程序的页面模板和静态文件
+//
+//go:embed templates all:static
+var embeddedAssets embed.FS
+
+// overlayFS 优先从自定义目录读取文件，不存在时使用内置文件
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+// Open 打开文件，自定义目录中没有时退回到内置文件
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if o.override != nil {
+		f, err := o.override.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return o.base.Open(name)
+}
+
+// 当前使用的页面资源
+var assets fs.FS = embeddedAssets
+
+// setupAssets 按配置决定是否使用自定义资源目录
+// 目录结构与内置资源相同（templates/、static/），只需放入要替换的文件
+func setupAssets(cfg *Config) {
+	dir := expandHome(cfg.Server.AssetsDir)
+	if dir == "" {
+		assets = embeddedAssets
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		slog.Warn("自定义资源目录不存在，使用内置资源", "path", dir)
+		assets = embeddedAssets
+		return
+	}
+	assets = overlayFS{override: os.DirFS(dir), base: embeddedAssets}
+	slog.Info("使用自定义资源目录", "path", dir)
+}
+
+// staticFS 返回静态文件目录
+func staticFS() http.FileSystem {
+	sub, err := fs.Sub(assets, "static")
+	if err != nil {
+		fatal("加载静态文件失败", "error", err)
+	}
+	return http.FS(sub)
+}
+
+// servePage 返回一个输出页面模板的处理函数
+func servePage(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := fs.ReadFile(assets, "templates/"+name)
+		if err != nil {
+			slog.Error("读取页面模板失败", "template", name, "error", err)
+			respondError(c, http.StatusInternalServerError, tr(c, "error.page_load"))
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+	}
+}
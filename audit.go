@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditLogFile = "audit.jsonl"
+
+// 审计日志查询默认返回条数
+const defaultAuditLimit = 100
+
+// 审计事件类型
+const (
+	auditActionChat            = "chat"
+	auditActionKnowledgeAdd    = "knowledge.add"
+	auditActionKnowledgeDelete = "knowledge.delete"
+	auditActionAuthSuccess     = "auth.success"
+	auditActionAuthFailed      = "auth.failed"
+	auditActionAdminQuery      = "admin.audit.query"
+	auditActionAdminRequest    = "admin.request"
+)
+
+// AuditEntry 审计日志条目
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user"`
+	ClientIP  string    `json:"client_ip"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Status    int       `json:"status"`
+}
+
+var auditMu sync.Mutex
+
+// requestUser 返回当前请求的用户标识，未认证的请求为anonymous
+func requestUser(c *gin.Context) string {
+	if user := c.GetString("user"); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// recordAudit 追加一条审计日志，审计日志只追加不修改
+func recordAudit(c *gin.Context, action, resource, detail string, status int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      requestUser(c),
+		ClientIP:  c.ClientIP(),
+		Action:    action,
+		Resource:  resource,
+		Detail:    detail,
+		Status:    status,
+	})
+}
+
+// writeAudit 写入一条审计日志
+func writeAudit(entry AuditEntry) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if err := appendJSONLine(dataPath(auditLogFile), entry); err != nil {
+		slog.Error("写入审计日志失败", "error", err)
+	}
+}
+
+// adminAuth 管理接口认证中间件
+// 配置了admin.token时要求请求携带该令牌，未配置时只允许本机访问
+// 通过认证的请求在处理完成后以 admin.request 记录到审计日志，包括方法、路由和响应状态
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := currentConfig().Admin.Token
+		if adminToken == "" {
+			// 连接的对端地址不受请求头影响；经由可信代理转发时，转发前的客户端地址同样要求是本机
+			if !isLoopbackIP(c.RemoteIP()) || !isLoopbackIP(c.ClientIP()) {
+				recordAudit(c, auditActionAuthFailed, c.FullPath(), "未配置管理令牌，仅允许本机访问", http.StatusForbidden)
+				respondError(c, http.StatusForbidden, tr(c, "error.admin_local_only"))
+				return
+			}
+			c.Set("user", "admin")
+			c.Next()
+			recordAdminRequest(c)
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.GetHeader("X-Admin-Token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			recordAudit(c, auditActionAuthFailed, c.FullPath(), "管理令牌无效", http.StatusUnauthorized)
+			respondError(c, http.StatusUnauthorized, tr(c, "error.admin_token_invalid"))
+			return
+		}
+
+		c.Set("user", "admin")
+		recordAudit(c, auditActionAuthSuccess, c.FullPath(), "", http.StatusOK)
+		c.Next()
+		recordAdminRequest(c)
+	}
+}
+
+// recordAdminRequest 记录一次管理接口调用，处理函数自己记录的审计日志只覆盖部分操作
+func recordAdminRequest(c *gin.Context) {
+	recordAudit(c, auditActionAdminRequest, c.Request.Method+" "+c.FullPath(), "", c.Writer.Status())
+}
+
+// isLoopbackIP 判断地址是否为本机地址
+func isLoopbackIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// auditLogHandler 查询审计日志
+// 支持按action、user、ip过滤，since/until为RFC3339时间，limit限制返回条数，结果按时间倒序
+func auditLogHandler(c *gin.Context) {
+	action := c.Query("action")
+	user := c.Query("user")
+	ip := c.Query("ip")
+
+	var since, until time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.since_invalid"))
+			return
+		}
+		since = t
+	}
+	if v := c.Query("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.until_invalid"))
+			return
+		}
+		until = t
+	}
+
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	entries := []AuditEntry{}
+	auditMu.Lock()
+	err := readJSONLines(dataPath(auditLogFile), func(line []byte) {
+		var entry AuditEntry
+		if json.Unmarshal(line, &entry) != nil {
+			return
+		}
+		if action != "" && entry.Action != action && !strings.HasPrefix(entry.Action, action+".") {
+			return
+		}
+		if user != "" && entry.User != user {
+			return
+		}
+		if ip != "" && entry.ClientIP != ip {
+			return
+		}
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			return
+		}
+		if !until.IsZero() && entry.Timestamp.After(until) {
+			return
+		}
+		entries = append(entries, entry)
+	})
+	auditMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_audit_log"))
+		return
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	total := len(entries)
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	recordAudit(c, auditActionAdminQuery, "audit", c.Request.URL.RawQuery, http.StatusOK)
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"entries": entries,
+	})
+}
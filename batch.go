@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的批量对话操作
+const auditActionChatBatch = "chat.batch"
+
+// 批量处理的默认并发数和单次请求最多的条数
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchMaxItems    = 1000
+)
+
+// 批量接口请求和响应使用的内容类型
+const batchContentType = "application/x-ndjson"
+
+// BatchItem 批量处理输入文件中的一行
+type BatchItem struct {
+	// 调用方自定义的ID，原样写入结果，为空时使用行号
+	ID        string `json:"id,omitempty"`
+	Message   string `json:"message"`
+	Model     string `json:"model,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+	Language  string `json:"language,omitempty"`
+}
+
+// BatchResult 批量处理输出文件中的一行，顺序与输入相同
+type BatchResult struct {
+	ID       string      `json:"id"`
+	Line     int         `json:"line"`
+	Model    string      `json:"model"`
+	Response string      `json:"response,omitempty"`
+	RecordID int         `json:"record_id,omitempty"`
+	Usage    *TokenUsage `json:"usage,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	// 失败时对应的HTTP状态码
+	Status int `json:"status,omitempty"`
+}
+
+// BatchSummary 一次批量处理的汇总
+type BatchSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Tokens    int
+}
+
+// batchItemLine 带行号的输入条目
+type batchItemLine struct {
+	BatchItem
+	Line int
+}
+
+// batchConcurrency 返回批量处理的并发数
+func batchConcurrency(cfg *Config) int {
+	if cfg.Batch.Concurrency > 0 {
+		return cfg.Batch.Concurrency
+	}
+	return defaultBatchConcurrency
+}
+
+// batchMaxItems 返回批量接口单次请求最多的条数
+func batchMaxItems(cfg *Config) int {
+	if cfg.Batch.MaxItems > 0 {
+		return cfg.Batch.MaxItems
+	}
+	return defaultBatchMaxItems
+}
+
+// parseBatchItems 读取JSON Lines格式的输入，空行跳过，格式错误时返回出错的行号
+// maxItems 大于0时限制条数，错误信息使用 locale 指定的语言
+func parseBatchItems(r io.Reader, maxItems int, locale string) ([]batchItemLine, error) {
+	var items []batchItemLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var item BatchItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, errors.New(translate(locale, "error.batch_line_invalid", line, err))
+		}
+		if strings.TrimSpace(item.Message) == "" {
+			return nil, errors.New(translate(locale, "error.batch_line_no_message", line))
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		items = append(items, batchItemLine{BatchItem: item, Line: line})
+		if maxItems > 0 && len(items) > maxItems {
+			return nil, errors.New(translate(locale, "error.batch_too_many", maxItems))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New(translate(locale, "error.batch_empty"))
+	}
+	return items, nil
+}
+
+// batchLimiter 按固定间隔放行请求，用于限制每分钟的请求数
+type batchLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newBatchLimiter 创建限速器，perMinute 不大于0时不限速
+func newBatchLimiter(perMinute int) *batchLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &batchLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// wait 等待下一个可用的时间点
+func (l *batchLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runBatch 按指定并发数和速率逐条执行对话，结果按输入顺序交给 emit
+// emit 返回错误时停止处理剩余条目，locale 为结果中错误信息使用的语言
+func runBatch(ctx context.Context, items []batchItemLine, concurrency, ratePerMinute int, clientIP, locale string, emit func(BatchResult) error) (BatchSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cfg := currentConfig()
+	limiter := newBatchLimiter(ratePerMinute)
+	type indexed struct {
+		index  int
+		result BatchResult
+	}
+	jobs := make(chan int)
+	results := make(chan indexed)
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- indexed{index, processBatchItem(ctx, cfg, items[index], limiter, clientIP, locale)}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range items {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 先完成的结果暂存，保证输出顺序与输入一致
+	summary := BatchSummary{Total: len(items)}
+	pending := map[int]BatchResult{}
+	next := 0
+	var emitErr error
+	for r := range results {
+		pending[r.index] = r.result
+		for emitErr == nil {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if result.Error != "" {
+				summary.Failed++
+			} else {
+				summary.Succeeded++
+			}
+			if result.Usage != nil {
+				summary.Tokens += result.Usage.TotalTokens
+			}
+			if emitErr = emit(result); emitErr != nil {
+				cancel()
+			}
+		}
+	}
+	return summary, emitErr
+}
+
+// processBatchItem 处理一条输入，与 /api/v1/chat 走相同的处理流程
+func processBatchItem(ctx context.Context, cfg *Config, item batchItemLine, limiter *batchLimiter, clientIP, locale string) BatchResult {
+	result := BatchResult{ID: item.ID, Line: item.Line, Model: item.Model}
+	if !routeRequested(cfg, item.Model) {
+		result.Model = resolveModel(cfg, item.Model)
+	}
+	if limit := maxMessageChars(cfg); limit > 0 && utf8.RuneCountInString(item.Message) > limit {
+		result.Error = translate(locale, "error.message_limit", limit)
+		result.Status = http.StatusRequestEntityTooLarge
+		return result
+	}
+	if item.Language != "" && !isValidAnswerLanguage(item.Language) {
+		result.Error = translate(locale, "error.language_invalid", item.Language)
+		result.Status = http.StatusBadRequest
+		return result
+	}
+	if err := limiter.wait(ctx); err != nil {
+		result.Error = err.Error()
+		result.Status = http.StatusServiceUnavailable
+		return result
+	}
+
+	req := ChatRequest{Message: item.Message, Model: result.Model, Workspace: item.Workspace, Language: item.Language}
+	resp, _, chatErr := processChat(ctx, req, clientIP)
+	if chatErr != nil {
+		result.Error = chatErr.localize(locale)
+		result.Status = chatErr.Status
+		return result
+	}
+	result.Model = resp.Model
+	result.Response = resp.Response
+	result.RecordID = resp.RecordID
+	result.Usage = resp.Usage
+	result.Warnings = resp.Warnings
+	return result
+}
+
+// chatBatchHandler 批量对话，请求体和响应都是JSON Lines，结果按输入顺序逐行返回
+func chatBatchHandler(c *gin.Context) {
+	cfg := currentConfig()
+	items, err := parseBatchItems(c.Request.Body, batchMaxItems(cfg), requestLocale(c))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondBodyTooLarge(c, tooLarge.Limit)
+			return
+		}
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", batchContentType)
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	summary, err := runBatch(c.Request.Context(), items, batchConcurrency(cfg), cfg.Batch.RatePerMinute, c.ClientIP(), requestLocale(c), func(r BatchResult) error {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		requestLogger(c).Warn("批量对话中断", "error", err)
+	}
+
+	recordAudit(c, auditActionChatBatch, "chat/batch",
+		fmt.Sprintf("total=%d succeeded=%d failed=%d tokens=%d", summary.Total, summary.Succeeded, summary.Failed, summary.Tokens), http.StatusOK)
+}
+
+// batchCommand 批量处理JSON Lines文件中的问题，结果写入输出文件
+// 指定 -server 时通过运行中的服务处理，否则使用相同的配置直接调用模型
+//
+//	ai-assistant batch -input prompts.jsonl -output answers.jsonl [-concurrency 4] [-rate 60] [-model ...]
+func batchCommand(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	input := fs.String("input", "-", "输入文件，每行一个 {\"id\", \"message\", \"model\"}，- 表示标准输入")
+	output := fs.String("output", "-", "输出文件，- 表示标准输出")
+	server := fs.String("server", os.Getenv(envPrefix+"SERVER"), "运行中的服务地址，为空时直接调用模型")
+	concurrency := fs.Int("concurrency", 0, "并发数，默认使用配置中的 batch.concurrency")
+	rate := fs.Int("rate", -1, "每分钟最多的请求数，0 为不限，默认使用配置中的 batch.rate_per_minute")
+	model := fs.String("model", "", "未在输入中指定模型时使用的模型")
+	fs.StringVar(&configFile, "config", configFile, "配置文件路径（直接调用模型时使用）")
+	fs.StringVar(&dataDirFlag, "data-dir", "", "数据目录（直接调用模型时使用）")
+	fs.Parse(args)
+
+	in := os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	out := os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var summary BatchSummary
+	var err error
+	if *server != "" {
+		summary, err = batchViaServer(strings.TrimSuffix(*server, "/"), in, out)
+	} else {
+		summary, err = batchDirect(in, out, *concurrency, *rate, *model)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Fprintf(os.Stderr, "完成 %d 条，成功 %d 条，失败 %d 条，共 %d tokens\n",
+		summary.Total, summary.Succeeded, summary.Failed, summary.Tokens)
+	if summary.Failed > 0 {
+		os.Exit(askExitFailure)
+	}
+}
+
+// batchDirect 使用本地配置直接处理
+func batchDirect(in io.Reader, out io.Writer, concurrency, rate int, model string) (BatchSummary, error) {
+	cfg, closeData, err := openLocalData()
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	defer closeData()
+
+	items, err := parseBatchItems(in, 0, defaultLocale(cfg))
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	for i := range items {
+		if items[i].Model == "" {
+			items[i].Model = model
+		}
+	}
+	if concurrency <= 0 {
+		concurrency = batchConcurrency(cfg)
+	}
+	if rate < 0 {
+		rate = cfg.Batch.RatePerMinute
+	}
+
+	enc := json.NewEncoder(out)
+	return runBatch(context.Background(), items, concurrency, rate, "", defaultLocale(cfg), func(r BatchResult) error {
+		return enc.Encode(r)
+	})
+}
+
+// batchViaServer 把输入原样提交给服务的批量接口，结果逐行写入输出
+// 并发数和速率由服务端配置决定
+func batchViaServer(server string, in io.Reader, out io.Writer) (BatchSummary, error) {
+	req, err := http.NewRequest(http.MethodPost, server+apiV1Prefix+"/chat/batch", in)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	req.Header.Set("Content-Type", batchContentType)
+
+	// 批量处理耗时不确定，不设置整体超时
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return BatchSummary{}, fmt.Errorf("请求服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Message != "" {
+			return BatchSummary{}, fmt.Errorf("服务返回错误（%d %s）: %s", resp.StatusCode, errResp.Code, errResp.Message)
+		}
+		return BatchSummary{}, fmt.Errorf("服务返回错误: %s", resp.Status)
+	}
+
+	var summary BatchSummary
+	dec := json.NewDecoder(resp.Body)
+	enc := json.NewEncoder(out)
+	for {
+		var result BatchResult
+		if err := dec.Decode(&result); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return summary, fmt.Errorf("读取结果失败: %w", err)
+		}
+		summary.Total++
+		if result.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+		if result.Usage != nil {
+			summary.Tokens += result.Usage.TotalTokens
+		}
+		if err := enc.Encode(result); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
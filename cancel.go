@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的取消生成操作
+const auditActionChatCancel = "chat.cancel"
+
+// 生成被取消或客户端断开时返回的状态码，与 nginx 的 499 Client Closed Request 一致
+const statusClientClosedRequest = 499
+
+// chatJob 一次正在进行的生成，ID 为请求ID，客户端可以通过 X-Request-ID 预先指定
+type chatJob struct {
+	User    string
+	Model   string
+	Started time.Time
+	cancel  context.CancelFunc
+}
+
+var (
+	chatJobsMu sync.Mutex
+	chatJobs   = map[string]*chatJob{}
+)
+
+// startChatJob 以请求ID登记一次生成，返回取消生成或客户端断开时都会结束的 context
+// 生成结束后必须调用返回的函数注销
+func startChatJob(c *gin.Context, model string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	id := requestID(c)
+	job := &chatJob{User: requestUser(c), Model: model, Started: time.Now(), cancel: cancel}
+
+	chatJobsMu.Lock()
+	chatJobs[id] = job
+	chatJobsMu.Unlock()
+
+	return ctx, func() {
+		chatJobsMu.Lock()
+		// 客户端重复使用请求ID时只注销自己登记的生成
+		if chatJobs[id] == job {
+			delete(chatJobs, id)
+		}
+		chatJobsMu.Unlock()
+		cancel()
+	}
+}
+
+// generationCancelled 判断生成是否因为取消或客户端断开而结束，此时不作为上游错误上报
+func generationCancelled(ctx context.Context) bool {
+	return ctx.Err() == context.Canceled
+}
+
+// respondDisconnected 客户端已断开时中断的上游调用不作为错误记录和上报，以 499 结束请求并返回 true
+func respondDisconnected(c *gin.Context, err error) bool {
+	if !generationCancelled(c.Request.Context()) {
+		return false
+	}
+	requestLogger(c).Info("客户端已断开，上游请求已中断", "error", err)
+	respondError(c, statusClientClosedRequest, tr(c, "error.generation_cancelled"))
+	return true
+}
+
+// cancelChatHandler 取消一次正在进行的生成
+// 上游请求随之中断，不再继续消耗 token；原请求返回 499，流式响应正常结束
+func cancelChatHandler(c *gin.Context) {
+	id := c.Param("job_id")
+	if !cancelChatJob(c, id) {
+		respondError(c, http.StatusNotFound, tr(c, "error.job_not_found", id))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": tr(c, "message.generation_cancelled"), "job_id": id})
+}
+
+// gatewayCancelHandler 取消通过 OpenAI 兼容接口发起的生成，使用同一个网关密钥认证
+func gatewayCancelHandler(c *gin.Context) {
+	id := c.Param("job_id")
+	if !cancelChatJob(c, id) {
+		respondOpenAIError(c, http.StatusNotFound, "not_found", tr(c, "error.job_not_found", id))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "object": "chat.completion.cancelled", "cancelled": true})
+}
+
+// cancelChatJob 取消当前用户发起的生成，没有找到或不是自己发起的生成时返回 false
+func cancelChatJob(c *gin.Context, id string) bool {
+	chatJobsMu.Lock()
+	job, ok := chatJobs[id]
+	if ok && job.User != requestUser(c) {
+		ok = false
+	}
+	if ok {
+		delete(chatJobs, id)
+	}
+	chatJobsMu.Unlock()
+	if !ok {
+		return false
+	}
+	job.cancel()
+
+	slog.Info("生成已取消", "job_id", id, "model", job.Model, "elapsed", time.Since(job.Started).Round(time.Millisecond))
+	recordAudit(c, auditActionChatCancel, job.Model, "job_id="+id, http.StatusOK)
+	return true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 快速收集的条目的 model 字段，表示内容不是由模型生成的
+const captureModel = "capture"
+
+// CaptureRequest 快速收集请求，text 为要保存的内容，其余字段可选
+type CaptureRequest struct {
+	Text string `json:"text"`
+	// 内容的来源链接，追加在内容末尾
+	URL string `json:"url"`
+	// 为空时使用内容的第一行
+	Title string `json:"title"`
+	// 逗号分隔的标签
+	Tags string `json:"tags"`
+}
+
+// captureHandler 直接把一段文字保存为知识库条目，不经过问答，供 Alfred、Raycast、脚本和剪藏工具调用
+// 请求体为 JSON 时按 CaptureRequest 解析，否则把请求体作为 text，url、title、tags 从查询参数读取
+func captureHandler(c *gin.Context) {
+	var req CaptureRequest
+	if c.ContentType() == gin.MIMEJSON {
+		if !bindJSON(c, &req) {
+			return
+		}
+	} else {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondBodyTooLarge(c, tooLarge.Limit)
+				return
+			}
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		req = CaptureRequest{Text: string(data), URL: c.Query("url"), Title: c.Query("title"), Tags: c.Query("tags")}
+	}
+
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		respondError(c, http.StatusBadRequest, tr(c, "error.capture_empty"))
+		return
+	}
+	if req.URL = strings.TrimSpace(req.URL); req.URL != "" {
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			respondError(c, http.StatusBadRequest, tr(c, "error.capture_invalid_url", req.URL))
+			return
+		}
+		text += "\n\n来源：" + req.URL
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = askDefaultTitle(strings.SplitN(text, "\n", 2)[0])
+	}
+
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     title,
+		Content:   text,
+		Model:     captureModel,
+		Timestamp: time.Now(),
+		Tags:      splitTags(req.Tags),
+	})
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgeAdd, err)
+		return
+	}
+	recordAudit(c, auditActionKnowledgeAdd, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.knowledge_added"),
+		"item":    item,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 数据文件和备份的压缩方式
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// 各压缩格式的文件头
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionExt 返回压缩方式对应的文件扩展名
+func compressionExt(mode string) string {
+	switch mode {
+	case compressionGzip:
+		return ".gz"
+	case compressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// compressData 按指定方式压缩数据
+func compressData(data []byte, mode string) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := newCompressWriter(&buf, mode)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressData 根据文件头识别压缩格式并解压，未压缩的数据原样返回
+func decompressData(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case bytes.HasPrefix(data, zstdMagic):
+		r, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return data, nil
+}
+
+// nopWriteCloser 不压缩时使用的写入器
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressWriter 返回按指定方式压缩的写入器，关闭时写入结尾
+func newCompressWriter(w io.Writer, mode string) (io.WriteCloser, error) {
+	switch mode {
+	case compressionGzip:
+		return gzip.NewWriter(w), nil
+	case compressionZstd:
+		return zstd.NewWriter(w)
+	case "", compressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("不支持的压缩方式: %s", mode)
+}
+
+// archiveEntry 归档中的一个文件
+type archiveEntry struct {
+	Name string
+	Data []byte
+}
+
+// writeArchive 将文件打包为 tar 归档并按指定方式压缩
+func writeArchive(w io.Writer, entries []archiveEntry, mode string) error {
+	cw, err := newCompressWriter(w, mode)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	now := time.Now()
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Name:    entry.Name,
+			Mode:    0644,
+			Size:    int64(len(entry.Data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未配置时允许的方法和请求头
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-Admin-Token", "X-Request-ID"}
+)
+
+// 个人访问令牌可以调用的接口（相对 API 前缀），access_tokens.allowed_origins 中的来源只能跨域调用这些接口
+var tokenCORSPaths = []string{
+	"/chat", "/chat/batch", "/chat/regenerate", "/chat/*/cancel",
+	"/summarize", "/translate", "/extract", "/embeddings", "/rerank", "/tokens/count",
+	"/capture", "/knowledge/add", "/knowledge/ocr", "/knowledge/*/translate",
+	"/graphql",
+}
+
+// 令牌客户端跨域调用时允许的方法和请求头，不允许携带 Cookie
+var (
+	tokenCORSMethods = []string{"GET", "POST", "OPTIONS"}
+	tokenCORSHeaders = []string{"Content-Type", "Authorization", "X-Request-ID"}
+)
+
+// corsMiddleware 跨域访问中间件，应用于 /api
+// 注册在全局而不是 /api 分组上，因为预检的 OPTIONS 请求没有对应的路由，分组中间件不会执行
+// 每次请求读取当前配置，热加载后立即生效
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := currentConfig().CORS
+		origin := c.GetHeader("Origin")
+		if origin == "" || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.Next()
+			return
+		}
+		// 浏览器扩展等令牌客户端只开放令牌可以调用的接口，不需要开启整个 API 的跨域访问
+		if !(cfg.Enabled && corsOriginAllowed(cfg.AllowedOrigins, origin)) && tokenCORSAllowed(c.Request.URL.Path, origin) {
+			applyTokenCORS(c, origin)
+			return
+		}
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		if !corsOriginAllowed(cfg.AllowedOrigins, origin) {
+			// 不返回跨域响应头，由浏览器拦截；预检请求直接拒绝
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		allowAll := containsString(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials
+		if allowAll {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if len(cfg.ExposedHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+
+		// 预检请求
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			methods := cfg.AllowedMethods
+			if len(methods) == 0 {
+				methods = defaultCORSMethods
+			}
+			headers := cfg.AllowedHeaders
+			if len(headers) == 0 {
+				headers = defaultCORSHeaders
+			}
+			c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			c.Header("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// corsOriginAllowed 判断来源是否允许跨域访问
+// 支持 "*"、完整来源（https://example.com）和通配符（https://*.example.com、chrome-extension://*）
+func corsOriginAllowed(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		if strings.Contains(pattern, "*") {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(origin)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenCORSAllowed 判断来源是否在 access_tokens.allowed_origins 中，且请求的是令牌可以调用的接口
+func tokenCORSAllowed(requestPath, origin string) bool {
+	if !corsOriginAllowed(currentConfig().AccessTokens.AllowedOrigins, origin) {
+		return false
+	}
+	rel := requestPath
+	if strings.HasPrefix(rel, apiV1Prefix+"/") {
+		rel = strings.TrimPrefix(rel, apiV1Prefix)
+	} else {
+		rel = strings.TrimPrefix(rel, apiLegacyPrefix)
+	}
+	for _, pattern := range tokenCORSPaths {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTokenCORS 返回令牌客户端的跨域响应头，令牌通过 Authorization 携带，因此不允许携带 Cookie
+func applyTokenCORS(c *gin.Context, origin string) {
+	cfg := currentConfig().CORS
+	c.Header("Vary", "Origin")
+	c.Header("Access-Control-Allow-Origin", origin)
+	if len(cfg.ExposedHeaders) > 0 {
+		c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+	}
+	if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+		c.Header("Access-Control-Allow-Methods", strings.Join(tokenCORSMethods, ", "))
+		c.Header("Access-Control-Allow-Headers", strings.Join(tokenCORSHeaders, ", "))
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的反馈和整理操作
+const (
+	auditActionFeedback            = "feedback"
+	auditActionAdminCurationTriage = "admin.curation.triage"
+	auditActionAdminExportGolden   = "admin.export.golden"
+)
+
+// 用户反馈的记录文件和标准数据集文件，标准数据集与问答记录分开保存
+const (
+	feedbackFile      = "feedback.jsonl"
+	goldenDatasetFile = "golden_dataset.json"
+)
+
+// 用户对回答的评价
+const (
+	feedbackRatingUp   = "up"
+	feedbackRatingDown = "down"
+)
+
+// 审核反馈的处理方式：accept 采用原回答，edit 采用审核人修改后的回答，reject 不加入标准数据集
+const (
+	curationActionAccept = "accept"
+	curationActionEdit   = "edit"
+	curationActionReject = "reject"
+)
+
+// 导出标准数据集时，除微调格式外还支持 eval 格式，每行为问题和标准答案
+const goldenFormatEval = "eval"
+
+// 待审核队列接口默认返回的条数
+const defaultCurationLimit = 100
+
+// Feedback 用户对一条问答回答的评价
+type Feedback struct {
+	RecordID  int       `json:"record_id"`
+	Rating    string    `json:"rating"`
+	Comment   string    `json:"comment,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FeedbackRequest 提交反馈的请求，rating 为 up 或 down
+type FeedbackRequest struct {
+	RecordID int    `json:"record_id" binding:"required"`
+	Rating   string `json:"rating" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// CurationItem 待审核队列中的一条问答，以及它收到的差评
+type CurationItem struct {
+	Record   QARecord   `json:"record"`
+	Feedback []Feedback `json:"feedback,omitempty"`
+}
+
+// GoldenExample 审核后的问答，accept 和 edit 的条目组成标准数据集，reject 的条目只用于从队列中移除
+type GoldenExample struct {
+	RecordID int    `json:"record_id"`
+	Question string `json:"question"`
+	// 标准答案，edit 时为审核人修改后的回答
+	Answer string `json:"answer"`
+	// edit 时保留模型原来的回答
+	OriginalAnswer string    `json:"original_answer,omitempty"`
+	Model          string    `json:"model"`
+	Action         string    `json:"action"`
+	Note           string    `json:"note,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Reviewer       string    `json:"reviewer,omitempty"`
+	CuratedAt      time.Time `json:"curated_at"`
+}
+
+// CurationRequest 审核一条问答的请求，action 为 edit 时 answer 为修改后的标准答案
+type CurationRequest struct {
+	Action string `json:"action" binding:"required"`
+	Answer string `json:"answer"`
+	Note   string `json:"note"`
+	// 逗号分隔的标签
+	Tags string `json:"tags"`
+}
+
+// goldenEvalExample 评测格式的一行
+type goldenEvalExample struct {
+	ID          int      `json:"id"`
+	Question    string   `json:"question"`
+	IdealAnswer string   `json:"ideal_answer"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+var (
+	feedbackMu sync.Mutex
+	curationMu sync.Mutex
+	// 全部审核结果，包括 reject 的条目
+	goldenDataset []GoldenExample
+)
+
+// curated 判断审核结果是否属于标准数据集
+func (e GoldenExample) curated() bool {
+	return e.Action != curationActionReject
+}
+
+// loadGoldenDataset 启动时读取标准数据集
+func loadGoldenDataset() {
+	var examples []GoldenExample
+	if err := loadDataFile(goldenDatasetFile, &examples); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取标准数据集失败", "error", err)
+		}
+		return
+	}
+	curationMu.Lock()
+	goldenDataset = examples
+	curationMu.Unlock()
+}
+
+// saveGoldenDatasetLocked 保存标准数据集，调用方需要持有 curationMu
+func saveGoldenDatasetLocked() error {
+	return saveDataFile(goldenDatasetFile, goldenDataset)
+}
+
+// feedbackHandler 记录用户对回答的评价，差评的问答会进入待审核队列
+func feedbackHandler(c *gin.Context) {
+	var req FeedbackRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Rating != feedbackRatingUp && req.Rating != feedbackRatingDown {
+		respondError(c, http.StatusBadRequest, tr(c, "error.feedback_rating_invalid", req.Rating))
+		return
+	}
+	_, ok, err := lookupQARecord(req.RecordID)
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.qa_not_found"))
+		return
+	}
+
+	feedback := Feedback{
+		RecordID:  req.RecordID,
+		Rating:    req.Rating,
+		Comment:   strings.TrimSpace(req.Comment),
+		User:      requestUser(c),
+		Timestamp: time.Now(),
+	}
+	feedbackMu.Lock()
+	err = appendJSONLine(dataPath(feedbackFile), feedback)
+	feedbackMu.Unlock()
+	if err != nil {
+		requestLogger(c).Error("写入反馈失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+
+	recordAudit(c, auditActionFeedback, fmt.Sprintf("qa/%d", req.RecordID), req.Rating, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.feedback_recorded"),
+	})
+}
+
+// readFeedback 读取全部反馈，按问答记录ID分组
+func readFeedback() (map[int][]Feedback, error) {
+	feedbackMu.Lock()
+	defer feedbackMu.Unlock()
+
+	byRecord := map[int][]Feedback{}
+	err := readJSONLines(dataPath(feedbackFile), func(line []byte) {
+		var feedback Feedback
+		if json.Unmarshal(line, &feedback) == nil {
+			byRecord[feedback.RecordID] = append(byRecord[feedback.RecordID], feedback)
+		}
+	})
+	return byRecord, err
+}
+
+// curationQueueHandler 返回还没有审核过、收到差评的问答，最新的在前；include_flagged=true 时同时包含被自动标记的问答
+func curationQueueHandler(c *gin.Context) {
+	limit := defaultCurationLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+	includeFlagged := c.Query("include_flagged") == "true"
+
+	feedback, err := readFeedback()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_feedback"))
+		return
+	}
+	records, err := allQARecords()
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	triaged := map[int]bool{}
+	curationMu.Lock()
+	for _, example := range goldenDataset {
+		triaged[example.RecordID] = true
+	}
+	curationMu.Unlock()
+
+	items := []CurationItem{}
+	for _, record := range records {
+		if triaged[record.ID] {
+			continue
+		}
+		var negative []Feedback
+		for _, f := range feedback[record.ID] {
+			if f.Rating == feedbackRatingDown {
+				negative = append(negative, f)
+			}
+		}
+		if len(negative) > 0 || (includeFlagged && record.Flagged) {
+			items = append(items, CurationItem{Record: record, Feedback: negative})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Record.ID > items[j].Record.ID
+	})
+	total := len(items)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": items,
+	})
+}
+
+// curateHandler 审核一条问答：accept 和 edit 把问答加入标准数据集，reject 只把它移出待审核队列；
+// 再次审核同一条问答时覆盖之前的结果
+func curateHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.qa_not_found"))
+		return
+	}
+	var req CurationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	answer := strings.TrimSpace(req.Answer)
+	switch req.Action {
+	case curationActionAccept, curationActionReject:
+	case curationActionEdit:
+		if answer == "" {
+			respondError(c, http.StatusBadRequest, tr(c, "error.curation_answer_required"))
+			return
+		}
+	default:
+		respondError(c, http.StatusBadRequest, tr(c, "error.curation_action_invalid", req.Action))
+		return
+	}
+
+	record, ok, err := lookupQARecord(id)
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.qa_not_found"))
+		return
+	}
+
+	example := GoldenExample{
+		RecordID:  record.ID,
+		Question:  record.Question,
+		Answer:    record.Answer,
+		Model:     record.Model,
+		Action:    req.Action,
+		Note:      strings.TrimSpace(req.Note),
+		Tags:      splitTags(req.Tags),
+		Reviewer:  requestUser(c),
+		CuratedAt: time.Now(),
+	}
+	if req.Action == curationActionEdit {
+		example.Answer, example.OriginalAnswer = answer, record.Answer
+	}
+
+	curationMu.Lock()
+	replaced := false
+	for i := range goldenDataset {
+		if goldenDataset[i].RecordID == example.RecordID {
+			goldenDataset[i], replaced = example, true
+			break
+		}
+	}
+	if !replaced {
+		goldenDataset = append(goldenDataset, example)
+	}
+	err = saveGoldenDatasetLocked()
+	curationMu.Unlock()
+	if err != nil {
+		requestLogger(c).Error("保存标准数据集失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+
+	recordAudit(c, auditActionAdminCurationTriage, fmt.Sprintf("qa/%d", record.ID), req.Action, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.curation_saved"),
+		"example": example,
+	})
+}
+
+// goldenDatasetHandler 返回审核结果，最新的在前；可以按 action 筛选，默认只返回标准数据集中的条目
+func goldenDatasetHandler(c *gin.Context) {
+	action := c.Query("action")
+	curationMu.Lock()
+	examples := []GoldenExample{}
+	for _, example := range goldenDataset {
+		if (action == "" && example.curated()) || example.Action == action {
+			examples = append(examples, example)
+		}
+	}
+	curationMu.Unlock()
+	sort.SliceStable(examples, func(i, j int) bool {
+		return examples[i].CuratedAt.After(examples[j].CuratedAt)
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"total":    len(examples),
+		"examples": examples,
+	})
+}
+
+// exportGoldenHandler 把标准数据集导出为 JSON Lines，敏感信息始终替换为占位符
+// format 为 openai、sharegpt 时与微调数据格式相同，为 eval 时每行为问题和标准答案；tags 只导出带有其中任一标签的条目
+func exportGoldenHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", finetuneFormatOpenAI)
+	if format != finetuneFormatOpenAI && format != finetuneFormatShareGPT && format != goldenFormatEval {
+		respondError(c, http.StatusBadRequest, tr(c, "error.golden_format_invalid", format))
+		return
+	}
+	tags := splitTags(c.Query("tags"))
+	system := finetuneSystemPrompt(c.Query("system") != "false")
+
+	curationMu.Lock()
+	var examples []GoldenExample
+	for _, example := range goldenDataset {
+		if !example.curated() {
+			continue
+		}
+		if len(tags) > 0 && !containsAny(tags, example.Tags) {
+			continue
+		}
+		examples = append(examples, example)
+	}
+	curationMu.Unlock()
+	sort.SliceStable(examples, func(i, j int) bool {
+		return examples[i].RecordID < examples[j].RecordID
+	})
+
+	var b strings.Builder
+	for _, example := range examples {
+		var row interface{}
+		if format == goldenFormatEval {
+			question, answer := redactQA(example.Question, example.Answer)
+			row = goldenEvalExample{ID: example.RecordID, Question: question, IdealAnswer: answer, Tags: example.Tags}
+		} else {
+			row = finetuneExample(format, system, QARecord{Question: example.Question, Answer: example.Answer})
+		}
+		line, err := json.Marshal(row)
+		if err != nil {
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	recordAudit(c, auditActionAdminExportGolden, "golden", fmt.Sprintf("format=%s records=%d", format, len(examples)), http.StatusOK)
+	filename := fmt.Sprintf("golden-%s-%s.jsonl", format, time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("X-Record-Count", strconv.Itoa(len(examples)))
+	c.Data(http.StatusOK, batchContentType, []byte(b.String()))
+}
+
+// containsAny 判断 values 中是否有任一元素在 list 中
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		if containsString(list, v) {
+			return true
+		}
+	}
+	return false
+}
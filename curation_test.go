@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFeedbackAcceptsRecordsOlderThanRecent(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openBoltStore(filepath.Join(dir, boltDataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedDataDir, savedStore, savedRecent, savedNextID := dataDir, store, recentQAs, nextQAID
+	savedConfig := activeConfig.Load()
+	dataDir, store, recentQAs, nextQAID = dir, s, nil, 1
+	activeConfig.Store(&Config{})
+	defer func() {
+		s.Close()
+		dataDir, store, recentQAs, nextQAID = savedDataDir, savedStore, savedRecent, savedNextID
+		activeConfig.Store(savedConfig)
+	}()
+
+	// 多出一条，最早的记录只保存在数据库中
+	var records []QARecord
+	for i := 0; i <= maxRecentQAs; i++ {
+		records = append(records, addQARecord(QARecord{
+			Question:  fmt.Sprintf("问题 %d", i),
+			Answer:    fmt.Sprintf("回答 %d", i),
+			Timestamp: time.Now(),
+		}))
+	}
+	oldest := records[0]
+	if _, ok := findQARecord(oldest.ID); ok {
+		t.Fatalf("record %d is still in recentQAs", oldest.ID)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/feedback", feedbackHandler)
+	post := func(id int) int {
+		body := fmt.Sprintf(`{"record_id": %d, "rating": "down"}`, id)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(oldest.ID); code != http.StatusOK {
+		t.Errorf("feedback for record %d: status %d, want %d", oldest.ID, code, http.StatusOK)
+	}
+	if code := post(records[len(records)-1].ID + 1); code != http.StatusNotFound {
+		t.Errorf("feedback for a missing record: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	feedback, err := readFeedback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feedback[oldest.ID]) != 1 {
+		t.Errorf("got %d feedback entries for record %d, want 1", len(feedback[oldest.ID]), oldest.ID)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 摘要的周期
+const (
+	digestPeriodDaily  = "daily"
+	digestPeriodWeekly = "weekly"
+)
+
+// 摘要任务在调度器中的名称
+const digestJobName = "digest"
+
+// 未配置 cron 时的运行时间：每天或每周一早上8点
+const (
+	defaultDigestDailyCron  = "0 8 * * *"
+	defaultDigestWeeklyCron = "0 8 * * 1"
+)
+
+// 提示词中最多列出的问答和知识库条目数量，以及每条截取的字数
+const (
+	digestMaxEntries = 50
+	digestEntryRunes = 200
+)
+
+// 摘要中统计次数的事件，对话和新增知识已经从审计日志和知识库中统计
+var digestCountedEvents = []string{eventKnowledgeDeleted, eventQuotaExceeded, eventBackupFinished, eventFinetuneFinished}
+
+// 事件发生的时间只保存在内存中，重启后清空，超过周报周期的记录在写入时丢弃
+const digestEventRetention = 8 * 24 * time.Hour
+
+var (
+	digestEventsMu sync.Mutex
+	digestEvents   = map[string][]time.Time{}
+)
+
+// digestActivity 一个周期内的使用情况，来自审计日志和事件总线
+type digestActivity struct {
+	Chats    int
+	Errors   int
+	Users    map[string]bool
+	Channels map[string]int
+	Events   map[string]int
+}
+
+// countDigestEvent 事件总线的订阅者，记录 digestCountedEvents 中的事件发生的时间，供摘要统计次数
+func countDigestEvent(e Event) {
+	if !containsString(digestCountedEvents, e.Name) {
+		return
+	}
+	digestEventsMu.Lock()
+	defer digestEventsMu.Unlock()
+	times := digestEvents[e.Name]
+	cutoff := e.Timestamp.Add(-digestEventRetention)
+	for len(times) > 0 && times[0].Before(cutoff) {
+		times = times[1:]
+	}
+	digestEvents[e.Name] = append(times, e.Timestamp)
+}
+
+// digestEventCounts 返回周期内各事件发生的次数
+func digestEventCounts(start, end time.Time) map[string]int {
+	counts := map[string]int{}
+	digestEventsMu.Lock()
+	defer digestEventsMu.Unlock()
+	for name, times := range digestEvents {
+		for _, t := range times {
+			if !t.Before(start) && !t.After(end) {
+				counts[name]++
+			}
+		}
+	}
+	return counts
+}
+
+// digestJob 开启摘要时返回对应的定时任务
+func digestJob(cfg *Config) (scheduledJob, bool) {
+	d := cfg.Digest
+	if !d.Enabled {
+		return scheduledJob{}, false
+	}
+	return scheduledJob{
+		Name: digestJobName,
+		Cron: digestCron(cfg),
+		Info: gin.H{"period": digestPeriod(cfg), "model": d.Model, "save": true, "webhook": d.Webhook, "email": d.Email},
+		Run:  executeDigest,
+	}, true
+}
+
+// digestPeriod 返回摘要周期，默认每天
+func digestPeriod(cfg *Config) string {
+	if cfg.Digest.Period == digestPeriodWeekly {
+		return digestPeriodWeekly
+	}
+	return digestPeriodDaily
+}
+
+// digestCron 返回摘要任务的 cron 表达式
+func digestCron(cfg *Config) string {
+	if cfg.Digest.Cron != "" {
+		return cfg.Digest.Cron
+	}
+	if digestPeriod(cfg) == digestPeriodWeekly {
+		return defaultDigestWeeklyCron
+	}
+	return defaultDigestDailyCron
+}
+
+// executeDigest 汇总周期内的问答和新增知识，生成报告保存到知识库，并按配置发送到 webhook 和邮件
+// 周期内没有任何活动时跳过
+func executeDigest(run *ScheduleRun) error {
+	cfg := currentConfig()
+	end := run.StartedAt
+	start, kind := end.AddDate(0, 0, -1), "日报"
+	label := kind + " " + end.Format("2006-01-02")
+	if digestPeriod(cfg) == digestPeriodWeekly {
+		start, kind = end.AddDate(0, 0, -7), "周报"
+		label = fmt.Sprintf("%s %s ~ %s", kind, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+	run.Title = label
+
+	activity, err := collectDigestActivity(start, end)
+	if err != nil {
+		return err
+	}
+	records, err := qaRecordsSince(start)
+	if err != nil {
+		return err
+	}
+	var items []KnowledgeItem
+	for _, item := range knowledgeItemsSince(start) {
+		// 不把之前生成的摘要算作新增知识
+		if !containsString(item.Tags, digestJobName) {
+			items = append(items, item)
+		}
+	}
+	if activity.Chats == 0 && len(activity.Events) == 0 && len(records) == 0 && len(items) == 0 {
+		run.Skipped = true
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+	prompt := buildDigestPrompt(kind, start, end, activity, records, items)
+	resp, record, chatErr := processChat(ctx, ChatRequest{Message: prompt, Model: cfg.Digest.Model}, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": cfg.Digest.Model, "source": "digest"})
+		}
+		return errors.New(chatErr.Message)
+	}
+	run.RecordID = record.ID
+
+	tags := cfg.Digest.Tags
+	if len(tags) == 0 {
+		tags = []string{digestJobName}
+	}
+	result := scheduleResult{Schedule: digestJobName, Title: label, Content: resp.Response, Model: resp.Model, RecordID: record.ID}
+	run.KnowledgeID, run.Deliveries = deliverScheduleResult(true, tags, cfg.Digest.Webhook, cfg.Digest.Email, result)
+	for target, status := range run.Deliveries {
+		if status != "ok" {
+			return fmt.Errorf("发送到 %s 失败: %s", target, status)
+		}
+	}
+	return nil
+}
+
+// collectDigestActivity 从审计日志统计周期内各渠道的对话次数、提问用户和失败请求
+func collectDigestActivity(start, end time.Time) (digestActivity, error) {
+	activity := digestActivity{Users: map[string]bool{}, Channels: map[string]int{}, Events: digestEventCounts(start, end)}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	err := readJSONLines(dataPath(auditLogFile), func(line []byte) {
+		var entry AuditEntry
+		if json.Unmarshal(line, &entry) != nil || entry.Timestamp.Before(start) || entry.Timestamp.After(end) {
+			return
+		}
+		if entry.Action != auditActionChat && !strings.HasSuffix(entry.Action, "."+auditActionChat) {
+			return
+		}
+		activity.Chats++
+		activity.Users[entry.User] = true
+		activity.Channels[entry.Action]++
+		if entry.Status >= http.StatusBadRequest {
+			activity.Errors++
+		}
+	})
+	if err != nil {
+		return activity, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	return activity, nil
+}
+
+// buildDigestPrompt 生成让模型撰写报告的提示词，问答和知识条目过多时只列出最近的部分
+func buildDigestPrompt(kind string, start, end time.Time, activity digestActivity, records []QARecord, items []KnowledgeItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "请根据以下数据撰写一份使用情况%s（Markdown 格式），包括：概览、常见问题和主题、新增知识要点、值得关注的问题（例如失败或被标记的请求）。\n\n", kind)
+	fmt.Fprintf(&b, "统计周期：%s ~ %s\n", start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "对话次数：%d，提问用户数：%d，失败请求：%d\n", activity.Chats, len(activity.Users), activity.Errors)
+	if len(activity.Channels) > 0 {
+		channels := make([]string, 0, len(activity.Channels))
+		for action, n := range activity.Channels {
+			channels = append(channels, fmt.Sprintf("%s %d", action, n))
+		}
+		sort.Strings(channels)
+		fmt.Fprintf(&b, "各渠道：%s\n", strings.Join(channels, "，"))
+	}
+	if len(activity.Events) > 0 {
+		events := make([]string, 0, len(activity.Events))
+		for name, n := range activity.Events {
+			events = append(events, fmt.Sprintf("%s %d", name, n))
+		}
+		sort.Strings(events)
+		fmt.Fprintf(&b, "系统事件：%s\n", strings.Join(events, "，"))
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp.After(records[j].Timestamp) })
+	fmt.Fprintf(&b, "\n## 问答记录（共 %d 条", len(records))
+	if len(records) > digestMaxEntries {
+		fmt.Fprintf(&b, "，列出最近 %d 条", digestMaxEntries)
+		records = records[:digestMaxEntries]
+	}
+	b.WriteString("）\n")
+	for _, r := range records {
+		flag := ""
+		if r.Flagged {
+			flag = "（已标记）"
+		}
+		fmt.Fprintf(&b, "- [%s] %s%s\n  回答：%s\n", r.Timestamp.Format("01-02 15:04"), truncateRunes(r.Question, digestEntryRunes), flag, truncateRunes(r.Answer, digestEntryRunes))
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Timestamp.After(items[j].Timestamp) })
+	fmt.Fprintf(&b, "\n## 新增知识（共 %d 条", len(items))
+	if len(items) > digestMaxEntries {
+		fmt.Fprintf(&b, "，列出最近 %d 条", digestMaxEntries)
+		items = items[:digestMaxEntries]
+	}
+	b.WriteString("）\n")
+	for _, item := range items {
+		fmt.Fprintf(&b, "- %s [%s]：%s\n", item.Title, strings.Join(item.Tags, ","), truncateRunes(item.Content, digestEntryRunes))
+	}
+	return b.String()
+}
+
+// truncateRunes 把文本压成一行并截取前 n 个字
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
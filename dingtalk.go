@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 钉钉机器人接收消息的方式
+const (
+	dingtalkModeOutgoing = "outgoing"
+	dingtalkModeStream   = "stream"
+)
+
+// Stream 模式建立连接的接口和机器人消息的主题
+const (
+	dingtalkStreamOpenURL = "https://api.dingtalk.com/v1.0/gateway/connections/open"
+	dingtalkTopicBotMsg   = "/v1.0/im/bot/messages/get"
+)
+
+// 回调请求的时间戳与当前时间最多相差多久，超过视为重放
+const dingtalkMaxClockSkew = 5 * time.Minute
+
+// sessionWebhook 只能指向钉钉的接口，签名不覆盖请求体，不能信任回调中的任意地址
+var dingtalkWebhookHosts = []string{"oapi.dingtalk.com", "api.dingtalk.com"}
+
+// Stream 连接断开后重新连接的间隔
+const dingtalkReconnectDelay = 5 * time.Second
+
+// 审计日志中的钉钉操作
+const auditActionDingTalkChat = "dingtalk.chat"
+
+var dingtalkHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// dingtalkMessage 机器人收到的消息，两种模式的格式相同
+type dingtalkMessage struct {
+	MsgType string `json:"msgtype"`
+	Text    struct {
+		Content string `json:"content"`
+	} `json:"text"`
+	ConversationID   string `json:"conversationId"`
+	ConversationType string `json:"conversationType"` // 1 单聊，2 群聊
+	SenderNick       string `json:"senderNick"`
+	SenderStaffID    string `json:"senderStaffId"`
+	SessionWebhook   string `json:"sessionWebhook"`
+	// 毫秒时间戳，过期后不能再通过 SessionWebhook 回复
+	SessionWebhookExpiredTime int64 `json:"sessionWebhookExpiredTime"`
+}
+
+// dingtalkFrame Stream 模式收发的数据帧
+type dingtalkFrame struct {
+	SpecVersion string            `json:"specVersion,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Code        int               `json:"code,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Headers     map[string]string `json:"headers"`
+	Data        string            `json:"data"`
+}
+
+// setupDingTalk 启用钉钉机器人，outgoing 模式下注册消息回调地址，stream 模式下建立长连接
+func setupDingTalk(r *gin.Engine, cfg *Config) {
+	if !cfg.DingTalk.Enabled {
+		return
+	}
+	if cfg.DingTalk.Mode == dingtalkModeStream {
+		go runDingTalkStream()
+		slog.Info("钉钉机器人已启用", "mode", dingtalkModeStream)
+		return
+	}
+	r.POST("/dingtalk/robot", dingtalkOutgoingHandler)
+	slog.Info("钉钉机器人已启用", "mode", dingtalkModeOutgoing, "path", "/dingtalk/robot")
+}
+
+// dingtalkOutgoingHandler 接收 outgoing 回调，校验签名后立即返回，回答通过 sessionWebhook 发送
+func dingtalkOutgoingHandler(c *gin.Context) {
+	if !dingtalkSignatureValid(currentConfig(), c.GetHeader("timestamp"), c.GetHeader("sign")) {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "钉钉签名无效", http.StatusUnauthorized)
+		respondError(c, http.StatusUnauthorized, tr(c, "error.signature_invalid"))
+		return
+	}
+	var msg dingtalkMessage
+	if err := c.ShouldBindJSON(&msg); err != nil {
+		respondError(c, http.StatusBadRequest, tr(c, "error.invalid_message"))
+		return
+	}
+	if !dingtalkSessionWebhookValid(msg.SessionWebhook) {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "sessionWebhook 不是钉钉的地址", http.StatusBadRequest)
+		respondError(c, http.StatusBadRequest, tr(c, "error.dingtalk_webhook_invalid"))
+		return
+	}
+	go handleDingTalkMessage(msg)
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// dingtalkSignatureValid 校验回调签名：Base64(HmacSHA256(timestamp + "\n" + AppSecret))
+func dingtalkSignatureValid(cfg *Config, timestamp, sign string) bool {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sign == "" {
+		return false
+	}
+	if skew := time.Since(time.UnixMilli(ms)); skew > dingtalkMaxClockSkew || skew < -dingtalkMaxClockSkew {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.DingTalk.AppSecret))
+	mac.Write([]byte(timestamp + "\n" + cfg.DingTalk.AppSecret))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(sign)) == 1
+}
+
+// dingtalkSessionWebhookValid 判断 sessionWebhook 是否为钉钉接口的 https 地址
+func dingtalkSessionWebhookValid(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return false
+	}
+	return containsString(dingtalkWebhookHosts, strings.ToLower(u.Hostname()))
+}
+
+// runDingTalkStream 通过 Stream 模式接收机器人消息，连接断开后自动重连
+func runDingTalkStream() {
+	for {
+		if err := dingtalkStreamOnce(); err != nil {
+			slog.Warn("钉钉 Stream 连接断开，稍后重试", "error", err)
+		}
+		time.Sleep(dingtalkReconnectDelay)
+	}
+}
+
+// dingtalkStreamOnce 申请连接地址并处理一次连接中的数据帧，直到连接断开
+func dingtalkStreamOnce() error {
+	endpoint, err := openDingTalkStream()
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("连接钉钉 Stream 失败: %w", err)
+	}
+	defer conn.Close()
+	slog.Info("已连接钉钉 Stream")
+
+	for {
+		var frame dingtalkFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			return err
+		}
+		topic := frame.Headers["topic"]
+		switch {
+		case frame.Type == "SYSTEM" && topic == "ping":
+			err = conn.WriteJSON(dingtalkFrame{Code: http.StatusOK, Message: "OK", Headers: frame.Headers, Data: frame.Data})
+		case frame.Type == "SYSTEM" && topic == "disconnect":
+			return errors.New("服务端要求断开连接")
+		case frame.Type == "CALLBACK" && topic == dingtalkTopicBotMsg:
+			var msg dingtalkMessage
+			if json.Unmarshal([]byte(frame.Data), &msg) == nil {
+				go handleDingTalkMessage(msg)
+			}
+			err = conn.WriteJSON(dingtalkFrame{
+				Code:    http.StatusOK,
+				Message: "OK",
+				Headers: map[string]string{"contentType": "application/json", "messageId": frame.Headers["messageId"]},
+				Data:    `{"response":null}`,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openDingTalkStream 使用应用凭证申请 Stream 连接，返回带 ticket 的连接地址
+func openDingTalkStream() (string, error) {
+	cfg := currentConfig()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"clientId":      cfg.DingTalk.AppKey,
+		"clientSecret":  cfg.DingTalk.AppSecret,
+		"subscriptions": []map[string]string{{"type": "CALLBACK", "topic": dingtalkTopicBotMsg}},
+		"ua":            "ai-assistant/" + version,
+	})
+	resp, err := dingtalkHTTPClient.Post(dingtalkStreamOpenURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("申请钉钉 Stream 连接失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Endpoint string `json:"endpoint"`
+		Ticket   string `json:"ticket"`
+		Message  string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.Endpoint == "" {
+		return "", fmt.Errorf("申请钉钉 Stream 连接失败: %s %s", resp.Status, result.Message)
+	}
+	return result.Endpoint + "?ticket=" + url.QueryEscape(result.Ticket), nil
+}
+
+// handleDingTalkMessage 把单聊消息和群聊中 @机器人的消息交给与 /api/v1/chat 相同的处理流程，以 markdown 回复
+func handleDingTalkMessage(msg dingtalkMessage) {
+	if !dingtalkSessionWebhookValid(msg.SessionWebhook) {
+		slog.Warn("钉钉消息的 sessionWebhook 不是钉钉的地址，忽略该消息", "conversation", msg.ConversationID)
+		return
+	}
+	cfg := currentConfig()
+	user := msg.SenderStaffID
+	if user == "" {
+		user = msg.SenderNick
+	}
+
+	content := strings.TrimSpace(msg.Text.Content)
+	if msg.MsgType != "text" || content == "" {
+		replyDingTalk(msg, "提示", "目前只支持文字提问，请 @我 并输入问题。")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+
+	req := ChatRequest{Message: content, Model: cfg.DingTalk.Model, Workspace: cfg.DingTalk.Workspace, User: "dingtalk:" + user}
+	resp, record, chatErr := processChat(ctx, req, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			slog.Error("调用模型失败", "source", "dingtalk", "error", chatErr.Err)
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": cfg.DingTalk.Model, "source": "dingtalk"})
+		}
+		dingtalkAudit(user, msg.ConversationID, chatErr.Message, chatErr.Status)
+		replyDingTalk(msg, "处理失败", "抱歉，处理失败："+chatErr.Message)
+		return
+	}
+	dingtalkAudit(user, msg.ConversationID, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+
+	replyDingTalk(msg, askDefaultTitle(content), resp.Response+"\n\n> "+resp.Model)
+}
+
+// replyDingTalk 通过消息中的 sessionWebhook 回复 markdown 消息，群聊中 @提问的成员
+func replyDingTalk(msg dingtalkMessage, title, text string) {
+	if !dingtalkSessionWebhookValid(msg.SessionWebhook) {
+		return
+	}
+	if msg.SessionWebhookExpiredTime > 0 && time.Now().After(time.UnixMilli(msg.SessionWebhookExpiredTime)) {
+		slog.Warn("钉钉会话已过期，无法回复", "conversation", msg.ConversationID)
+		return
+	}
+
+	body := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": title, "text": text},
+	}
+	if msg.ConversationType == "2" && msg.SenderStaffID != "" {
+		body["markdown"] = map[string]string{"title": title, "text": "@" + msg.SenderStaffID + "\n\n" + text}
+		body["at"] = map[string]interface{}{"atUserIds": []string{msg.SenderStaffID}}
+	}
+	payload, _ := json.Marshal(body)
+
+	resp, err := dingtalkHTTPClient.Post(msg.SessionWebhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("发送钉钉消息失败", "conversation", msg.ConversationID, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.ErrCode != 0 {
+		slog.Error("发送钉钉消息失败", "conversation", msg.ConversationID, "errcode", result.ErrCode, "errmsg", result.ErrMsg)
+	}
+}
+
+// dingtalkAudit 记录钉钉操作的审计日志，用户为 dingtalk:<员工ID>
+func dingtalkAudit(user, conversation, detail string, status int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      "dingtalk:" + user,
+		Action:    auditActionDingTalkChat,
+		Resource:  conversation,
+		Detail:    detail,
+		Status:    status,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDingTalkSessionWebhookRejectsOtherHosts(t *testing.T) {
+	valid := []string{
+		"https://oapi.dingtalk.com/robot/sendBySession?session=abc",
+		"https://api.dingtalk.com/v1.0/robot/sendBySession?session=abc",
+	}
+	for _, u := range valid {
+		if !dingtalkSessionWebhookValid(u) {
+			t.Errorf("dingtalkSessionWebhookValid(%q) = false, want true", u)
+		}
+	}
+	invalid := []string{
+		"",
+		"http://oapi.dingtalk.com/robot/sendBySession",
+		"https://evil.example.com/robot/sendBySession",
+		"https://oapi.dingtalk.com.evil.example.com/robot",
+		"https://127.0.0.1/robot",
+		"https://169.254.169.254/latest/meta-data",
+		"https://oapi.dingtalk.com:8443/robot",
+		"https://user@oapi.dingtalk.com/robot",
+	}
+	for _, u := range invalid {
+		if dingtalkSessionWebhookValid(u) {
+			t.Errorf("dingtalkSessionWebhookValid(%q) = true, want false", u)
+		}
+	}
+}
+
+func TestDingTalkSignatureRejectsExpiredTimestamp(t *testing.T) {
+	cfg := &Config{}
+	cfg.DingTalk.AppSecret = "secret"
+	sign := func(ts string) string {
+		mac := hmac.New(sha256.New, []byte(cfg.DingTalk.AppSecret))
+		mac.Write([]byte(ts + "\n" + cfg.DingTalk.AppSecret))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if !dingtalkSignatureValid(cfg, now, sign(now)) {
+		t.Fatal("current timestamp with a valid signature was rejected")
+	}
+	for _, offset := range []time.Duration{-dingtalkMaxClockSkew - time.Minute, dingtalkMaxClockSkew + time.Minute, -time.Hour} {
+		ts := strconv.FormatInt(time.Now().Add(offset).UnixMilli(), 10)
+		if dingtalkSignatureValid(cfg, ts, sign(ts)) {
+			t.Errorf("timestamp offset %v was accepted", offset)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+)
+
+// 默认的收件箱检查间隔
+const defaultEmailPollInterval = time.Minute
+
+// 每次检查最多处理的邮件数量，其余的留到下一次
+const maxEmailsPerPoll = 20
+
+// 邮件正文最多读取的字节数
+const maxEmailBodyBytes = 1 << 20
+
+// 审计日志中的邮件操作
+const (
+	auditActionEmailChat = "email.chat"
+	auditActionEmailSave = "email.knowledge.add"
+)
+
+// incomingEmail 收到的提问邮件
+type incomingEmail struct {
+	From       string
+	Subject    string
+	Body       string
+	MessageID  string
+	References []string
+}
+
+// emailPollInterval 返回收件箱检查间隔
+func emailPollInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Email.PollInterval); err == nil && d > 0 {
+		return d
+	}
+	return defaultEmailPollInterval
+}
+
+// emailIMAPUsername 返回登录 IMAP 的用户名，默认为邮箱地址
+func emailIMAPUsername(cfg *Config) string {
+	if cfg.Email.IMAP.Username != "" {
+		return cfg.Email.IMAP.Username
+	}
+	return cfg.Email.Address
+}
+
+// startEmailGateway 启用邮件网关，定期检查收件箱并回复新邮件
+func startEmailGateway(cfg *Config) {
+	if !cfg.Email.Enabled {
+		return
+	}
+	go func() {
+		for {
+			// 只读模式下邮件留在收件箱中，关闭后再回复
+			if readOnly(currentConfig()) {
+				slog.Debug("服务处于只读模式，暂不检查邮件")
+			} else if err := pollEmails(); err != nil {
+				slog.Error("检查邮件失败", "error", err)
+			}
+			time.Sleep(emailPollInterval(currentConfig()))
+		}
+	}()
+	slog.Info("邮件网关已启用", "address", cfg.Email.Address, "interval", emailPollInterval(cfg).String())
+}
+
+// pollEmails 取出收件箱中的未读邮件逐封回答
+// 取邮件时服务器即把邮件标记为已读，处理失败的邮件不会重复回复
+func pollEmails() error {
+	emails, err := fetchUnseenEmails(currentConfig())
+	if err != nil {
+		return err
+	}
+	for _, e := range emails {
+		handleEmail(e)
+	}
+	return nil
+}
+
+// fetchUnseenEmails 登录 IMAP 服务器，读取未读邮件
+func fetchUnseenEmails(cfg *Config) ([]incomingEmail, error) {
+	c, err := client.DialTLS(cfg.Email.IMAP.Addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("连接 IMAP 服务器失败: %w", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login(emailIMAPUsername(cfg), cfg.Email.IMAP.Password); err != nil {
+		return nil, fmt.Errorf("登录 IMAP 服务器失败: %w", err)
+	}
+	mailbox := cfg.Email.IMAP.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := c.Select(mailbox, false); err != nil {
+		return nil, fmt.Errorf("打开邮箱 %s 失败: %w", mailbox, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("搜索未读邮件失败: %w", err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	if len(uids) > maxEmailsPerPoll {
+		uids = uids[:maxEmailsPerPoll]
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{}
+	messages := make(chan *imap.Message, len(uids))
+	if err := c.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages); err != nil {
+		return nil, fmt.Errorf("读取邮件失败: %w", err)
+	}
+
+	var emails []incomingEmail
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		e, err := parseEmail(body)
+		if err != nil {
+			slog.Warn("无法解析邮件", "uid", msg.Uid, "error", err)
+			continue
+		}
+		if e != nil {
+			emails = append(emails, *e)
+		}
+	}
+	return emails, nil
+}
+
+// parseEmail 解析邮件的发件人、主题和纯文本正文，自动回复的邮件返回 nil，避免互相回复
+func parseEmail(r io.Reader) (*incomingEmail, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer mr.Close()
+
+	if v := mr.Header.Get("Auto-Submitted"); v != "" && v != "no" {
+		return nil, nil
+	}
+	from, err := mr.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, fmt.Errorf("缺少发件人")
+	}
+	e := &incomingEmail{From: from[0].Address}
+	e.Subject, _ = mr.Header.Subject()
+	e.MessageID, _ = mr.Header.MessageID()
+	e.References, _ = mr.Header.MsgIDList("References")
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		h, ok := part.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+		if ct, _, _ := h.ContentType(); ct != "text/plain" && ct != "" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part.Body, maxEmailBodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		e.Body = stripQuotedLines(string(data))
+		break
+	}
+	return e, nil
+}
+
+// stripQuotedLines 去掉回复邮件中以 > 开头的引用内容
+func stripQuotedLines(body string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// emailSenderAllowed 检查发件人是否在 email.allowed_senders 中，以 @ 开头的项匹配整个域名，列表为空时允许所有人
+func emailSenderAllowed(cfg *Config, from string) bool {
+	if len(cfg.Email.AllowedSenders) == 0 {
+		return true
+	}
+	from = strings.ToLower(from)
+	for _, allowed := range cfg.Email.AllowedSenders {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if from == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(from, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleEmail 把邮件正文作为问题交给与 /api/v1/chat 相同的处理流程，回答通过 SMTP 回复给发件人
+// 开启 email.archive 时，以邮件主题为标题把回答保存到知识库
+func handleEmail(e incomingEmail) {
+	cfg := currentConfig()
+	if strings.EqualFold(e.From, cfg.Email.Address) {
+		return
+	}
+	if !emailSenderAllowed(cfg, e.From) {
+		emailAudit(e.From, auditActionEmailChat, e.Subject, "发件人不在允许列表中", http.StatusForbidden)
+		slog.Warn("忽略不在允许列表中的发件人", "from", e.From)
+		return
+	}
+
+	question := e.Body
+	if question == "" {
+		question = strings.TrimSpace(e.Subject)
+	}
+	if question == "" {
+		return
+	}
+	if max := maxMessageChars(cfg); max > 0 && utf8.RuneCountInString(question) > max {
+		emailAudit(e.From, auditActionEmailChat, e.Subject, "问题过长", http.StatusRequestEntityTooLarge)
+		sendEmailReply(e, fmt.Sprintf("抱歉，问题过长，最多允许 %d 个字符。", max))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+
+	req := ChatRequest{Message: question, Model: cfg.Email.Model, Workspace: cfg.Email.Workspace, User: "email:" + e.From}
+	resp, record, chatErr := processChat(ctx, req, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			slog.Error("调用模型失败", "source", "email", "error", chatErr.Err)
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": cfg.Email.Model, "source": "email"})
+		}
+		emailAudit(e.From, auditActionEmailChat, e.Subject, chatErr.Message, chatErr.Status)
+		sendEmailReply(e, "抱歉，处理失败："+chatErr.Message)
+		return
+	}
+	emailAudit(e.From, auditActionEmailChat, e.Subject, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+
+	text := resp.Response
+	if cfg.Email.Archive {
+		title := strings.TrimSpace(e.Subject)
+		if title == "" {
+			title = askDefaultTitle(question)
+		}
+		item, err := addKnowledgeItem(KnowledgeItem{
+			Title:     title,
+			Content:   record.Answer,
+			Model:     record.Model,
+			Timestamp: time.Now(),
+			Tags:      []string{"email"},
+		})
+		if err != nil {
+			emailAudit(e.From, auditActionEmailSave, "knowledge", err.Error(), http.StatusForbidden)
+			text += "\n\n未能保存到知识库：" + err.Error()
+		} else {
+			emailAudit(e.From, auditActionEmailSave, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+			text += fmt.Sprintf("\n\n已保存到知识库（ID %d）", item.ID)
+		}
+	}
+	text += "\n\n-- \n" + resp.Model
+	sendEmailReply(e, text)
+}
+
+// sendEmailReply 通过 SMTP 回复邮件，保留邮件串的引用关系
+func sendEmailReply(e incomingEmail, text string) {
+	subject := strings.TrimSpace(e.Subject)
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	var h mail.Header
+	if e.MessageID != "" {
+		h.SetMsgIDList("In-Reply-To", []string{e.MessageID})
+		h.SetMsgIDList("References", append(e.References, e.MessageID))
+	}
+	h.Set("Auto-Submitted", "auto-replied")
+	if err := sendEmail([]string{e.From}, subject, text, h); err != nil {
+		slog.Error("发送回复邮件失败", "to", e.From, "error", err)
+	}
+}
+
+// sendEmail 以 email.address 为发件人通过 SMTP 发送纯文本邮件，h 中可以预先设置额外的邮件头
+// 服务器支持时使用 STARTTLS
+func sendEmail(to []string, subject, text string, h mail.Header) error {
+	cfg := currentConfig()
+
+	addrs := make([]*mail.Address, len(to))
+	for i, addr := range to {
+		addrs[i] = &mail.Address{Address: addr}
+	}
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Address: cfg.Email.Address}})
+	h.SetAddressList("To", addrs)
+	h.SetSubject(subject)
+	h.GenerateMessageID()
+	h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var buf bytes.Buffer
+	w, err := mail.CreateSingleInlineWriter(&buf, h)
+	if err == nil {
+		io.WriteString(w, text)
+		err = w.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("生成邮件失败: %w", err)
+	}
+
+	username, password := cfg.Email.SMTP.Username, cfg.Email.SMTP.Password
+	if username == "" {
+		username, password = emailIMAPUsername(cfg), cfg.Email.IMAP.Password
+	}
+	// 没有密码时不认证，适用于内网邮件中继
+	var auth smtp.Auth
+	if password != "" {
+		host, _, _ := net.SplitHostPort(cfg.Email.SMTP.Addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return smtp.SendMail(cfg.Email.SMTP.Addr, auth, cfg.Email.Address, to, buf.Bytes())
+}
+
+// emailAudit 记录邮件操作的审计日志，用户为 email:<发件人地址>
+func emailAudit(from, action, resource, detail string, status int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      "email:" + from,
+		Action:    action,
+		Resource:  resource,
+		Detail:    detail,
+		Status:    status,
+	})
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审计日志中的向量操作
+const (
+	auditActionEmbeddings        = "embeddings"
+	auditActionGatewayEmbeddings = "gateway.embeddings"
+)
+
+// 未配置时每批发给上游的条数、单次请求最多的条数和缓存的向量条数
+const (
+	defaultEmbeddingBatchSize = 64
+	defaultEmbeddingMaxInputs = 256
+	defaultEmbeddingCacheSize = 10000
+)
+
+// 向量缓存，键为模型和文本的哈希，超出容量时先淘汰最早加入的条目
+var (
+	embeddingCacheMu    sync.Mutex
+	embeddingCache      = map[string][]float32{}
+	embeddingCacheOrder []string
+)
+
+// EmbeddingsRequest 向量请求
+type EmbeddingsRequest struct {
+	Input []string `json:"input" binding:"required"`
+	// 为空时使用 embeddings.model，指定时必须与其相同
+	Model string `json:"model"`
+}
+
+// EmbeddingVector 一段文本的向量
+type EmbeddingVector struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingsResponse 向量结果
+type EmbeddingsResponse struct {
+	Model string            `json:"model"`
+	Data  []EmbeddingVector `json:"data"`
+	// 命中缓存、没有请求上游的条数
+	Cached int         `json:"cached"`
+	Usage  *TokenUsage `json:"usage,omitempty"`
+}
+
+// embeddingsHandler 为一组文本生成向量，命中缓存的文本不再请求上游
+func embeddingsHandler(c *gin.Context) {
+	cfg := currentConfig()
+	if cfg.Embeddings.Model == "" {
+		respondError(c, http.StatusServiceUnavailable, tr(c, "error.embeddings_disabled"))
+		return
+	}
+	var req EmbeddingsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Model == "" {
+		req.Model = cfg.Embeddings.Model
+	}
+	if req.Model != cfg.Embeddings.Model {
+		respondError(c, http.StatusBadRequest, tr(c, "error.model_unavailable", req.Model))
+		return
+	}
+	if msgKey, limit := checkEmbeddingInputs(cfg, req.Input); msgKey != "" {
+		respondError(c, http.StatusBadRequest, tr(c, msgKey, limit))
+		return
+	}
+	for _, text := range req.Input {
+		if !checkMessageLength(c, text) {
+			return
+		}
+	}
+	c.Set("model", req.Model)
+
+	vectors, usage, cached, err := embedTexts(c.Request.Context(), req.Model, req.Input)
+	if err != nil {
+		if respondDisconnected(c, err) {
+			return
+		}
+		requestLogger(c).Error("调用向量模型失败", "error", err)
+		reportError(c, "upstream", err, "", map[string]interface{}{"model": req.Model, "source": "embeddings"})
+		respondError(c, http.StatusBadGateway, tr(c, "error.embeddings_failed", err))
+		return
+	}
+	recordAudit(c, auditActionEmbeddings, req.Model, fmt.Sprintf("inputs=%d cached=%d", len(req.Input), cached), http.StatusOK)
+
+	data := make([]EmbeddingVector, len(vectors))
+	for i, v := range vectors {
+		data[i] = EmbeddingVector{Index: i, Embedding: v}
+	}
+	c.JSON(http.StatusOK, EmbeddingsResponse{Model: req.Model, Data: data, Cached: cached, Usage: usage})
+}
+
+// gatewayEmbeddingsHandler 以 OpenAI 格式提供 /v1/embeddings，计入网关密钥的配额
+func gatewayEmbeddingsHandler(c *gin.Context) {
+	cfg := currentConfig()
+	key := c.MustGet("gateway_key").(GatewayKey)
+	if cfg.Embeddings.Model == "" {
+		respondOpenAIError(c, http.StatusNotFound, "not_found", tr(c, "error.embeddings_disabled"))
+		return
+	}
+
+	var req struct {
+		Input json.RawMessage `json:"input"`
+		Model string          `json:"model"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	inputs, err := parseEmbeddingInput(req.Input)
+	if err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", tr(c, "error.embeddings_input_invalid"))
+		return
+	}
+	if req.Model == "" {
+		req.Model = cfg.Embeddings.Model
+	}
+	if req.Model != cfg.Embeddings.Model || (len(key.Models) > 0 && !containsString(key.Models, req.Model)) {
+		respondOpenAIError(c, http.StatusNotFound, "model_not_found", tr(c, "error.model_unavailable", req.Model))
+		return
+	}
+	if msgKey, limit := checkEmbeddingInputs(cfg, inputs); msgKey != "" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", tr(c, msgKey, limit))
+		return
+	}
+	c.Set("model", req.Model)
+
+	if msgKey, limit := checkGatewayQuota(key); msgKey != "" {
+		msg := translate(defaultLocale(cfg), msgKey, limit)
+		recordAudit(c, auditActionGatewayEmbeddings, req.Model, msg, http.StatusTooManyRequests)
+		publishEvent(eventQuotaExceeded, gin.H{"key": key.Name, "model": req.Model, "message": msg})
+		respondOpenAIError(c, http.StatusTooManyRequests, "rate_limit_exceeded", tr(c, msgKey, limit))
+		return
+	}
+
+	vectors, usage, cached, err := embedTexts(c.Request.Context(), req.Model, inputs)
+	if err != nil {
+		if generationCancelled(c.Request.Context()) {
+			requestLogger(c).Info("客户端已断开，上游请求已中断", "error", err)
+			respondOpenAIError(c, statusClientClosedRequest, "request_cancelled", tr(c, "error.generation_cancelled"))
+			return
+		}
+		requestLogger(c).Error("调用向量模型失败", "error", err)
+		reportError(c, "upstream", err, "", map[string]interface{}{"model": req.Model, "source": "gateway.embeddings"})
+		recordAudit(c, auditActionGatewayEmbeddings, req.Model, err.Error(), http.StatusBadGateway)
+		respondOpenAIError(c, http.StatusBadGateway, "upstream_error", err.Error())
+		return
+	}
+	addGatewayUsage(key, usage.TotalTokens)
+	recordAudit(c, auditActionGatewayEmbeddings, req.Model, fmt.Sprintf("inputs=%d cached=%d tokens=%d", len(inputs), cached, usage.TotalTokens), http.StatusOK)
+
+	data := make([]openai.Embedding, len(vectors))
+	for i, v := range vectors {
+		data[i] = openai.Embedding{Object: "embedding", Embedding: v, Index: i}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+		"model":  req.Model,
+		"usage":  gin.H{"prompt_tokens": usage.PromptTokens, "total_tokens": usage.TotalTokens},
+	})
+}
+
+// parseEmbeddingInput 解析 OpenAI 格式的 input，可以是一个字符串或字符串数组
+func parseEmbeddingInput(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// checkEmbeddingInputs 检查条数和空文本，不通过时返回提示信息的消息ID和对应的参数
+func checkEmbeddingInputs(cfg *Config, inputs []string) (string, int) {
+	maxInputs := cfg.Embeddings.MaxInputs
+	if maxInputs <= 0 {
+		maxInputs = defaultEmbeddingMaxInputs
+	}
+	if len(inputs) == 0 || len(inputs) > maxInputs {
+		return "error.embeddings_input_count", maxInputs
+	}
+	for i, text := range inputs {
+		if text == "" {
+			return "error.embeddings_input_empty", i
+		}
+	}
+	return "", 0
+}
+
+// embedTexts 返回每段文本的向量和命中缓存的条数，未命中的文本按 embeddings.batch_size 分批请求上游
+// 用量计入 embeddings
+func embedTexts(ctx context.Context, model string, inputs []string) ([][]float32, *TokenUsage, int, error) {
+	vectors := make([][]float32, len(inputs))
+	var missing []int
+	for i, text := range inputs {
+		if v, ok := lookupEmbedding(model, text); ok {
+			vectors[i] = v
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	batchSize := currentConfig().Embeddings.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultEmbeddingBatchSize
+	}
+	usage := &TokenUsage{}
+	client := newOpenAIClient()
+	for start := 0; start < len(missing); start += batchSize {
+		batch := missing[start:min(start+batchSize, len(missing))]
+		texts := make([]string, len(batch))
+		for j, i := range batch {
+			texts[j] = inputs[i]
+		}
+		resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{Input: texts, Model: openai.EmbeddingModel(model)})
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(resp.Data) != len(texts) {
+			return nil, nil, 0, fmt.Errorf("上游返回了 %d 个向量，应为 %d 个", len(resp.Data), len(texts))
+		}
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(batch) {
+				return nil, nil, 0, fmt.Errorf("上游返回的向量序号无效: %d", d.Index)
+			}
+			i := batch[d.Index]
+			vectors[i] = d.Embedding
+			storeEmbedding(model, inputs[i], d.Embedding)
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+	}
+	if len(missing) > 0 {
+		recordFeatureUsage(usageFeatureEmbeddings, model, usage)
+	}
+	return vectors, usage, len(inputs) - len(missing), nil
+}
+
+// embeddingCacheKey 根据模型和文本计算缓存键
+func embeddingCacheKey(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupEmbedding 查找缓存的向量
+func lookupEmbedding(model, text string) ([]float32, bool) {
+	embeddingCacheMu.Lock()
+	defer embeddingCacheMu.Unlock()
+	v, ok := embeddingCache[embeddingCacheKey(model, text)]
+	return v, ok
+}
+
+// storeEmbedding 缓存向量，超出 embeddings.cache_size 时淘汰最早的条目
+func storeEmbedding(model, text string, v []float32) {
+	size := currentConfig().Embeddings.CacheSize
+	if size < 0 {
+		return
+	}
+	if size == 0 {
+		size = defaultEmbeddingCacheSize
+	}
+
+	embeddingCacheMu.Lock()
+	defer embeddingCacheMu.Unlock()
+	key := embeddingCacheKey(model, text)
+	if _, ok := embeddingCache[key]; ok {
+		return
+	}
+	embeddingCache[key] = v
+	embeddingCacheOrder = append(embeddingCacheOrder, key)
+	for len(embeddingCacheOrder) > size {
+		delete(embeddingCache, embeddingCacheOrder[0])
+		embeddingCacheOrder = embeddingCacheOrder[1:]
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 加密数据文件的文件头
+var encryptedDataMagic = []byte("AIAENC1\n")
+
+// 密钥缺失或不正确，无法解密数据
+var errDataKey = errors.New("无法解密数据")
+
+// 数据文件的加密密钥，启动时由 setupDataEncryption 设置，为空表示不加密
+var dataKey []byte
+
+// parseDataKey 解析 storage.encryption_key，支持 base64 或十六进制编码的32字节密钥
+func parseDataKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("需要 base64 或十六进制编码的32字节密钥，可以用 openssl rand -base64 32 生成")
+}
+
+// setupDataEncryption 根据配置启用数据文件加密
+func setupDataEncryption(cfg *Config) error {
+	if cfg.Storage.EncryptionKey == "" {
+		return nil
+	}
+	key, err := parseDataKey(cfg.Storage.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("storage.encryption_key 无效: %w", err)
+	}
+	dataKey = key
+	return nil
+}
+
+// dataCipher 返回数据加密使用的AES-256-GCM
+func dataCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptData 启用加密时加密数据，格式为 文件头 + nonce + 密文，未启用时原样返回
+func encryptData(data []byte) ([]byte, error) {
+	if dataKey == nil {
+		return data, nil
+	}
+	gcm, err := dataCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedDataMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedDataMagic), nil
+}
+
+// decryptData 解密带文件头的加密数据，未加密的数据原样返回，便于开启加密后读取原有的明文文件
+func decryptData(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedDataMagic) {
+		return data, nil
+	}
+	if dataKey == nil {
+		return nil, fmt.Errorf("%w: 数据文件已加密，需要配置 storage.encryption_key", errDataKey)
+	}
+	gcm, err := dataCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	rest := data[len(encryptedDataMagic):]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("加密数据格式错误")
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], encryptedDataMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 密钥可能不正确", errDataKey)
+	}
+	return plaintext, nil
+}
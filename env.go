@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// 环境变量前缀
+const envPrefix = "AI_ASSISTANT_"
+
+// 匹配 ${VAR} 和 ${VAR:-默认值}
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnvRefs 展开配置文件内容中的环境变量引用
+// 只处理 ${VAR} 形式，避免误伤值中出现的普通 $ 字符
+func expandEnvRefs(data []byte) []byte {
+	return envRefPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		groups := envRefPattern.FindSubmatch(match)
+		if value, ok := os.LookupEnv(string(groups[1])); ok {
+			return []byte(value)
+		}
+		return groups[2]
+	})
+}
+
+// applyEnvOverrides 用 AI_ASSISTANT_* 环境变量覆盖配置文件中的值
+func applyEnvOverrides(cfg *Config) {
+	overrides := map[string]*string{
+		"PROVIDER":      &cfg.API.Provider,
+		"API_KEY":       &cfg.API.APIKey,
+		"BASE_URL":      &cfg.API.BaseURL,
+		"RECORDING":     &cfg.API.Recording.Mode,
+		"HOST":          &cfg.Server.Host,
+		"PORT":          &cfg.Server.Port,
+		"LISTEN":        &cfg.Server.Listen,
+		"DEFAULT_MODEL": &cfg.Models.Default,
+		"ADMIN_TOKEN":   &cfg.Admin.Token,
+		"LOG_LEVEL":     &cfg.Logging.Level,
+		"LOG_FORMAT":    &cfg.Logging.Format,
+		"DATA_DIR":      &cfg.Storage.DataDir,
+		"DATA_KEY":      &cfg.Storage.EncryptionKey,
+		"DATABASE_URL":  &cfg.Storage.DSN,
+	}
+	for name, field := range overrides {
+		if value, ok := os.LookupEnv(envPrefix + name); ok {
+			*field = value
+		}
+	}
+
+	// 端口允许只写数字
+	if cfg.Server.Port != "" && !strings.HasPrefix(cfg.Server.Port, ":") {
+		cfg.Server.Port = ":" + cfg.Server.Port
+	}
+}
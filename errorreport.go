@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 错误上报的HTTP超时
+const errorReportTimeout = 5 * time.Second
+
+var errorReportClient = &http.Client{Timeout: errorReportTimeout}
+
+// ErrorReport 上报的错误事件
+type ErrorReport struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Kind        string                 `json:"kind"`
+	Message     string                 `json:"message"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release"`
+	RequestID   string                 `json:"request_id,omitempty"`
+	Method      string                 `json:"method,omitempty"`
+	Path        string                 `json:"path,omitempty"`
+	User        string                 `json:"user,omitempty"`
+	ClientIP    string                 `json:"client_ip,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// reportError 异步上报错误，附带请求上下文
+// kind用于区分错误来源，例如panic、upstream
+func reportError(c *gin.Context, kind string, err error, stack string, extra map[string]interface{}) {
+	cfg := currentConfig().ErrorReporting
+	if !cfg.Enabled {
+		return
+	}
+
+	report := ErrorReport{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC(),
+		Level:       "error",
+		Kind:        kind,
+		Message:     err.Error(),
+		Environment: cfg.Environment,
+		Release:     version,
+		Stack:       stack,
+		Extra:       extra,
+	}
+	if c != nil {
+		report.RequestID = requestID(c)
+		report.Method = c.Request.Method
+		report.Path = c.Request.URL.Path
+		report.User = requestUser(c)
+		report.ClientIP = c.ClientIP()
+	}
+
+	go func() {
+		if cfg.DSN != "" {
+			if err := sendSentryEvent(cfg.DSN, report); err != nil {
+				slog.Warn("上报Sentry失败", "error", err)
+			}
+		}
+		if cfg.WebhookURL != "" {
+			if err := sendErrorWebhook(cfg.WebhookURL, report); err != nil {
+				slog.Warn("上报错误Webhook失败", "error", err)
+			}
+		}
+	}()
+}
+
+// newEventID 生成Sentry要求的32位十六进制事件ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sendErrorWebhook 将错误事件以JSON形式POST到通用Webhook
+func sendErrorWebhook(webhookURL string, report ErrorReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	resp, err := errorReportClient.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendSentryEvent 通过Sentry的envelope接口上报事件
+// DSN格式: https://<key>@<host>/<project_id>
+func sendSentryEvent(dsn string, report ErrorReport) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return fmt.Errorf("无效的Sentry DSN")
+	}
+	key := u.User.Username()
+	projectID := strings.Trim(u.Path, "/")
+	if idx := strings.LastIndex(projectID, "/"); idx >= 0 {
+		projectID = projectID[idx+1:]
+	}
+	pathPrefix := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/"+projectID)
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, pathPrefix, projectID)
+
+	event := map[string]interface{}{
+		"event_id":    report.EventID,
+		"timestamp":   report.Timestamp.Format(time.RFC3339),
+		"level":       report.Level,
+		"platform":    "go",
+		"logger":      report.Kind,
+		"release":     report.Release,
+		"environment": report.Environment,
+		"message":     map[string]string{"formatted": report.Message},
+		"exception": map[string]interface{}{
+			"values": []map[string]string{{"type": report.Kind, "value": report.Message}},
+		},
+		"tags": map[string]string{
+			"kind":       report.Kind,
+			"request_id": report.RequestID,
+		},
+		"user": map[string]string{
+			"id":         report.User,
+			"ip_address": report.ClientIP,
+		},
+		"request": map[string]string{
+			"method": report.Method,
+			"url":    report.Path,
+		},
+		"extra": mergeExtra(report.Extra, report.Stack),
+	}
+
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": report.EventID, "dsn": dsn})
+	itemHeader, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(eventData)})
+
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(itemHeader)
+	body.WriteByte('\n')
+	body.Write(eventData)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=ai-assistant/%s", key, version))
+
+	resp, err := errorReportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Sentry返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// mergeExtra 将调用栈放入附加信息
+func mergeExtra(extra map[string]interface{}, stack string) map[string]interface{} {
+	merged := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		merged[k] = v
+	}
+	if stack != "" {
+		merged["stack"] = stack
+	}
+	return merged
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 事件类型
+const (
+	eventChatCompleted    = "chat.completed"
+	eventKnowledgeAdded   = "knowledge.added"
+	eventKnowledgeDeleted = "knowledge.deleted"
+	eventQuotaExceeded    = "quota.exceeded"
+	eventBackupFinished   = "backup.finished"
+	eventFinetuneFinished = "finetune.finished"
+)
+
+var knownEvents = []string{
+	eventChatCompleted,
+	eventKnowledgeAdded,
+	eventKnowledgeDeleted,
+	eventQuotaExceeded,
+	eventBackupFinished,
+	eventFinetuneFinished,
+}
+
+// 订阅全部事件
+const eventAll = "*"
+
+// 开启 events.log 时保存事件的文件
+const eventLogFile = "events.jsonl"
+
+// 查询事件日志默认返回的条数
+const defaultEventLimit = 100
+
+// Event 事件总线上传递的事件，ID 同时用作 Webhook 的投递ID
+type Event struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// eventSubscriber 事件订阅者，handler 在发布事件的 goroutine 中同步调用，耗时的处理需要自行异步执行
+type eventSubscriber struct {
+	Name    string
+	Event   string
+	handler func(Event)
+}
+
+var (
+	eventBusMu       sync.RWMutex
+	eventSubscribers []eventSubscriber
+)
+
+var eventLogMu sync.Mutex
+
+func init() {
+	// 内置订阅者：Webhook 通知、事件日志、摘要统计和条目评分
+	subscribeEvent("webhooks", eventAll, deliverWebhookEvent)
+	subscribeEvent("event_log", eventAll, logEvent)
+	subscribeEvent("digest", eventAll, countDigestEvent)
+	subscribeEvent("quality", eventKnowledgeAdded, func(e Event) {
+		if item, ok := e.Data.(KnowledgeItem); ok {
+			enqueueQualityScore(item.ID)
+		}
+	})
+}
+
+// subscribeEvent 注册事件订阅者，event 为 "*" 时接收全部事件；同一事件的订阅者按注册顺序调用
+func subscribeEvent(name, event string, handler func(Event)) {
+	eventBusMu.Lock()
+	defer eventBusMu.Unlock()
+	eventSubscribers = append(eventSubscribers, eventSubscriber{Name: name, Event: event, handler: handler})
+}
+
+// publishEvent 发布事件，依次调用订阅了该事件的订阅者，单个订阅者 panic 时只记录日志，不影响其他订阅者
+func publishEvent(name string, data interface{}) {
+	e := Event{ID: newEventID(), Name: name, Timestamp: time.Now().UTC(), Data: data}
+	eventBusMu.RLock()
+	subscribers := make([]eventSubscriber, 0, len(eventSubscribers))
+	for _, s := range eventSubscribers {
+		if s.Event == eventAll || s.Event == name {
+			subscribers = append(subscribers, s)
+		}
+	}
+	eventBusMu.RUnlock()
+
+	for _, s := range subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("事件订阅者处理失败", "subscriber", s.Name, "event", name, "panic", fmt.Sprint(r))
+				}
+			}()
+			s.handler(e)
+		}()
+	}
+}
+
+// logEvent 开启 events.log 时把事件追加到事件日志，事件内容包含问答记录，开启数据加密时加密后写入
+func logEvent(e Event) {
+	if !currentConfig().Events.Log {
+		return
+	}
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	if err := appendSealedJSONLine(dataPath(eventLogFile), e); err != nil {
+		slog.Error("写入事件日志失败", "event", e.Name, "error", err)
+	}
+}
+
+// eventsHandler 查询事件日志，可按事件类型筛选，最新的在前，不包含事件内容时传 data=false
+func eventsHandler(c *gin.Context) {
+	name := c.Query("event")
+	withData := c.Query("data") != "false"
+	limit := defaultEventLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	events := []json.RawMessage{}
+	eventLogMu.Lock()
+	err := readSealedJSONLines(dataPath(eventLogFile), func(line []byte) {
+		var e struct {
+			Name string `json:"event"`
+		}
+		if json.Unmarshal(line, &e) != nil || (name != "" && e.Name != name) {
+			return
+		}
+		events = append(events, json.RawMessage(append([]byte(nil), line...)))
+	})
+	eventLogMu.Unlock()
+	if err != nil && !isNotExist(err) {
+		requestLogger(c).Error("读取事件日志失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_events"))
+		return
+	}
+
+	total := len(events)
+	// 日志按时间顺序追加，倒序即为最新的在前
+	result := make([]interface{}, 0, min(total, limit))
+	for i := total - 1; i >= 0 && len(result) < limit; i-- {
+		if withData {
+			result = append(result, events[i])
+			continue
+		}
+		var e Event
+		if json.Unmarshal(events[i], &e) == nil {
+			e.Data = nil
+			result = append(result, e)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "events": result})
+}
+
+// eventSubscribersHandler 返回已注册的事件订阅者及其订阅的事件
+func eventSubscribersHandler(c *gin.Context) {
+	eventBusMu.RLock()
+	subscribers := make([]gin.H, 0, len(eventSubscribers))
+	for _, s := range eventSubscribers {
+		subscribers = append(subscribers, gin.H{"name": s.Name, "event": s.Event})
+	}
+	eventBusMu.RUnlock()
+	sort.SliceStable(subscribers, func(i, j int) bool { return subscribers[i]["name"].(string) < subscribers[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"events": knownEvents, "subscribers": subscribers})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 失败的对话记录文件，与问答记录分开保存
+const chatFailureLogFile = "chat_failures.jsonl"
+
+// 失败记录中问题和错误信息的最大字数
+const (
+	chatFailureMessageRunes = 200
+	chatFailureErrorRunes   = 500
+)
+
+// 失败记录接口默认返回的条数
+const defaultChatFailureLimit = 100
+
+// 错误类型
+const (
+	errorClassTimeout          = "timeout"
+	errorClassRateLimited      = "rate_limited"
+	errorClassAuth             = "auth"
+	errorClassModelNotFound    = "model_not_found"
+	errorClassInvalidRequest   = "invalid_request"
+	errorClassUpstream         = "upstream_error"
+	errorClassNetwork          = "network"
+	errorClassEmptyResponse    = "empty_response"
+	errorClassContextExceeded  = "context_exceeded"
+	errorClassResponseRejected = "response_rejected"
+	errorClassModeration       = "moderation_failed"
+	errorClassOther            = "other"
+)
+
+var chatFailureLogMu sync.Mutex
+
+// ChatFailure 一次失败的回答
+type ChatFailure struct {
+	Timestamp time.Time `json:"timestamp"`
+	Model     string    `json:"model"`
+	Class     string    `json:"class"`
+	// 返回给客户端的状态码
+	Status int `json:"status"`
+	// 上游返回的状态码，没有收到上游响应时为空
+	UpstreamStatus int    `json:"upstream_status,omitempty"`
+	Error          string `json:"error"`
+	// 截断后的问题，开启 pii 时敏感信息已替换为占位符
+	Message string `json:"message"`
+	User    string `json:"user,omitempty"`
+	// 智能路由随后换用更强的模型重试，本次失败没有返回给用户
+	Retried bool `json:"retried,omitempty"`
+}
+
+// ChatFailureGroup 同一类错误的汇总
+type ChatFailureGroup struct {
+	Class    string         `json:"class"`
+	Count    int            `json:"count"`
+	LastSeen time.Time      `json:"last_seen"`
+	Models   map[string]int `json:"models"`
+	// 最近一次的错误信息
+	LastError string `json:"last_error"`
+}
+
+// recordChatFailure 保存一次失败的回答，用户取消的不保存；message 为发送给上游的问题，开启数据加密时加密后写入
+func recordChatFailure(ctx context.Context, req ChatRequest, message string, chatErr *chatError, retried bool) {
+	if chatErr == nil || generationCancelled(ctx) {
+		return
+	}
+	class, upstreamStatus := classifyChatError(chatErr)
+	failure := ChatFailure{
+		Timestamp:      time.Now(),
+		Model:          req.Model,
+		Class:          class,
+		Status:         chatErr.Status,
+		UpstreamStatus: upstreamStatus,
+		Error:          truncateRunes(chatErr.Message, chatFailureErrorRunes),
+		Message:        truncateRunes(message, chatFailureMessageRunes),
+		User:           req.User,
+		Retried:        retried,
+	}
+
+	chatFailureLogMu.Lock()
+	defer chatFailureLogMu.Unlock()
+	if err := appendSealedJSONLine(dataPath(chatFailureLogFile), failure); err != nil {
+		slog.Error("写入失败记录失败", "error", err)
+	}
+}
+
+// classifyChatError 判断错误类型，并取出上游返回的状态码
+func classifyChatError(chatErr *chatError) (string, int) {
+	switch chatErr.Key {
+	case "error.context_exceeded":
+		return errorClassContextExceeded, 0
+	case "error.response_rejected":
+		return errorClassResponseRejected, 0
+	case "error.moderation_failed":
+		return errorClassModeration, 0
+	}
+
+	err := chatErr.Err
+	if err == nil {
+		return errorClassOther, 0
+	}
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if errors.As(err, &apiErr) {
+		status = apiErr.HTTPStatusCode
+	} else if errors.As(err, &reqErr) {
+		status = reqErr.HTTPStatusCode
+	}
+
+	var netErr net.Error
+	switch {
+	case status == http.StatusTooManyRequests:
+		return errorClassRateLimited, status
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return errorClassAuth, status
+	case status == http.StatusNotFound:
+		return errorClassModelNotFound, status
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return errorClassTimeout, status
+	case status >= 500:
+		return errorClassUpstream, status
+	case status >= 400:
+		return errorClassInvalidRequest, status
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return errorClassTimeout, 0
+	case errors.As(err, &netErr):
+		return errorClassNetwork, 0
+	case strings.Contains(err.Error(), "上游未返回任何结果"):
+		return errorClassEmptyResponse, 0
+	}
+	return errorClassOther, status
+}
+
+// chatFailuresHandler 返回失败的回答和按错误类型的汇总，最新的在前
+// 查询参数：class、model、since、limit，汇总包含筛选后的全部记录
+func chatFailuresHandler(c *gin.Context) {
+	class, model := c.Query("class"), c.Query("model")
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.since_invalid"))
+			return
+		}
+		since = t
+	}
+	limit := defaultChatFailureLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	failures := []ChatFailure{}
+	chatFailureLogMu.Lock()
+	err := readSealedJSONLines(dataPath(chatFailureLogFile), func(line []byte) {
+		var failure ChatFailure
+		if json.Unmarshal(line, &failure) != nil {
+			return
+		}
+		if (class == "" || failure.Class == class) && (model == "" || failure.Model == model) && !failure.Timestamp.Before(since) {
+			failures = append(failures, failure)
+		}
+	})
+	chatFailureLogMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_failures"))
+		return
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Timestamp.After(failures[j].Timestamp)
+	})
+	groups := groupChatFailures(failures)
+	total := len(failures)
+	if len(failures) > limit {
+		failures = failures[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":  total,
+		"groups": groups,
+		"errors": failures,
+	})
+}
+
+// groupChatFailures 按错误类型汇总，failures 按从新到旧排列，次数多的类型在前
+func groupChatFailures(failures []ChatFailure) []ChatFailureGroup {
+	byClass := map[string]*ChatFailureGroup{}
+	var classes []string
+	for _, failure := range failures {
+		g, ok := byClass[failure.Class]
+		if !ok {
+			g = &ChatFailureGroup{Class: failure.Class, LastSeen: failure.Timestamp, LastError: failure.Error, Models: map[string]int{}}
+			byClass[failure.Class] = g
+			classes = append(classes, failure.Class)
+		}
+		g.Count++
+		g.Models[failure.Model]++
+	}
+	groups := make([]ChatFailureGroup, 0, len(classes))
+	for _, class := range classes {
+		groups = append(groups, *byClass[class])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Count > groups[j].Count
+	})
+	return groups
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 可以通过 features 配置关闭的子系统，未配置的默认开启
+const (
+	featureRAG        = "rag"
+	featureStreaming  = "streaming"
+	featureTools      = "tools"
+	featureModeration = "moderation"
+	featureJudge      = "judge"
+	featureShadow     = "shadow"
+)
+
+// knownFeatures 全部功能开关，按 /api/v1/admin/features 返回的顺序排列
+var knownFeatures = []string{featureRAG, featureStreaming, featureTools, featureModeration, featureJudge, featureShadow}
+
+// featureEnabled 判断功能是否开启，features 中没有配置的功能默认开启
+// 关闭的功能即使在各自的配置中启用也不会生效，修改后重新加载配置即可，不需要重启
+func featureEnabled(cfg *Config, name string) bool {
+	enabled, ok := cfg.Features[name]
+	return !ok || enabled
+}
+
+// disabledGatewayFeature 返回 OpenAI 兼容接口的请求用到但已经关闭的功能，都开启时返回空
+func disabledGatewayFeature(cfg *Config, req openai.ChatCompletionRequest) string {
+	if req.Stream && !featureEnabled(cfg, featureStreaming) {
+		return featureStreaming
+	}
+	if (len(req.Tools) > 0 || len(req.Functions) > 0) && !featureEnabled(cfg, featureTools) {
+		return featureTools
+	}
+	return ""
+}
+
+// featuresHandler 返回各功能开关当前是否开启
+func featuresHandler(c *gin.Context) {
+	cfg := currentConfig()
+	features := make(map[string]bool, len(knownFeatures))
+	for _, name := range knownFeatures {
+		features[name] = featureEnabled(cfg, name)
+	}
+	c.JSON(http.StatusOK, gin.H{"features": features})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 过滤规则命中后的处理方式
+const (
+	filterActionRedact = "redact"
+	filterActionReject = "reject"
+	filterActionWarn   = "warn"
+)
+
+const filterRedactText = "***"
+
+// FilterRule 模型输出的过滤规则
+type FilterRule struct {
+	Pattern string `yaml:"pattern"`
+	Regex   bool   `yaml:"regex"`
+	Action  string `yaml:"action"`
+}
+
+// FilterResult 过滤结果
+type FilterResult struct {
+	Text     string
+	Rejected bool
+	Warnings []string
+}
+
+// 已编译的规则缓存，键为规则原文
+var filterRegexCache sync.Map
+
+// compile 将规则编译为正则表达式，关键词规则按字面量、不区分大小写匹配
+func (r FilterRule) compile() *regexp.Regexp {
+	key := r.Pattern
+	if !r.Regex {
+		key = "literal:" + r.Pattern
+	}
+	if cached, ok := filterRegexCache.Load(key); ok {
+		return cached.(*regexp.Regexp)
+	}
+
+	expr := r.Pattern
+	if !r.Regex {
+		expr = "(?i)" + regexp.QuoteMeta(r.Pattern)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		slog.Warn("过滤规则无效", "pattern", r.Pattern, "error", err)
+		return nil
+	}
+	filterRegexCache.Store(key, re)
+	return re
+}
+
+// filterRulesFor 返回指定工作区生效的规则，工作区配置了规则时覆盖全局规则
+func filterRulesFor(workspace string) []FilterRule {
+	filters := currentConfig().Filters
+	if workspace != "" {
+		if rules, ok := filters.Workspaces[workspace]; ok {
+			return rules
+		}
+	}
+	return filters.Rules
+}
+
+// applyResponseFilters 对模型输出执行过滤规则
+func applyResponseFilters(text, workspace string) FilterResult {
+	result := FilterResult{Text: text}
+	for _, rule := range filterRulesFor(workspace) {
+		if strings.TrimSpace(rule.Pattern) == "" {
+			continue
+		}
+		re := rule.compile()
+		if re == nil || !re.MatchString(result.Text) {
+			continue
+		}
+
+		switch rule.Action {
+		case filterActionReject:
+			result.Rejected = true
+			return result
+		case filterActionWarn:
+			result.Warnings = append(result.Warnings, "filter:"+rule.Pattern)
+		default:
+			// 未配置处理方式时按filterActionRedact处理
+			result.Text = re.ReplaceAllString(result.Text, filterRedactText)
+		}
+	}
+	return result
+}
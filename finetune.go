@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审计日志中的导出微调数据操作
+const auditActionAdminExportFinetune = "admin.export.finetune"
+
+// 微调数据的格式：openai 为 OpenAI 微调接口的 messages 格式，sharegpt 为 ShareGPT 的 conversations 格式
+const (
+	finetuneFormatOpenAI   = "openai"
+	finetuneFormatShareGPT = "sharegpt"
+)
+
+// 拼接问题和回答一起屏蔽敏感信息，两者中相同的内容使用同一个占位符
+const finetuneSeparator = "\x00"
+
+// FinetuneFilter 导出微调数据时筛选问答记录的条件
+type FinetuneFilter struct {
+	// 只导出回答被保存到知识库且带有其中任一标签的问答
+	Tags  []string
+	Model string
+	Since time.Time
+	// 只导出评审模型评分不低于该值的问答，为 0 时不限制
+	MinScore float64
+	// 只导出收到该评价（up 或 down）的问答，为空时不限制；rating=up 时收到过差评的问答同样不导出
+	Rating string
+	// 是否包含被标记的问答，默认不包含
+	IncludeFlagged bool
+}
+
+// openAIFinetuneExample OpenAI 微调数据的一行
+type openAIFinetuneExample struct {
+	Messages []openAIFinetuneMessage `json:"messages"`
+}
+
+type openAIFinetuneMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// shareGPTExample ShareGPT 格式的一行
+type shareGPTExample struct {
+	Conversations []shareGPTTurn `json:"conversations"`
+}
+
+type shareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// exportFinetuneHandler 把问答记录导出为微调数据（JSON Lines），问题和回答中的敏感信息始终替换为占位符
+// 查询参数：format、tags、model、since、min_score、include_flagged，system=false 时不包含系统提示词
+func exportFinetuneHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", finetuneFormatOpenAI)
+	if format != finetuneFormatOpenAI && format != finetuneFormatShareGPT {
+		respondError(c, http.StatusBadRequest, tr(c, "error.finetune_format_invalid", format))
+		return
+	}
+	filter, ok := parseFinetuneFilter(c)
+	if !ok {
+		return
+	}
+	data, count, err := buildFinetuneData(format, filter, c.Query("system") != "false")
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+
+	recordAudit(c, auditActionAdminExportFinetune, "qa", fmt.Sprintf("format=%s records=%d", format, count), http.StatusOK)
+	filename := fmt.Sprintf("finetune-%s-%s.jsonl", format, time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("X-Record-Count", strconv.Itoa(count))
+	c.Data(http.StatusOK, batchContentType, data)
+}
+
+// parseFinetuneFilter 从查询参数解析筛选条件，参数无效时返回错误响应
+func parseFinetuneFilter(c *gin.Context) (FinetuneFilter, bool) {
+	filter := FinetuneFilter{
+		Tags:           splitTags(c.Query("tags")),
+		Model:          c.Query("model"),
+		IncludeFlagged: c.Query("include_flagged") == "true",
+	}
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.since_invalid"))
+			return filter, false
+		}
+		filter.Since = t
+	}
+	if v := c.Query("min_score"); v != "" {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil || score < 0 || score > 10 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.min_score_invalid"))
+			return filter, false
+		}
+		filter.MinScore = score
+	}
+	if v := c.Query("rating"); v != "" {
+		if v != feedbackRatingUp && v != feedbackRatingDown {
+			respondError(c, http.StatusBadRequest, tr(c, "error.feedback_rating_invalid", v))
+			return filter, false
+		}
+		filter.Rating = v
+	}
+	return filter, true
+}
+
+// buildFinetuneData 按条件筛选问答记录并生成微调数据，返回 JSON Lines 和样本数
+// withSystem 为 true 时每个样本以 prompt.system 开头
+func buildFinetuneData(format string, filter FinetuneFilter, withSystem bool) ([]byte, int, error) {
+	records, err := allQARecords()
+	if err != nil {
+		return nil, 0, err
+	}
+	var feedback map[int][]Feedback
+	if filter.Rating != "" {
+		if feedback, err = readFeedback(); err != nil {
+			return nil, 0, err
+		}
+	}
+	records = filterFinetuneRecords(records, filter, feedback)
+	system := finetuneSystemPrompt(withSystem)
+
+	var b bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(finetuneExample(format, system, record))
+		if err != nil {
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), len(records), nil
+}
+
+// finetuneSystemPrompt 返回样本开头的系统提示词，withSystem 为 false 时为空
+func finetuneSystemPrompt(withSystem bool) string {
+	if !withSystem {
+		return ""
+	}
+	if system := currentConfig().Prompt.System; system != "" {
+		return system
+	}
+	return defaultSystemPrompt
+}
+
+// filterFinetuneRecords 按条件筛选问答记录，按时间从早到晚排列，没有回答的记录不导出
+// feedback 为按问答记录ID分组的用户评价，按评价筛选时使用
+func filterFinetuneRecords(records []QARecord, filter FinetuneFilter, feedback map[int][]Feedback) []QARecord {
+	// 按标签筛选时，找出带有这些标签的知识库条目的内容，保存到知识库的内容就是问答的回答
+	var taggedAnswers map[string]bool
+	if len(filter.Tags) > 0 {
+		taggedAnswers = map[string]bool{}
+		dataMu.RLock()
+		for _, item := range knowledgeBase {
+			for _, tag := range item.Tags {
+				if containsString(filter.Tags, tag) {
+					taggedAnswers[item.Content] = true
+					break
+				}
+			}
+		}
+		dataMu.RUnlock()
+	}
+
+	var result []QARecord
+	for _, record := range records {
+		switch {
+		case strings.TrimSpace(record.Question) == "" || strings.TrimSpace(record.Answer) == "":
+		case record.Flagged && !filter.IncludeFlagged:
+		case filter.Model != "" && record.Model != filter.Model:
+		case record.Timestamp.Before(filter.Since):
+		case filter.MinScore > 0 && (record.Judge == nil || record.Judge.Score < filter.MinScore):
+		case taggedAnswers != nil && !taggedAnswers[record.Answer]:
+		case filter.Rating != "" && !feedbackMatches(feedback[record.ID], filter.Rating):
+		default:
+			result = append(result, record)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// feedbackMatches 判断问答收到的评价是否符合筛选条件
+// up 要求至少一个好评且没有差评，down 要求至少一个差评
+func feedbackMatches(feedback []Feedback, rating string) bool {
+	var up, down bool
+	for _, f := range feedback {
+		switch f.Rating {
+		case feedbackRatingUp:
+			up = true
+		case feedbackRatingDown:
+			down = true
+		}
+	}
+	if rating == feedbackRatingUp {
+		return up && !down
+	}
+	return down
+}
+
+// finetuneExample 把一条问答转换为指定格式的一行微调数据，敏感信息替换为占位符
+func finetuneExample(format, system string, record QARecord) interface{} {
+	question, answer := redactQA(record.Question, record.Answer)
+
+	if format == finetuneFormatShareGPT {
+		var turns []shareGPTTurn
+		if system != "" {
+			turns = append(turns, shareGPTTurn{From: "system", Value: system})
+		}
+		turns = append(turns, shareGPTTurn{From: "human", Value: question}, shareGPTTurn{From: "gpt", Value: answer})
+		return shareGPTExample{Conversations: turns}
+	}
+
+	var messages []openAIFinetuneMessage
+	if system != "" {
+		messages = append(messages, openAIFinetuneMessage{Role: openai.ChatMessageRoleSystem, Content: system})
+	}
+	messages = append(messages,
+		openAIFinetuneMessage{Role: openai.ChatMessageRoleUser, Content: question},
+		openAIFinetuneMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+	)
+	return openAIFinetuneExample{Messages: messages}
+}
+
+// redactQA 把问题和回答中的敏感信息替换为占位符，两者中相同的内容使用同一个占位符
+func redactQA(question, answer string) (string, string) {
+	redacted, _ := redactPII(question + finetuneSeparator + answer)
+	question, answer, _ = strings.Cut(redacted, finetuneSeparator)
+	return question, answer
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审计日志中的微调操作
+const (
+	auditActionAdminFinetuneUpload = "admin.finetune.upload"
+	auditActionAdminFinetuneCreate = "admin.finetune.create"
+	auditActionAdminFinetuneCancel = "admin.finetune.cancel"
+)
+
+// 微调任务保存在数据目录中的文件
+const finetuneJobsFile = "finetune_jobs.json"
+
+// 未配置 finetune.poll_interval 时查询任务状态的间隔
+const defaultFinetunePollInterval = time.Minute
+
+// 查询上游微调接口的超时
+const finetuneRequestTimeout = 30 * time.Second
+
+// 上游微调任务的状态，succeeded、failed、cancelled 之后不再变化
+const (
+	finetuneStatusSucceeded = "succeeded"
+	finetuneStatusFailed    = "failed"
+	finetuneStatusCancelled = "cancelled"
+)
+
+// FinetuneJob 通过本服务创建的微调任务，状态定期从上游同步
+type FinetuneJob struct {
+	ID             string `json:"id"`
+	Model          string `json:"model"`
+	TrainingFile   string `json:"training_file"`
+	ValidationFile string `json:"validation_file,omitempty"`
+	Suffix         string `json:"suffix,omitempty"`
+	Status         string `json:"status"`
+	// 微调得到的模型，任务成功后才有
+	FineTunedModel string `json:"fine_tuned_model,omitempty"`
+	TrainedTokens  int    `json:"trained_tokens,omitempty"`
+	// 成功后是否把微调得到的模型加入可用模型，以及是否已经加入
+	Register   bool       `json:"register"`
+	Registered bool       `json:"registered,omitempty"`
+	User       string     `json:"user,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// finished 判断任务是否已经结束
+func (j FinetuneJob) finished() bool {
+	return j.Status == finetuneStatusSucceeded || j.Status == finetuneStatusFailed || j.Status == finetuneStatusCancelled
+}
+
+// FinetuneFile 上传到上游的数据集
+type FinetuneFile struct {
+	ID       string `json:"id"`
+	FileName string `json:"filename"`
+	Bytes    int    `json:"bytes"`
+	Status   string `json:"status,omitempty"`
+}
+
+// FinetuneEvent 微调任务的训练事件，例如开始训练、每一步的损失和完成
+type FinetuneEvent struct {
+	CreatedAt time.Time `json:"created_at"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
+// FinetuneJobRequest 创建微调任务的请求
+type FinetuneJobRequest struct {
+	// 上传数据集时返回的文件ID
+	TrainingFile   string `json:"training_file" binding:"required"`
+	ValidationFile string `json:"validation_file"`
+	// 作为基础的模型，例如 gpt-4o-mini-2024-07-18
+	Model string `json:"model" binding:"required"`
+	// 附加到微调得到的模型名称中
+	Suffix string `json:"suffix"`
+	Epochs int    `json:"epochs"`
+	// 成功后是否把微调得到的模型加入可用模型，默认 true
+	Register *bool `json:"register"`
+}
+
+var (
+	finetuneMu   sync.Mutex
+	finetuneJobs []FinetuneJob
+)
+
+// loadFinetuneJobs 启动时读取保存的微调任务
+func loadFinetuneJobs() {
+	var jobs []FinetuneJob
+	if err := loadDataFile(finetuneJobsFile, &jobs); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取微调任务失败", "error", err)
+		}
+		return
+	}
+	finetuneMu.Lock()
+	finetuneJobs = jobs
+	finetuneMu.Unlock()
+}
+
+// saveFinetuneJobsLocked 保存微调任务，调用方需要持有 finetuneMu
+func saveFinetuneJobsLocked() {
+	if err := saveDataFile(finetuneJobsFile, finetuneJobs); err != nil {
+		slog.Error("保存微调任务失败", "error", err)
+	}
+}
+
+// finetunedModels 返回已经加入可用模型的微调模型
+func finetunedModels() []string {
+	finetuneMu.Lock()
+	defer finetuneMu.Unlock()
+	var models []string
+	for _, job := range finetuneJobs {
+		if job.Registered {
+			models = append(models, job.FineTunedModel)
+		}
+	}
+	return models
+}
+
+// uploadFinetuneFileHandler 把数据集上传到上游，请求体为 OpenAI 微调格式的 JSON Lines；
+// from_history=true 时改为上传按查询参数从问答记录导出的数据，参数与 GET /admin/export/finetune 相同
+func uploadFinetuneFileHandler(c *gin.Context) {
+	var data []byte
+	examples := 0
+	name := c.Query("name")
+	if c.Query("from_history") == "true" {
+		filter, ok := parseFinetuneFilter(c)
+		if !ok {
+			return
+		}
+		var err error
+		data, examples, err = buildFinetuneData(finetuneFormatOpenAI, filter, c.Query("system") != "false")
+		if err != nil {
+			requestLogger(c).Error("读取问答记录失败", "error", err)
+			respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+			return
+		}
+		if examples == 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.finetune_dataset_empty"))
+			return
+		}
+	} else {
+		var err error
+		data, err = io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondBodyTooLarge(c, tooLarge.Limit)
+				return
+			}
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if examples, err = countFinetuneExamples(data); err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.finetune_dataset_invalid", err))
+			return
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("finetune-%s.jsonl", time.Now().Format("20060102-150405"))
+	}
+
+	file, err := newOpenAIClient().CreateFileBytes(c.Request.Context(), openai.FileBytesRequest{
+		Name:    name,
+		Bytes:   data,
+		Purpose: openai.PurposeFineTune,
+	})
+	if err != nil {
+		if respondDisconnected(c, err) {
+			return
+		}
+		recordAudit(c, auditActionAdminFinetuneUpload, name, err.Error(), http.StatusBadGateway)
+		respondError(c, http.StatusBadGateway, tr(c, "error.finetune_upstream", err))
+		return
+	}
+
+	recordAudit(c, auditActionAdminFinetuneUpload, file.ID, fmt.Sprintf("name=%s examples=%d", name, examples), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"file":     FinetuneFile{ID: file.ID, FileName: file.FileName, Bytes: file.Bytes, Status: file.Status},
+		"examples": examples,
+	})
+}
+
+// countFinetuneExamples 检查数据集的每一行都是带有 messages 的 JSON 对象，返回样本数
+func countFinetuneExamples(data []byte) (int, error) {
+	count := 0
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var example openAIFinetuneExample
+		if err := json.Unmarshal(line, &example); err != nil {
+			return 0, fmt.Errorf("第 %d 行不是有效的 JSON: %v", i+1, err)
+		}
+		if len(example.Messages) == 0 {
+			return 0, fmt.Errorf("第 %d 行缺少 messages", i+1)
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("数据集为空")
+	}
+	return count, nil
+}
+
+// createFinetuneJobHandler 在上游创建微调任务，之后定期同步状态
+func createFinetuneJobHandler(c *gin.Context) {
+	var req FinetuneJobRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Epochs < 0 {
+		respondError(c, http.StatusBadRequest, tr(c, "error.finetune_epochs_invalid"))
+		return
+	}
+
+	request := openai.FineTuningJobRequest{
+		TrainingFile:   req.TrainingFile,
+		ValidationFile: req.ValidationFile,
+		Model:          req.Model,
+		Suffix:         req.Suffix,
+	}
+	if req.Epochs > 0 {
+		request.Hyperparameters = &openai.Hyperparameters{Epochs: req.Epochs}
+	}
+	remote, err := newOpenAIClient().CreateFineTuningJob(c.Request.Context(), request)
+	if err != nil {
+		if respondDisconnected(c, err) {
+			return
+		}
+		recordAudit(c, auditActionAdminFinetuneCreate, req.Model, err.Error(), http.StatusBadGateway)
+		respondError(c, http.StatusBadGateway, tr(c, "error.finetune_upstream", err))
+		return
+	}
+
+	job := FinetuneJob{
+		ID:             remote.ID,
+		Model:          req.Model,
+		TrainingFile:   req.TrainingFile,
+		ValidationFile: req.ValidationFile,
+		Suffix:         req.Suffix,
+		Register:       req.Register == nil || *req.Register,
+		User:           requestUser(c),
+		CreatedAt:      time.Now(),
+	}
+	finetuneMu.Lock()
+	finetuneJobs = append(finetuneJobs, job)
+	saveFinetuneJobsLocked()
+	finetuneMu.Unlock()
+	job = updateFinetuneJob(remote)
+
+	slog.Info("已创建微调任务", "job_id", job.ID, "model", job.Model, "training_file", job.TrainingFile)
+	recordAudit(c, auditActionAdminFinetuneCreate, job.ID, "model="+job.Model, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.finetune_created"),
+		"job":     job,
+	})
+}
+
+// finetuneJobsHandler 返回通过本服务创建的微调任务，最新的在前
+func finetuneJobsHandler(c *gin.Context) {
+	finetuneMu.Lock()
+	jobs := append([]FinetuneJob{}, finetuneJobs...)
+	finetuneMu.Unlock()
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": jobs,
+	})
+}
+
+// finetuneJobHandler 从上游刷新一个微调任务的状态，并返回最近的训练事件
+func finetuneJobHandler(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := findFinetuneJob(id); !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.finetune_job_not_found", id))
+		return
+	}
+	client := newOpenAIClient()
+	remote, err := client.RetrieveFineTuningJob(c.Request.Context(), id)
+	if err != nil {
+		if respondDisconnected(c, err) {
+			return
+		}
+		respondError(c, http.StatusBadGateway, tr(c, "error.finetune_upstream", err))
+		return
+	}
+	job := updateFinetuneJob(remote)
+
+	events := []FinetuneEvent{}
+	if list, err := client.ListFineTuningJobEvents(c.Request.Context(), id); err == nil {
+		for _, e := range list.Data {
+			events = append(events, FinetuneEvent{CreatedAt: time.Unix(e.CreatedAt, 0), Level: e.Level, Message: e.Message})
+		}
+	} else {
+		requestLogger(c).Warn("获取微调事件失败", "job_id", id, "error", err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"job":    job,
+		"events": events,
+	})
+}
+
+// cancelFinetuneJobHandler 取消一个还没有结束的微调任务
+func cancelFinetuneJobHandler(c *gin.Context) {
+	id := c.Param("id")
+	job, ok := findFinetuneJob(id)
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.finetune_job_not_found", id))
+		return
+	}
+	if job.finished() {
+		respondError(c, http.StatusConflict, tr(c, "error.finetune_job_finished", id, job.Status))
+		return
+	}
+	remote, err := newOpenAIClient().CancelFineTuningJob(c.Request.Context(), id)
+	if err != nil {
+		if respondDisconnected(c, err) {
+			return
+		}
+		recordAudit(c, auditActionAdminFinetuneCancel, id, err.Error(), http.StatusBadGateway)
+		respondError(c, http.StatusBadGateway, tr(c, "error.finetune_upstream", err))
+		return
+	}
+	job = updateFinetuneJob(remote)
+
+	recordAudit(c, auditActionAdminFinetuneCancel, id, "", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.finetune_cancelled"),
+		"job":     job,
+	})
+}
+
+// findFinetuneJob 按ID查找微调任务
+func findFinetuneJob(id string) (FinetuneJob, bool) {
+	finetuneMu.Lock()
+	defer finetuneMu.Unlock()
+	for _, job := range finetuneJobs {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return FinetuneJob{}, false
+}
+
+// updateFinetuneJob 用上游返回的任务更新本地记录，任务成功时按 register 把微调得到的模型加入可用模型
+func updateFinetuneJob(remote openai.FineTuningJob) FinetuneJob {
+	finetuneMu.Lock()
+	defer finetuneMu.Unlock()
+	for i := range finetuneJobs {
+		job := &finetuneJobs[i]
+		if job.ID != remote.ID {
+			continue
+		}
+		wasFinished := job.finished()
+		changed := job.Status != remote.Status || job.FineTunedModel != remote.FineTunedModel || job.TrainedTokens != remote.TrainedTokens
+		job.Status, job.FineTunedModel, job.TrainedTokens = remote.Status, remote.FineTunedModel, remote.TrainedTokens
+		if job.finished() && !wasFinished {
+			finishedAt := time.Now()
+			if remote.FinishedAt > 0 {
+				finishedAt = time.Unix(remote.FinishedAt, 0)
+			}
+			job.FinishedAt = &finishedAt
+			if job.Status == finetuneStatusSucceeded && job.Register && job.FineTunedModel != "" {
+				job.Registered = true
+				slog.Info("微调任务已完成，模型已加入可用模型", "job_id", job.ID, "model", job.FineTunedModel)
+			} else {
+				slog.Info("微调任务已结束", "job_id", job.ID, "status", job.Status)
+			}
+			publishEvent(eventFinetuneFinished, *job)
+		}
+		if changed {
+			saveFinetuneJobsLocked()
+		}
+		return *job
+	}
+	return FinetuneJob{}
+}
+
+// pollFinetuneJobsPeriodically 按 finetune.poll_interval 同步还没有结束的微调任务，每次都读取当前配置以支持热加载
+func pollFinetuneJobsPeriodically() {
+	for {
+		finetuneMu.Lock()
+		var pending []string
+		for _, job := range finetuneJobs {
+			if !job.finished() {
+				pending = append(pending, job.ID)
+			}
+		}
+		finetuneMu.Unlock()
+
+		if len(pending) > 0 {
+			client := newOpenAIClient()
+			for _, id := range pending {
+				ctx, cancel := context.WithTimeout(context.Background(), finetuneRequestTimeout)
+				remote, err := client.RetrieveFineTuningJob(ctx, id)
+				cancel()
+				if err != nil {
+					slog.Warn("查询微调任务状态失败", "job_id", id, "error", err)
+					continue
+				}
+				updateFinetuneJob(remote)
+			}
+		}
+		time.Sleep(finetunePollInterval(currentConfig()))
+	}
+}
+
+// finetunePollInterval 返回查询微调任务状态的间隔
+func finetunePollInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Finetune.PollInterval); err == nil && d > 0 {
+		return d
+	}
+	return defaultFinetunePollInterval
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+)
+
+// 命令行指定的端口，优先级高于配置文件和环境变量
+var portFlag string
+
+// 命令行指定的数据目录
+var dataDirFlag string
+
+// 只检查配置不启动服务
+var checkConfigOnly bool
+
+// 子命令，写在其它参数之前，例如 ai-assistant import-key
+var subcommands = map[string]func(args []string){
+	"ask":        askCommand,
+	"batch":      batchCommand,
+	"import-key": importKeyCommand,
+	"migrate":    migrateCommand,
+	"tui":        tuiCommand,
+}
+
+// parseFlags 解析命令行参数
+func parseFlags() {
+	flag.StringVar(&configFile, "config", configFile, "配置文件路径")
+	flag.StringVar(&profileFlag, "profile", "", "使用的配置档，覆盖 AI_ASSISTANT_PROFILE 环境变量和配置文件中的 profile")
+	flag.StringVar(&portFlag, "port", "", "监听端口，覆盖配置文件中的 server.port")
+	flag.StringVar(&dataDirFlag, "data-dir", "", "数据目录，覆盖配置文件中的 storage.data_dir")
+	flag.BoolVar(&checkConfigOnly, "check-config", false, "检查配置文件后退出，不启动服务")
+	flag.Parse()
+}
+
+// applyFlagOverrides 用命令行参数覆盖配置
+func applyFlagOverrides(cfg *Config) {
+	if dataDirFlag != "" {
+		cfg.Storage.DataDir = dataDirFlag
+	}
+	if storageDriverFlag != "" {
+		cfg.Storage.Driver = storageDriverFlag
+	}
+	if storageDSNFlag != "" {
+		cfg.Storage.DSN = storageDSNFlag
+	}
+	if portFlag != "" {
+		cfg.Server.Port = portFlag
+		if !strings.HasPrefix(cfg.Server.Port, ":") {
+			cfg.Server.Port = ":" + cfg.Server.Port
+		}
+	}
+}
+
+// dataPath 返回数据目录下的文件路径
+func dataPath(name string) string {
+	return filepath.Join(dataDir, name)
+}
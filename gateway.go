@@ -0,0 +1,557 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审计日志中的网关操作
+const auditActionGatewayChat = "gateway.chat"
+
+// 未配置 gateway.cache_size 时最多缓存的响应数
+const defaultGatewayCacheSize = 1000
+
+// GatewayKey OpenAI 兼容接口的调用密钥及其配额
+type GatewayKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// 每天最多使用的 token 数和请求数，0 表示不限
+	DailyTokens   int `yaml:"daily_tokens"`
+	DailyRequests int `yaml:"daily_requests"`
+	// 允许使用的模型，为空时可以使用全部可用模型和 embeddings.model
+	Models []string `yaml:"models"`
+}
+
+// gatewayQuota 某个密钥当天的用量
+type gatewayQuota struct {
+	day      string
+	requests int
+	tokens   int
+}
+
+var (
+	gatewayQuotaMu sync.Mutex
+	gatewayQuotas  = map[string]*gatewayQuota{}
+)
+
+// gatewayCacheEntry 缓存的完整响应
+type gatewayCacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+// 响应缓存按最近使用的顺序淘汰，gatewayCacheLRU 的元素为 *gatewayCacheEntry，最近使用的在前
+var (
+	gatewayCacheMu  sync.Mutex
+	gatewayCache    = map[string]*list.Element{}
+	gatewayCacheLRU = list.New()
+)
+
+// setupGateway 注册 OpenAI 兼容接口，现有的 OpenAI 客户端和工具可以把本服务当作网关使用
+// 路由始终注册，是否启用在每次请求时判断，便于通过热加载开关
+func setupGateway(r *gin.Engine) {
+	v1 := r.Group("/v1", gatewayAuth())
+	{
+		v1.POST("/chat/completions", gatewayChatHandler)
+		v1.POST("/chat/completions/:job_id/cancel", gatewayCancelHandler)
+		v1.POST("/embeddings", gatewayEmbeddingsHandler)
+		v1.GET("/models", gatewayModelsHandler)
+	}
+}
+
+// gatewayAuth 校验 Authorization: Bearer <key>，通过后在上下文中保存对应的密钥配置
+func gatewayAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentConfig().Gateway.Enabled {
+			respondOpenAIError(c, http.StatusNotFound, "not_found", tr(c, "error.gateway_disabled"))
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		for _, key := range currentConfig().Gateway.Keys {
+			if key.Key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key.Key)) == 1 {
+				c.Set("user", "gateway:"+key.Name)
+				c.Set("gateway_key", key)
+				c.Next()
+				return
+			}
+		}
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "网关密钥无效", http.StatusUnauthorized)
+		respondOpenAIError(c, http.StatusUnauthorized, "invalid_api_key", tr(c, "error.api_key_invalid"))
+	}
+}
+
+// gatewayModelsHandler 以 OpenAI 格式返回当前密钥可以使用的模型
+func gatewayModelsHandler(c *gin.Context) {
+	key := c.MustGet("gateway_key").(GatewayKey)
+	models := []gin.H{}
+	for _, model := range availableModels(currentConfig()) {
+		if len(key.Models) == 0 || containsString(key.Models, model) {
+			models = append(models, gin.H{"id": model, "object": "model", "owned_by": "ai-assistant"})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+}
+
+// gatewayChatHandler 转发 /v1/chat/completions 请求到配置的上游，
+// 转发前检查配额并按配置加入知识库上下文，完成后记录用量和审计日志
+func gatewayChatHandler(c *gin.Context) {
+	cfg := currentConfig()
+	key := c.MustGet("gateway_key").(GatewayKey)
+
+	var req openai.ChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondOpenAIError(c, http.StatusRequestEntityTooLarge, "request_too_large", tr(c, "error.body_too_large", formatBytes(tooLarge.Limit)))
+			return
+		}
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", tr(c, "error.messages_empty"))
+		return
+	}
+	req.Model = resolveModel(cfg, req.Model)
+	if !isModelAvailable(cfg, req.Model) || (len(key.Models) > 0 && !containsString(key.Models, req.Model)) {
+		respondOpenAIError(c, http.StatusNotFound, "model_not_found", tr(c, "error.model_unavailable", req.Model))
+		return
+	}
+	c.Set("model", req.Model)
+	if capability := unsupportedCapability(cfg, req); capability != "" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", tr(c, "error.model_capability", req.Model, capability))
+		return
+	}
+	if feature := disabledGatewayFeature(cfg, req); feature != "" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", tr(c, "error.feature_disabled", feature))
+		return
+	}
+	applyModelDefaults(cfg, &req)
+
+	if msgKey, limit := checkGatewayQuota(key); msgKey != "" {
+		msg := translate(defaultLocale(cfg), msgKey, limit)
+		recordAudit(c, auditActionGatewayChat, req.Model, msg, http.StatusTooManyRequests)
+		publishEvent(eventQuotaExceeded, gin.H{"key": key.Name, "model": req.Model, "message": msg})
+		respondOpenAIError(c, http.StatusTooManyRequests, "rate_limit_exceeded", tr(c, msgKey, limit))
+		return
+	}
+
+	// 在最后一条用户消息前加入知识库上下文，超出上下文长度时拒绝请求
+	limit := promptTokenLimit(cfg, req.Model, max(req.MaxTokens, req.MaxCompletionTokens))
+	if cfg.Gateway.RAG {
+		enrichWithKnowledge(c.Request.Context(), req.Model, req.Messages, limit)
+	}
+	if limit > 0 {
+		if tokens, err := countChatTokens(cfg, req.Model, req.Messages); err == nil && tokens > limit {
+			respondOpenAIError(c, http.StatusBadRequest, "context_length_exceeded", tr(c, "error.context_exceeded", tokens, limit))
+			return
+		}
+	}
+
+	// 请求ID即生成的ID，可以通过 POST /v1/chat/completions/<请求ID>/cancel 取消
+	ctx, done := startChatJob(c, req.Model)
+	defer done()
+
+	if req.Stream {
+		gatewayStream(ctx, c, key, req)
+		return
+	}
+
+	// 相同的请求在缓存有效期内直接返回上次的响应
+	cacheKey := ""
+	if ttl := gatewayCacheTTL(cfg); ttl > 0 {
+		cacheKey = gatewayCacheKey(req)
+		if body, ok := lookupGatewayCache(cacheKey); ok {
+			addGatewayUsage(key, 0)
+			recordAudit(c, auditActionGatewayChat, req.Model, "cache=hit", http.StatusOK)
+			c.Header("X-Cache", "HIT")
+			c.Data(http.StatusOK, "application/json", body)
+			return
+		}
+	}
+
+	resp, err := newOpenAIClient().CreateChatCompletion(ctx, req)
+	if err != nil {
+		if generationCancelled(ctx) {
+			recordAudit(c, auditActionGatewayChat, req.Model, "cancelled=true", statusClientClosedRequest)
+			respondOpenAIError(c, statusClientClosedRequest, "request_cancelled", tr(c, "error.generation_cancelled"))
+			return
+		}
+		respondUpstreamError(c, req.Model, err)
+		return
+	}
+
+	if !cfg.Models.ShowReasoning {
+		for i := range resp.Choices {
+			resp.Choices[i].Message.ReasoningContent = ""
+		}
+	}
+
+	usage := newTokenUsage(resp.Usage)
+	recordUsage(req.Model, usage)
+	addGatewayUsage(key, usage.TotalTokens)
+	recordAudit(c, auditActionGatewayChat, req.Model, fmt.Sprintf("tokens=%d", usage.TotalTokens), http.StatusOK)
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondOpenAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if cacheKey != "" {
+		storeGatewayCache(cacheKey, body, gatewayCacheTTL(cfg))
+		c.Header("X-Cache", "MISS")
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// gatewayStreamOpen 打开上游流式响应的结果
+type gatewayStreamOpen struct {
+	stream *openai.ChatCompletionStream
+	err    error
+}
+
+// gatewayStreamChunk 从上游读到的一个分片或读取错误
+type gatewayStreamChunk struct {
+	chunk openai.ChatCompletionStreamResponse
+	err   error
+}
+
+// gatewayStream 以 SSE 转发流式响应，要求上游在最后一个分片中返回用量
+// 没有开启 models.show_reasoning 时去掉推理模型的思考过程，只剩思考过程的分片不转发
+// 生成被取消时停止读取上游并正常结束流，已经产生的用量无法得知，不计入
+// 上游超过 gateway.heartbeat 没有返回内容时发送 SSE 注释保持连接，此时响应已经开始，之后的上游错误以 error 事件返回
+func gatewayStream(ctx context.Context, c *gin.Context, key GatewayKey, req openai.ChatCompletionRequest) {
+	cfg := currentConfig()
+	showReasoning := cfg.Models.ShowReasoning
+	heartbeat := newHeartbeat(gatewayHeartbeatInterval(cfg))
+	defer heartbeat.stop()
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	opened := make(chan gatewayStreamOpen, 1)
+	go func() {
+		stream, err := newOpenAIClient().CreateChatCompletionStream(ctx, req)
+		opened <- gatewayStreamOpen{stream: stream, err: err}
+	}()
+
+	started := false
+	var stream *openai.ChatCompletionStream
+	var openErr error
+	for stream == nil && openErr == nil {
+		select {
+		case result := <-opened:
+			stream, openErr = result.stream, result.err
+		case <-heartbeat.C:
+			if !started {
+				startSSE(c)
+				started = true
+			}
+			writeSSEHeartbeat(c)
+		}
+	}
+	if openErr != nil && !started {
+		if generationCancelled(ctx) {
+			recordAudit(c, auditActionGatewayChat, req.Model, "cancelled=true stream=true", statusClientClosedRequest)
+			respondOpenAIError(c, statusClientClosedRequest, "request_cancelled", tr(c, "error.generation_cancelled"))
+			return
+		}
+		respondUpstreamError(c, req.Model, openErr)
+		return
+	}
+	if !started {
+		startSSE(c)
+	}
+
+	var usage *TokenUsage
+	cancelled := false
+	if openErr != nil {
+		cancelled = writeSSEStreamError(ctx, c, openErr)
+	} else {
+		defer stream.Close()
+		chunks := make(chan gatewayStreamChunk)
+		go func() {
+			defer close(chunks)
+			for {
+				chunk, err := stream.Recv()
+				select {
+				case chunks <- gatewayStreamChunk{chunk: chunk, err: err}:
+				case <-ctx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+
+	read:
+		for {
+			select {
+			case <-heartbeat.C:
+				writeSSEHeartbeat(c)
+			case next, ok := <-chunks:
+				if !ok {
+					break read
+				}
+				if errors.Is(next.err, io.EOF) {
+					break read
+				}
+				if next.err != nil {
+					cancelled = writeSSEStreamError(ctx, c, next.err)
+					break read
+				}
+				chunk := next.chunk
+				if chunk.Usage != nil {
+					usage = newTokenUsage(*chunk.Usage)
+				}
+				if !showReasoning && hideStreamReasoning(&chunk) {
+					continue
+				}
+				data, err := json.Marshal(chunk)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+				c.Writer.Flush()
+				heartbeat.reset()
+			}
+		}
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+
+	tokens := 0
+	if usage != nil {
+		recordUsage(req.Model, usage)
+		tokens = usage.TotalTokens
+	}
+	addGatewayUsage(key, tokens)
+	detail := fmt.Sprintf("tokens=%d stream=true", tokens)
+	if cancelled {
+		detail += " cancelled=true"
+	}
+	recordAudit(c, auditActionGatewayChat, req.Model, detail, http.StatusOK)
+}
+
+// writeSSEStreamError 响应开始后上游出错时发送 error 事件，生成被取消时不发送并返回 true
+func writeSSEStreamError(ctx context.Context, c *gin.Context, err error) bool {
+	if generationCancelled(ctx) {
+		requestLogger(c).Info("生成已取消，停止读取上游流式响应")
+		return true
+	}
+	requestLogger(c).Error("读取上游流式响应失败", "error", err)
+	data, _ := json.Marshal(gin.H{"error": gin.H{"message": err.Error(), "type": "upstream_error"}})
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	return false
+}
+
+// gatewayHeartbeatInterval 返回流式响应的心跳间隔，未配置时为 15s，配置为 0 时不发送
+func gatewayHeartbeatInterval(cfg *Config) time.Duration {
+	if cfg.Gateway.Heartbeat == "" {
+		return defaultStreamHeartbeat
+	}
+	d, err := time.ParseDuration(cfg.Gateway.Heartbeat)
+	if err != nil || d < 0 {
+		return defaultStreamHeartbeat
+	}
+	return d
+}
+
+// hideStreamReasoning 去掉分片中的思考过程，去掉后没有其他内容时返回 true
+func hideStreamReasoning(chunk *openai.ChatCompletionStreamResponse) bool {
+	empty := chunk.Usage == nil
+	for i := range chunk.Choices {
+		choice := &chunk.Choices[i]
+		hadReasoning := choice.Delta.ReasoningContent != ""
+		choice.Delta.ReasoningContent = ""
+		if !hadReasoning || choice.Delta.Content != "" || choice.Delta.Role != "" ||
+			len(choice.Delta.ToolCalls) > 0 || choice.Delta.FunctionCall != nil || choice.FinishReason != "" {
+			empty = false
+		}
+	}
+	return empty && len(chunk.Choices) > 0
+}
+
+// enrichWithKnowledge 根据最后一条用户消息检索知识库，把上下文加在该消息前面
+// limit 大于 0 时，放不下的知识库条目从最不相关的开始去掉
+func enrichWithKnowledge(ctx context.Context, model string, messages []openai.ChatCompletionMessage, limit int) {
+	cfg := currentConfig()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != openai.ChatMessageRoleUser || messages[i].Content == "" {
+			continue
+		}
+		question := messages[i].Content
+		for items := retrieveKnowledge(ctx, question); len(items) > 0; items = items[:len(items)-1] {
+			messages[i].Content = formatKnowledgeContext(items) + "\n\n" + question
+			if limit == 0 {
+				return
+			}
+			if tokens, err := countChatTokens(cfg, model, messages); err != nil || tokens <= limit {
+				return
+			}
+		}
+		messages[i].Content = question
+		return
+	}
+}
+
+// checkGatewayQuota 检查密钥当天的配额，超出时返回提示信息的消息ID和对应的上限
+func checkGatewayQuota(key GatewayKey) (string, int) {
+	gatewayQuotaMu.Lock()
+	defer gatewayQuotaMu.Unlock()
+
+	q := currentGatewayQuota(key.Name)
+	if key.DailyRequests > 0 && q.requests >= key.DailyRequests {
+		return "error.quota_requests", key.DailyRequests
+	}
+	if key.DailyTokens > 0 && q.tokens >= key.DailyTokens {
+		return "error.quota_tokens", key.DailyTokens
+	}
+	return "", 0
+}
+
+// addGatewayUsage 累计密钥当天的用量
+func addGatewayUsage(key GatewayKey, tokens int) {
+	gatewayQuotaMu.Lock()
+	defer gatewayQuotaMu.Unlock()
+
+	q := currentGatewayQuota(key.Name)
+	q.requests++
+	q.tokens += tokens
+}
+
+// currentGatewayQuota 返回密钥当天的用量，跨天时清零，调用方需持有 gatewayQuotaMu
+// 新建当天的用量时同时删除其它密钥前几天的用量，已经从配置中删除的密钥不会一直保留
+func currentGatewayQuota(name string) *gatewayQuota {
+	today := time.Now().Format("2006-01-02")
+	q, ok := gatewayQuotas[name]
+	if !ok || q.day != today {
+		for k, stale := range gatewayQuotas {
+			if stale.day != today {
+				delete(gatewayQuotas, k)
+			}
+		}
+		q = &gatewayQuota{day: today}
+		gatewayQuotas[name] = q
+	}
+	return q
+}
+
+// gatewayCacheTTL 返回响应缓存的有效期，未配置时不缓存
+func gatewayCacheTTL(cfg *Config) time.Duration {
+	d, err := time.ParseDuration(cfg.Gateway.CacheTTL)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// gatewayCacheKey 根据请求内容计算缓存键
+func gatewayCacheKey(req openai.ChatCompletionRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// gatewayCacheSize 返回最多缓存的响应数
+func gatewayCacheSize(cfg *Config) int {
+	if cfg.Gateway.CacheSize > 0 {
+		return cfg.Gateway.CacheSize
+	}
+	return defaultGatewayCacheSize
+}
+
+// lookupGatewayCache 查找未过期的缓存响应，命中时移到最近使用的位置
+func lookupGatewayCache(key string) ([]byte, bool) {
+	gatewayCacheMu.Lock()
+	defer gatewayCacheMu.Unlock()
+
+	elem, ok := gatewayCache[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*gatewayCacheEntry)
+	if time.Now().After(entry.expires) {
+		removeGatewayCacheElement(elem)
+		return nil, false
+	}
+	gatewayCacheLRU.MoveToFront(elem)
+	return entry.body, true
+}
+
+// storeGatewayCache 缓存响应，同时清理过期的条目，超出 gateway.cache_size 时淘汰最久没有使用的条目
+func storeGatewayCache(key string, body []byte, ttl time.Duration) {
+	size := gatewayCacheSize(currentConfig())
+	gatewayCacheMu.Lock()
+	defer gatewayCacheMu.Unlock()
+
+	now := time.Now()
+	for elem := gatewayCacheLRU.Back(); elem != nil; {
+		prev := elem.Prev()
+		if now.After(elem.Value.(*gatewayCacheEntry).expires) {
+			removeGatewayCacheElement(elem)
+		}
+		elem = prev
+	}
+	if elem, ok := gatewayCache[key]; ok {
+		removeGatewayCacheElement(elem)
+	}
+	gatewayCache[key] = gatewayCacheLRU.PushFront(&gatewayCacheEntry{key: key, body: body, expires: now.Add(ttl)})
+	for gatewayCacheLRU.Len() > size {
+		removeGatewayCacheElement(gatewayCacheLRU.Back())
+	}
+}
+
+// removeGatewayCacheElement 删除一条缓存，调用方需持有 gatewayCacheMu
+func removeGatewayCacheElement(elem *list.Element) {
+	gatewayCacheLRU.Remove(elem)
+	delete(gatewayCache, elem.Value.(*gatewayCacheEntry).key)
+}
+
+// clearGatewayCache 清空响应缓存
+func clearGatewayCache() {
+	gatewayCacheMu.Lock()
+	defer gatewayCacheMu.Unlock()
+	gatewayCache = map[string]*list.Element{}
+	gatewayCacheLRU.Init()
+}
+
+// respondUpstreamError 上游调用失败时返回 OpenAI 格式的错误，保留上游的状态码
+func respondUpstreamError(c *gin.Context, model string, err error) {
+	requestLogger(c).Error("调用模型失败", "error", err)
+	reportError(c, "upstream", err, "", map[string]interface{}{"model": model})
+
+	status := http.StatusBadGateway
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode >= 400 {
+		status = apiErr.HTTPStatusCode
+	}
+	recordAudit(c, auditActionGatewayChat, model, err.Error(), status)
+	respondOpenAIError(c, status, "upstream_error", err.Error())
+}
+
+// respondOpenAIError 返回 OpenAI 格式的错误，兼容现有客户端的错误处理
+func respondOpenAIError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"message":    message,
+			"type":       code,
+			"code":       code,
+			"request_id": requestID(c),
+		},
+	})
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema GraphQL 接口定义，供需要一次取回多种数据的看板前端使用
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	# 问答记录，按ID倒序；使用数据库存储时包含全部历史，否则为最近的记录
+	qaRecords(limit: Int = 20, offset: Int = 0, model: String, flagged: Boolean, search: String): QARecordPage!
+	# 知识库条目，按ID排序
+	knowledgeItems(limit: Int = 20, offset: Int = 0, tag: String, search: String): KnowledgeItemPage!
+	knowledgeItem(id: Int!): KnowledgeItem
+	# 标签及其使用次数，按次数倒序
+	tags(limit: Int = 50): [TagCount!]!
+	stats: Stats!
+	models: Models!
+}
+
+type Mutation {
+	chat(message: String!, model: String, workspace: String, language: String): ChatResult!
+	addKnowledge(recordId: Int!, title: String!, tags: [String!]): KnowledgeItem!
+	deleteKnowledge(id: Int!): Boolean!
+}
+
+type QARecordPage {
+	totalCount: Int!
+	items: [QARecord!]!
+}
+
+type KnowledgeItemPage {
+	totalCount: Int!
+	items: [KnowledgeItem!]!
+}
+
+type QARecord {
+	id: Int!
+	question: String!
+	answer: String!
+	model: String!
+	timestamp: Time!
+	usage: TokenUsage
+	flagged: Boolean!
+	flags: [String!]!
+}
+
+type KnowledgeItem {
+	id: Int!
+	title: String!
+	content: String!
+	model: String!
+	timestamp: Time!
+	tags: [String!]!
+	# 译文对应的原始条目ID和译文的语言
+	sourceId: Int
+	language: String
+}
+
+type TokenUsage {
+	promptTokens: Int!
+	completionTokens: Int!
+	totalTokens: Int!
+	cachedTokens: Int!
+}
+
+type TagCount {
+	tag: String!
+	count: Int!
+}
+
+type Stats {
+	knowledgeItems: Int!
+	qaRecords: Int!
+	requests: Int!
+	tokens: TokenUsage!
+	cacheHitRatio: Float!
+}
+
+type Models {
+	default: String!
+	available: [String!]!
+}
+
+type ChatResult {
+	response: String!
+	model: String!
+	recordId: Int!
+	usage: TokenUsage
+	warnings: [String!]!
+}
+`
+
+// 解析后的 GraphQL 接口
+var parsedGraphQLSchema = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{})
+
+// 在 context 中保存当前请求的 gin.Context，用于审计日志
+type graphqlContextKey struct{}
+
+// graphqlRequest GraphQL 请求
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlHandler 执行 GraphQL 查询，支持 POST JSON 和 GET 查询参数
+func graphqlHandler(c *gin.Context) {
+	var req graphqlRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if v := c.Query("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				respondError(c, http.StatusBadRequest, tr(c, "error.graphql_variables", err))
+				return
+			}
+		}
+		// GET 请求只允许查询，避免通过链接触发修改
+		if graphqlMutationRequested(req.Query, req.OperationName) {
+			respondError(c, http.StatusBadRequest, tr(c, "error.graphql_mutation_get"))
+			return
+		}
+	} else if !bindJSON(c, &req) {
+		return
+	}
+	if req.Query == "" {
+		respondError(c, http.StatusBadRequest, tr(c, "error.graphql_query_empty"))
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlContextKey{}, c)
+	resp := parsedGraphQLSchema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	c.JSON(http.StatusOK, resp)
+}
+
+// graphqlOperation 文档中的一个顶层定义
+type graphqlOperation struct {
+	// query、mutation、subscription 或 fragment
+	Type string
+	Name string
+}
+
+// graphqlMutationRequested 判断请求要执行的操作是否为修改
+// 指定了 operationName 时只看同名的操作，否则文档中有任何修改都算作修改
+func graphqlMutationRequested(doc, operationName string) bool {
+	for _, op := range graphqlOperations(doc) {
+		if op.Type == "mutation" && (operationName == "" || op.Name == operationName) {
+			return true
+		}
+	}
+	return false
+}
+
+// graphqlOperations 扫描文档，返回顶层定义的类型和名称，省略关键字的 { ... } 为匿名查询
+// 只做词法分析：跳过注释、字符串和块字符串，按括号层级找出顶层定义；语法错误由执行时报告
+func graphqlOperations(doc string) []graphqlOperation {
+	var ops []graphqlOperation
+	depth := 0
+	// expectDefinition 表示下一个顶层名称是定义的关键字，expectName 表示下一个顶层名称是定义的名称
+	expectDefinition, expectName := true, false
+	for i := 0; i < len(doc); {
+		ch := doc[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',':
+			i++
+		case ch == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(doc[i:], `"""`):
+			i += 3
+			for i < len(doc) && !strings.HasPrefix(doc[i:], `"""`) {
+				if strings.HasPrefix(doc[i:], `\"""`) {
+					i += 3
+				}
+				i++
+			}
+			i += 3
+		case ch == '"':
+			i++
+			for i < len(doc) && doc[i] != '"' && doc[i] != '\n' {
+				if doc[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case ch == '{' || ch == '(' || ch == '[':
+			if ch == '{' && depth == 0 && expectDefinition {
+				ops = append(ops, graphqlOperation{Type: "query"})
+			}
+			expectDefinition, expectName = false, false
+			depth++
+			i++
+		case ch == '}' || ch == ')' || ch == ']':
+			if depth > 0 {
+				depth--
+			}
+			if ch == '}' && depth == 0 {
+				expectDefinition = true
+			}
+			expectName = false
+			i++
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			start := i
+			for i < len(doc) && (doc[i] == '_' || doc[i] >= 'a' && doc[i] <= 'z' || doc[i] >= 'A' && doc[i] <= 'Z' || doc[i] >= '0' && doc[i] <= '9') {
+				i++
+			}
+			if depth == 0 && expectDefinition {
+				ops = append(ops, graphqlOperation{Type: doc[start:i]})
+				expectDefinition, expectName = false, true
+			} else if depth == 0 && expectName {
+				ops[len(ops)-1].Name = doc[start:i]
+				expectName = false
+			}
+		default:
+			// 变量、指令等其它符号之后不再是定义的名称
+			if depth == 0 {
+				expectName = false
+			}
+			i++
+		}
+	}
+	return ops
+}
+
+// graphqlGinContext 返回执行查询的 gin.Context
+func graphqlGinContext(ctx context.Context) *gin.Context {
+	c, _ := ctx.Value(graphqlContextKey{}).(*gin.Context)
+	return c
+}
+
+// graphqlResolver 查询和修改的根对象
+type graphqlResolver struct{}
+
+// pageBounds 返回分页后的下标范围，limit 最多 100
+func pageBounds(limit, offset int32, total int) (int, int) {
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	start := int(offset)
+	if start < 0 {
+		start = 0
+	}
+	if start > total {
+		start = total
+	}
+	end := start + int(limit)
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// QaRecords 查询问答记录
+func (r *graphqlResolver) QaRecords(args struct {
+	Limit   int32
+	Offset  int32
+	Model   *string
+	Flagged *bool
+	Search  *string
+}) (*qaRecordPage, error) {
+	records, err := allQARecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []QARecord
+	for _, qa := range records {
+		if args.Model != nil && qa.Model != *args.Model {
+			continue
+		}
+		if args.Flagged != nil && qa.Flagged != *args.Flagged {
+			continue
+		}
+		if args.Search != nil && !containsFold(qa.Question, *args.Search) && !containsFold(qa.Answer, *args.Search) {
+			continue
+		}
+		matched = append(matched, qa)
+	}
+
+	start, end := pageBounds(args.Limit, args.Offset, len(matched))
+	page := &qaRecordPage{total: len(matched), items: []*qaRecordResolver{}}
+	for _, qa := range matched[start:end] {
+		page.items = append(page.items, &qaRecordResolver{qa})
+	}
+	return page, nil
+}
+
+// KnowledgeItems 查询知识库条目
+func (r *graphqlResolver) KnowledgeItems(args struct {
+	Limit  int32
+	Offset int32
+	Tag    *string
+	Search *string
+}) *knowledgeItemPage {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	var matched []KnowledgeItem
+	for _, item := range knowledgeBase {
+		if args.Tag != nil && !containsString(item.Tags, *args.Tag) {
+			continue
+		}
+		if args.Search != nil && !containsFold(item.Title, *args.Search) && !containsFold(item.Content, *args.Search) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	start, end := pageBounds(args.Limit, args.Offset, len(matched))
+	page := &knowledgeItemPage{total: len(matched), items: []*knowledgeItemResolver{}}
+	for _, item := range matched[start:end] {
+		page.items = append(page.items, &knowledgeItemResolver{item})
+	}
+	return page
+}
+
+// KnowledgeItem 按ID查询知识库条目
+func (r *graphqlResolver) KnowledgeItem(args struct{ ID int32 }) *knowledgeItemResolver {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, item := range knowledgeBase {
+		if item.ID == int(args.ID) {
+			return &knowledgeItemResolver{item}
+		}
+	}
+	return nil
+}
+
+// Tags 查询标签统计
+func (r *graphqlResolver) Tags(args struct{ Limit int32 }) []*tagCountResolver {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	tags := []*tagCountResolver{}
+	for _, t := range topTags(int(args.Limit)) {
+		tags = append(tags, &tagCountResolver{t})
+	}
+	return tags
+}
+
+// Stats 查询汇总统计，问答记录数与 qaRecords 查询使用相同的数据
+func (r *graphqlResolver) Stats() (*statsResolver, error) {
+	usageMu.Lock()
+	tokens := usageTotal
+	usageMu.Unlock()
+
+	records, err := allQARecords()
+	if err != nil {
+		return nil, err
+	}
+
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	return &statsResolver{
+		knowledgeItems: len(knowledgeBase),
+		qaRecords:      len(records),
+		tokens:         tokens,
+	}, nil
+}
+
+// Models 查询可用模型
+func (r *graphqlResolver) Models() *modelsResolver {
+	cfg := currentConfig()
+	return &modelsResolver{def: cfg.Models.Default, available: availableModels(cfg)}
+}
+
+// Chat 发送一条消息
+func (r *graphqlResolver) Chat(ctx context.Context, args struct {
+	Message   string
+	Model     *string
+	Workspace *string
+	Language  *string
+}) (*chatResultResolver, error) {
+	c := graphqlGinContext(ctx)
+	if scopeErr := tokenScopeError(c, tokenScopeChat); scopeErr != nil {
+		recordAudit(c, auditActionAuthFailed, "graphql/chat", scopeErr.Message, scopeErr.Status)
+		return nil, &graphqlError{message: scopeErr.localize(requestLocale(c)), code: errorCode(scopeErr.Status)}
+	}
+	req := ChatRequest{Message: args.Message}
+	if args.Model != nil {
+		req.Model = *args.Model
+	}
+	if args.Workspace != nil {
+		req.Workspace = *args.Workspace
+	}
+	if args.Language != nil {
+		if !isValidAnswerLanguage(*args.Language) {
+			return nil, errors.New(tr(c, "error.language_invalid", *args.Language))
+		}
+		req.Language = *args.Language
+	}
+	req.User = requestUser(c)
+	if limit := maxMessageChars(currentConfig()); len([]rune(req.Message)) > limit {
+		return nil, errors.New(tr(c, "error.message_limit", limit))
+	}
+	// 与 chatHandler 相同，没有指定模型时使用默认模型，开启智能路由时在处理过程中选择模型
+	if !routeRequested(currentConfig(), req.Model) {
+		req.Model = resolveModel(currentConfig(), req.Model)
+		c.Set("model", req.Model)
+	}
+
+	resp, record, chatErr := processChat(ctx, req, c.ClientIP())
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			requestLogger(c).Error("调用模型失败", "error", chatErr.Err)
+			reportError(c, "upstream", chatErr.Err, "", map[string]interface{}{"model": req.Model})
+		}
+		if chatErr.Audit {
+			recordAudit(c, auditActionChat, req.Model, chatErr.Message, chatErr.Status)
+		}
+		return nil, &graphqlError{message: chatErr.localize(requestLocale(c)), code: errorCode(chatErr.Status)}
+	}
+	c.Set("model", resp.Model)
+	recordAudit(c, auditActionChat, resp.Model, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+	return &chatResultResolver{resp: resp, recordID: record.ID}, nil
+}
+
+// AddKnowledge 把问答记录添加到知识库
+func (r *graphqlResolver) AddKnowledge(ctx context.Context, args struct {
+	RecordID int32
+	Title    string
+	Tags     *[]string
+}) (*knowledgeItemResolver, error) {
+	c := graphqlGinContext(ctx)
+	if scopeErr := tokenScopeError(c, tokenScopeCapture); scopeErr != nil {
+		recordAudit(c, auditActionAuthFailed, "graphql/addKnowledge", scopeErr.Message, scopeErr.Status)
+		return nil, &graphqlError{message: scopeErr.localize(requestLocale(c)), code: errorCode(scopeErr.Status)}
+	}
+	var source *QARecord
+	dataMu.RLock()
+	for _, record := range recentQAs {
+		if record.ID == int(args.RecordID) {
+			source = &record
+			break
+		}
+	}
+	dataMu.RUnlock()
+	if source == nil {
+		return nil, &graphqlError{message: tr(c, "error.qa_not_found"), code: errorCode(http.StatusNotFound)}
+	}
+
+	var tags []string
+	if args.Tags != nil {
+		for _, tag := range *args.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     args.Title,
+		Content:   source.Answer,
+		Model:     source.Model,
+		Timestamp: time.Now(),
+		Tags:      tags,
+	})
+	if err != nil {
+		chatErr := knowledgeWriteError(err)
+		return nil, &graphqlError{message: chatErr.localize(requestLocale(c)), code: errorCode(chatErr.Status)}
+	}
+	recordAudit(c, auditActionKnowledgeAdd, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	return &knowledgeItemResolver{item}, nil
+}
+
+// DeleteKnowledge 把知识库条目移到回收站，条目不存在时返回 false，只读模式下返回错误
+func (r *graphqlResolver) DeleteKnowledge(ctx context.Context, args struct{ ID int32 }) (bool, error) {
+	item, err := trashKnowledgeItem(int(args.ID))
+	if errors.Is(err, errKnowledgeNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		chatErr := knowledgeWriteError(err)
+		return false, &graphqlError{message: chatErr.localize(requestLocale(graphqlGinContext(ctx))), code: errorCode(chatErr.Status)}
+	}
+	recordAudit(graphqlGinContext(ctx), auditActionKnowledgeDelete, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	return true, nil
+}
+
+// graphqlError 带错误码的 GraphQL 错误，错误码与 REST 接口相同
+type graphqlError struct {
+	message string
+	code    string
+}
+
+func (e *graphqlError) Error() string { return e.message }
+
+// Extensions 错误的扩展字段
+func (e *graphqlError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+type qaRecordPage struct {
+	total int
+	items []*qaRecordResolver
+}
+
+func (p *qaRecordPage) TotalCount() int32          { return int32(p.total) }
+func (p *qaRecordPage) Items() []*qaRecordResolver { return p.items }
+
+type knowledgeItemPage struct {
+	total int
+	items []*knowledgeItemResolver
+}
+
+func (p *knowledgeItemPage) TotalCount() int32               { return int32(p.total) }
+func (p *knowledgeItemPage) Items() []*knowledgeItemResolver { return p.items }
+
+type qaRecordResolver struct{ qa QARecord }
+
+func (r *qaRecordResolver) ID() int32                  { return int32(r.qa.ID) }
+func (r *qaRecordResolver) Question() string           { return r.qa.Question }
+func (r *qaRecordResolver) Answer() string             { return r.qa.Answer }
+func (r *qaRecordResolver) Model() string              { return r.qa.Model }
+func (r *qaRecordResolver) Timestamp() graphql.Time    { return graphql.Time{Time: r.qa.Timestamp} }
+func (r *qaRecordResolver) Usage() *tokenUsageResolver { return newTokenUsageResolver(r.qa.Usage) }
+func (r *qaRecordResolver) Flagged() bool              { return r.qa.Flagged }
+func (r *qaRecordResolver) Flags() []string            { return nonNilStrings(r.qa.Flags) }
+
+type knowledgeItemResolver struct{ item KnowledgeItem }
+
+func (r *knowledgeItemResolver) ID() int32               { return int32(r.item.ID) }
+func (r *knowledgeItemResolver) Title() string           { return r.item.Title }
+func (r *knowledgeItemResolver) Content() string         { return r.item.Content }
+func (r *knowledgeItemResolver) Model() string           { return r.item.Model }
+func (r *knowledgeItemResolver) Timestamp() graphql.Time { return graphql.Time{Time: r.item.Timestamp} }
+func (r *knowledgeItemResolver) Tags() []string          { return nonNilStrings(r.item.Tags) }
+
+// SourceID 不是译文时返回 null
+func (r *knowledgeItemResolver) SourceID() *int32 {
+	if r.item.SourceID == 0 {
+		return nil
+	}
+	id := int32(r.item.SourceID)
+	return &id
+}
+
+// Language 未设置语言时返回 null
+func (r *knowledgeItemResolver) Language() *string {
+	if r.item.Language == "" {
+		return nil
+	}
+	return &r.item.Language
+}
+
+type tokenUsageResolver struct{ u TokenUsage }
+
+// newTokenUsageResolver 用量为空时返回 nil
+func newTokenUsageResolver(u *TokenUsage) *tokenUsageResolver {
+	if u == nil {
+		return nil
+	}
+	return &tokenUsageResolver{*u}
+}
+
+func (r *tokenUsageResolver) PromptTokens() int32     { return int32(r.u.PromptTokens) }
+func (r *tokenUsageResolver) CompletionTokens() int32 { return int32(r.u.CompletionTokens) }
+func (r *tokenUsageResolver) TotalTokens() int32      { return int32(r.u.TotalTokens) }
+func (r *tokenUsageResolver) CachedTokens() int32     { return int32(r.u.CachedTokens) }
+
+type tagCountResolver struct{ t TagCount }
+
+func (r *tagCountResolver) Tag() string  { return r.t.Tag }
+func (r *tagCountResolver) Count() int32 { return int32(r.t.Count) }
+
+type statsResolver struct {
+	knowledgeItems int
+	qaRecords      int
+	tokens         UsageStats
+}
+
+func (r *statsResolver) KnowledgeItems() int32 { return int32(r.knowledgeItems) }
+func (r *statsResolver) QaRecords() int32      { return int32(r.qaRecords) }
+func (r *statsResolver) Requests() int32       { return int32(r.tokens.Requests) }
+func (r *statsResolver) Tokens() *tokenUsageResolver {
+	return &tokenUsageResolver{TokenUsage{
+		PromptTokens:     r.tokens.PromptTokens,
+		CompletionTokens: r.tokens.CompletionTokens,
+		TotalTokens:      r.tokens.TotalTokens,
+		CachedTokens:     r.tokens.CachedTokens,
+	}}
+}
+func (r *statsResolver) CacheHitRatio() float64 { return r.tokens.cacheHitRatio() }
+
+type modelsResolver struct {
+	def       string
+	available []string
+}
+
+func (r *modelsResolver) Default() string     { return r.def }
+func (r *modelsResolver) Available() []string { return nonNilStrings(r.available) }
+
+type chatResultResolver struct {
+	resp     *ChatResponse
+	recordID int
+}
+
+func (r *chatResultResolver) Response() string           { return r.resp.Response }
+func (r *chatResultResolver) Model() string              { return r.resp.Model }
+func (r *chatResultResolver) RecordID() int32            { return int32(r.recordID) }
+func (r *chatResultResolver) Usage() *tokenUsageResolver { return newTokenUsageResolver(r.resp.Usage) }
+func (r *chatResultResolver) Warnings() []string         { return nonNilStrings(r.resp.Warnings) }
+
+// containsFold 不区分大小写地判断是否包含子串
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// nonNilStrings 把 nil 切片转换为空切片，GraphQL 中的非空列表不能返回 null
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
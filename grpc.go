@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	assistantpb "ai-assistant/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// 默认的 gRPC 监听地址
+const defaultGRPCListen = "localhost:9090"
+
+// grpcServer 实现 assistantpb.AssistantServer，与 REST 接口共用存储和模型调用
+type grpcServer struct {
+	assistantpb.UnimplementedAssistantServer
+}
+
+// startGRPCServer 按配置在单独的端口上启动 gRPC 服务
+func startGRPCServer(cfg *Config) {
+	if !cfg.GRPC.Enabled {
+		return
+	}
+	address := cfg.GRPC.Listen
+	if address == "" {
+		address = defaultGRPCListen
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		fatal("gRPC 服务监听失败", "address", address, "error", err)
+	}
+
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(bodyLimit(cfg, ""))),
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+	)
+	assistantpb.RegisterAssistantServer(srv, &grpcServer{})
+	if cfg.GRPC.Reflection {
+		reflection.Register(srv)
+	}
+
+	go func() {
+		slog.Info("gRPC 服务启动", "address", address)
+		if err := srv.Serve(ln); err != nil {
+			slog.Error("gRPC 服务退出", "error", err)
+		}
+	}()
+}
+
+// grpcAdminMethods 需要管理权限的方法，规则与 adminAuth 相同
+var grpcAdminMethods = map[string]bool{
+	assistantpb.Assistant_CreateKnowledge_FullMethodName: true,
+	assistantpb.Assistant_DeleteKnowledge_FullMethodName: true,
+}
+
+// grpcMethodScopes 个人访问令牌可以调用的方法及所需的权限范围，规则与 tokenAuth 相同
+var grpcMethodScopes = map[string]string{
+	assistantpb.Assistant_Chat_FullMethodName: tokenScopeChat,
+}
+
+// grpcIdentityKey 在 context 中保存 gRPC 调用方的键
+type grpcIdentityKey struct{}
+
+// grpcIdentity 认证后的 gRPC 调用方
+type grpcIdentity struct {
+	User   string
+	Scopes []string
+	// 是否携带了有效的令牌
+	Authenticated bool
+}
+
+// grpcUnaryAuth 一元调用的认证拦截器
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// grpcStreamAuth 流式调用的认证拦截器
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &grpcAuthStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcAuthStream 带有认证结果的 ServerStream
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 返回带有调用方的 context
+func (s *grpcAuthStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcAuthorize 按 authorization 元数据中的 Bearer 令牌认证调用方，并检查方法所需的权限
+// 管理方法与 adminAuth 相同：配置了管理令牌时要求管理令牌，否则只允许本机访问；
+// 其余方法与 tokenAuth 相同：携带的令牌必须有效，开启 access_tokens.required 时必须携带令牌
+func grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	cfg := currentConfig()
+	locale := grpcLocale(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+
+	if grpcAdminMethods[method] {
+		if cfg.Admin.Token == "" {
+			if !isLoopbackIP(grpcClientIP(ctx)) {
+				grpcAudit(ctx, auditActionAuthFailed, method, "未配置管理令牌，仅允许本机访问", http.StatusForbidden)
+				return nil, status.Error(codes.PermissionDenied, translate(locale, "error.admin_local_only"))
+			}
+		} else {
+			if values := md.Get("x-admin-token"); token == "" && len(values) > 0 {
+				token = values[0]
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Admin.Token)) != 1 {
+				grpcAudit(ctx, auditActionAuthFailed, method, "管理令牌无效", http.StatusUnauthorized)
+				return nil, status.Error(codes.Unauthenticated, translate(locale, "error.admin_token_invalid"))
+			}
+			grpcAudit(ctx, auditActionAuthSuccess, method, "", http.StatusOK)
+		}
+		return context.WithValue(ctx, grpcIdentityKey{}, grpcIdentity{User: "admin", Scopes: knownTokenScopes, Authenticated: true}), nil
+	}
+
+	var identity grpcIdentity
+	if token != "" {
+		user, scopes, ok := lookupToken(cfg, token)
+		if !ok {
+			grpcAudit(ctx, auditActionAuthFailed, method, "个人访问令牌无效", http.StatusUnauthorized)
+			return nil, status.Error(codes.Unauthenticated, translate(locale, "error.access_token_invalid"))
+		}
+		identity = grpcIdentity{User: user, Scopes: scopes, Authenticated: true}
+	}
+	if scope, ok := grpcMethodScopes[method]; ok {
+		if scopeErr := scopeError(cfg, identity.Scopes, identity.Authenticated, scope); scopeErr != nil {
+			grpcAudit(ctx, auditActionAuthFailed, method, scopeErr.Message, scopeErr.Status)
+			return nil, status.Error(grpcCode(scopeErr.Status), scopeErr.localize(locale))
+		}
+	}
+	if !identity.Authenticated {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, grpcIdentityKey{}, identity), nil
+}
+
+// grpcUser 返回 gRPC 调用方的用户名，匿名调用为 grpc
+func grpcUser(ctx context.Context) string {
+	if identity, ok := ctx.Value(grpcIdentityKey{}).(grpcIdentity); ok {
+		return identity.User
+	}
+	return "grpc"
+}
+
+// Chat 发送消息并以流的形式返回回答
+func (s *grpcServer) Chat(req *assistantpb.ChatRequest, stream assistantpb.Assistant_ChatServer) error {
+	if req.GetMessage() == "" {
+		return status.Error(codes.InvalidArgument, translate(grpcLocale(stream.Context()), "error.message_empty"))
+	}
+	if limit := maxMessageChars(currentConfig()); utf8.RuneCountInString(req.GetMessage()) > limit {
+		return status.Error(codes.InvalidArgument, translate(grpcLocale(stream.Context()), "error.message_limit", limit))
+	}
+
+	ctx := stream.Context()
+	// 模型留空时与 REST 接口相同，由处理流程使用默认模型或智能路由选择
+	chatReq := ChatRequest{Message: req.GetMessage(), Model: req.GetModel(), Workspace: req.GetWorkspace(), User: grpcUser(ctx)}
+
+	// 模型每返回一段内容就发送一条增量，客户端断开后不再发送
+	var sendErr error
+	streamed := false
+	resp, record, chatErr := processChatStream(ctx, chatReq, grpcClientIP(ctx), func(delta string) {
+		if sendErr != nil || delta == "" {
+			return
+		}
+		streamed = true
+		sendErr = stream.Send(&assistantpb.ChatChunk{Delta: delta})
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			slog.Error("调用模型失败", "error", chatErr.Err, "transport", "grpc")
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": chatReq.Model})
+		}
+		if chatErr.Audit {
+			grpcAudit(ctx, auditActionChat, chatReq.Model, chatErr.Message, chatErr.Status)
+		}
+		return status.Error(grpcCode(chatErr.Status), chatErr.localize(grpcLocale(ctx)))
+	}
+	grpcAudit(ctx, auditActionChat, resp.Model, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+
+	// 关闭 streaming 时上游为非流式调用，完整回答作为一条增量发送；最后发送带用量的结束消息
+	if !streamed {
+		if err := stream.Send(&assistantpb.ChatChunk{Delta: resp.Response, Model: resp.Model}); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&assistantpb.ChatChunk{
+		Done:     true,
+		Model:    resp.Model,
+		Usage:    toPBUsage(resp.Usage),
+		RecordId: int64(record.ID),
+		Warnings: resp.Warnings,
+	})
+}
+
+// ListModels 返回可用模型
+func (s *grpcServer) ListModels(ctx context.Context, _ *assistantpb.ListModelsRequest) (*assistantpb.ListModelsResponse, error) {
+	cfg := currentConfig()
+	return &assistantpb.ListModelsResponse{Default: cfg.Models.Default, Available: availableModels(cfg)}, nil
+}
+
+// ListKnowledge 返回知识库条目，可按标签筛选
+func (s *grpcServer) ListKnowledge(ctx context.Context, req *assistantpb.ListKnowledgeRequest) (*assistantpb.ListKnowledgeResponse, error) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	resp := &assistantpb.ListKnowledgeResponse{}
+	for _, item := range knowledgeBase {
+		if req.GetTag() != "" && !containsString(item.Tags, req.GetTag()) {
+			continue
+		}
+		resp.Items = append(resp.Items, toPBKnowledge(item))
+	}
+	return resp, nil
+}
+
+// GetKnowledge 返回一条知识库条目
+func (s *grpcServer) GetKnowledge(ctx context.Context, req *assistantpb.GetKnowledgeRequest) (*assistantpb.KnowledgeItem, error) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	for _, item := range knowledgeBase {
+		if int64(item.ID) == req.GetId() {
+			return toPBKnowledge(item), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, translate(grpcLocale(ctx), "error.knowledge_not_found"))
+}
+
+// CreateKnowledge 添加知识库条目
+func (s *grpcServer) CreateKnowledge(ctx context.Context, req *assistantpb.CreateKnowledgeRequest) (*assistantpb.KnowledgeItem, error) {
+	if strings.TrimSpace(req.GetTitle()) == "" {
+		return nil, status.Error(codes.InvalidArgument, translate(grpcLocale(ctx), "error.title_empty"))
+	}
+	item := KnowledgeItem{
+		Title:     req.GetTitle(),
+		Content:   req.GetContent(),
+		Model:     req.GetModel(),
+		Timestamp: time.Now(),
+		Tags:      req.GetTags(),
+	}
+
+	switch {
+	case req.GetRecordId() != 0 && req.GetContent() != "":
+		return nil, status.Error(codes.InvalidArgument, translate(grpcLocale(ctx), "error.content_and_record"))
+	case req.GetRecordId() != 0:
+		found := false
+		dataMu.RLock()
+		for _, record := range recentQAs {
+			if int64(record.ID) == req.GetRecordId() {
+				item.Content, item.Model, found = record.Answer, record.Model, true
+				break
+			}
+		}
+		dataMu.RUnlock()
+		if !found {
+			return nil, status.Error(codes.NotFound, translate(grpcLocale(ctx), "error.qa_not_found"))
+		}
+	case req.GetContent() == "":
+		return nil, status.Error(codes.InvalidArgument, translate(grpcLocale(ctx), "error.content_or_record"))
+	}
+
+	item, err := addKnowledgeItem(item)
+	if err != nil {
+		chatErr := knowledgeWriteError(err)
+		return nil, status.Error(grpcCode(chatErr.Status), chatErr.localize(grpcLocale(ctx)))
+	}
+	grpcAudit(ctx, auditActionKnowledgeAdd, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	return toPBKnowledge(item), nil
+}
+
+// DeleteKnowledge 把知识库条目移到回收站
+func (s *grpcServer) DeleteKnowledge(ctx context.Context, req *assistantpb.DeleteKnowledgeRequest) (*assistantpb.DeleteKnowledgeResponse, error) {
+	item, err := trashKnowledgeItem(int(req.GetId()))
+	if err != nil {
+		chatErr := knowledgeWriteError(err)
+		return nil, status.Error(grpcCode(chatErr.Status), chatErr.localize(grpcLocale(ctx)))
+	}
+	grpcAudit(ctx, auditActionKnowledgeDelete, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	return &assistantpb.DeleteKnowledgeResponse{}, nil
+}
+
+// grpcClientIP 返回 gRPC 请求的对端地址
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// grpcAudit 为 gRPC 请求写入审计日志
+func grpcAudit(ctx context.Context, action, resource, detail string, code int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      grpcUser(ctx),
+		ClientIP:  grpcClientIP(ctx),
+		Action:    action,
+		Resource:  resource,
+		Detail:    detail,
+		Status:    code,
+	})
+}
+
+// grpcCode 把HTTP状态码转换为 gRPC 状态码
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case statusClientClosedRequest:
+		return codes.Canceled
+	}
+	return codes.Internal
+}
+
+// toPBKnowledge 转换知识库条目
+func toPBKnowledge(item KnowledgeItem) *assistantpb.KnowledgeItem {
+	return &assistantpb.KnowledgeItem{
+		Id:        int64(item.ID),
+		Title:     item.Title,
+		Content:   item.Content,
+		Model:     item.Model,
+		Timestamp: timestamppb.New(item.Timestamp),
+		Tags:      item.Tags,
+	}
+}
+
+// toPBUsage 转换token用量
+func toPBUsage(u *TokenUsage) *assistantpb.TokenUsage {
+	if u == nil {
+		return nil
+	}
+	return &assistantpb.TokenUsage{
+		PromptTokens:     int32(u.PromptTokens),
+		CompletionTokens: int32(u.CompletionTokens),
+		TotalTokens:      int32(u.TotalTokens),
+		CachedTokens:     int32(u.CachedTokens),
+	}
+}
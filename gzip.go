@@ -0,0 +1,193 @@
+package main
+
+import (
+	"compress/flate"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+)
+
+// 响应压缩的默认参数
+const (
+	defaultCompressMinSize = 1024
+	encodingGzip           = "gzip"
+	encodingDeflate        = "deflate"
+)
+
+// 会被压缩的响应类型，流式响应（text/event-stream）不压缩
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/csv",
+	"text/markdown",
+	"text/javascript",
+}
+
+// compressMiddleware 按 Accept-Encoding 对较大的文本响应进行 gzip/deflate 压缩
+// 响应先缓存到 min_size 字节，不足该大小的响应原样返回
+func compressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := currentConfig().Server.Compression
+		if !cfg.Enabled || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		minSize := cfg.MinSize
+		if minSize <= 0 {
+			minSize = defaultCompressMinSize
+		}
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, level: cfg.Level, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoding 根据 Accept-Encoding 选择压缩方式，优先 gzip
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted[encodingGzip] || accepted["*"]:
+		return encodingGzip
+	case accepted[encodingDeflate]:
+		return encodingDeflate
+	}
+	return ""
+}
+
+// compressWriter 缓存响应开头的内容，超过阈值且类型可压缩时开始压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser
+}
+
+// Write 写入响应内容
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.zw != nil {
+			return w.zw.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString 写入字符串响应内容
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应刷新时不再等待阈值
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide 决定是否压缩，并写出已缓存的内容
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	if large && header.Get("Content-Encoding") == "" && w.Status() != http.StatusNoContent &&
+		w.Status() != http.StatusNotModified && isCompressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		var err error
+		if w.encoding == encodingGzip {
+			w.zw, err = gzip.NewWriterLevel(w.ResponseWriter, w.compressLevel())
+		} else {
+			w.zw, err = flate.NewWriter(w.ResponseWriter, w.compressLevel())
+		}
+		if err != nil {
+			w.zw = nil
+			header.Del("Content-Encoding")
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish 请求结束时写出剩余内容并结束压缩流
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+	}
+}
+
+// compressLevel 返回压缩级别，未配置时使用默认级别
+func (w *compressWriter) compressLevel() int {
+	if w.level < 1 || w.level > 9 {
+		return flate.DefaultCompression
+	}
+	return w.level
+}
+
+// isCompressible 判断响应类型是否需要压缩
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
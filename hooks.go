@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未配置 token_header 时读取令牌的请求头
+const defaultHookTokenHeader = "X-Hook-Token"
+
+// 审计日志中的触发器操作
+const auditActionHookTrigger = "hook.trigger"
+
+// HookConfig 入站 Webhook 触发器：把收到的 JSON 套用提示词模板后交给对话流程
+type HookConfig struct {
+	Name string `yaml:"name"`
+	// 调用方需要在请求头或 token 查询参数中带上的令牌，为空时不校验
+	Token string `yaml:"token"`
+	// 读取令牌的请求头，默认 X-Hook-Token，GitLab 可设置为 X-Gitlab-Token
+	TokenHeader string `yaml:"token_header"`
+	// 提示词模板（Go text/template），数据为请求体，渲染结果为空时跳过
+	Template string `yaml:"template"`
+	// 保存到知识库时的标题模板，为空时使用提示词开头
+	Title     string   `yaml:"title"`
+	Model     string   `yaml:"model"`
+	Workspace string   `yaml:"workspace"`
+	Save      bool     `yaml:"save"`
+	Tags      []string `yaml:"tags"`
+	// 立即返回 202 并在后台处理，适用于等待时间较短的调用方
+	Async bool `yaml:"async"`
+}
+
+// hookTemplateFuncs 模板中可用的函数
+var hookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) string {
+		data, _ := json.MarshalIndent(v, "", "  ")
+		return string(data)
+	},
+}
+
+// findHook 按名称查找触发器
+func findHook(cfg *Config, name string) (HookConfig, bool) {
+	for _, hook := range cfg.Hooks {
+		if hook.Name == name {
+			return hook, true
+		}
+	}
+	return HookConfig{}, false
+}
+
+// parseHookTemplate 解析触发器模板
+func parseHookTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(hookTemplateFuncs).Parse(text)
+}
+
+// renderHookTemplate 用请求体渲染模板，返回去掉首尾空白的结果
+func renderHookTemplate(name, text string, payload interface{}) (string, error) {
+	tmpl, err := parseHookTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// hookHandler 接收任意 JSON，按触发器的模板生成提示词并交给与 /api/v1/chat 相同的处理流程
+// 配置了 save 时把回答保存到知识库
+func hookHandler(c *gin.Context) {
+	cfg := currentConfig()
+	hook, ok := findHook(cfg, c.Param("name"))
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.hook_not_found", c.Param("name")))
+		return
+	}
+
+	if hook.Token != "" {
+		header := hook.TokenHeader
+		if header == "" {
+			header = defaultHookTokenHeader
+		}
+		token := c.GetHeader(header)
+		if token == "" {
+			token = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(hook.Token)) != 1 {
+			recordAudit(c, auditActionAuthFailed, c.FullPath(), "触发器 "+hook.Name+" 令牌无效", http.StatusUnauthorized)
+			respondError(c, http.StatusUnauthorized, tr(c, "error.token_invalid"))
+			return
+		}
+	}
+
+	var payload interface{}
+	if !bindJSON(c, &payload) {
+		return
+	}
+	message, err := renderHookTemplate(hook.Name, hook.Template, payload)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, tr(c, "error.template_failed", err))
+		return
+	}
+	if message == "" {
+		c.JSON(http.StatusOK, gin.H{"message": tr(c, "message.hook_skipped"), "skipped": true})
+		return
+	}
+	if !checkMessageLength(c, message) {
+		return
+	}
+	title := askDefaultTitle(message)
+	if hook.Save && hook.Title != "" {
+		if t, err := renderHookTemplate(hook.Name+".title", hook.Title, payload); err == nil && t != "" {
+			title = askDefaultTitle(t)
+		}
+	}
+
+	if hook.Async {
+		clientIP := c.ClientIP()
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+			defer cancel()
+			if _, _, chatErr := runHook(ctx, hook, message, title, clientIP); chatErr != nil {
+				slog.Error("触发器处理失败", "hook", hook.Name, "error", chatErr.Message)
+			}
+		}()
+		recordAudit(c, auditActionHookTrigger, hook.Name, "async", http.StatusAccepted)
+		c.JSON(http.StatusAccepted, gin.H{"message": tr(c, "message.hook_accepted")})
+		return
+	}
+
+	resp, item, chatErr := runHook(c.Request.Context(), hook, message, title, c.ClientIP())
+	if chatErr != nil {
+		recordAudit(c, auditActionHookTrigger, hook.Name, chatErr.Message, chatErr.Status)
+		respondError(c, chatErr.Status, chatErr.localize(requestLocale(c)))
+		return
+	}
+	recordAudit(c, auditActionHookTrigger, hook.Name, fmt.Sprintf("record_id=%d", resp.RecordID), http.StatusOK)
+
+	result := gin.H{
+		"response":  resp.Response,
+		"model":     resp.Model,
+		"record_id": resp.RecordID,
+	}
+	if item != nil {
+		result["knowledge_id"] = item.ID
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// runHook 调用模型，需要时保存到知识库
+func runHook(ctx context.Context, hook HookConfig, message, title, clientIP string) (*ChatResponse, *KnowledgeItem, *chatError) {
+	req := ChatRequest{Message: message, Model: hook.Model, Workspace: hook.Workspace}
+	resp, record, chatErr := processChat(ctx, req, clientIP)
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": hook.Model, "source": "hook", "hook": hook.Name})
+		}
+		return nil, nil, chatErr
+	}
+	if !hook.Save {
+		return resp, nil, nil
+	}
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     title,
+		Content:   record.Answer,
+		Model:     record.Model,
+		Timestamp: time.Now(),
+		Tags:      hook.Tags,
+	})
+	if err != nil {
+		return nil, nil, knowledgeWriteError(err)
+	}
+	return resp, &item, nil
+}
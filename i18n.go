@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// 支持的语言
+const (
+	localeZhCN = "zh-CN"
+	localeEn   = "en"
+)
+
+var supportedLocales = []string{localeZhCN, localeEn}
+
+const localeContextKey = "locale"
+
+// localeMessages 接口返回给用户的提示和错误信息，按语言和消息ID索引
+var localeMessages = map[string]map[string]string{
+	localeZhCN: {
+		"error.internal":                   "服务器内部错误",
+		"error.page_load":                  "页面加载失败",
+		"error.limit_invalid":              "limit 参数必须为正整数",
+		"error.since_invalid":              "since 参数格式错误，应为RFC3339时间",
+		"error.min_score_invalid":          "min_score 应在 0 到 10 之间",
+		"error.finetune_format_invalid":    "format 无效: %q，可选 openai、sharegpt",
+		"error.finetune_dataset_invalid":   "数据集无效: %v",
+		"error.finetune_dataset_empty":     "没有符合条件的问答记录",
+		"error.finetune_epochs_invalid":    "epochs 不能为负数",
+		"error.finetune_upstream":          "调用上游微调接口失败: %v",
+		"error.finetune_job_not_found":     "没有找到微调任务 %s",
+		"error.finetune_job_finished":      "微调任务 %s 已经结束（%s），不能取消",
+		"error.until_invalid":              "until 参数格式错误，应为RFC3339时间",
+		"error.admin_local_only":           "未配置管理令牌，仅允许本机访问管理接口",
+		"error.admin_token_invalid":        "管理令牌无效",
+		"error.read_audit_log":             "读取审计日志失败",
+		"error.read_moderation_log":        "读取审核日志失败",
+		"error.read_deliveries":            "读取投递记录失败",
+		"error.read_events":                "读取事件日志失败",
+		"error.read_schedule_runs":         "读取运行记录失败",
+		"error.read_shadow_log":            "读取影子流量对比记录失败",
+		"error.read_failures":              "读取失败记录失败",
+		"error.announcement_level_invalid": "level 无效: %q，可选 info、warning、critical",
+		"error.announcement_time_invalid":  "ends_at 必须晚于 starts_at",
+		"error.save_announcement":          "保存公告失败",
+		"error.read_only":                  "服务正在维护，暂时只能浏览知识库，请稍后再试",
+		"error.read_only_config":           "只读模式由配置 maintenance.read_only 开启，请修改配置后重新加载",
+		"error.backup_failed":              "备份失败: %v",
+		"error.reload_failed":              "重新加载配置失败: %v",
+		"error.qa_not_found":               "未找到对应的问答记录",
+		"error.feedback_rating_invalid":    "rating 无效: %q，可选 up、down",
+		"error.read_feedback":              "读取反馈失败",
+		"error.curation_action_invalid":    "action 无效: %q，可选 accept、edit、reject",
+		"error.curation_answer_required":   "action 为 edit 时需要提供修改后的 answer",
+		"error.golden_format_invalid":      "format 无效: %q，可选 openai、sharegpt、eval",
+		"error.no_stronger_model":          "没有比 %s 能力更强的可用模型，请在 models.settings 中配置 tier",
+		"error.job_not_found":              "没有找到正在进行的生成 %s",
+		"error.generation_cancelled":       "生成已取消",
+		"error.knowledge_not_found":        "未找到对应的知识库条目",
+		"error.trash_item_not_found":       "回收站中没有对应的条目",
+		"error.undo_expired":               "撤销令牌无效或已过期",
+		"error.link_type_invalid":          "type 无效: %q，可选 supersedes、related、part-of",
+		"error.access_token_required":      "需要个人访问令牌",
+		"error.access_token_invalid":       "个人访问令牌无效或已过期",
+		"error.access_token_scope":         "个人访问令牌没有 %s 权限",
+		"error.access_token_scope_invalid": "scopes 无效: %q，可选 capture、chat",
+		"error.access_token_not_found":     "未找到对应的个人访问令牌",
+		"error.expires_in_invalid":         "expires_in 无效: %q",
+		"error.link_self":                  "不能关联到条目自身",
+		"error.link_target_not_found":      "关联的目标条目 %d 不存在",
+		"error.link_exists":                "关联已存在",
+		"error.link_not_found":             "未找到对应的关联",
+		"error.stale_check_running":        "链接检查正在进行，请稍后再试",
+		"error.undo_conflict":              "数据已经发生变化，无法撤销",
+		"error.message_empty":              "message 不能为空",
+		"error.message_too_long":           "消息过长：共 %d 个字符，最多允许 %d 个字符，请精简内容或分多次发送",
+		"error.message_limit":              "消息过长，最多允许 %d 个字符",
+		"error.body_too_large":             "请求体过大，最多允许 %s",
+		"error.language_invalid":           "language 无效: %q，应为语言标签（如 en、zh-CN）或 auto",
+		"error.target_language_invalid":    "target_language 无效: %q，应为语言标签（如 en、zh-CN）",
+		"error.source_language_invalid":    "source_language 无效: %q，应为语言标签（如 en、zh-CN）",
+		"error.formality_invalid":          "formality 无效: %q，可选 default、formal、informal",
+		"error.max_keywords_invalid":       "max_keywords 应在 1 到 %d 之间",
+		"error.extract_failed":             "提取失败: %v",
+		"error.embeddings_disabled":        "未配置 embeddings.model，向量接口不可用",
+		"error.topics_running":             "主题分析正在进行，请稍后再试",
+		"error.qa_history_unavailable":     "分析问答历史需要数据库存储（storage.driver 为 bolt、sqlite 或 postgres），数据文件只保存最近 %d 条问答",
+		"error.topics_failed":              "主题分析失败: %v",
+		"error.window_invalid":             "window 无效: %q",
+		"error.min_count_invalid":          "min_count 应为正整数",
+		"error.trending_not_found":         "时间范围内没有这个问题",
+		"error.trending_published":         "最佳回答已经在知识库中（条目 %d）",
+		"error.embeddings_failed":          "生成向量失败: %v",
+		"error.embeddings_input_invalid":   "input 应为字符串或字符串数组",
+		"error.embeddings_input_count":     "input 应包含 1 到 %d 条文本",
+		"error.embeddings_input_empty":     "input[%d] 不能为空",
+		"error.rerank_documents_count":     "documents 最多 %d 条",
+		"error.top_n_invalid":              "top_n 不能为负数",
+		"error.rerank_provider_invalid":    "provider 无效: %q，可选 llm 或 model",
+		"error.rerank_model_missing":       "provider 为 model 时需要指定 model 或配置 rag.rerank.model",
+		"error.rerank_failed":              "重排失败: %v",
+		"error.token_count_source":         "text 和 messages 需要且只能提供其中一个",
+		"error.models_refresh_failed":      "从上游获取模型列表失败: %v",
+		"error.already_in_language":        "该条目已经是 %s",
+		"error.translate_failed":           "翻译失败: %v",
+		"error.verify_failed":              "复核失败: %v",
+		"error.score_failed":               "评分失败: %v",
+		"error.ocr_failed":                 "识别图片文字失败: %v",
+		"error.capture_empty":              "内容不能为空",
+		"error.capture_invalid_url":        "来源链接无效: %s",
+		"error.ocr_no_text":                "图片中没有识别出文字",
+		"error.ocr_unsupported_image":      "不支持的图片格式: %s，可选 PNG、JPEG、GIF、WebP",
+		"error.summary_source":             "text、knowledge_id 和 record_id 需要且只能提供其中一个",
+		"error.summary_length_invalid":     "length 无效: %q，可选 short、medium、long",
+		"error.summary_style_invalid":      "style 无效: %q，可选 paragraph、bullets、executive",
+		"error.summarize_failed":           "生成摘要失败: %v",
+		"error.title_empty":                "title 不能为空",
+		"error.content_and_record":         "content 和 record_id 只能提供其中一个",
+		"error.content_or_record":          "需要提供 content 或 record_id",
+		"error.moderation_failed":          "内容审核失败: %v",
+		"error.moderation_blocked":         "消息未通过内容审核",
+		"error.plugin_rejected":            "插件 %s 拒绝了请求：%s",
+		"error.dingtalk_webhook_invalid":   "sessionWebhook 不是钉钉的地址",
+		"error.response_rejected":          "回复包含被禁止的内容",
+		"error.hook_not_found":             "未找到触发器: %s",
+		"error.token_invalid":              "令牌无效",
+		"error.template_failed":            "渲染模板失败: %v",
+		"error.signature_invalid":          "签名无效",
+		"error.read_request":               "读取请求失败",
+		"error.invalid_message":            "无法解析消息内容",
+		"error.invalid_callback":           "无法解析回调内容",
+		"error.invalid_event":              "无法解析事件: %v",
+		"error.invalid_verification":       "无法解析验证请求",
+		"error.schedule_not_found":         "未找到定时任务: %s",
+		"error.schedule_running":           "任务正在运行，请稍后再试",
+		"error.graphql_variables":          "variables 不是有效的JSON: %v",
+		"error.graphql_mutation_get":       "mutation 需要使用 POST 请求",
+		"error.graphql_query_empty":        "query 不能为空",
+		"error.gateway_disabled":           "未启用 OpenAI 兼容接口",
+		"error.api_key_invalid":            "API 密钥无效",
+		"error.messages_empty":             "messages 不能为空",
+		"error.model_unavailable":          "模型 %s 不可用",
+		"error.context_exceeded":           "提示词过长：%d 个 token，模型最多允许 %d 个",
+		"error.model_capability":           "模型 %s 不支持 %s",
+		"error.feature_disabled":           "功能 %s 已关闭",
+		"error.quota_requests":             "已达到每日请求数上限（%d），请明天再试",
+		"error.quota_tokens":               "已达到每日 token 上限（%d），请明天再试",
+		"error.batch_line_invalid":         "第 %d 行格式无效: %v",
+		"error.batch_line_no_message":      "第 %d 行缺少 message",
+		"error.batch_too_many":             "条数超过上限，最多允许 %d 条",
+		"error.batch_empty":                "输入中没有任何条目",
+		"message.cache_cleared":            "缓存已清空",
+		"message.index_rebuilt":            "知识库索引已重建",
+		"message.backup_done":              "备份完成",
+		"message.finetune_created":         "已创建微调任务",
+		"message.finetune_cancelled":       "已取消微调任务",
+		"message.feedback_recorded":        "感谢反馈",
+		"message.curation_saved":           "已保存审核结果",
+		"message.knowledge_added":          "已成功添加到知识库",
+		"message.knowledge_deleted":        "已将知识库条目移到回收站",
+		"message.knowledge_restored":       "已从回收站恢复知识库条目",
+		"message.knowledge_purged":         "已永久删除知识库条目",
+		"message.undone":                   "已撤销",
+		"message.link_added":               "已添加关联",
+		"message.link_removed":             "已删除关联",
+		"message.knowledge_translated":     "已翻译并保存到知识库",
+		"message.knowledge_published":      "已取消草稿标记",
+		"message.access_token_revoked":     "已撤销个人访问令牌",
+		"message.models_refreshed":         "已从上游获取 %d 个模型",
+		"message.generation_cancelled":     "已取消生成",
+		"message.hook_skipped":             "模板结果为空，已跳过",
+		"message.hook_accepted":            "已接受，正在后台处理",
+		"message.config_reloaded":          "配置已重新加载",
+	},
+	localeEn: {
+		"error.internal":                   "Internal server error",
+		"error.page_load":                  "Failed to load page",
+		"error.limit_invalid":              "limit must be a positive integer",
+		"error.since_invalid":              "Invalid since parameter, expected an RFC3339 time",
+		"error.min_score_invalid":          "min_score must be between 0 and 10",
+		"error.finetune_format_invalid":    "Invalid format: %q, expected openai or sharegpt",
+		"error.finetune_dataset_invalid":   "Invalid dataset: %v",
+		"error.finetune_dataset_empty":     "No QA records match the filters",
+		"error.finetune_epochs_invalid":    "epochs must not be negative",
+		"error.finetune_upstream":          "Fine-tuning request to the upstream failed: %v",
+		"error.finetune_job_not_found":     "Fine-tuning job %s not found",
+		"error.finetune_job_finished":      "Fine-tuning job %s has already finished (%s) and cannot be cancelled",
+		"error.until_invalid":              "Invalid until parameter, expected an RFC3339 time",
+		"error.admin_local_only":           "No admin token is configured; the admin API is only available from localhost",
+		"error.admin_token_invalid":        "Invalid admin token",
+		"error.read_audit_log":             "Failed to read the audit log",
+		"error.read_moderation_log":        "Failed to read the moderation log",
+		"error.read_deliveries":            "Failed to read webhook deliveries",
+		"error.read_events":                "Failed to read the event log",
+		"error.read_schedule_runs":         "Failed to read schedule runs",
+		"error.read_shadow_log":            "Failed to read shadow traffic comparisons",
+		"error.read_failures":              "Failed to read the failure log",
+		"error.announcement_level_invalid": "Invalid level: %q, expected info, warning or critical",
+		"error.announcement_time_invalid":  "ends_at must be later than starts_at",
+		"error.save_announcement":          "Failed to save the announcement",
+		"error.read_only":                  "The service is under maintenance and read-only for now, please try again later",
+		"error.read_only_config":           "Read-only mode is enabled by maintenance.read_only in the configuration; change it and reload",
+		"error.backup_failed":              "Backup failed: %v",
+		"error.reload_failed":              "Failed to reload configuration: %v",
+		"error.qa_not_found":               "QA record not found",
+		"error.feedback_rating_invalid":    "Invalid rating: %q, expected up or down",
+		"error.read_feedback":              "Failed to read feedback",
+		"error.curation_action_invalid":    "Invalid action: %q, expected accept, edit or reject",
+		"error.curation_answer_required":   "An edited answer is required when action is edit",
+		"error.golden_format_invalid":      "Invalid format: %q, expected openai, sharegpt or eval",
+		"error.no_stronger_model":          "No stronger model than %s is available; set tier in models.settings",
+		"error.job_not_found":              "No generation in progress with ID %s",
+		"error.generation_cancelled":       "Generation cancelled",
+		"error.knowledge_not_found":        "Knowledge item not found",
+		"error.trash_item_not_found":       "Item not found in the trash",
+		"error.undo_expired":               "The undo token is invalid or has expired",
+		"error.link_type_invalid":          "Invalid type: %q, expected supersedes, related or part-of",
+		"error.access_token_required":      "A personal access token is required",
+		"error.access_token_invalid":       "Personal access token is invalid or expired",
+		"error.access_token_scope":         "Personal access token does not have the %s scope",
+		"error.access_token_scope_invalid": "Invalid scope: %q, expected capture or chat",
+		"error.access_token_not_found":     "Personal access token not found",
+		"error.expires_in_invalid":         "Invalid expires_in: %q",
+		"error.link_self":                  "An item cannot be linked to itself",
+		"error.link_target_not_found":      "Link target %d not found",
+		"error.link_exists":                "The link already exists",
+		"error.link_not_found":             "Link not found",
+		"error.stale_check_running":        "A link check is already running, please try again later",
+		"error.undo_conflict":              "The data has changed since and the operation cannot be undone",
+		"error.message_empty":              "message must not be empty",
+		"error.message_too_long":           "Message too long: %d characters, at most %d allowed. Please shorten it or send it in several parts",
+		"error.message_limit":              "Message too long, at most %d characters allowed",
+		"error.body_too_large":             "Request body too large, at most %s allowed",
+		"error.language_invalid":           "Invalid language %q, expected a language tag (such as en or zh-CN) or auto",
+		"error.target_language_invalid":    "Invalid target_language %q, expected a language tag such as en or zh-CN",
+		"error.source_language_invalid":    "Invalid source_language %q, expected a language tag such as en or zh-CN",
+		"error.formality_invalid":          "Invalid formality %q, expected default, formal or informal",
+		"error.max_keywords_invalid":       "max_keywords must be between 1 and %d",
+		"error.extract_failed":             "Extraction failed: %v",
+		"error.embeddings_disabled":        "Embeddings are unavailable because embeddings.model is not configured",
+		"error.topics_running":             "Topic analysis is already running, try again later",
+		"error.qa_history_unavailable":     "Analyzing QA history requires database storage (storage.driver bolt, sqlite or postgres); data files keep only the last %d records",
+		"error.topics_failed":              "Topic analysis failed: %v",
+		"error.window_invalid":             "Invalid window: %q",
+		"error.min_count_invalid":          "min_count must be a positive integer",
+		"error.trending_not_found":         "No such question in the time window",
+		"error.trending_published":         "The best answer is already in the knowledge base (item %d)",
+		"error.embeddings_failed":          "Failed to create embeddings: %v",
+		"error.embeddings_input_invalid":   "input must be a string or an array of strings",
+		"error.embeddings_input_count":     "input must contain between 1 and %d texts",
+		"error.embeddings_input_empty":     "input[%d] must not be empty",
+		"error.rerank_documents_count":     "documents can contain at most %d items",
+		"error.top_n_invalid":              "top_n must not be negative",
+		"error.rerank_provider_invalid":    "Invalid provider %q, expected llm or model",
+		"error.rerank_model_missing":       "provider model requires a model or rag.rerank.model",
+		"error.rerank_failed":              "Rerank failed: %v",
+		"error.token_count_source":         "Provide exactly one of text or messages",
+		"error.models_refresh_failed":      "Failed to fetch the model list from the provider: %v",
+		"error.already_in_language":        "The item is already in %s",
+		"error.translate_failed":           "Translation failed: %v",
+		"error.verify_failed":              "Verification failed: %v",
+		"error.score_failed":               "Scoring failed: %v",
+		"error.ocr_failed":                 "Failed to recognize text in the image: %v",
+		"error.capture_empty":              "Text must not be empty",
+		"error.capture_invalid_url":        "Invalid source URL: %s",
+		"error.ocr_no_text":                "No text was recognized in the image",
+		"error.ocr_unsupported_image":      "Unsupported image format: %s, expected PNG, JPEG, GIF or WebP",
+		"error.summary_source":             "Exactly one of text, knowledge_id and record_id is required",
+		"error.summary_length_invalid":     "Invalid length %q, expected short, medium or long",
+		"error.summary_style_invalid":      "Invalid style %q, expected paragraph, bullets or executive",
+		"error.summarize_failed":           "Failed to generate summary: %v",
+		"error.title_empty":                "title must not be empty",
+		"error.content_and_record":         "Only one of content and record_id may be provided",
+		"error.content_or_record":          "Either content or record_id is required",
+		"error.moderation_failed":          "Content moderation failed: %v",
+		"error.moderation_blocked":         "The message did not pass content moderation",
+		"error.plugin_rejected":            "Plugin %s rejected the request: %s",
+		"error.dingtalk_webhook_invalid":   "sessionWebhook is not a DingTalk address",
+		"error.response_rejected":          "The response contains blocked content",
+		"error.hook_not_found":             "Hook not found: %s",
+		"error.token_invalid":              "Invalid token",
+		"error.template_failed":            "Failed to render template: %v",
+		"error.signature_invalid":          "Invalid signature",
+		"error.read_request":               "Failed to read request",
+		"error.invalid_message":            "Unable to parse message",
+		"error.invalid_callback":           "Unable to parse callback",
+		"error.invalid_event":              "Unable to parse event: %v",
+		"error.invalid_verification":       "Unable to parse verification request",
+		"error.schedule_not_found":         "Schedule not found: %s",
+		"error.schedule_running":           "The schedule is already running, please try again later",
+		"error.graphql_variables":          "variables is not valid JSON: %v",
+		"error.graphql_mutation_get":       "Mutations require a POST request",
+		"error.graphql_query_empty":        "query must not be empty",
+		"error.gateway_disabled":           "The OpenAI-compatible API is not enabled",
+		"error.api_key_invalid":            "Invalid API key",
+		"error.messages_empty":             "messages must not be empty",
+		"error.model_unavailable":          "Model %s is not available",
+		"error.context_exceeded":           "The prompt is too long: %d tokens, the model allows at most %d",
+		"error.model_capability":           "Model %s does not support %s",
+		"error.feature_disabled":           "Feature %s is disabled",
+		"error.quota_requests":             "Daily request limit (%d) reached, please try again tomorrow",
+		"error.quota_tokens":               "Daily token limit (%d) reached, please try again tomorrow",
+		"error.batch_line_invalid":         "Line %d is not valid JSON: %v",
+		"error.batch_line_no_message":      "Line %d is missing message",
+		"error.batch_too_many":             "Too many items, at most %d allowed",
+		"error.batch_empty":                "The input contains no items",
+		"message.cache_cleared":            "Cache cleared",
+		"message.index_rebuilt":            "Knowledge index rebuilt",
+		"message.backup_done":              "Backup completed",
+		"message.finetune_created":         "Fine-tuning job created",
+		"message.finetune_cancelled":       "Fine-tuning job cancelled",
+		"message.feedback_recorded":        "Thanks for the feedback",
+		"message.curation_saved":           "Curation result saved",
+		"message.knowledge_added":          "Added to the knowledge base",
+		"message.knowledge_deleted":        "Knowledge item moved to the trash",
+		"message.knowledge_restored":       "Knowledge item restored from the trash",
+		"message.knowledge_purged":         "Knowledge item permanently deleted",
+		"message.undone":                   "Undone",
+		"message.link_added":               "Link added",
+		"message.link_removed":             "Link removed",
+		"message.knowledge_translated":     "Translated and saved to the knowledge base",
+		"message.knowledge_published":      "Draft flag removed",
+		"message.access_token_revoked":     "Personal access token revoked",
+		"message.models_refreshed":         "Fetched %d models from the provider",
+		"message.generation_cancelled":     "Generation cancelled",
+		"message.hook_skipped":             "Template rendered empty, skipped",
+		"message.hook_accepted":            "Accepted, processing in the background",
+		"message.config_reloaded":          "Configuration reloaded",
+	},
+}
+
+// defaultLocale 返回 i18n.default_locale，未配置时为简体中文
+func defaultLocale(cfg *Config) string {
+	if locale := matchLocale(cfg.I18n.DefaultLocale); locale != "" {
+		return locale
+	}
+	return localeZhCN
+}
+
+// matchLocale 把语言标签对应到支持的语言，例如 en-US 对应 en，zh、zh-Hans 对应 zh-CN，不支持时返回空字符串
+func matchLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return ""
+	}
+	for _, locale := range supportedLocales {
+		if tag == strings.ToLower(locale) {
+			return locale
+		}
+	}
+	base, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	for _, locale := range supportedLocales {
+		if l, _, _ := strings.Cut(strings.ToLower(locale), "-"); l == base {
+			return locale
+		}
+	}
+	return ""
+}
+
+// negotiateLocale 按 Accept-Language 中的权重选择支持的语言，都不支持时返回 fallback
+func negotiateLocale(acceptLanguage, fallback string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if tag != "" && q > 0 {
+			candidates = append(candidates, candidate{tag, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, cand := range candidates {
+		if locale := matchLocale(cand.tag); locale != "" {
+			return locale
+		}
+	}
+	return fallback
+}
+
+// localeMiddleware 确定请求使用的语言：lang 查询参数优先，其次是 Accept-Language 请求头，
+// 都没有匹配时使用 i18n.default_locale，结果通过 Content-Language 响应头返回
+func localeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale := matchLocale(c.Query("lang"))
+		if locale == "" {
+			locale = negotiateLocale(c.GetHeader("Accept-Language"), defaultLocale(currentConfig()))
+		}
+		c.Set(localeContextKey, locale)
+		c.Header("Content-Language", locale)
+		c.Next()
+	}
+}
+
+// requestLocale 返回当前请求使用的语言
+func requestLocale(c *gin.Context) string {
+	if c != nil {
+		if locale := c.GetString(localeContextKey); locale != "" {
+			return locale
+		}
+	}
+	return defaultLocale(currentConfig())
+}
+
+// grpcLocale 按 gRPC 元数据中的 accept-language 选择语言
+func grpcLocale(ctx context.Context) string {
+	fallback := defaultLocale(currentConfig())
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("accept-language"); len(values) > 0 {
+		return negotiateLocale(strings.Join(values, ","), fallback)
+	}
+	return fallback
+}
+
+// translate 返回指定语言的消息，有参数时按格式化字符串处理
+// 该语言缺少这条消息时使用简体中文，仍然没有时返回消息ID
+func translate(locale, key string, args ...interface{}) string {
+	format, ok := localeMessages[locale][key]
+	if !ok {
+		if format, ok = localeMessages[localeZhCN][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// tr 按当前请求的语言返回消息
+func tr(c *gin.Context, key string, args ...interface{}) string {
+	return translate(requestLocale(c), key, args...)
+}
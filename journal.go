@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// 变更日志文件名，位于数据目录下
+const journalFile = "journal.jsonl"
+
+// 最近问答最多保留的条数
+const maxRecentQAs = 5
+
+// 默认的日志压缩条件
+const (
+	defaultCompactThreshold = 100
+	defaultCompactInterval  = 10 * time.Minute
+)
+
+// 变更类型
+const (
+	journalOpQAAdd           = "qa.add"
+	journalOpKnowledgeAdd    = "knowledge.add"
+	journalOpKnowledgeDelete = "knowledge.delete"
+	// 移到回收站和从回收站恢复，Knowledge 为变更后的条目
+	journalOpKnowledgeTrash   = "knowledge.trash"
+	journalOpKnowledgeRestore = "knowledge.restore"
+	// 修改条目，Knowledge 为修改后的完整条目
+	journalOpKnowledgeUpdate = "knowledge.update"
+)
+
+// JournalEntry 变更日志中的一条记录
+type JournalEntry struct {
+	Op        string         `json:"op"`
+	Time      time.Time      `json:"time"`
+	QA        *QARecord      `json:"qa,omitempty"`
+	Knowledge *KnowledgeItem `json:"knowledge,omitempty"`
+	ID        int            `json:"id,omitempty"`
+}
+
+// dataMu 保护 recentQAs、knowledgeBase、knowledgeTrash 和ID计数器
+var dataMu sync.RWMutex
+
+// 上次压缩后写入变更日志的条数
+var journalPending int
+
+// addQARecord 记录一条问答，分配ID后写入变更日志，返回分配了ID的记录
+func addQARecord(record QARecord) QARecord {
+	dataMu.Lock()
+	record.ID = nextQAID
+	commitJournalEntry(JournalEntry{Op: journalOpQAAdd, QA: &record})
+	dataMu.Unlock()
+
+	maybeCompact()
+	return record
+}
+
+// 删除的知识库条目不存在时返回的错误
+var errKnowledgeNotFound = errors.New("知识库条目不存在")
+
+// addKnowledgeItem 添加知识库条目，分配ID后写入变更日志，返回分配了ID的条目
+// 只读模式下返回 errReadOnly；添加前调用 on_knowledge_add 插件，插件拒绝时不添加并返回 *pluginRejection
+func addKnowledgeItem(item KnowledgeItem) (KnowledgeItem, error) {
+	if readOnly(currentConfig()) {
+		return KnowledgeItem{}, errReadOnly
+	}
+	if err := runKnowledgePlugins(context.Background(), &item); err != nil {
+		return KnowledgeItem{}, err
+	}
+
+	dataMu.Lock()
+	item.ID = nextKnowledgeID
+	commitJournalEntry(JournalEntry{Op: journalOpKnowledgeAdd, Knowledge: &item})
+	dataMu.Unlock()
+
+	invalidateRAGIndex()
+	maybeCompact()
+	publishEvent(eventKnowledgeAdded, item)
+	return item, nil
+}
+
+// deleteKnowledgeItem 永久删除知识库条目，条目不存在时返回 errKnowledgeNotFound，只读模式下返回 errReadOnly
+// 用户删除条目时使用 trashKnowledgeItem，删除后仍然可以从回收站恢复
+func deleteKnowledgeItem(id int) (KnowledgeItem, error) {
+	if readOnly(currentConfig()) {
+		return KnowledgeItem{}, errReadOnly
+	}
+	dataMu.Lock()
+	var deleted KnowledgeItem
+	found := false
+	for _, item := range knowledgeBase {
+		if item.ID == id {
+			deleted, found = item, true
+			break
+		}
+	}
+	if found {
+		commitJournalEntry(JournalEntry{Op: journalOpKnowledgeDelete, ID: id})
+	}
+	dataMu.Unlock()
+
+	if found {
+		invalidateRAGIndex()
+		maybeCompact()
+		publishEvent(eventKnowledgeDeleted, deleted)
+	}
+	if !found {
+		return deleted, errKnowledgeNotFound
+	}
+	return deleted, nil
+}
+
+// updateKnowledgeItem 修改知识库中的条目，update 返回 false 时放弃修改
+// 条目不存在或放弃修改时返回 false
+func updateKnowledgeItem(id int, update func(item *KnowledgeItem) bool) (KnowledgeItem, bool) {
+	dataMu.Lock()
+	var updated KnowledgeItem
+	found := false
+	for _, item := range knowledgeBase {
+		if item.ID == id {
+			updated, found = item, true
+			break
+		}
+	}
+	if found {
+		updated.Tags = append([]string(nil), updated.Tags...)
+		updated.Links = append([]KnowledgeLink(nil), updated.Links...)
+		if found = update(&updated); found {
+			commitJournalEntry(JournalEntry{Op: journalOpKnowledgeUpdate, Knowledge: &updated})
+		}
+	}
+	dataMu.Unlock()
+
+	if found {
+		invalidateRAGIndex()
+		maybeCompact()
+	}
+	return updated, found
+}
+
+// commitJournalEntry 应用变更并追加到变更日志（使用数据库时写入数据库），调用方需持有 dataMu
+// 写变更日志失败时退回到完整保存数据文件，保证变更不丢失
+func commitJournalEntry(entry JournalEntry) {
+	entry.Time = time.Now()
+	applyJournalEntry(entry)
+
+	if store != nil {
+		if err := store.Apply(entry); err != nil {
+			slog.Error("写入数据库失败", "op", entry.Op, "error", err)
+		}
+		return
+	}
+
+	if err := appendJournal(entry); err != nil {
+		slog.Error("写入变更日志失败，改为直接保存数据文件", "op", entry.Op, "error", err)
+		if err := compactDataLocked(); err != nil {
+			slog.Error("保存数据文件失败", "error", err)
+		}
+		return
+	}
+	journalPending++
+}
+
+// applyJournalEntry 把一条变更应用到内存数据，重复应用同一条变更不会产生重复数据
+func applyJournalEntry(entry JournalEntry) {
+	switch entry.Op {
+	case journalOpQAAdd:
+		if entry.QA == nil {
+			return
+		}
+		for _, qa := range recentQAs {
+			if qa.ID == entry.QA.ID {
+				return
+			}
+		}
+		recentQAs = append([]QARecord{*entry.QA}, recentQAs...)
+		if len(recentQAs) > maxRecentQAs {
+			recentQAs = recentQAs[:maxRecentQAs]
+		}
+		if entry.QA.ID >= nextQAID {
+			nextQAID = entry.QA.ID + 1
+		}
+	case journalOpKnowledgeAdd:
+		if entry.Knowledge == nil {
+			return
+		}
+		for _, item := range knowledgeBase {
+			if item.ID == entry.Knowledge.ID {
+				return
+			}
+		}
+		knowledgeBase = append(knowledgeBase, *entry.Knowledge)
+		if entry.Knowledge.ID >= nextKnowledgeID {
+			nextKnowledgeID = entry.Knowledge.ID + 1
+		}
+	case journalOpKnowledgeDelete:
+		knowledgeBase = removeKnowledgeItem(knowledgeBase, entry.ID)
+		knowledgeTrash = removeKnowledgeItem(knowledgeTrash, entry.ID)
+	case journalOpKnowledgeTrash:
+		if entry.Knowledge == nil {
+			return
+		}
+		knowledgeBase = removeKnowledgeItem(knowledgeBase, entry.Knowledge.ID)
+		knowledgeTrash = insertKnowledgeItemSorted(knowledgeTrash, *entry.Knowledge)
+	case journalOpKnowledgeRestore:
+		if entry.Knowledge == nil {
+			return
+		}
+		knowledgeTrash = removeKnowledgeItem(knowledgeTrash, entry.Knowledge.ID)
+		knowledgeBase = insertKnowledgeItemSorted(knowledgeBase, *entry.Knowledge)
+	case journalOpKnowledgeUpdate:
+		if entry.Knowledge == nil {
+			return
+		}
+		for i, item := range knowledgeBase {
+			if item.ID == entry.Knowledge.ID {
+				knowledgeBase[i] = *entry.Knowledge
+				return
+			}
+		}
+	}
+}
+
+// appendJournal 追加一条变更并同步到磁盘
+func appendJournal(entry JournalEntry) error {
+	data, err := sealJSONLine(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dataPath(journalFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayJournal 启动时重放变更日志中尚未压缩的变更，返回重放的条数
+// 崩溃时可能留下写了一半的最后一行，这样的行会被跳过
+func replayJournal() int {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+
+	count := 0
+	var decryptErr error
+	err := readJSONLines(dataPath(journalFile), func(line []byte) {
+		line, err := openJSONLine(line)
+		if err != nil {
+			decryptErr = err
+			return
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return
+		}
+		applyJournalEntry(entry)
+		count++
+	})
+	if err != nil {
+		slog.Error("读取变更日志失败", "error", err)
+	}
+	if decryptErr != nil {
+		fatal("无法读取变更日志", "error", decryptErr)
+	}
+	journalPending = count
+	return count
+}
+
+// compactData 把内存中的数据完整写入数据文件，然后清空变更日志
+func compactData() error {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	return compactDataLocked()
+}
+
+// compactDataLocked 同 compactData，调用方需持有 dataMu
+func compactDataLocked() error {
+	if store != nil {
+		return nil
+	}
+	if err := saveDataFile(knowledgeDataFile, storedKnowledgeItems()); err != nil {
+		return err
+	}
+	if err := saveDataFile(qaDataFile, recentQAs); err != nil {
+		return err
+	}
+	// 数据文件写入成功后才清空变更日志，中途崩溃时重放是幂等的
+	if err := os.Truncate(dataPath(journalFile), 0); err != nil && !isNotExist(err) {
+		return err
+	}
+	journalPending = 0
+	return nil
+}
+
+// maybeCompact 变更日志累积到阈值时压缩
+func maybeCompact() {
+	threshold := currentConfig().Storage.CompactThreshold
+	if threshold <= 0 {
+		threshold = defaultCompactThreshold
+	}
+
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	if journalPending < threshold {
+		return
+	}
+	if err := compactDataLocked(); err != nil {
+		slog.Error("压缩变更日志失败", "error", err)
+	}
+}
+
+// compactPeriodically 定期压缩变更日志
+func compactPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		dataMu.Lock()
+		if journalPending > 0 {
+			if err := compactDataLocked(); err != nil {
+				slog.Error("压缩变更日志失败", "error", err)
+			}
+		}
+		dataMu.Unlock()
+	}
+}
+
+// compactInterval 返回定期压缩的间隔
+func compactInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Storage.CompactInterval); err == nil && d > 0 {
+		return d
+	}
+	return defaultCompactInterval
+}
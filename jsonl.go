@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// encryptedJSONLine 启用数据加密时日志中的一行，内容为加密后的原始记录
+type encryptedJSONLine struct {
+	Enc []byte `json:"enc"`
+}
+
+// appendJSONLine 以JSON Lines格式向文件末尾追加一条记录
+func appendJSONLine(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readJSONLines 逐行读取JSON Lines文件，文件不存在时视为空，无法解析的行会被跳过
+func readJSONLines(path string, fn func(line []byte)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || !json.Valid(line) {
+			continue
+		}
+		fn(line)
+	}
+	return scanner.Err()
+}
+
+// sealJSONLine 把记录序列化为一行，启用数据加密时整条记录加密
+func sealJSONLine(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || dataKey == nil {
+		return data, err
+	}
+	enc, err := encryptData(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encryptedJSONLine{Enc: enc})
+}
+
+// openJSONLine 解密 sealJSONLine 写入的一行，明文的行原样返回
+func openJSONLine(line []byte) ([]byte, error) {
+	var enc encryptedJSONLine
+	if json.Unmarshal(line, &enc) != nil || enc.Enc == nil {
+		return line, nil
+	}
+	return decryptData(enc.Enc)
+}
+
+// appendSealedJSONLine 与 appendJSONLine 相同，用于包含问答内容的日志，启用数据加密时加密后写入
+func appendSealedJSONLine(path string, v interface{}) error {
+	data, err := sealJSONLine(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readSealedJSONLines 与 readJSONLines 相同，加密的行解密后回调
+// 开启加密前写入的明文行照常读取；无法解密的行被跳过，读取结束后返回解密错误
+func readSealedJSONLines(path string, fn func(line []byte)) error {
+	var decryptErr error
+	err := readJSONLines(path, func(line []byte) {
+		plain, err := openJSONLine(line)
+		if err != nil {
+			if decryptErr == nil {
+				decryptErr = err
+			}
+			return
+		}
+		fn(plain)
+	})
+	if err != nil {
+		return err
+	}
+	return decryptErr
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// 加密密钥的前缀和口令环境变量
+const (
+	encryptedKeyPrefix = "enc:v1:"
+	passphraseEnv      = "AI_ASSISTANT_KEY_PASSPHRASE"
+)
+
+// 口令派生密钥的参数
+const (
+	pbkdf2Iterations = 600000
+	pbkdf2SaltSize   = 16
+)
+
+// 系统钥匙串中的默认服务名和账户名
+const (
+	defaultKeyringService = "ai-assistant"
+	defaultKeyringAccount = "api-key"
+)
+
+// encryptWithPassphrase 用口令加密密钥，返回 enc:v1: 开头的字符串
+func encryptWithPassphrase(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, pbkdf2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, nonce, []byte(plaintext), nil)
+	payload := append(append(salt, nonce...), sealed...)
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// decryptWithPassphrase 解密 enc:v1: 开头的密钥
+func decryptWithPassphrase(value, passphrase string) (string, error) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedKeyPrefix))
+	if err != nil {
+		return "", fmt.Errorf("加密密钥格式错误: %w", err)
+	}
+	if len(payload) < pbkdf2SaltSize {
+		return "", errors.New("加密密钥格式错误")
+	}
+
+	salt := payload[:pbkdf2SaltSize]
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	rest := payload[pbkdf2SaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return "", errors.New("加密密钥格式错误")
+	}
+
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("解密失败，口令可能不正确")
+	}
+	return string(plaintext), nil
+}
+
+// passphraseCipher 由口令和盐派生AES-256-GCM
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// resolveEncryptedKey 使用环境变量中的口令解密密钥
+func resolveEncryptedKey(value string) (string, error) {
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return "", fmt.Errorf("需要设置 %s 环境变量来解密密钥", passphraseEnv)
+	}
+	return decryptWithPassphrase(value, passphrase)
+}
+
+// parseKeyringRef 解析 keyring://<服务名>/<账户名>
+func parseKeyringRef(ref string) (string, string) {
+	service, account, _ := strings.Cut(strings.TrimPrefix(ref, "keyring://"), "/")
+	if service == "" {
+		service = defaultKeyringService
+	}
+	if account == "" {
+		account = defaultKeyringAccount
+	}
+	return service, account
+}
+
+// readKeyring 从系统钥匙串读取密钥
+// macOS 使用 security 命令，Linux 使用 libsecret 的 secret-tool 命令
+func readKeyring(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("当前系统 %s 不支持钥匙串", runtime.GOOS)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("读取钥匙串失败: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("钥匙串中没有 %s/%s", service, account)
+	}
+	return secret, nil
+}
+
+// writeKeyring 将密钥写入系统钥匙串，已存在时覆盖
+func writeKeyring(service, account, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// -w 放在最后且不带值时 security 从标准输入读取密钥并要求再输入一次确认，避免密钥出现在进程参数中
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w")
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=ai-assistant "+account, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return fmt.Errorf("当前系统 %s 不支持钥匙串", runtime.GOOS)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("写入钥匙串失败: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// 配置文件中 api_key 所在的行
+var apiKeyLinePattern = regexp.MustCompile(`(?m)^(\s*api_key:\s*).*$`)
+
+// importKeyCommand 一次性导入上游API密钥：写入钥匙串或用口令加密，并输出可写入配置的值
+//
+//	ai-assistant import-key [-mode keyring|passphrase] [-from-config] [-write]
+func importKeyCommand(args []string) {
+	fs := flag.NewFlagSet("import-key", flag.ExitOnError)
+	mode := fs.String("mode", "keyring", "存储方式: keyring（系统钥匙串）或 passphrase（口令加密）")
+	fromConfig := fs.Bool("from-config", false, "从配置文件中读取当前的明文密钥，而不是从标准输入读取")
+	write := fs.Bool("write", false, "将生成的值写回配置文件的 api.api_key")
+	service := fs.String("service", defaultKeyringService, "钥匙串服务名")
+	account := fs.String("account", defaultKeyringAccount, "钥匙串账户名")
+	fs.StringVar(&configFile, "config", configFile, "配置文件路径")
+	fs.Parse(args)
+
+	var plaintext string
+	if *fromConfig {
+		cfg, err := readConfigFile(configFile)
+		if err != nil {
+			exitWithError(err)
+		}
+		plaintext = cfg.API.APIKey
+	} else {
+		fmt.Fprint(os.Stderr, "请输入API密钥: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			exitWithError(fmt.Errorf("读取密钥失败: %w", err))
+		}
+		plaintext = strings.TrimSpace(line)
+	}
+	if plaintext == "" {
+		exitWithError(errors.New("密钥不能为空"))
+	}
+
+	var value string
+	switch *mode {
+	case "keyring":
+		if err := writeKeyring(*service, *account, plaintext); err != nil {
+			exitWithError(err)
+		}
+		value = fmt.Sprintf("keyring://%s/%s", *service, *account)
+	case "passphrase":
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			exitWithError(fmt.Errorf("需要设置 %s 环境变量作为加密口令", passphraseEnv))
+		}
+		encrypted, err := encryptWithPassphrase(plaintext, passphrase)
+		if err != nil {
+			exitWithError(err)
+		}
+		value = encrypted
+	default:
+		exitWithError(fmt.Errorf("不支持的存储方式: %s", *mode))
+	}
+
+	if !*write {
+		fmt.Printf("请将配置文件中的 api.api_key 设置为:\n  api_key: %q\n", value)
+		return
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !apiKeyLinePattern.Match(data) {
+		exitWithError(fmt.Errorf("配置文件 %s 中没有找到 api_key", configFile))
+	}
+	data = apiKeyLinePattern.ReplaceAll(data, []byte(fmt.Sprintf("${1}%q", value)))
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("已更新 %s 中的 api.api_key\n", configFile)
+}
+
+// exitWithError 输出错误并以退出码1退出
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
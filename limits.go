@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求大小的默认限制
+const (
+	defaultMaxBodyKB       = 1024
+	defaultMaxMessageChars = 32000
+	defaultMaxUploadMB     = 20
+)
+
+// 上传文件的接口，没有单独配置时使用 limits.max_upload_mb
+var uploadRoutes = []string{apiV1Prefix + "/admin/finetune/files", apiV1Prefix + "/knowledge/ocr"}
+
+// bodyLimit 返回请求允许的最大字节数，按路由单独配置的优先，/api 和 /api/v1 下的路由视为同一个
+func bodyLimit(cfg *Config, route string) int64 {
+	route = canonicalAPIRoute(route)
+	for pattern, kb := range cfg.Limits.Endpoints {
+		if canonicalAPIRoute(pattern) == route && kb > 0 {
+			return int64(kb) * 1024
+		}
+	}
+	if containsString(uploadRoutes, route) {
+		return maxUploadBytes(cfg)
+	}
+	if cfg.Limits.MaxBodyKB > 0 {
+		return int64(cfg.Limits.MaxBodyKB) * 1024
+	}
+	return defaultMaxBodyKB * 1024
+}
+
+// maxUploadBytes 返回上传文件允许的最大字节数，供文档上传类接口使用
+func maxUploadBytes(cfg *Config) int64 {
+	if cfg.Limits.MaxUploadMB > 0 {
+		return int64(cfg.Limits.MaxUploadMB) << 20
+	}
+	return defaultMaxUploadMB << 20
+}
+
+// maxMessageChars 返回聊天消息允许的最大字符数
+func maxMessageChars(cfg *Config) int {
+	if cfg.Limits.MaxMessageChars > 0 {
+		return cfg.Limits.MaxMessageChars
+	}
+	return defaultMaxMessageChars
+}
+
+// bodyLimitMiddleware 限制请求体大小，Content-Length 超过限制时直接返回 413，
+// 没有声明长度的请求在读取超过限制时失败
+func bodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		limit := bodyLimit(currentConfig(), route)
+		if c.Request.ContentLength > limit {
+			respondBodyTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// bindJSON 解析 JSON 请求体，失败时返回错误响应；请求体超过大小限制时返回 413
+func bindJSON(c *gin.Context, v interface{}) bool {
+	err := c.ShouldBindJSON(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondBodyTooLarge(c, tooLarge.Limit)
+		return false
+	}
+	respondError(c, http.StatusBadRequest, err.Error())
+	return false
+}
+
+// checkMessageLength 检查聊天消息长度，超过限制时返回 413
+func checkMessageLength(c *gin.Context, message string) bool {
+	limit := maxMessageChars(currentConfig())
+	if n := utf8.RuneCountInString(message); n > limit {
+		respondError(c, http.StatusRequestEntityTooLarge, tr(c, "error.message_too_long", n, limit))
+		return false
+	}
+	return true
+}
+
+// respondBodyTooLarge 返回请求体过大的错误
+func respondBodyTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, tr(c, "error.body_too_large", formatBytes(limit)))
+}
+
+// formatBytes 把字节数格式化为便于阅读的大小
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d 字节", n)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的关联操作
+const (
+	auditActionKnowledgeLink   = "knowledge.link"
+	auditActionKnowledgeUnlink = "knowledge.unlink"
+)
+
+// 关联类型
+const (
+	// 条目替代了目标条目，检索到目标条目时改为提供该条目
+	linkTypeSupersedes = "supersedes"
+	// 两个条目相关，检索到任意一个时一并提供另一个
+	linkTypeRelated = "related"
+	// 条目是目标条目的一部分，检索到该条目时一并提供目标条目
+	linkTypePartOf = "part-of"
+)
+
+var knowledgeLinkTypes = []string{linkTypeSupersedes, linkTypeRelated, linkTypePartOf}
+
+// 未配置 rag.links 时检索结果之外最多附加的关联条目数
+const defaultRAGLinks = 3
+
+// 沿 supersedes 关联查找最新条目时最多经过的层数，避免关联成环
+const maxSupersedeDepth = 5
+
+// KnowledgeLink 知识库条目指向另一个条目的关联
+type KnowledgeLink struct {
+	Type     string `json:"type"`
+	TargetID int    `json:"target_id"`
+}
+
+// AddKnowledgeLinkRequest 添加关联的请求
+type AddKnowledgeLinkRequest struct {
+	TargetID int `json:"target_id" binding:"required"`
+	// supersedes、related 或 part-of
+	Type string `json:"type" binding:"required"`
+}
+
+// addKnowledgeLinkHandler 为知识库条目添加指向另一个条目的关联
+func addKnowledgeLinkHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.knowledge_not_found"))
+		return
+	}
+	var req AddKnowledgeLinkRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !containsString(knowledgeLinkTypes, req.Type) {
+		respondError(c, http.StatusBadRequest, tr(c, "error.link_type_invalid", req.Type))
+		return
+	}
+	if req.TargetID == id {
+		respondError(c, http.StatusBadRequest, tr(c, "error.link_self"))
+		return
+	}
+	if _, ok := findKnowledgeItem(req.TargetID); !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.link_target_not_found", req.TargetID))
+		return
+	}
+
+	link := KnowledgeLink{Type: req.Type, TargetID: req.TargetID}
+	exists := false
+	item, ok := updateKnowledgeItem(id, func(item *KnowledgeItem) bool {
+		for _, l := range item.Links {
+			if l == link {
+				exists = true
+				return false
+			}
+		}
+		item.Links = append(item.Links, link)
+		return true
+	})
+	if exists {
+		respondError(c, http.StatusConflict, tr(c, "error.link_exists"))
+		return
+	}
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.knowledge_not_found"))
+		return
+	}
+
+	recordAudit(c, auditActionKnowledgeLink, fmt.Sprintf("knowledge/%d", id), fmt.Sprintf("%s %d", link.Type, link.TargetID), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.link_added"),
+		"item":    item,
+	})
+}
+
+// removeKnowledgeLinkHandler 删除知识库条目指向目标条目的关联，查询参数 type 为空时删除全部类型的关联
+func removeKnowledgeLinkHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.knowledge_not_found"))
+		return
+	}
+	targetID, err := strconv.Atoi(c.Param("target_id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.link_not_found"))
+		return
+	}
+	linkType := c.Query("type")
+
+	missing := false
+	item, ok := updateKnowledgeItem(id, func(item *KnowledgeItem) bool {
+		links := item.Links[:0]
+		for _, l := range item.Links {
+			if l.TargetID != targetID || (linkType != "" && l.Type != linkType) {
+				links = append(links, l)
+			}
+		}
+		if len(links) == len(item.Links) {
+			missing = true
+			return false
+		}
+		item.Links = links
+		if len(item.Links) == 0 {
+			item.Links = nil
+		}
+		return true
+	})
+	if missing {
+		respondError(c, http.StatusNotFound, tr(c, "error.link_not_found"))
+		return
+	}
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.knowledge_not_found"))
+		return
+	}
+
+	recordAudit(c, auditActionKnowledgeUnlink, fmt.Sprintf("knowledge/%d", id), fmt.Sprintf("%s %d", linkType, targetID), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.link_removed"),
+		"item":    item,
+	})
+}
+
+// ragLinks 返回检索结果之外最多附加的关联条目数
+func ragLinks(cfg *Config) int {
+	if cfg.RAG.Links == 0 {
+		return defaultRAGLinks
+	}
+	return max(cfg.RAG.Links, 0)
+}
+
+// expandLinkedKnowledge 按关联调整检索结果：被替代的条目换成替代它的最新条目，
+// 再附加最多 limit 个 related 和 part-of 关联的条目；指向回收站或已删除条目的关联会被忽略
+func expandLinkedKnowledge(items []KnowledgeItem, limit int) []KnowledgeItem {
+	if len(items) == 0 {
+		return items
+	}
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	byID := make(map[int]KnowledgeItem, len(knowledgeBase))
+	supersededBy := map[int]int{}
+	relatedFrom := map[int][]int{}
+	for _, item := range knowledgeBase {
+		byID[item.ID] = item
+		for _, l := range item.Links {
+			switch l.Type {
+			case linkTypeSupersedes:
+				supersededBy[l.TargetID] = item.ID
+			case linkTypeRelated:
+				relatedFrom[l.TargetID] = append(relatedFrom[l.TargetID], item.ID)
+			}
+		}
+	}
+
+	seen := map[int]bool{}
+	result := make([]KnowledgeItem, 0, len(items)+limit)
+	for _, item := range items {
+		for depth := 0; depth < maxSupersedeDepth; depth++ {
+			newer, ok := byID[supersededBy[item.ID]]
+			if !ok {
+				break
+			}
+			item = newer
+		}
+		if !seen[item.ID] {
+			seen[item.ID] = true
+			result = append(result, item)
+		}
+	}
+
+	added := 0
+	for _, item := range result[:len(result):len(result)] {
+		var linked []int
+		for _, l := range item.Links {
+			if l.Type == linkTypeRelated || l.Type == linkTypePartOf {
+				linked = append(linked, l.TargetID)
+			}
+		}
+		linked = append(linked, relatedFrom[item.ID]...)
+		for _, id := range linked {
+			if added >= limit {
+				return result
+			}
+			if linkedItem, ok := byID[id]; ok && !seen[id] {
+				seen[id] = true
+				result = append(result, linkedItem)
+				added++
+			}
+		}
+	}
+	return result
+}
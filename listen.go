@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unix socket 地址前缀，例如 unix:/run/ai-assistant/ai.sock
+const unixSocketPrefix = "unix:"
+
+// 默认的 unix socket 权限，允许同组的反向代理访问
+const defaultSocketMode = 0660
+
+// unixSocketPath 判断监听地址是否为 unix socket，返回 socket 文件路径
+// 以 unix: 开头或以 / 开头的地址都视为 unix socket
+func unixSocketPath(listen string) (string, bool) {
+	if path, ok := strings.CutPrefix(listen, unixSocketPrefix); ok {
+		return expandHome(path), true
+	}
+	if strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "~/") {
+		return expandHome(listen), true
+	}
+	return "", false
+}
+
+// listenAddress 返回服务的监听地址，未配置 server.listen 时使用 host 和 port
+func listenAddress(cfg *Config) string {
+	if cfg.Server.Listen != "" {
+		return cfg.Server.Listen
+	}
+	return cfg.Server.Host + cfg.Server.Port
+}
+
+// parseSocketMode 解析八进制的 socket 文件权限，例如 "0660"
+func parseSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return defaultSocketMode, nil
+	}
+	n, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("无效的权限: %q", mode)
+	}
+	return os.FileMode(n), nil
+}
+
+// newListener 按配置创建 TCP 或 unix socket 监听
+func newListener(cfg *Config) (net.Listener, error) {
+	address := listenAddress(cfg)
+	path, ok := unixSocketPath(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	mode, err := parseSocketMode(cfg.Server.SocketMode)
+	if err != nil {
+		return nil, err
+	}
+	// 上次异常退出时留下的 socket 文件会导致监听失败，数据目录锁已保证没有其它实例在使用
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是 socket 文件", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("删除旧的 socket 文件失败: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("设置 socket 文件权限失败: %w", err)
+	}
+	return ln, nil
+}
+
+// displayAddress 返回日志中显示的服务地址
+func displayAddress(cfg *Config, scheme string) string {
+	address := listenAddress(cfg)
+	if path, ok := unixSocketPath(address); ok {
+		return unixSocketPrefix + path
+	}
+	return scheme + "://" + address
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockFile 当前平台不支持文件锁，直接视为加锁成功
+func lockFile(f *os.File) error {
+	return nil
+}
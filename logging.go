@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求上下文中保存日志器的键
+const loggerContextKey = "logger"
+
+// setupLogging 根据配置初始化全局日志器
+// 配置了日志文件时写入文件并按规则轮转，console为true时同时输出到标准输出
+func setupLogging() {
+	var w io.Writer = os.Stdout
+	cfg := currentConfig().Logging
+
+	if fileCfg := cfg.File; fileCfg.Path != "" {
+		rf, err := newRotatingFile(fileCfg.Path, fileCfg.MaxSizeMB, fileCfg.MaxAgeDays, fileCfg.MaxBackups, fileCfg.Daily)
+		if err != nil {
+			fatal("打开日志文件失败", "path", fileCfg.Path, "error", err)
+		}
+		w = rf
+		if cfg.Console {
+			w = io.MultiWriter(os.Stdout, rf)
+		}
+	}
+
+	slog.SetDefault(slog.New(newLogHandler(w)))
+}
+
+// newLogHandler 按配置的格式和级别创建日志处理器
+func newLogHandler(w io.Writer) slog.Handler {
+	cfg := currentConfig().Logging
+	opts := &slog.HandlerOptions{Level: parseLogLevel(cfg.Level)}
+	if strings.ToLower(cfg.Format) == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// parseLogLevel 解析日志级别，无法识别时使用info
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// fatal 记录错误日志并退出进程
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestLogger 返回当前请求的日志器，附带请求相关的字段
+func requestLogger(c *gin.Context) *slog.Logger {
+	if v, ok := c.Get(loggerContextKey); ok {
+		if logger, ok := v.(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// requestLogMiddleware 为每个请求准备日志器并在请求结束后输出访问日志
+func requestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Set(loggerContextKey, slog.Default().With(
+			"request_id", requestID(c),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"client_ip", c.ClientIP(),
+		))
+
+		c.Next()
+
+		attrs := []any{
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"user", requestUser(c),
+		}
+		if model := c.GetString("model"); model != "" {
+			attrs = append(attrs, "model", model)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		logger := requestLogger(c)
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			logger.Error("请求完成", attrs...)
+		case status >= 400:
+			logger.Warn("请求完成", attrs...)
+		default:
+			logger.Info("请求完成", attrs...)
+		}
+	}
+}
+
+// recoveryMiddleware 捕获处理器中的panic并记录日志
+func recoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		requestLogger(c).Error("处理请求时发生panic", "panic", err)
+		reportError(c, "panic", fmt.Errorf("%v", err), string(debug.Stack()), nil)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+	})
+}
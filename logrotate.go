@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 轮转后的日志文件名中的时间格式
+const rotateTimeFormat = "20060102-150405"
+
+// rotatingFile 按大小和日期轮转的日志文件
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	daily      bool
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// newRotatingFile 打开日志文件，目录不存在时自动创建
+func newRotatingFile(path string, maxSizeMB, maxAgeDays, maxBackups int, daily bool) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxBackups: maxBackups,
+		daily:      daily,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open 以追加方式打开当前日志文件
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = info.ModTime()
+	if rf.size == 0 {
+		rf.openedAt = time.Now()
+	}
+	return nil
+}
+
+// Write 实现io.Writer接口，写入前判断是否需要轮转
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "日志文件轮转失败: %v\n", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// shouldRotate 判断写入之前是否需要轮转
+func (rf *rotatingFile) shouldRotate(next int) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.maxSize > 0 && rf.size+int64(next) > rf.maxSize {
+		return true
+	}
+	if rf.daily {
+		y1, m1, d1 := rf.openedAt.Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+// rotate 将当前文件重命名为带时间戳的备份并重新打开，然后清理过期备份
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	backup := rf.path + "." + time.Now().Format(rotateTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.cleanup()
+	return nil
+}
+
+// cleanup 按保留天数和保留个数删除旧的备份
+func (rf *rotatingFile) cleanup() {
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+
+	type backupFile struct {
+		path string
+		time time.Time
+	}
+	var files []backupFile
+	for _, path := range backups {
+		stamp := strings.TrimPrefix(path, rf.path+".")
+		t, err := time.ParseInLocation(rotateTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{path: path, time: t})
+	}
+
+	// 新的在前
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].time.After(files[j].time)
+	})
+
+	for i, f := range files {
+		expired := rf.maxAge > 0 && time.Since(f.time) > rf.maxAge
+		excess := rf.maxBackups > 0 && i >= rf.maxBackups
+		if expired || excess {
+			os.Remove(f.path)
+		}
+	}
+}
+
+// Close 关闭日志文件
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
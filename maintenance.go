@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的切换只读模式操作
+const auditActionAdminMaintenance = "admin.maintenance"
+
+// 通过管理接口设置的只读模式保存在数据目录中的文件，重启后仍然生效
+const maintenanceFile = "maintenance.json"
+
+// 只读模式下客户端多久后可以重试，写入 Retry-After 响应头
+const maintenanceRetryAfter = "300"
+
+// 只读模式下仍然可以使用的非 GET 接口，均为 /api/v1 下的路由
+var readOnlyAllowedRoutes = []string{
+	apiV1Prefix + "/tokens/count",
+	// 维护期间通过公告告知用户
+	apiV1Prefix + "/announcement",
+}
+
+// MaintenanceState 通过管理接口设置的只读模式
+type MaintenanceState struct {
+	ReadOnly bool   `json:"read_only"`
+	Message  string `json:"message,omitempty"`
+	// 开启只读模式的时间和管理员
+	Since *time.Time `json:"since,omitempty"`
+	User  string     `json:"user,omitempty"`
+}
+
+// MaintenanceRequest 切换只读模式的请求
+type MaintenanceRequest struct {
+	ReadOnly *bool `json:"read_only" binding:"required"`
+	// 返回给客户端的提示，为空时使用 maintenance.message 或默认提示
+	Message string `json:"message"`
+}
+
+var (
+	maintenanceMu    sync.Mutex
+	maintenanceState MaintenanceState
+)
+
+// loadMaintenanceState 启动时读取通过管理接口设置的只读模式
+func loadMaintenanceState() {
+	var state MaintenanceState
+	if err := loadDataFile(maintenanceFile, &state); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取只读模式设置失败", "error", err)
+		}
+		return
+	}
+	maintenanceMu.Lock()
+	maintenanceState = state
+	maintenanceMu.Unlock()
+	if state.ReadOnly {
+		slog.Warn("服务处于只读模式", "user", state.User, "since", state.Since)
+	}
+}
+
+// readOnly 判断服务是否处于只读模式：配置了 maintenance.read_only 或通过管理接口开启
+func readOnly(cfg *Config) bool {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	return cfg.Maintenance.ReadOnly || maintenanceState.ReadOnly
+}
+
+// 只读模式下添加或删除知识库条目时返回的错误
+var errReadOnly = errors.New("服务处于只读模式")
+
+// readOnlyChatError 只读模式下拒绝对话和写入的错误，gRPC、Slack Socket Mode、钉钉 Stream 等不经过 HTTP 中间件的渠道同样使用
+func readOnlyChatError(cfg *Config) *chatError {
+	maintenanceMu.Lock()
+	message := maintenanceState.Message
+	maintenanceMu.Unlock()
+	if message == "" {
+		message = cfg.Maintenance.Message
+	}
+	if message != "" {
+		return &chatError{Status: http.StatusServiceUnavailable, Message: message, Audit: true}
+	}
+	chatErr := newChatError(http.StatusServiceUnavailable, "error.read_only")
+	chatErr.Audit = true
+	return chatErr
+}
+
+// readOnlyMessage 返回只读模式下的提示，管理接口设置的优先，其次是 maintenance.message
+func readOnlyMessage(c *gin.Context, cfg *Config) string {
+	maintenanceMu.Lock()
+	message := maintenanceState.Message
+	maintenanceMu.Unlock()
+	if message == "" {
+		message = cfg.Maintenance.Message
+	}
+	if message == "" {
+		message = tr(c, "error.read_only")
+	}
+	return message
+}
+
+// maintenanceMiddleware 只读模式下拒绝对话和写入，返回 503；GET 请求、管理接口和少数只读接口不受影响，
+// 管理员仍然可以备份、迁移和关闭只读模式
+func maintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := currentConfig()
+		if !readOnly(cfg) || !blockedWhenReadOnly(c) {
+			c.Next()
+			return
+		}
+		message := readOnlyMessage(c, cfg)
+		c.Header("Retry-After", maintenanceRetryAfter)
+		// OpenAI 兼容接口返回 OpenAI 格式的错误
+		if strings.HasPrefix(c.Request.URL.Path, "/v1/") {
+			respondOpenAIError(c, http.StatusServiceUnavailable, "service_unavailable", message)
+			return
+		}
+		respondError(c, http.StatusServiceUnavailable, message)
+	}
+}
+
+// blockedWhenReadOnly 判断请求在只读模式下是否需要拒绝
+func blockedWhenReadOnly(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	route := canonicalAPIRoute(c.FullPath())
+	if strings.HasPrefix(route, apiV1Prefix+"/admin/") || containsString(readOnlyAllowedRoutes, route) {
+		return false
+	}
+	return true
+}
+
+// maintenanceHandler 返回只读模式的状态，source 为 config 时只能通过修改配置关闭
+func maintenanceHandler(c *gin.Context) {
+	cfg := currentConfig()
+	maintenanceMu.Lock()
+	state := maintenanceState
+	maintenanceMu.Unlock()
+
+	result := gin.H{"read_only": cfg.Maintenance.ReadOnly || state.ReadOnly}
+	switch {
+	case cfg.Maintenance.ReadOnly:
+		result["source"] = "config"
+	case state.ReadOnly:
+		result["source"] = "admin"
+		result["since"] = state.Since
+		result["user"] = state.User
+	}
+	if cfg.Maintenance.ReadOnly || state.ReadOnly {
+		result["message"] = readOnlyMessage(c, cfg)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// setMaintenanceHandler 开启或关闭只读模式，设置保存到数据目录
+func setMaintenanceHandler(c *gin.Context) {
+	var req MaintenanceRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	cfg := currentConfig()
+	if !*req.ReadOnly && cfg.Maintenance.ReadOnly {
+		respondError(c, http.StatusConflict, tr(c, "error.read_only_config"))
+		return
+	}
+
+	state := MaintenanceState{}
+	if *req.ReadOnly {
+		now := time.Now()
+		state = MaintenanceState{ReadOnly: true, Message: strings.TrimSpace(req.Message), Since: &now, User: requestUser(c)}
+	}
+	maintenanceMu.Lock()
+	maintenanceState = state
+	err := saveDataFile(maintenanceFile, state)
+	maintenanceMu.Unlock()
+	if err != nil {
+		// 保存失败时设置仍然生效，只是重启后恢复
+		requestLogger(c).Error("保存只读模式设置失败", "error", err)
+	}
+
+	detail := "off"
+	if state.ReadOnly {
+		detail = "on"
+		slog.Warn("已开启只读模式", "user", state.User)
+	} else {
+		slog.Info("已关闭只读模式", "user", requestUser(c))
+	}
+	recordAudit(c, auditActionAdminMaintenance, "read_only", detail, http.StatusOK)
+	maintenanceHandler(c)
+}
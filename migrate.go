@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// migrate 子命令指定的目标数据库，优先级高于配置文件
+var (
+	storageDriverFlag string
+	storageDSNFlag    string
+)
+
+// migrateCommand 将数据文件中的知识库和问答记录导入数据库，保留原有ID并输出校验报告
+//
+//	ai-assistant migrate [-driver postgres] [-dsn ...] [-force]
+func migrateCommand(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.StringVar(&storageDriverFlag, "driver", "", "目标数据库驱动，默认使用配置文件中的 storage.driver")
+	fs.StringVar(&storageDSNFlag, "dsn", "", "目标数据库连接串，默认使用配置文件中的 storage.dsn")
+	force := fs.Bool("force", false, "目标数据库中已有数据时仍然导入，ID相同的记录会被覆盖")
+	fs.StringVar(&configFile, "config", configFile, "配置文件路径")
+	fs.StringVar(&dataDirFlag, "data-dir", "", "数据目录，默认使用配置文件中的 storage.data_dir")
+	fs.Parse(args)
+
+	cfg, err := readConfigFile(configFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !usesDatabase(cfg) {
+		exitWithError(errors.New("请通过 -driver 和 -dsn 参数或配置文件中的 storage.driver 指定目标数据库"))
+	}
+	activeConfig.Store(cfg)
+
+	// 读取数据文件，加锁确保服务没有在同时写入
+	dataDir = resolveDataDir(cfg)
+	if err := lockDataDir(cfg); err != nil {
+		exitWithError(err)
+	}
+	if err := setupDataEncryption(cfg); err != nil {
+		exitWithError(err)
+	}
+	loadKnowledgeBase()
+	loadRecentQAs()
+	replayJournal()
+
+	target, err := openStore(cfg)
+	if err != nil {
+		exitWithError(err)
+	}
+	defer target.Close()
+
+	existingItems, err := target.Knowledge()
+	if err != nil {
+		exitWithError(err)
+	}
+	existingQAs, err := target.RecentQAs(0)
+	if err != nil {
+		exitWithError(err)
+	}
+	if (len(existingItems) > 0 || len(existingQAs) > 0) && !*force {
+		exitWithError(fmt.Errorf("目标数据库中已有 %d 条知识库条目和 %d 条问答记录，确认要合并导入请加 -force 参数",
+			len(existingItems), len(existingQAs)))
+	}
+
+	fmt.Printf("从 %s 导入 %d 条知识库条目和 %d 条问答记录到 %s ...\n",
+		dataDir, len(storedKnowledgeItems()), len(recentQAs), cfg.Storage.Driver)
+	if err := target.Import(storedKnowledgeItems(), recentQAs, *force); err != nil {
+		exitWithError(fmt.Errorf("导入失败，数据库未做任何修改: %w", err))
+	}
+
+	if problems := verifyMigration(target); len(problems) > 0 {
+		fmt.Println("校验发现问题:")
+		for _, p := range problems {
+			fmt.Println("  - " + p)
+		}
+		exitWithError(errors.New("迁移校验未通过"))
+	}
+	fmt.Println("校验通过：所有记录的ID和内容一致")
+	fmt.Printf("请在配置文件中设置 storage.driver: %s 和 storage.dsn 后重启服务\n", cfg.Storage.Driver)
+}
+
+// verifyMigration 将数据库中的记录与数据文件逐条比对，返回发现的问题
+func verifyMigration(target Store) []string {
+	var problems []string
+
+	items, err := target.Knowledge()
+	if err != nil {
+		return []string{"读取知识库失败: " + err.Error()}
+	}
+	itemsByID := map[int]KnowledgeItem{}
+	for _, item := range items {
+		itemsByID[item.ID] = item
+	}
+	for _, want := range storedKnowledgeItems() {
+		got, ok := itemsByID[want.ID]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("知识库条目 %d 未导入", want.ID))
+		case got.Title != want.Title || got.Content != want.Content || got.Model != want.Model ||
+			!reflect.DeepEqual(got.Tags, want.Tags) || !sameTime(got.Timestamp, want.Timestamp):
+			problems = append(problems, fmt.Sprintf("知识库条目 %d 内容不一致", want.ID))
+		}
+	}
+
+	qas, err := target.RecentQAs(0)
+	if err != nil {
+		return append(problems, "读取问答记录失败: "+err.Error())
+	}
+	qasByID := map[int]QARecord{}
+	for _, qa := range qas {
+		qasByID[qa.ID] = qa
+	}
+	for _, want := range recentQAs {
+		got, ok := qasByID[want.ID]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("问答记录 %d 未导入", want.ID))
+		case got.Question != want.Question || got.Answer != want.Answer || got.Model != want.Model:
+			problems = append(problems, fmt.Sprintf("问答记录 %d 内容不一致", want.ID))
+		}
+	}
+
+	fmt.Printf("知识库条目: 数据文件 %d 条，数据库 %d 条\n", len(storedKnowledgeItems()), len(items))
+	fmt.Printf("问答记录:   数据文件 %d 条，数据库 %d 条\n", len(recentQAs), len(qas))
+	return problems
+}
+
+// sameTime 比较时间，数据库只保存到微秒
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 上游服务商：openai 为 OpenAI 兼容的接口，mock 不访问网络，按 api.mock 返回模拟的回答
+const (
+	apiProviderOpenAI = "openai"
+	apiProviderMock   = "mock"
+)
+
+// mock 服务商构造请求使用的地址，请求不会真正发出
+const mockBaseURL = "http://mock.invalid/v1"
+
+// 未配置 api.mock 时的回答模板和延迟，以及流式响应每段的字数和模拟向量的维度
+const (
+	defaultMockResponse   = "这是 {{.Model}} 的模拟回答。你的问题是：{{.Message}}"
+	defaultMockLatency    = 200 * time.Millisecond
+	defaultMockChunkDelay = 30 * time.Millisecond
+	mockChunkRunes        = 4
+	mockEmbeddingDims     = 64
+)
+
+// MockConfig mock 服务商的回答和延迟，用于离线开发、演示和压测
+type MockConfig struct {
+	// 按顺序匹配最后一条用户消息，第一个匹配的回答生效，都不匹配时使用 default
+	Responses []MockResponse `yaml:"responses"`
+	// 默认回答，与 responses 中的回答一样是 text/template 模板，可以使用 {{.Model}} 和 {{.Message}}
+	Default string `yaml:"default"`
+	// 返回第一段内容前的延迟，默认 200ms
+	Latency string `yaml:"latency"`
+	// 流式响应每一段之间的延迟，默认 30ms
+	ChunkDelay string `yaml:"chunk_delay"`
+}
+
+// MockResponse 一条模拟回答
+type MockResponse struct {
+	// 正则表达式，为空时匹配全部
+	Match    string `yaml:"match"`
+	Response string `yaml:"response"`
+}
+
+// mockTemplateData 回答模板可以使用的字段
+type mockTemplateData struct {
+	Model   string
+	Message string
+}
+
+// mockDoer 代替上游处理请求，支持对话（含流式）、向量、模型列表、内容审核和重排接口
+type mockDoer struct{}
+
+// Do 实现openai.HTTPDoer接口
+func (mockDoer) Do(req *http.Request) (*http.Response, error) {
+	cfg := currentConfig()
+	if err := sleepContext(req.Context(), mockDuration(cfg.API.Mock.Latency, defaultMockLatency)); err != nil {
+		return nil, err
+	}
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/chat/completions"):
+		var chatReq openai.ChatCompletionRequest
+		if err := json.NewDecoder(req.Body).Decode(&chatReq); err != nil {
+			return mockErrorResponse(req, http.StatusBadRequest, err.Error()), nil
+		}
+		content, err := mockChatContent(cfg, chatReq)
+		if err != nil {
+			return mockErrorResponse(req, http.StatusInternalServerError, err.Error()), nil
+		}
+		if chatReq.Stream {
+			return mockStreamResponse(req, cfg, chatReq, content), nil
+		}
+		return mockJSONResponse(req, openai.ChatCompletionResponse{
+			ID:      "mock-" + newRequestID(),
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   chatReq.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: mockUsage(cfg, chatReq, content),
+		}), nil
+
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/embeddings"):
+		var embReq struct {
+			Input interface{} `json:"input"`
+			Model string      `json:"model"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&embReq); err != nil {
+			return mockErrorResponse(req, http.StatusBadRequest, err.Error()), nil
+		}
+		var inputs []string
+		switch v := embReq.Input.(type) {
+		case string:
+			inputs = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				inputs = append(inputs, fmt.Sprint(item))
+			}
+		}
+		resp := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(embReq.Model)}
+		for i, text := range inputs {
+			resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: mockEmbedding(text)})
+			resp.Usage.PromptTokens += mockTokens(text)
+		}
+		resp.Usage.TotalTokens = resp.Usage.PromptTokens
+		return mockJSONResponse(req, resp), nil
+
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/moderations"):
+		return mockJSONResponse(req, openai.ModerationResponse{ID: "mock-" + newRequestID(), Results: []openai.Result{{}}}), nil
+
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/rerank"):
+		var rerankReq struct {
+			Query     string   `json:"query"`
+			Documents []string `json:"documents"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&rerankReq); err != nil {
+			return mockErrorResponse(req, http.StatusBadRequest, err.Error()), nil
+		}
+		results := make([]gin.H, len(rerankReq.Documents))
+		for i, doc := range rerankReq.Documents {
+			results[i] = gin.H{"index": i, "relevance_score": mockRelevance(rerankReq.Query, doc)}
+		}
+		return mockJSONResponse(req, gin.H{"results": results, "usage": gin.H{"total_tokens": mockTokens(rerankReq.Query + strings.Join(rerankReq.Documents, ""))}}), nil
+
+	case req.Method == http.MethodGet && strings.HasSuffix(path, "/models"):
+		list := openai.ModelsList{}
+		for _, model := range cfg.Models.Available {
+			list.Models = append(list.Models, openai.Model{ID: model, Object: "model", OwnedBy: apiProviderMock})
+		}
+		return mockJSONResponse(req, list), nil
+
+	case req.Method == http.MethodGet && strings.Contains(path, "/models/"):
+		model := path[strings.Index(path, "/models/")+len("/models/"):]
+		if !containsString(cfg.Models.Available, model) {
+			return mockErrorResponse(req, http.StatusNotFound, fmt.Sprintf("模型 %s 不存在", model)), nil
+		}
+		return mockJSONResponse(req, openai.Model{ID: model, Object: "model", OwnedBy: apiProviderMock}), nil
+	}
+	return mockErrorResponse(req, http.StatusNotFound, fmt.Sprintf("mock 服务商不支持 %s %s", req.Method, path)), nil
+}
+
+// mockChatContent 按最后一条用户消息选择回答并渲染模板
+func mockChatContent(cfg *Config, req openai.ChatCompletionRequest) (string, error) {
+	data := mockTemplateData{Model: req.Model}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleUser {
+			data.Message = req.Messages[i].Content
+			for _, part := range req.Messages[i].MultiContent {
+				data.Message += part.Text
+			}
+			break
+		}
+	}
+	text := cfg.API.Mock.Default
+	if text == "" {
+		text = defaultMockResponse
+	}
+	for _, r := range cfg.API.Mock.Responses {
+		if r.Match == "" {
+			text = r.Response
+			break
+		}
+		if re, err := regexp.Compile(r.Match); err == nil && re.MatchString(data.Message) {
+			text = r.Response
+			break
+		}
+	}
+	tmpl, err := template.New("mock").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析模拟回答模板失败: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("渲染模拟回答失败: %w", err)
+	}
+	return b.String(), nil
+}
+
+// mockStreamResponse 把回答按 mockChunkRunes 个字一段、间隔 api.mock.chunk_delay 以 SSE 返回
+// 请求被取消时停止输出
+func mockStreamResponse(req *http.Request, cfg *Config, chatReq openai.ChatCompletionRequest, content string) *http.Response {
+	pr, pw := io.Pipe()
+	delay := mockDuration(cfg.API.Mock.ChunkDelay, defaultMockChunkDelay)
+	go func() {
+		id := "mock-" + newRequestID()
+		write := func(chunk openai.ChatCompletionStreamResponse) error {
+			chunk.ID, chunk.Object, chunk.Created, chunk.Model = id, "chat.completion.chunk", time.Now().Unix(), chatReq.Model
+			data, _ := json.Marshal(chunk)
+			_, err := fmt.Fprintf(pw, "data: %s\n\n", data)
+			return err
+		}
+		runes := []rune(content)
+		for start := 0; start < len(runes); start += mockChunkRunes {
+			if start > 0 {
+				if err := sleepContext(req.Context(), delay); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			delta := openai.ChatCompletionStreamChoiceDelta{Content: string(runes[start:min(start+mockChunkRunes, len(runes))])}
+			if start == 0 {
+				delta.Role = openai.ChatMessageRoleAssistant
+			}
+			if err := write(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{Delta: delta}}}); err != nil {
+				return
+			}
+		}
+		write(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{FinishReason: openai.FinishReasonStop}}})
+		if chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage {
+			usage := mockUsage(cfg, chatReq, content)
+			write(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{}, Usage: &usage})
+		}
+		fmt.Fprint(pw, "data: [DONE]\n\n")
+		pw.Close()
+	}()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       pr,
+		Request:    req,
+	}
+}
+
+// mockUsage 按模型的编码计算模拟回答的用量
+func mockUsage(cfg *Config, req openai.ChatCompletionRequest, content string) openai.Usage {
+	prompt, err := countChatTokens(cfg, req.Model, req.Messages)
+	if err != nil {
+		prompt = 0
+		for _, m := range req.Messages {
+			prompt += mockTokens(m.Content)
+		}
+	}
+	completion := mockTokens(content)
+	return openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// mockTokens 粗略估算文本的 token 数
+func mockTokens(text string) int {
+	return max((len([]rune(text))+1)/2, 1)
+}
+
+// mockEmbedding 按文本的哈希生成确定的单位向量，相同的文本得到相同的向量
+func mockEmbedding(text string) []float32 {
+	vector := make([]float32, mockEmbeddingDims)
+	var norm float64
+	for i := range vector {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", i, text)))
+		v := float64(int32(binary.BigEndian.Uint32(sum[:4]))) / math.MaxInt32
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// mockRelevance 按查询中出现在文档里的字的比例估算相关度
+func mockRelevance(query, document string) float64 {
+	runes := []rune(strings.ToLower(query))
+	if len(runes) == 0 {
+		return 0
+	}
+	document = strings.ToLower(document)
+	hits := 0
+	for _, r := range runes {
+		if strings.ContainsRune(document, r) {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(runes))
+}
+
+// mockJSONResponse 返回 JSON 格式的模拟响应
+func mockJSONResponse(req *http.Request, v interface{}) *http.Response {
+	data, _ := json.Marshal(v)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+// mockErrorResponse 返回 OpenAI 格式的错误响应
+func mockErrorResponse(req *http.Request, status int, message string) *http.Response {
+	resp := mockJSONResponse(req, gin.H{"error": gin.H{"message": message, "type": "mock_error"}})
+	resp.StatusCode, resp.Status = status, fmt.Sprintf("%d %s", status, http.StatusText(status))
+	return resp
+}
+
+// mockDuration 解析延迟配置，未配置或无效时使用默认值，可以配置为 0
+func mockDuration(value string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+// sleepContext 等待指定时间，context 结束时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
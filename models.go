@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审计日志中的刷新模型操作
+const auditActionAdminModelsRefresh = "admin.models.refresh"
+
+// 未配置 models.discover.interval 时的刷新间隔，以及每次请求上游的超时
+const (
+	defaultModelDiscoveryInterval = time.Hour
+	modelDiscoveryTimeout         = 30 * time.Second
+)
+
+// 模型能力，与 models.settings 中的开关对应
+const (
+	modelCapabilityVision   = "vision"
+	modelCapabilityTools    = "tools"
+	modelCapabilityJSONMode = "json_mode"
+)
+
+// ModelSettings 单个模型的上下文长度、默认参数、价格和能力
+type ModelSettings struct {
+	// 上下文长度（token），提示词放不下时先减少知识库上下文，仍放不下时拒绝请求
+	ContextWindow int `yaml:"context_window" json:"context_window,omitempty"`
+	// 请求没有指定时使用的 temperature 和 max_tokens
+	Temperature *float32 `yaml:"temperature" json:"temperature,omitempty"`
+	MaxTokens   int      `yaml:"max_tokens" json:"max_tokens,omitempty"`
+	// 每百万 token 的价格，用于在 /api/v1/usage 中估算费用
+	Pricing *ModelPricing `yaml:"pricing" json:"pricing,omitempty"`
+	// 是否支持图片输入、工具调用和 JSON 模式，未配置时不检查
+	Vision   *bool `yaml:"vision" json:"vision,omitempty"`
+	Tools    *bool `yaml:"tools" json:"tools,omitempty"`
+	JSONMode *bool `yaml:"json_mode" json:"json_mode,omitempty"`
+	// 能力等级，数字越大能力越强，用于成本优先的路由和“换更强的模型重新生成”
+	Tier int `yaml:"tier" json:"tier,omitempty"`
+	// 是否为推理模型，为 true 时 max_tokens 改为 max_completion_tokens 发送，未配置时按模型名识别 o1、o3 等
+	Reasoning *bool `yaml:"reasoning" json:"reasoning,omitempty"`
+}
+
+// ModelPricing 每百万 token 的价格
+type ModelPricing struct {
+	Input  float64 `yaml:"input" json:"input"`
+	Output float64 `yaml:"output" json:"output"`
+	// 命中提示词缓存的输入 token 的价格，为 0 时按 input 计算
+	CachedInput float64 `yaml:"cached_input" json:"cached_input,omitempty"`
+}
+
+// unitPrice 输入和输出每百万 token 的价格之和，用于比较模型的价格
+func (p *ModelPricing) unitPrice() float64 {
+	return p.Input + p.Output
+}
+
+// cost 按价格估算用量的费用
+func (p *ModelPricing) cost(stats *UsageStats) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	uncached := stats.PromptTokens - stats.CachedTokens
+	return (float64(uncached)*p.Input + float64(stats.CachedTokens)*cachedPrice + float64(stats.CompletionTokens)*p.Output) / 1e6
+}
+
+// 最近一次从上游发现的模型
+var (
+	discoveryMu      sync.RWMutex
+	discoveredModels []string
+	discoveredAt     time.Time
+	discoveryError   string
+)
+
+// modelsHandler 返回默认模型、可用模型列表、模型别名和各模型的设置
+// 开启模型发现后，可用模型包括上游返回的模型，unavailable 列出配置了但上游没有返回的模型
+// 开启模型探测后，health 返回各模型最近一次的探测结果；开启智能路由后，router 为可以代替模型名的 auto
+func modelsHandler(c *gin.Context) {
+	cfg := currentConfig()
+	result := gin.H{
+		"default":   cfg.Models.Default,
+		"available": availableModels(cfg),
+	}
+	if len(cfg.Models.Aliases) > 0 {
+		result["aliases"] = cfg.Models.Aliases
+	}
+	if len(cfg.Models.Settings) > 0 {
+		result["settings"] = cfg.Models.Settings
+	}
+	if cfg.Models.Probe.Enabled {
+		result["health"] = modelHealthList(cfg)
+	}
+	if cfg.Router.Enabled {
+		result["router"] = routerModelAuto
+	}
+	if cfg.Models.Discover.Enabled {
+		discoveryMu.RLock()
+		if !discoveredAt.IsZero() {
+			result["discovered_at"] = discoveredAt
+		}
+		if discoveryError != "" {
+			result["discovery_error"] = discoveryError
+		}
+		discoveryMu.RUnlock()
+		if unavailable := unavailableModels(cfg); len(unavailable) > 0 {
+			result["unavailable"] = unavailable
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// resolveModel 返回请求实际使用的模型：为空时使用默认模型，别名换成对应的模型
+func resolveModel(cfg *Config, model string) string {
+	if model == "" {
+		return cfg.Models.Default
+	}
+	if target, ok := cfg.Models.Aliases[model]; ok {
+		return target
+	}
+	return model
+}
+
+// isConfiguredModel 判断配置中引用的模型是否在 models.available 中或是配置的别名
+func isConfiguredModel(cfg *Config, model string) bool {
+	_, isAlias := cfg.Models.Aliases[model]
+	return isAlias || containsString(cfg.Models.Available, model)
+}
+
+// availableModels 返回可用的模型：先是 models.available 中的模型，然后是微调任务成功后加入的模型，
+// 最后是上游返回且匹配 models.discover.include 的其他模型
+func availableModels(cfg *Config) []string {
+	models := append([]string{}, cfg.Models.Available...)
+	for _, model := range finetunedModels() {
+		if !containsString(models, model) {
+			models = append(models, model)
+		}
+	}
+	if !cfg.Models.Discover.Enabled {
+		return models
+	}
+	discoveryMu.RLock()
+	defer discoveryMu.RUnlock()
+	for _, model := range discoveredModels {
+		if !containsString(models, model) && matchModelPatterns(cfg.Models.Discover.Include, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// isModelAvailable 判断模型是否可以使用
+func isModelAvailable(cfg *Config, model string) bool {
+	return containsString(availableModels(cfg), model)
+}
+
+// unavailableModels 返回配置了但上游没有返回的模型，还没有成功发现过时返回空
+func unavailableModels(cfg *Config) []string {
+	discoveryMu.RLock()
+	defer discoveryMu.RUnlock()
+	if discoveredAt.IsZero() {
+		return nil
+	}
+	var missing []string
+	for _, model := range cfg.Models.Available {
+		if !containsString(discoveredModels, model) {
+			missing = append(missing, model)
+		}
+	}
+	return missing
+}
+
+// applyModelDefaults 把 models.settings 中的默认参数填入请求中没有指定的字段
+// 推理模型不接受 max_tokens，改为发送 max_completion_tokens
+func applyModelDefaults(cfg *Config, req *openai.ChatCompletionRequest) {
+	settings := cfg.Models.Settings[req.Model]
+	if req.Temperature == 0 && settings.Temperature != nil {
+		req.Temperature = *settings.Temperature
+	}
+	if req.MaxTokens == 0 && req.MaxCompletionTokens == 0 && settings.MaxTokens > 0 {
+		req.MaxTokens = settings.MaxTokens
+	}
+	if req.MaxTokens > 0 && isReasoningModel(cfg, req.Model) {
+		if req.MaxCompletionTokens == 0 {
+			req.MaxCompletionTokens = req.MaxTokens
+		}
+		req.MaxTokens = 0
+	}
+}
+
+// 按模型名识别推理模型时使用的前缀，与 OpenAI 不接受 max_tokens 的模型系列一致
+var reasoningModelPrefixes = []string{"o1", "o3", "o4", "gpt-5"}
+
+// isReasoningModel 判断模型是否为推理模型，优先使用 models.settings 中的 reasoning
+func isReasoningModel(cfg *Config, model string) bool {
+	if reasoning := cfg.Models.Settings[model].Reasoning; reasoning != nil {
+		return *reasoning
+	}
+	name := strings.ToLower(path.Base(model))
+	for _, prefix := range reasoningModelPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupportedCapability 返回请求用到但模型声明不支持的能力，都支持时返回空
+func unsupportedCapability(cfg *Config, req openai.ChatCompletionRequest) string {
+	settings := cfg.Models.Settings[req.Model]
+	if settings.Vision != nil && !*settings.Vision {
+		for _, m := range req.Messages {
+			for _, part := range m.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeImageURL {
+					return modelCapabilityVision
+				}
+			}
+		}
+	}
+	if settings.Tools != nil && !*settings.Tools && (len(req.Tools) > 0 || len(req.Functions) > 0) {
+		return modelCapabilityTools
+	}
+	if settings.JSONMode != nil && !*settings.JSONMode && req.ResponseFormat != nil &&
+		req.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeText {
+		return modelCapabilityJSONMode
+	}
+	return ""
+}
+
+// promptTokenLimit 返回提示词最多可以使用的 token 数，即上下文长度减去为回答预留的 max_tokens
+// 没有配置上下文长度时返回 0，表示不限制
+func promptTokenLimit(cfg *Config, model string, maxTokens int) int {
+	settings := cfg.Models.Settings[model]
+	if settings.ContextWindow <= 0 {
+		return 0
+	}
+	if maxTokens == 0 {
+		maxTokens = settings.MaxTokens
+	}
+	return max(settings.ContextWindow-maxTokens, 1)
+}
+
+// countChatTokens 估算发送给模型的消息列表的 token 数，图片等非文本内容不计入
+func countChatTokens(cfg *Config, model string, messages []openai.ChatCompletionMessage) (int, error) {
+	encoding, _ := tokenEncodingFor(cfg, model)
+	enc, err := tokenEncoder(encoding)
+	if err != nil {
+		return 0, err
+	}
+	counted := make([]TokenCountMessage, len(messages))
+	for i, m := range messages {
+		content := m.Content
+		for _, part := range m.MultiContent {
+			content += part.Text
+		}
+		counted[i] = TokenCountMessage{Role: m.Role, Content: content}
+	}
+	return countMessageTokens(enc, counted), nil
+}
+
+// matchModelPatterns 判断模型是否匹配任一模式，没有模式时全部匹配
+func matchModelPatterns(patterns []string, model string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshModels 调用上游的 /models 接口更新发现的模型，失败时保留上一次的结果
+func refreshModels(ctx context.Context) ([]string, error) {
+	list, err := newOpenAIClient().ListModels(ctx)
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	if err != nil {
+		discoveryError = err.Error()
+		return nil, err
+	}
+	models := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		models = append(models, m.ID)
+	}
+	sort.Strings(models)
+	discoveredModels, discoveredAt, discoveryError = models, time.Now(), ""
+	return models, nil
+}
+
+// discoverModelsPeriodically 按 models.discover.interval 定期刷新模型列表，每次都读取当前配置以支持热加载
+func discoverModelsPeriodically() {
+	for {
+		cfg := currentConfig()
+		interval := modelDiscoveryInterval(cfg)
+		if cfg.Models.Discover.Enabled {
+			ctx, cancel := context.WithTimeout(context.Background(), modelDiscoveryTimeout)
+			models, err := refreshModels(ctx)
+			cancel()
+			if err != nil {
+				slog.Warn("从上游获取模型列表失败，继续使用上一次的结果", "error", err)
+			} else if missing := unavailableModels(cfg); len(missing) > 0 {
+				slog.Warn("配置的模型不在上游的模型列表中", "models", missing, "discovered", len(models))
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// modelDiscoveryInterval 返回模型列表的刷新间隔
+func modelDiscoveryInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Models.Discover.Interval); err == nil && d > 0 {
+		return d
+	}
+	return defaultModelDiscoveryInterval
+}
+
+// adminRefreshModelsHandler 立即从上游刷新模型列表
+func adminRefreshModelsHandler(c *gin.Context) {
+	cfg := currentConfig()
+	models, err := refreshModels(c.Request.Context())
+	if err != nil {
+		recordAudit(c, auditActionAdminModelsRefresh, "models", err.Error(), http.StatusBadGateway)
+		respondError(c, http.StatusBadGateway, tr(c, "error.models_refresh_failed", err))
+		return
+	}
+	recordAudit(c, auditActionAdminModelsRefresh, "models", "", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     tr(c, "message.models_refreshed", len(models)),
+		"discovered":  models,
+		"available":   availableModels(cfg),
+		"unavailable": unavailableModels(cfg),
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 审核处理方式
+const (
+	moderationActionBlock = "block"
+	moderationActionFlag  = "flag"
+	moderationActionAllow = "allow"
+)
+
+// 审核来源
+const (
+	moderationProviderKeywords = "keywords"
+	moderationProviderOpenAI   = "openai"
+)
+
+const moderationLogFile = "moderation_log.jsonl"
+
+// ModerationResult 内容审核结果
+type ModerationResult struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// ModerationLogEntry 审核日志条目
+type ModerationLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	// 开启 pii.enabled 时为屏蔽敏感信息后的消息
+	Message    string   `json:"message"`
+	Categories []string `json:"categories,omitempty"`
+	ClientIP   string   `json:"client_ip"`
+}
+
+var moderationLogMu sync.Mutex
+
+// moderationAction 返回配置的处理方式
+func moderationAction() string {
+	action := currentConfig().Moderation.Action
+	switch action {
+	case moderationActionFlag, moderationActionAllow:
+		return action
+	}
+	return moderationActionBlock
+}
+
+// moderateMessage 在调用模型前审核用户消息
+func moderateMessage(ctx context.Context, text string) (*ModerationResult, error) {
+	if currentConfig().Moderation.Provider == moderationProviderOpenAI {
+		return moderateWithOpenAI(ctx, text)
+	}
+	return moderateWithKeywords(text), nil
+}
+
+// moderateWithKeywords 使用本地关键词规则审核
+func moderateWithKeywords(text string) *ModerationResult {
+	result := &ModerationResult{}
+	lower := strings.ToLower(text)
+	for _, keyword := range currentConfig().Moderation.Keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			result.Flagged = true
+			result.Categories = append(result.Categories, "keyword:"+keyword)
+		}
+	}
+	return result
+}
+
+// moderateWithOpenAI 调用OpenAI审核接口
+func moderateWithOpenAI(ctx context.Context, text string) (*ModerationResult, error) {
+	resp, err := newOpenAIClient().Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: currentConfig().Moderation.Model,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ModerationResult{}
+	for _, r := range resp.Results {
+		if !r.Flagged {
+			continue
+		}
+		result.Flagged = true
+
+		// 将命中的分类展开为列表
+		data, _ := json.Marshal(r.Categories)
+		var categories map[string]bool
+		json.Unmarshal(data, &categories)
+		for name, hit := range categories {
+			if hit {
+				result.Categories = append(result.Categories, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// appendModerationLog 追加一条审核日志
+func appendModerationLog(entry ModerationLogEntry) {
+	moderationLogMu.Lock()
+	defer moderationLogMu.Unlock()
+
+	if err := appendJSONLine(dataPath(moderationLogFile), entry); err != nil {
+		slog.Error("写入审核日志失败", "error", err)
+	}
+}
+
+// moderationLogHandler 查询审核日志（管理接口）
+// since为RFC3339时间，limit限制返回条数，结果按时间倒序；逐行读取日志，内存中只保留最新的 limit 条
+func moderationLogHandler(c *gin.Context) {
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.since_invalid"))
+			return
+		}
+		since = t
+	}
+
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	// 日志按时间追加，latest 作为环形缓冲区保存最新的 limit 条
+	var latest []ModerationLogEntry
+	total := 0
+	moderationLogMu.Lock()
+	err := readJSONLines(dataPath(moderationLogFile), func(line []byte) {
+		var entry ModerationLogEntry
+		if json.Unmarshal(line, &entry) != nil {
+			return
+		}
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			return
+		}
+		if len(latest) < limit {
+			latest = append(latest, entry)
+		} else {
+			latest[total%limit] = entry
+		}
+		total++
+	})
+	moderationLogMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_moderation_log"))
+		return
+	}
+
+	entries := make([]ModerationLogEntry, 0, len(latest))
+	for i := range latest {
+		entries = append(entries, latest[(total-1-i)%len(latest)])
+	}
+
+	recordAudit(c, auditActionAdminQuery, "moderation", c.Request.URL.RawQuery, http.StatusOK)
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"entries": entries,
+	})
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Swagger UI 使用的前端资源
+const swaggerUIVersion = "5.17.14"
+
+// fields 描述 gin.H 形式的响应，值为示例类型，用于生成文档中的字段类型
+type fields map[string]interface{}
+
+// ErrorResponse 错误响应
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// apiParam 路径或查询参数
+type apiParam struct {
+	Name        string
+	In          string
+	Description string
+	Type        string
+}
+
+// apiOperation 一个API接口的文档描述
+type apiOperation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Params      []apiParam
+	Request     interface{}
+	Response    interface{}
+	Admin       bool
+	ErrorStatus []int
+	// 请求体和响应的内容类型，默认为 application/json
+	ContentType string
+}
+
+// statusDescription 返回状态码的说明，标准库没有收录 499
+func statusDescription(status int) string {
+	if status == statusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// apiOperations 全部API接口，路径相对于 /api/v1，新增接口时需要同步添加
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/chat", Tag: "chat", Summary: "发送消息并返回模型的回答",
+		Params: []apiParam{
+			{Name: "X-Workspace", In: "header", Description: "工作区，也可以在请求体中指定", Type: "string"},
+			{Name: "X-Answer-Language", In: "header", Description: "回答语言，也可以在请求体中指定", Type: "string"},
+		},
+		Request:     ChatRequest{},
+		Response:    ChatResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, statusClientClosedRequest, http.StatusInternalServerError}},
+	{Method: "POST", Path: "/chat/batch", Tag: "chat", Summary: "批量对话，请求体和响应每行一个条目（JSON Lines）",
+		Request:     BatchItem{},
+		Response:    BatchResult{},
+		ContentType: batchContentType,
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge}},
+	{Method: "POST", Path: "/chat/regenerate", Tag: "chat", Summary: "换更强的模型重新回答问答记录中的问题",
+		Request:     RegenerateRequest{},
+		Response:    ChatResponse{},
+		ErrorStatus: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusForbidden, http.StatusInternalServerError}},
+	{Method: "POST", Path: "/chat/{job_id}/cancel", Tag: "chat", Summary: "取消正在进行的生成，job_id 为该次请求的请求ID",
+		Params:      []apiParam{{Name: "job_id", In: "path", Description: "请求ID（X-Request-ID）", Type: "string"}},
+		Response:    fields{"message": "", "job_id": ""},
+		ErrorStatus: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound}},
+	{Method: "GET", Path: "/models", Tag: "chat", Summary: "可用模型列表",
+		Response: fields{"default": "", "available": []string{}, "aliases": map[string]string{}, "settings": map[string]ModelSettings{}, "health": []ModelHealth{}, "router": "", "unavailable": []string{}, "discovered_at": "", "discovery_error": ""}},
+	{Method: "GET", Path: "/usage", Tag: "chat", Summary: "token 用量统计",
+		Response: fields{"total": UsageStats{}, "cache_hit_ratio": 0.0, "cost": 0.0,
+			"models":   map[string]fields{"": {"stats": UsageStats{}, "cache_hit_ratio": 0.0, "cost": 0.0}},
+			"features": map[string]UsageStats{}}},
+	{Method: "GET", Path: "/version", Tag: "system", Summary: "版本和构建信息",
+		Response: fields{"version": "", "git_commit": "", "build_time": "", "go_version": "", "profile": ""}},
+	{Method: "GET", Path: "/status", Tag: "system", Summary: "服务状态、模型探测结果和上游节点状态",
+		Response: fields{"status": "", "version": "", "models": []ModelHealth{}, "upstreams": []UpstreamStatus{}, "read_only": false, "message": ""}},
+	{Method: "GET", Path: "/announcement", Tag: "system", Summary: "正在显示的公告，没有时为 null",
+		Response: fields{"announcement": Announcement{}}},
+	{Method: "PUT", Path: "/announcement", Tag: "system", Summary: "发布或撤下公告，message 为空时撤下", Admin: true,
+		Request:  AnnouncementRequest{},
+		Response: fields{"announcement": Announcement{}, "active": false}},
+	{Method: "GET", Path: "/recent", Tag: "qa", Summary: "最近的问答记录",
+		Response: fields{"recent_qas": []QARecord{}}},
+	{Method: "POST", Path: "/feedback", Tag: "qa", Summary: "评价一条问答的回答，差评的问答进入待审核队列",
+		Request:     FeedbackRequest{},
+		Response:    fields{"message": ""},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: "POST", Path: "/knowledge/add", Tag: "knowledge", Summary: "把问答记录添加到知识库",
+		Request:     AddToKnowledgeRequest{},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound}},
+	{Method: "GET", Path: "/knowledge", Tag: "knowledge", Summary: "知识库全部条目",
+		Response: fields{"knowledge_base": []KnowledgeItem{}}},
+	{Method: "DELETE", Path: "/knowledge/{id}", Tag: "knowledge", Summary: "把知识库条目移到回收站",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"message": "", "undo_token": "", "undo_expires_at": ""},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "GET", Path: "/knowledge/trash", Tag: "knowledge", Summary: "回收站中的条目，最近删除的在前",
+		Response: fields{"trash": []TrashItem{}}},
+	{Method: "GET", Path: "/knowledge/stale", Tag: "knowledge", Summary: "需要复查的条目：包含失效链接、长时间没有更新或模型复核认为可能已经过时",
+		Response: fields{"max_age": "", "total": 0, "checked_at": "", "items": []StaleItem{}}},
+	{Method: "POST", Path: "/knowledge/stale/check", Tag: "knowledge", Summary: "立即检查知识库条目中的链接", Admin: true,
+		Response:    StaleLinkReport{},
+		ErrorStatus: []int{http.StatusConflict}},
+	{Method: "POST", Path: "/knowledge/{id}/restore", Tag: "knowledge", Summary: "把回收站中的条目恢复到知识库",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "POST", Path: "/knowledge/{id}/links", Tag: "knowledge", Summary: "添加指向另一个条目的关联：supersedes、related 或 part-of",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Request:     AddKnowledgeLinkRequest{},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusNotImplemented}},
+	{Method: "DELETE", Path: "/knowledge/{id}/links/{target_id}", Tag: "knowledge", Summary: "删除指向目标条目的关联",
+		Params: []apiParam{
+			{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"},
+			{Name: "target_id", In: "path", Description: "目标条目ID", Type: "integer"},
+			{Name: "type", In: "query", Description: "只删除该类型的关联，为空时删除全部类型", Type: "string"},
+		},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "DELETE", Path: "/knowledge/trash/{id}", Tag: "knowledge", Summary: "永久删除回收站中的条目", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"message": "", "undo_token": "", "undo_expires_at": ""},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "POST", Path: "/undo/{token}", Tag: "knowledge", Summary: "撤销删除等操作，令牌在操作后 5 分钟内有效，只能使用一次",
+		Params:      []apiParam{{Name: "token", In: "path", Description: "操作返回的 undo_token", Type: "string"}},
+		Response:    fields{"message": "", "kind": "", "target": ""},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusConflict}},
+	{Method: "POST", Path: "/knowledge/{id}/translate", Tag: "knowledge", Summary: "把知识库条目翻译成目标语言，保存为关联到原始条目的新条目",
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Request:     TranslateKnowledgeRequest{},
+		Response:    fields{"message": "", "item": KnowledgeItem{}, "usage": TokenUsage{}, "replaced": []int{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway}},
+	{Method: "POST", Path: "/capture", Tag: "knowledge", Summary: "直接把一段文字保存为知识库条目；请求体也可以是纯文本，此时 url、title、tags 从查询参数读取",
+		Request:     CaptureRequest{},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge}},
+	{Method: "POST", Path: "/knowledge/ocr", Tag: "knowledge", Summary: "识别图片中的文字保存为知识库条目，请求体为 PNG、JPEG、GIF 或 WebP 图片",
+		Params: []apiParam{
+			{Name: "title", In: "query", Description: "标题，为空时使用识别出的第一行文字", Type: "string"},
+			{Name: "tags", In: "query", Description: "逗号分隔的标签", Type: "string"},
+		},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway}},
+	{Method: "POST", Path: "/knowledge/{id}/verify", Tag: "knowledge", Summary: "让模型复核条目内容是否仍然准确，结果保存到条目上", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"id": 0, "verification": KnowledgeVerification{}},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusBadGateway}},
+	{Method: "POST", Path: "/knowledge/{id}/score", Tag: "knowledge", Summary: "让模型为条目重新评分，分数过低时标记为草稿", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"id": 0, "quality": KnowledgeQuality{}, "draft": false},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusBadGateway}},
+	{Method: "POST", Path: "/knowledge/{id}/publish", Tag: "knowledge", Summary: "人工确认后取消条目的草稿标记", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "知识库条目ID", Type: "integer"}},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "POST", Path: "/summarize", Tag: "utility", Summary: "对原文、知识库条目或问答记录生成摘要，不写入问答记录",
+		Request:     SummarizeRequest{},
+		Response:    SummarizeResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusBadGateway}},
+	{Method: "POST", Path: "/translate", Tag: "utility", Summary: "翻译文本，不写入问答记录",
+		Request:     TranslateRequest{},
+		Response:    TranslateResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusBadGateway}},
+	{Method: "POST", Path: "/extract", Tag: "utility", Summary: "提取关键词、实体和建议的标题",
+		Request:     ExtractRequest{},
+		Response:    ExtractResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusBadGateway}},
+	{Method: "POST", Path: "/embeddings", Tag: "utility", Summary: "生成文本向量，相同的文本使用缓存",
+		Request:     EmbeddingsRequest{},
+		Response:    EmbeddingsResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusBadGateway, http.StatusServiceUnavailable}},
+	{Method: "POST", Path: "/rerank", Tag: "utility", Summary: "按与查询的相关度重排候选文本",
+		Request:     RerankRequest{},
+		Response:    RerankResponse{},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusBadGateway}},
+	{Method: "POST", Path: "/tokens/count", Tag: "utility", Summary: "按模型计算 token 数",
+		Request:     TokenCountRequest{},
+		Response:    fields{"results": []TokenCount{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge}},
+	{Method: "POST", Path: "/graphql", Tag: "graphql", Summary: "执行 GraphQL 查询或修改",
+		Request:     graphqlRequest{},
+		Response:    fields{"data": map[string]interface{}{}, "errors": []map[string]interface{}{}},
+		ErrorStatus: []int{http.StatusUnauthorized}},
+	{Method: "POST", Path: "/hooks/{name}", Tag: "hooks", Summary: "触发入站 Webhook，按模板生成提示词并调用模型",
+		Params:      []apiParam{{Name: "name", In: "path", Description: "触发器名称", Type: "string"}},
+		Request:     map[string]interface{}{},
+		Response:    fields{"response": "", "model": "", "record_id": 0, "knowledge_id": 0},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusRequestEntityTooLarge}},
+
+	{Method: "GET", Path: "/admin/audit", Tag: "admin", Summary: "查询审计日志", Admin: true,
+		Params: []apiParam{
+			{Name: "action", In: "query", Description: "操作类型", Type: "string"},
+			{Name: "user", In: "query", Description: "用户", Type: "string"},
+			{Name: "ip", In: "query", Description: "客户端IP", Type: "string"},
+			{Name: "since", In: "query", Description: "开始时间（RFC3339）", Type: "string"},
+			{Name: "until", In: "query", Description: "结束时间（RFC3339）", Type: "string"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "entries": []AuditEntry{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/moderation/log", Tag: "moderation", Summary: "查询内容审核日志，结果按时间倒序", Admin: true,
+		Params: []apiParam{
+			{Name: "since", In: "query", Description: "开始时间（RFC3339）", Type: "string"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "entries": []ModerationLogEntry{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/stats", Tag: "admin", Summary: "管理后台汇总统计", Admin: true,
+		Response: fields{
+			"users":           fields{"count": 0, "list": []string{}},
+			"requests":        fields{"chats": 0, "by_action": map[string]int{}, "since_startup": 0},
+			"tokens":          UsageStats{},
+			"knowledge":       fields{"items": 0, "top_tags": []TagCount{}},
+			"recent_qas":      0,
+			"error_trends":    []DailyCount{},
+			"cache_hit_ratio": 0.0,
+		}},
+	{Method: "POST", Path: "/admin/cache/clear", Tag: "admin", Summary: "清空服务端缓存", Admin: true,
+		Response: fields{"message": ""}},
+	{Method: "POST", Path: "/admin/backup", Tag: "admin", Summary: "立即备份数据文件", Admin: true,
+		Response:    fields{"message": "", "path": "", "files": []string{}},
+		ErrorStatus: []int{http.StatusInternalServerError}},
+	{Method: "POST", Path: "/admin/reindex", Tag: "admin", Summary: "重建知识库检索索引", Admin: true,
+		Response: fields{"message": "", "items": 0}},
+	{Method: "POST", Path: "/admin/reload", Tag: "admin", Summary: "重新加载配置文件", Admin: true,
+		Response:    fields{"message": "", "restart_required": []string{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/features", Tag: "admin", Summary: "各功能开关当前是否开启", Admin: true,
+		Response: fields{"features": map[string]bool{}}},
+	{Method: "GET", Path: "/admin/tokens", Tag: "admin", Summary: "个人访问令牌列表，不包含令牌本身", Admin: true,
+		Response: fields{"tokens": []AccessToken{}}},
+	{Method: "POST", Path: "/admin/tokens", Tag: "admin", Summary: "创建只能调用收集和提问接口的个人访问令牌，令牌只返回这一次", Admin: true,
+		Request:     CreateAccessTokenRequest{},
+		Response:    fields{"token": "", "info": AccessToken{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "DELETE", Path: "/admin/tokens/{id}", Tag: "admin", Summary: "撤销个人访问令牌", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "令牌ID", Type: "string"}},
+		Response:    fields{"message": "", "id": ""},
+		ErrorStatus: []int{http.StatusNotFound}},
+	{Method: "GET", Path: "/admin/maintenance", Tag: "admin", Summary: "只读模式的状态", Admin: true,
+		Response: fields{"read_only": false, "source": "", "message": "", "since": "", "user": ""}},
+	{Method: "POST", Path: "/admin/maintenance", Tag: "admin", Summary: "开启或关闭只读模式，对话和写入返回 503", Admin: true,
+		Request:     MaintenanceRequest{},
+		Response:    fields{"read_only": false, "source": "", "message": "", "since": "", "user": ""},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusConflict}},
+	{Method: "POST", Path: "/admin/models/refresh", Tag: "admin", Summary: "从上游刷新模型列表", Admin: true,
+		Response:    fields{"message": "", "discovered": []string{}, "available": []string{}, "unavailable": []string{}},
+		ErrorStatus: []int{http.StatusBadGateway}},
+	{Method: "GET", Path: "/admin/events", Tag: "admin", Summary: "事件日志，需开启 events.log", Admin: true,
+		Params: []apiParam{
+			{Name: "event", In: "query", Description: "事件类型", Type: "string"},
+			{Name: "data", In: "query", Description: "为 false 时不返回事件内容", Type: "boolean"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "events": []Event{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/events/subscribers", Tag: "admin", Summary: "事件类型和已注册的订阅者", Admin: true,
+		Response: fields{"events": []string{}, "subscribers": []fields{{"name": "", "event": ""}}}},
+	{Method: "GET", Path: "/admin/webhooks/deliveries", Tag: "admin", Summary: "Webhook 投递记录", Admin: true,
+		Params: []apiParam{
+			{Name: "webhook", In: "query", Description: "接收地址名称", Type: "string"},
+			{Name: "event", In: "query", Description: "事件类型", Type: "string"},
+			{Name: "failed", In: "query", Description: "为 true 时只返回失败的投递", Type: "boolean"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "deliveries": []WebhookDelivery{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/schedules", Tag: "admin", Summary: "定时任务列表及下次运行时间", Admin: true,
+		Response: fields{"schedules": []fields{{"name": "", "cron": "", "model": "", "save": false, "webhook": "", "email": []string{}, "next_run": ""}}}},
+	{Method: "POST", Path: "/admin/schedules/{name}/run", Tag: "admin", Summary: "立即运行一次定时任务", Admin: true,
+		Params:      []apiParam{{Name: "name", In: "path", Description: "定时任务名称", Type: "string"}},
+		Response:    fields{"run": ScheduleRun{}},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError}},
+	{Method: "GET", Path: "/admin/schedules/{name}/runs", Tag: "admin", Summary: "定时任务运行记录", Admin: true,
+		Params: []apiParam{
+			{Name: "name", In: "path", Description: "定时任务名称", Type: "string"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "runs": []ScheduleRun{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/shadow", Tag: "admin", Summary: "影子流量对比记录", Admin: true,
+		Params: []apiParam{
+			{Name: "model", In: "query", Description: "影子模型", Type: "string"},
+			{Name: "limit", In: "query", Description: "最多返回的条数", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "summary": []ShadowSummary{}, "comparisons": []ShadowComparison{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/errors", Tag: "admin", Summary: "失败的回答和按错误类型的汇总，最新的在前", Admin: true,
+		Params: []apiParam{
+			{Name: "class", In: "query", Description: "错误类型，例如 timeout、rate_limited、upstream_error", Type: "string"},
+			{Name: "model", In: "query", Description: "模型", Type: "string"},
+			{Name: "since", In: "query", Description: "开始时间（RFC3339）", Type: "string"},
+			{Name: "limit", In: "query", Description: "最多返回的条数，默认 100", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "groups": []ChatFailureGroup{}, "errors": []ChatFailure{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/admin/export/finetune", Tag: "admin", Summary: "把问答记录导出为微调数据，每行一个样本（JSON Lines）", Admin: true,
+		Params: []apiParam{
+			{Name: "format", In: "query", Description: "openai（默认）或 sharegpt", Type: "string"},
+			{Name: "tags", In: "query", Description: "逗号分隔的标签，只导出回答保存到知识库且带有其中任一标签的问答", Type: "string"},
+			{Name: "model", In: "query", Description: "模型", Type: "string"},
+			{Name: "since", In: "query", Description: "开始时间（RFC3339）", Type: "string"},
+			{Name: "min_score", In: "query", Description: "评审模型的最低评分", Type: "number"},
+			{Name: "rating", In: "query", Description: "用户评价，up 或 down", Type: "string"},
+			{Name: "include_flagged", In: "query", Description: "是否包含被标记的问答", Type: "boolean"},
+			{Name: "system", In: "query", Description: "为 false 时不包含系统提示词", Type: "boolean"},
+		},
+		Response:    openAIFinetuneExample{},
+		ContentType: batchContentType,
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/admin/finetune/files", Tag: "admin", Summary: "上传微调数据集，请求体为 OpenAI 微调格式的 JSON Lines", Admin: true,
+		Params: []apiParam{
+			{Name: "name", In: "query", Description: "文件名", Type: "string"},
+			{Name: "from_history", In: "query", Description: "为 true 时上传从问答记录导出的数据，筛选参数与导出接口相同", Type: "boolean"},
+		},
+		Request:     openAIFinetuneExample{},
+		Response:    fields{"file": FinetuneFile{}, "examples": 0},
+		ContentType: batchContentType,
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusBadGateway}},
+	{Method: "POST", Path: "/admin/finetune/jobs", Tag: "admin", Summary: "创建微调任务", Admin: true,
+		Request:     FinetuneJobRequest{},
+		Response:    fields{"message": "", "job": FinetuneJob{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusBadGateway}},
+	{Method: "GET", Path: "/admin/finetune/jobs", Tag: "admin", Summary: "微调任务列表", Admin: true,
+		Response: fields{"jobs": []FinetuneJob{}}},
+	{Method: "GET", Path: "/admin/finetune/jobs/{id}", Tag: "admin", Summary: "刷新并返回微调任务的状态和训练事件", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "微调任务ID", Type: "string"}},
+		Response:    fields{"job": FinetuneJob{}, "events": []FinetuneEvent{}},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusBadGateway}},
+	{Method: "POST", Path: "/admin/finetune/jobs/{id}/cancel", Tag: "admin", Summary: "取消微调任务", Admin: true,
+		Params:      []apiParam{{Name: "id", In: "path", Description: "微调任务ID", Type: "string"}},
+		Response:    fields{"message": "", "job": FinetuneJob{}},
+		ErrorStatus: []int{http.StatusNotFound, http.StatusConflict, http.StatusBadGateway}},
+	{Method: "GET", Path: "/analytics/topics", Tag: "admin", Summary: "最近一次问题主题分析的结果，主题按问题数从多到少排列", Admin: true,
+		Response: TopicReport{}},
+	{Method: "POST", Path: "/analytics/topics/refresh", Tag: "admin", Summary: "立即重新分析问题主题", Admin: true,
+		Response:    TopicReport{},
+		ErrorStatus: []int{http.StatusConflict, http.StatusNotImplemented, http.StatusBadGateway}},
+	{Method: "GET", Path: "/analytics/trending", Tag: "admin", Summary: "一段时间内反复出现的问题和它们的最佳回答，按提问次数从多到少排列", Admin: true,
+		Params: []apiParam{
+			{Name: "window", In: "query", Description: "统计的时间范围，默认 168h", Type: "string"},
+			{Name: "min_count", In: "query", Description: "最少的提问次数，默认 2", Type: "integer"},
+			{Name: "limit", In: "query", Description: "最多返回的条数，默认 20", Type: "integer"},
+		},
+		Response:    fields{"window": "", "total": 0, "questions": []TrendingQuestion{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusNotImplemented}},
+	{Method: "POST", Path: "/analytics/trending/publish", Tag: "admin", Summary: "把热门问题的最佳回答发布为知识库条目", Admin: true,
+		Request:     PublishTrendingRequest{},
+		Response:    fields{"message": "", "item": KnowledgeItem{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{Method: "GET", Path: "/admin/curation/queue", Tag: "admin", Summary: "待审核的问答：收到差评且还没有审核过，最新的在前", Admin: true,
+		Params: []apiParam{
+			{Name: "include_flagged", In: "query", Description: "是否同时包含被自动标记的问答", Type: "boolean"},
+			{Name: "limit", In: "query", Description: "最多返回的条数，默认 100", Type: "integer"},
+		},
+		Response:    fields{"total": 0, "items": []CurationItem{}},
+		ErrorStatus: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/admin/curation/{record_id}", Tag: "admin", Summary: "审核一条问答：accept、edit 加入标准数据集，reject 移出待审核队列", Admin: true,
+		Params:      []apiParam{{Name: "record_id", In: "path", Description: "问答记录ID", Type: "integer"}},
+		Request:     CurationRequest{},
+		Response:    fields{"message": "", "example": GoldenExample{}},
+		ErrorStatus: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: "GET", Path: "/admin/curation/golden", Tag: "admin", Summary: "审核结果，默认只返回标准数据集中的条目", Admin: true,
+		Params:   []apiParam{{Name: "action", In: "query", Description: "accept、edit 或 reject", Type: "string"}},
+		Response: fields{"total": 0, "examples": []GoldenExample{}}},
+	{Method: "GET", Path: "/admin/export/golden", Tag: "admin", Summary: "把标准数据集导出为评测或微调数据，每行一个样本（JSON Lines）", Admin: true,
+		Params: []apiParam{
+			{Name: "format", In: "query", Description: "openai（默认）、sharegpt 或 eval", Type: "string"},
+			{Name: "tags", In: "query", Description: "逗号分隔的标签，只导出带有其中任一标签的条目", Type: "string"},
+			{Name: "system", In: "query", Description: "为 false 时不包含系统提示词", Type: "boolean"},
+		},
+		Response:    openAIFinetuneExample{},
+		ContentType: batchContentType,
+		ErrorStatus: []int{http.StatusBadRequest}},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]interface{}
+)
+
+// openAPIHandler 返回 OpenAPI 3 文档
+func openAPIHandler(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = buildOpenAPI()
+	})
+	c.JSON(http.StatusOK, openAPIDoc)
+}
+
+// buildOpenAPI 根据接口列表和请求、响应结构体生成 OpenAPI 文档
+func buildOpenAPI() map[string]interface{} {
+	components := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	errorSchema := schemaFor(reflect.TypeOf(ErrorResponse{}), components)
+	for _, op := range apiOperations {
+		operation := map[string]interface{}{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+		}
+
+		var params []interface{}
+		for _, p := range op.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.In == "path",
+				"schema":      map[string]interface{}{"type": p.Type},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					contentType: map[string]interface{}{"schema": schemaForValue(op.Request, components)},
+				},
+			}
+		}
+
+		responses := map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "成功",
+				"content": map[string]interface{}{
+					contentType: map[string]interface{}{"schema": schemaForValue(op.Response, components)},
+				},
+			},
+		}
+		errorStatus := append([]int{}, op.ErrorStatus...)
+		if op.Admin {
+			errorStatus = append(errorStatus, http.StatusUnauthorized, http.StatusForbidden)
+			operation["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		}
+		for _, status := range errorStatus {
+			responses[statusKey(status)] = map[string]interface{}{
+				"description": statusDescription(status),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorSchema},
+				},
+			}
+		}
+		operation["responses"] = responses
+
+		item, _ := paths[op.Path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "AI Assistant API",
+			"version":     version,
+			"description": "AI 助手的 REST 接口。错误响应统一为 {code, message, request_id}。",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": apiV1Prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "管理令牌（admin.token），也可以通过 X-Admin-Token 请求头传递",
+				},
+			},
+		},
+	}
+}
+
+// operationID 根据方法和路径生成 operationId，例如 GET /knowledge/{id} -> getKnowledgeId
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '_'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// statusKey 把状态码转换为文档中 responses 的键
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
+
+// schemaForValue 返回示例值对应的 schema
+func schemaForValue(v interface{}, components map[string]interface{}) map[string]interface{} {
+	if f, ok := v.(fields); ok {
+		properties := map[string]interface{}{}
+		for name, value := range f {
+			properties[name] = schemaForValue(value, components)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	if m, ok := v.(map[string]fields); ok {
+		var item interface{} = fields{}
+		for _, value := range m {
+			item = value
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaForValue(item, components)}
+	}
+	return schemaFor(reflect.TypeOf(v), components)
+}
+
+// schemaFor 通过反射生成类型的 schema，结构体放入 components 并返回引用
+func schemaFor(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), components)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), components)}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := components[name]; !ok {
+			// 先占位，避免结构体引用自身时无限递归
+			components[name] = map[string]interface{}{}
+			components[name] = structSchema(t, components)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema 根据 json 标签生成结构体的 schema，binding:"required" 的字段为必填
+func structSchema(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, components)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// swaggerUIHandler 返回 Swagger UI 页面
+func swaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <title>AI Assistant API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@`+swaggerUIVersion+`/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@`+swaggerUIVersion+`/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({ url: '/api/openapi.json', dom_id: '#swagger-ui' });
+    </script>
+</body>
+</html>`))
+}
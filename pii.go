@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// piiPattern 一类敏感信息的识别规则
+type piiPattern struct {
+	name   string
+	label  string
+	regexp *regexp.Regexp
+}
+
+// 识别顺序很重要：身份证号需要在手机号之前匹配，避免被截取成手机号
+var piiPatterns = []piiPattern{
+	{
+		name:   "api_key",
+		label:  "API_KEY",
+		regexp: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{16,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{20,}|xox[abpr]-[A-Za-z0-9-]{10,})`),
+	},
+	{
+		name:   "email",
+		label:  "EMAIL",
+		regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		name:   "id_card",
+		label:  "ID_CARD",
+		regexp: regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+	},
+	{
+		name:   "phone",
+		label:  "PHONE",
+		regexp: regexp.MustCompile(`(?:\+?86[- ]?)?\b1[3-9]\d{9}\b`),
+	},
+}
+
+// PIIMapping 占位符与原始内容的对应关系，只保存在本地
+type PIIMapping map[string]string
+
+// piiEnabledTypes 返回启用的敏感信息类型，未配置时全部启用
+func piiEnabledTypes() map[string]bool {
+	enabled := make(map[string]bool)
+	types := currentConfig().PII.Types
+	if len(types) == 0 {
+		for _, p := range piiPatterns {
+			enabled[p.name] = true
+		}
+		return enabled
+	}
+	for _, t := range types {
+		enabled[t] = true
+	}
+	return enabled
+}
+
+// redactPII 将文本中的敏感信息替换为占位符，返回替换后的文本和映射关系
+// 相同的原始内容会复用同一个占位符
+func redactPII(text string) (string, PIIMapping) {
+	mapping := PIIMapping{}
+	reverse := map[string]string{}
+	counters := map[string]int{}
+	enabled := piiEnabledTypes()
+
+	for _, p := range piiPatterns {
+		if !enabled[p.name] {
+			continue
+		}
+		text = p.regexp.ReplaceAllStringFunc(text, func(match string) string {
+			if placeholder, ok := reverse[match]; ok {
+				return placeholder
+			}
+			counters[p.label]++
+			placeholder := fmt.Sprintf("[%s_%d]", p.label, counters[p.label])
+			mapping[placeholder] = match
+			reverse[match] = placeholder
+			return placeholder
+		})
+	}
+
+	return text, mapping
+}
+
+// restore 将模型回复中的占位符还原为原始内容
+func (m PIIMapping) restore(text string) string {
+	if len(m) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(m)*2)
+	for placeholder, original := range m {
+		pairs = append(pairs, placeholder, original)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// redact 将文本中已经屏蔽过的原始内容替换回占位符，用于把回答发送给外部服务
+func (m PIIMapping) redact(text string) string {
+	if len(m) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(m)*2)
+	for placeholder, original := range m {
+		pairs = append(pairs, original, placeholder)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
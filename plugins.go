@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 插件可以挂载的位置：调用模型前、得到回答后、添加知识库条目前
+const (
+	pluginHookPreChat        = "pre_chat"
+	pluginHookPostChat       = "post_chat"
+	pluginHookOnKnowledgeAdd = "on_knowledge_add"
+)
+
+var pluginHooks = []string{pluginHookPreChat, pluginHookPostChat, pluginHookOnKnowledgeAdd}
+
+// 插件调用失败时的处理：allow 跳过该插件继续处理，reject 拒绝请求
+const (
+	pluginOnErrorAllow  = "allow"
+	pluginOnErrorReject = "reject"
+)
+
+// 未配置 timeout 时单次调用插件的超时
+const defaultPluginTimeout = 5 * time.Second
+
+// 插件响应的最大长度
+const pluginMaxResponseBytes = 1 << 20
+
+var pluginHTTPClient = &http.Client{}
+
+// PluginConfig 外部插件的清单，插件是一个 HTTP 接口，在挂载的位置被调用，可以修改数据或拒绝请求
+type PluginConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// 挂载的位置：pre_chat、post_chat、on_knowledge_add
+	Hooks []string `yaml:"hooks"`
+	Auth  struct {
+		// 以 Authorization: Bearer 发送
+		Token string `yaml:"token"`
+		// 用于签名的密钥，签名方式与 Webhook 相同，为空时不签名
+		Secret string `yaml:"secret"`
+	} `yaml:"auth"`
+	// 单次调用的超时，默认 5s
+	Timeout string `yaml:"timeout"`
+	// 调用失败或响应无效时的处理，默认 allow
+	OnError string `yaml:"on_error"`
+}
+
+// PluginRequest 发送给插件的请求体
+type PluginRequest struct {
+	Hook      string      `json:"hook"`
+	Plugin    string      `json:"plugin"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// PluginResponse 插件的响应，reject 为 true 时拒绝本次请求，message 为返回给用户的原因；
+// data 为修改后的数据，只有挂载位置允许修改的字段生效，省略的字段保持不变
+type PluginResponse struct {
+	Reject  bool            `json:"reject"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// PluginChatData pre_chat 和 post_chat 发送给插件的数据，pre_chat 可以修改 message 和 model，post_chat 可以修改 answer
+type PluginChatData struct {
+	Message   string `json:"message"`
+	Model     string `json:"model"`
+	User      string `json:"user,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+	Answer    string `json:"answer,omitempty"`
+}
+
+// pluginChatPatch 插件对对话数据的修改
+type pluginChatPatch struct {
+	Message *string `json:"message"`
+	Model   *string `json:"model"`
+	Answer  *string `json:"answer"`
+}
+
+// pluginKnowledgePatch 插件对知识库条目的修改，on_knowledge_add 可以修改标题、内容和标签
+type pluginKnowledgePatch struct {
+	Title   *string   `json:"title"`
+	Content *string   `json:"content"`
+	Tags    *[]string `json:"tags"`
+}
+
+// pluginRejection 插件拒绝了请求，或者插件调用失败且 on_error 为 reject
+type pluginRejection struct {
+	Plugin  string
+	Message string
+}
+
+func (e *pluginRejection) Error() string {
+	return fmt.Sprintf("插件 %s 拒绝了请求：%s", e.Plugin, e.Message)
+}
+
+// pluginChatError 把插件拒绝转换为对话错误
+func pluginChatError(err error) *chatError {
+	var rejection *pluginRejection
+	if !errors.As(err, &rejection) {
+		rejection = &pluginRejection{Message: err.Error()}
+	}
+	chatErr := newChatError(http.StatusForbidden, "error.plugin_rejected", rejection.Plugin, rejection.Message)
+	chatErr.Audit = true
+	return chatErr
+}
+
+// runPlugins 按配置顺序调用挂载在 hook 上的插件，每个插件看到的是前面插件修改后的数据；
+// data 在每次调用前重新生成，apply 把插件返回的修改应用到调用方的数据上；任一插件拒绝时停止并返回 *pluginRejection
+func runPlugins(ctx context.Context, hook string, data func() interface{}, apply func(json.RawMessage) error) error {
+	for _, plugin := range currentConfig().Plugins {
+		if !containsString(plugin.Hooks, hook) {
+			continue
+		}
+		resp, err := callPlugin(ctx, plugin, hook, data())
+		if err == nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+			if applyErr := apply(resp.Data); applyErr != nil {
+				err = fmt.Errorf("插件返回的数据无效: %w", applyErr)
+			}
+		}
+		if err != nil {
+			if plugin.OnError == pluginOnErrorReject {
+				return &pluginRejection{Plugin: plugin.Name, Message: err.Error()}
+			}
+			slog.Warn("调用插件失败，跳过该插件", "plugin", plugin.Name, "hook", hook, "error", err)
+			continue
+		}
+		if resp.Reject {
+			message := resp.Message
+			if message == "" {
+				message = "未说明原因"
+			}
+			return &pluginRejection{Plugin: plugin.Name, Message: message}
+		}
+	}
+	return nil
+}
+
+// callPlugin 调用一次插件，网络错误、非2xx响应和无法解析的响应都返回错误，不重试
+func callPlugin(ctx context.Context, plugin PluginConfig, hook string, data interface{}) (*PluginResponse, error) {
+	body, err := json.Marshal(PluginRequest{Hook: hook, Plugin: plugin.Name, Timestamp: time.Now().UTC(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout(plugin))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, plugin.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ai-assistant/"+version)
+	req.Header.Set("X-Plugin-Hook", hook)
+	req.Header.Set("X-Plugin-Timestamp", timestamp)
+	if plugin.Auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+plugin.Auth.Token)
+	}
+	if plugin.Auth.Secret != "" {
+		req.Header.Set("X-Plugin-Signature", "sha256="+webhookSignature(plugin.Auth.Secret, timestamp, body))
+	}
+
+	start := time.Now()
+	resp, err := pluginHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("插件返回状态码 %d", resp.StatusCode)
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, pluginMaxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("插件调用完成", "plugin", plugin.Name, "hook", hook, "duration_ms", time.Since(start).Milliseconds())
+
+	var result PluginResponse
+	// 空响应表示不做修改
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return &result, nil
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析插件响应失败: %w", err)
+	}
+	return &result, nil
+}
+
+// runPreChatPlugins 调用 pre_chat 插件，插件可以修改问题和模型，改成未配置的模型时按响应无效处理
+func runPreChatPlugins(ctx context.Context, cfg *Config, req *ChatRequest) error {
+	return runPlugins(ctx, pluginHookPreChat, func() interface{} {
+		return PluginChatData{Message: req.Message, Model: req.Model, User: req.User, Workspace: req.Workspace}
+	}, func(raw json.RawMessage) error {
+		var patch pluginChatPatch
+		if err := json.Unmarshal(raw, &patch); err != nil {
+			return err
+		}
+		if patch.Message != nil && *patch.Message == "" {
+			return errors.New("message 不能为空")
+		}
+		if patch.Model != nil && *patch.Model != req.Model {
+			model := resolveModel(cfg, *patch.Model)
+			if !isConfiguredModel(cfg, model) {
+				return fmt.Errorf("模型 %s 不可用", *patch.Model)
+			}
+			req.Model = model
+		}
+		if patch.Message != nil {
+			req.Message = *patch.Message
+		}
+		return nil
+	})
+}
+
+// runPostChatPlugins 调用 post_chat 插件，插件可以修改回答；流式响应已经输出的内容无法收回，最终结果以修改后的回答为准
+func runPostChatPlugins(ctx context.Context, req ChatRequest, answer *string) error {
+	return runPlugins(ctx, pluginHookPostChat, func() interface{} {
+		return PluginChatData{Message: req.Message, Model: req.Model, User: req.User, Workspace: req.Workspace, Answer: *answer}
+	}, func(raw json.RawMessage) error {
+		var patch pluginChatPatch
+		if err := json.Unmarshal(raw, &patch); err != nil {
+			return err
+		}
+		if patch.Answer != nil {
+			*answer = *patch.Answer
+		}
+		return nil
+	})
+}
+
+// runKnowledgePlugins 调用 on_knowledge_add 插件，插件可以修改条目的标题、内容和标签
+func runKnowledgePlugins(ctx context.Context, item *KnowledgeItem) error {
+	return runPlugins(ctx, pluginHookOnKnowledgeAdd, func() interface{} {
+		return *item
+	}, func(raw json.RawMessage) error {
+		var patch pluginKnowledgePatch
+		if err := json.Unmarshal(raw, &patch); err != nil {
+			return err
+		}
+		if (patch.Title != nil && *patch.Title == "") || (patch.Content != nil && *patch.Content == "") {
+			return errors.New("title 和 content 不能为空")
+		}
+		if patch.Title != nil {
+			item.Title = *patch.Title
+		}
+		if patch.Content != nil {
+			item.Content = *patch.Content
+		}
+		if patch.Tags != nil {
+			item.Tags = *patch.Tags
+		}
+		return nil
+	})
+}
+
+// pluginTimeout 返回单次调用插件的超时
+func pluginTimeout(plugin PluginConfig) time.Duration {
+	if d, err := time.ParseDuration(plugin.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultPluginTimeout
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPprofMux 创建注册了pprof处理器的路由
+func newPprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// setupPprof 按配置启用pprof
+// 配置了pprof.listen时在独立端口上提供，否则挂在需要管理认证的/api/v1/admin/debug/pprof下
+func setupPprof(admins ...*gin.RouterGroup) {
+	cfg := currentConfig().Pprof
+	if !cfg.Enabled {
+		return
+	}
+
+	if cfg.Listen != "" {
+		go func() {
+			slog.Info("pprof已启动", "address", cfg.Listen)
+			if err := http.ListenAndServe(cfg.Listen, newPprofMux()); err != nil {
+				slog.Error("pprof服务退出", "error", err)
+			}
+		}()
+		return
+	}
+
+	for _, admin := range admins {
+		handler := http.StripPrefix(admin.BasePath(), newPprofMux())
+		admin.GET("/debug/pprof/*profile", gin.WrapH(handler))
+		admin.POST("/debug/pprof/symbol", gin.WrapH(handler))
+	}
+	slog.Info("pprof已启用", "path", admins[0].BasePath()+"/debug/pprof/")
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 探测方式：completion 发送一次极短的对话请求，models 只查询上游的模型信息
+const (
+	probeMethodCompletion = "completion"
+	probeMethodModels     = "models"
+)
+
+// 未配置 models.probe 时的探测间隔和超时
+const (
+	defaultModelProbeInterval = 5 * time.Minute
+	defaultModelProbeTimeout  = 15 * time.Second
+)
+
+// 服务整体状态：全部模型可用、部分模型不可用、全部模型不可用
+const (
+	serviceStatusOK       = "ok"
+	serviceStatusDegraded = "degraded"
+	serviceStatusDown     = "down"
+)
+
+// ModelHealth 一个模型最近一次的探测结果
+type ModelHealth struct {
+	Model     string    `json:"model"`
+	Available bool      `json:"available"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// 连续失败的次数，恢复后清零
+	Failures int `json:"failures,omitempty"`
+}
+
+// 各模型最近一次的探测结果
+var (
+	modelHealthMu sync.RWMutex
+	modelHealth   = map[string]ModelHealth{}
+)
+
+// statusHandler 返回服务状态、各模型的探测结果和上游节点的状态，取模型和节点中较差的状态
+func statusHandler(c *gin.Context) {
+	cfg := currentConfig()
+	status := serviceStatusOK
+	result := gin.H{"version": version}
+	if cfg.Models.Probe.Enabled {
+		health := modelHealthList(cfg)
+		status = worseStatus(status, serviceStatus(health))
+		result["models"] = health
+	}
+	if len(cfg.API.Endpoints) > 0 {
+		upstreams := upstreamStatuses(cfg)
+		status = worseStatus(status, upstreamServiceStatus(upstreams))
+		result["upstreams"] = upstreams
+	}
+	if readOnly(cfg) {
+		result["read_only"] = true
+		result["message"] = readOnlyMessage(c, cfg)
+	}
+	result["status"] = status
+	c.JSON(http.StatusOK, result)
+}
+
+// worseStatus 返回两个状态中较差的一个
+func worseStatus(a, b string) string {
+	rank := map[string]int{serviceStatusOK: 0, serviceStatusDegraded: 1, serviceStatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// upstreamServiceStatus 根据节点是否被摘除判断状态
+func upstreamServiceStatus(upstreams []UpstreamStatus) string {
+	healthy := 0
+	for _, u := range upstreams {
+		if u.Healthy {
+			healthy++
+		}
+	}
+	switch healthy {
+	case len(upstreams):
+		return serviceStatusOK
+	case 0:
+		return serviceStatusDown
+	default:
+		return serviceStatusDegraded
+	}
+}
+
+// serviceStatus 根据模型的探测结果判断服务整体状态，还没有探测过的模型不计入
+func serviceStatus(health []ModelHealth) string {
+	available, failing := 0, 0
+	for _, h := range health {
+		if h.CheckedAt.IsZero() {
+			continue
+		}
+		if h.Available {
+			available++
+		} else {
+			failing++
+		}
+	}
+	switch {
+	case failing == 0:
+		return serviceStatusOK
+	case available == 0:
+		return serviceStatusDown
+	default:
+		return serviceStatusDegraded
+	}
+}
+
+// modelHealthList 按 models.available 的顺序返回探测结果，还没有探测过的模型视为可用
+func modelHealthList(cfg *Config) []ModelHealth {
+	modelHealthMu.RLock()
+	defer modelHealthMu.RUnlock()
+	list := make([]ModelHealth, 0, len(cfg.Models.Available))
+	for _, model := range cfg.Models.Available {
+		h, ok := modelHealth[model]
+		if !ok {
+			h = ModelHealth{Model: model, Available: true}
+		}
+		list = append(list, h)
+	}
+	return list
+}
+
+// isModelHealthy 判断模型最近一次探测是否成功，未开启探测或还没有探测过时视为可用
+func isModelHealthy(cfg *Config, model string) bool {
+	if !cfg.Models.Probe.Enabled {
+		return true
+	}
+	modelHealthMu.RLock()
+	defer modelHealthMu.RUnlock()
+	h, ok := modelHealth[model]
+	return !ok || h.Available
+}
+
+// probeModelsPeriodically 按 models.probe.interval 定期探测模型，每次都读取当前配置以支持热加载
+func probeModelsPeriodically() {
+	for {
+		cfg := currentConfig()
+		if cfg.Models.Probe.Enabled {
+			probeModels(cfg)
+		}
+		time.Sleep(modelProbeInterval(cfg))
+	}
+}
+
+// modelProbeInterval 返回模型的探测间隔
+func modelProbeInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Models.Probe.Interval); err == nil && d > 0 {
+		return d
+	}
+	return defaultModelProbeInterval
+}
+
+// modelProbeTimeout 返回单次探测的超时
+func modelProbeTimeout(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Models.Probe.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultModelProbeTimeout
+}
+
+// probeModels 并发探测 models.available 中的全部模型，状态变化时记录日志
+func probeModels(cfg *Config) {
+	timeout := modelProbeTimeout(cfg)
+	var wg sync.WaitGroup
+	for _, model := range cfg.Models.Available {
+		wg.Add(1)
+		go func(model string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := probeModel(ctx, cfg, model)
+			h := ModelHealth{Model: model, Available: err == nil, LatencyMs: time.Since(start).Milliseconds(), CheckedAt: time.Now()}
+
+			modelHealthMu.Lock()
+			prev, probed := modelHealth[model]
+			if err != nil {
+				h.Error = err.Error()
+				h.Failures = prev.Failures + 1
+			}
+			modelHealth[model] = h
+			modelHealthMu.Unlock()
+
+			switch {
+			case err != nil && (!probed || prev.Available):
+				slog.Warn("模型探测失败，标记为不可用", "model", model, "error", err)
+			case err == nil && probed && !prev.Available:
+				slog.Info("模型已恢复可用", "model", model, "latency_ms", h.LatencyMs)
+			}
+		}(model)
+	}
+	wg.Wait()
+}
+
+// probeModel 探测一个模型，completion 方式的用量计入 probe
+func probeModel(ctx context.Context, cfg *Config, model string) error {
+	client := newOpenAIClient()
+	if cfg.Models.Probe.Method == probeMethodModels {
+		_, err := client.GetModel(ctx, model)
+		return err
+	}
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping"}},
+		MaxTokens: 1,
+	})
+	if err != nil {
+		return err
+	}
+	recordFeatureUsage(usageFeatureProbe, model, newTokenUsage(resp.Usage))
+	return nil
+}
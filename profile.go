@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 默认配置档，即不做任何覆盖的基础配置
+const defaultProfile = "default"
+
+// 命令行指定的配置档
+var profileFlag string
+
+// selectedProfile 返回要使用的配置档，优先级: -profile > AI_ASSISTANT_PROFILE > 配置文件中的 profile
+func selectedProfile(cfg *Config) string {
+	if profileFlag != "" {
+		return profileFlag
+	}
+	if name := os.Getenv(envPrefix + "PROFILE"); name != "" {
+		return name
+	}
+	if cfg.Profile != "" {
+		return cfg.Profile
+	}
+	return defaultProfile
+}
+
+// profileFilePath 返回配置档的独立文件路径，例如 config.yaml 对应 config.office.yaml
+func profileFilePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// applyProfile 把选中的配置档覆盖到基础配置上
+// 配置档先在 profiles 中查找，找不到再读取同目录下的独立文件；只需写出与基础配置不同的部分
+func applyProfile(cfg *Config, path string) error {
+	name := selectedProfile(cfg)
+	cfg.Profile = name
+	if name == defaultProfile {
+		return nil
+	}
+
+	if node, ok := cfg.Profiles[name]; ok {
+		if err := node.Decode(cfg); err != nil {
+			return fmt.Errorf("解析配置档 %s 失败: %w", name, err)
+		}
+		cfg.Profile = name
+		return nil
+	}
+
+	file := profileFilePath(path, name)
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("配置档 %s 不存在: profiles 中没有定义，也没有找到 %s", name, file)
+	}
+	if err != nil {
+		return fmt.Errorf("读取配置档 %s 失败: %w", name, err)
+	}
+	if err := yaml.Unmarshal(expandEnvRefs(data), cfg); err != nil {
+		return fmt.Errorf("解析配置档 %s 失败: %w", file, err)
+	}
+	cfg.Profile = name
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 默认系统提示词
+const defaultSystemPrompt = "You are a helpful assistant."
+
+// 提示词缓存模式
+const (
+	cacheModeAuto      = "auto"
+	cacheModeAnthropic = "anthropic"
+	cacheModeOpenAI    = "openai"
+	cacheModeOff       = "off"
+)
+
+// 回答语言设为 auto 时，使用与问题相同的语言回答
+const answerLanguageAuto = "auto"
+
+// 回答语言只接受语言标签（如 en、zh-CN、pt-BR），避免把任意文本拼进系统提示词
+var validAnswerLanguage = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8}){0,2}$`)
+
+// 常用语言标签对应的语言名称，写进提示词时模型更容易遵循
+var answerLanguageNames = map[string]string{
+	"zh":      "Simplified Chinese",
+	"zh-cn":   "Simplified Chinese",
+	"zh-hans": "Simplified Chinese",
+	"zh-tw":   "Traditional Chinese",
+	"zh-hk":   "Traditional Chinese",
+	"zh-hant": "Traditional Chinese",
+	"en":      "English",
+	"ja":      "Japanese",
+	"ko":      "Korean",
+	"fr":      "French",
+	"de":      "German",
+	"es":      "Spanish",
+	"ru":      "Russian",
+	"pt":      "Portuguese",
+	"it":      "Italian",
+}
+
+// isValidAnswerLanguage 检查回答语言是否为 auto 或合法的语言标签
+func isValidAnswerLanguage(language string) bool {
+	return language == answerLanguageAuto || validAnswerLanguage.MatchString(language)
+}
+
+// answerLanguage 确定回答使用的语言：请求中指定的优先，其次是 prompt.user_languages 中该用户的设置，
+// 最后是 prompt.answer_language，都为空时不限制
+func answerLanguage(cfg *Config, requested, user string) string {
+	if requested != "" {
+		return requested
+	}
+	if language := cfg.Prompt.UserLanguages[user]; language != "" {
+		return language
+	}
+	return cfg.Prompt.AnswerLanguage
+}
+
+// answerLanguageInstruction 返回附加在系统提示词后的语言要求
+func answerLanguageInstruction(language string) string {
+	switch language {
+	case "":
+		return ""
+	case answerLanguageAuto:
+		return "\n\nAlways answer in the same language as the user's question."
+	}
+	return fmt.Sprintf("\n\nAlways answer in %s, regardless of the language of the question.", languageName(language))
+}
+
+// languageName 返回语言标签对应的语言名称，不在常用列表中时返回标签本身
+func languageName(tag string) string {
+	if name, ok := answerLanguageNames[strings.ToLower(strings.ReplaceAll(tag, "_", "-"))]; ok {
+		return name
+	}
+	return tag
+}
+
+// systemPrompt 返回配置的系统提示词，启用注入防护时附加防护说明
+func systemPrompt() string {
+	cfg := currentConfig()
+	prompt := defaultSystemPrompt
+	if cfg.Prompt.System != "" {
+		prompt = cfg.Prompt.System
+	}
+	if cfg.InjectionGuard.Enabled {
+		prompt += injectionGuardPrompt()
+	}
+	return prompt
+}
+
+// buildChatMessages 构造发送给模型的消息列表
+// 固定不变的系统提示词始终放在最前面，每次都不同的知识库上下文和用户问题放在后面，
+// 这样上游的提示词缓存才能命中相同的前缀；language 不为空时在系统提示词后附加回答语言的要求
+// 模型配置了上下文长度时，放不下的知识库条目从最不相关的开始去掉
+func buildChatMessages(ctx context.Context, model, content, language string) []openai.ChatCompletionMessage {
+	cfg := currentConfig()
+	items := retrieveKnowledge(ctx, content)
+	limit := promptTokenLimit(cfg, model, 0)
+	for {
+		messages := composeChatMessages(items, content, language)
+		if len(items) == 0 || limit == 0 {
+			return messages
+		}
+		tokens, err := countChatTokens(cfg, model, messages)
+		if err != nil || tokens <= limit {
+			return messages
+		}
+		slog.Info("提示词超出模型的上下文长度，减少知识库上下文", "model", model, "tokens", tokens, "limit", limit, "items", len(items))
+		items = items[:len(items)-1]
+	}
+}
+
+// composeChatMessages 把系统提示词、知识库上下文和用户问题组合成消息列表
+func composeChatMessages(items []KnowledgeItem, content, language string) []openai.ChatCompletionMessage {
+	if len(items) > 0 {
+		content = formatKnowledgeContext(items) + "\n\n" + content
+	}
+
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt() + answerLanguageInstruction(language),
+		},
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: content,
+		},
+	}
+}
+
+// cacheModeFor 判断指定模型使用哪种提示词缓存方式
+func cacheModeFor(model string) string {
+	cache := currentConfig().Prompt.Cache
+	if !cache.Enabled {
+		return cacheModeOff
+	}
+
+	switch cache.Mode {
+	case cacheModeAnthropic, cacheModeOpenAI, cacheModeOff:
+		return cache.Mode
+	}
+
+	// auto模式下根据模型名称推断
+	lower := strings.ToLower(model)
+	if strings.Contains(lower, "claude") || strings.Contains(lower, "anthropic") {
+		return cacheModeAnthropic
+	}
+	return cacheModeOpenAI
+}
+
+// promptCacheDoer 为发往Anthropic兼容接口的系统提示词加上cache_control标记
+// OpenAI的缓存是自动的，只要前缀稳定即可命中，因此无需改写请求
+type promptCacheDoer struct {
+	next openai.HTTPDoer
+}
+
+// Do 实现openai.HTTPDoer接口
+func (d *promptCacheDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return d.next.Do(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if rewritten, ok := addCacheControl(body); ok {
+		body = rewritten
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return d.next.Do(req)
+}
+
+// addCacheControl 将系统消息改写为带cache_control的内容块
+func addCacheControl(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, false
+	}
+
+	model, _ := payload["model"].(string)
+	if cacheModeFor(model) != cacheModeAnthropic {
+		return nil, false
+	}
+
+	messages, _ := payload["messages"].([]interface{})
+	changed := false
+	for _, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok || msg["role"] != openai.ChatMessageRoleSystem {
+			continue
+		}
+		text, ok := msg["content"].(string)
+		if !ok || text == "" {
+			continue
+		}
+		msg["content"] = []interface{}{
+			map[string]interface{}{
+				"type":          "text",
+				"text":          text,
+				"cache_control": map[string]string{"type": "ephemeral"},
+			},
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, false
+	}
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
@@ -0,0 +1,839 @@
+// AI 助手的 gRPC 接口，与 REST 接口共用存储和模型调用
+//
+// 修改后重新生成代码:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative proto/assistant.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: proto/assistant.proto
+
+package assistantpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChatRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// 为空时使用默认模型
+	Model         string `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	Workspace     string `protobuf:"bytes,3,opt,name=workspace,proto3" json:"workspace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatRequest) Reset() {
+	*x = ChatRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatRequest) ProtoMessage() {}
+
+func (x *ChatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatRequest.ProtoReflect.Descriptor instead.
+func (*ChatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChatRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ChatRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *ChatRequest) GetWorkspace() string {
+	if x != nil {
+		return x.Workspace
+	}
+	return ""
+}
+
+type ChatChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 本次新增的回答内容
+	Delta string `protobuf:"bytes,1,opt,name=delta,proto3" json:"delta,omitempty"`
+	// 为 true 时是最后一条消息，带有用量和问答记录ID
+	Done          bool        `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+	Model         string      `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	Usage         *TokenUsage `protobuf:"bytes,4,opt,name=usage,proto3" json:"usage,omitempty"`
+	RecordId      int64       `protobuf:"varint,5,opt,name=record_id,json=recordId,proto3" json:"record_id,omitempty"`
+	Warnings      []string    `protobuf:"bytes,6,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatChunk) Reset() {
+	*x = ChatChunk{}
+	mi := &file_proto_assistant_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatChunk) ProtoMessage() {}
+
+func (x *ChatChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatChunk.ProtoReflect.Descriptor instead.
+func (*ChatChunk) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChatChunk) GetDelta() string {
+	if x != nil {
+		return x.Delta
+	}
+	return ""
+}
+
+func (x *ChatChunk) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+func (x *ChatChunk) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *ChatChunk) GetUsage() *TokenUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *ChatChunk) GetRecordId() int64 {
+	if x != nil {
+		return x.RecordId
+	}
+	return 0
+}
+
+func (x *ChatChunk) GetWarnings() []string {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+type TokenUsage struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	PromptTokens     int32                  `protobuf:"varint,1,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	CompletionTokens int32                  `protobuf:"varint,2,opt,name=completion_tokens,json=completionTokens,proto3" json:"completion_tokens,omitempty"`
+	TotalTokens      int32                  `protobuf:"varint,3,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	CachedTokens     int32                  `protobuf:"varint,4,opt,name=cached_tokens,json=cachedTokens,proto3" json:"cached_tokens,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *TokenUsage) Reset() {
+	*x = TokenUsage{}
+	mi := &file_proto_assistant_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TokenUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TokenUsage) ProtoMessage() {}
+
+func (x *TokenUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TokenUsage.ProtoReflect.Descriptor instead.
+func (*TokenUsage) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TokenUsage) GetPromptTokens() int32 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *TokenUsage) GetCompletionTokens() int32 {
+	if x != nil {
+		return x.CompletionTokens
+	}
+	return 0
+}
+
+func (x *TokenUsage) GetTotalTokens() int32 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+func (x *TokenUsage) GetCachedTokens() int32 {
+	if x != nil {
+		return x.CachedTokens
+	}
+	return 0
+}
+
+type ListModelsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListModelsRequest) Reset() {
+	*x = ListModelsRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListModelsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListModelsRequest) ProtoMessage() {}
+
+func (x *ListModelsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListModelsRequest.ProtoReflect.Descriptor instead.
+func (*ListModelsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{3}
+}
+
+type ListModelsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Default       string                 `protobuf:"bytes,1,opt,name=default,proto3" json:"default,omitempty"`
+	Available     []string               `protobuf:"bytes,2,rep,name=available,proto3" json:"available,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListModelsResponse) Reset() {
+	*x = ListModelsResponse{}
+	mi := &file_proto_assistant_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListModelsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListModelsResponse) ProtoMessage() {}
+
+func (x *ListModelsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListModelsResponse.ProtoReflect.Descriptor instead.
+func (*ListModelsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListModelsResponse) GetDefault() string {
+	if x != nil {
+		return x.Default
+	}
+	return ""
+}
+
+func (x *ListModelsResponse) GetAvailable() []string {
+	if x != nil {
+		return x.Available
+	}
+	return nil
+}
+
+type KnowledgeItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Content       string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	Model         string                 `protobuf:"bytes,4,opt,name=model,proto3" json:"model,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Tags          []string               `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KnowledgeItem) Reset() {
+	*x = KnowledgeItem{}
+	mi := &file_proto_assistant_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KnowledgeItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KnowledgeItem) ProtoMessage() {}
+
+func (x *KnowledgeItem) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KnowledgeItem.ProtoReflect.Descriptor instead.
+func (*KnowledgeItem) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *KnowledgeItem) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *KnowledgeItem) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *KnowledgeItem) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *KnowledgeItem) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *KnowledgeItem) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *KnowledgeItem) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+type ListKnowledgeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 只返回带有该标签的条目
+	Tag           string `protobuf:"bytes,1,opt,name=tag,proto3" json:"tag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKnowledgeRequest) Reset() {
+	*x = ListKnowledgeRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKnowledgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKnowledgeRequest) ProtoMessage() {}
+
+func (x *ListKnowledgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKnowledgeRequest.ProtoReflect.Descriptor instead.
+func (*ListKnowledgeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListKnowledgeRequest) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+type ListKnowledgeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*KnowledgeItem       `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKnowledgeResponse) Reset() {
+	*x = ListKnowledgeResponse{}
+	mi := &file_proto_assistant_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKnowledgeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKnowledgeResponse) ProtoMessage() {}
+
+func (x *ListKnowledgeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKnowledgeResponse.ProtoReflect.Descriptor instead.
+func (*ListKnowledgeResponse) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListKnowledgeResponse) GetItems() []*KnowledgeItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type GetKnowledgeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetKnowledgeRequest) Reset() {
+	*x = GetKnowledgeRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetKnowledgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetKnowledgeRequest) ProtoMessage() {}
+
+func (x *GetKnowledgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetKnowledgeRequest.ProtoReflect.Descriptor instead.
+func (*GetKnowledgeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetKnowledgeRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CreateKnowledgeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Title string                 `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	// 直接提供内容，与 record_id 二选一
+	Content string `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	// 引用最近的一条问答记录，使用其回答作为内容
+	RecordId      int64    `protobuf:"varint,3,opt,name=record_id,json=recordId,proto3" json:"record_id,omitempty"`
+	Tags          []string `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	Model         string   `protobuf:"bytes,5,opt,name=model,proto3" json:"model,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateKnowledgeRequest) Reset() {
+	*x = CreateKnowledgeRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateKnowledgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateKnowledgeRequest) ProtoMessage() {}
+
+func (x *CreateKnowledgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateKnowledgeRequest.ProtoReflect.Descriptor instead.
+func (*CreateKnowledgeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CreateKnowledgeRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *CreateKnowledgeRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *CreateKnowledgeRequest) GetRecordId() int64 {
+	if x != nil {
+		return x.RecordId
+	}
+	return 0
+}
+
+func (x *CreateKnowledgeRequest) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *CreateKnowledgeRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+type DeleteKnowledgeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteKnowledgeRequest) Reset() {
+	*x = DeleteKnowledgeRequest{}
+	mi := &file_proto_assistant_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteKnowledgeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteKnowledgeRequest) ProtoMessage() {}
+
+func (x *DeleteKnowledgeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteKnowledgeRequest.ProtoReflect.Descriptor instead.
+func (*DeleteKnowledgeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DeleteKnowledgeRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteKnowledgeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteKnowledgeResponse) Reset() {
+	*x = DeleteKnowledgeResponse{}
+	mi := &file_proto_assistant_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteKnowledgeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteKnowledgeResponse) ProtoMessage() {}
+
+func (x *DeleteKnowledgeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_assistant_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteKnowledgeResponse.ProtoReflect.Descriptor instead.
+func (*DeleteKnowledgeResponse) Descriptor() ([]byte, []int) {
+	return file_proto_assistant_proto_rawDescGZIP(), []int{11}
+}
+
+var File_proto_assistant_proto protoreflect.FileDescriptor
+
+const file_proto_assistant_proto_rawDesc = "" +
+	"\n" +
+	"\x15proto/assistant.proto\x12\x0eaiassistant.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"[\n" +
+	"\vChatRequest\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x1c\n" +
+	"\tworkspace\x18\x03 \x01(\tR\tworkspace\"\xb6\x01\n" +
+	"\tChatChunk\x12\x14\n" +
+	"\x05delta\x18\x01 \x01(\tR\x05delta\x12\x12\n" +
+	"\x04done\x18\x02 \x01(\bR\x04done\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\x120\n" +
+	"\x05usage\x18\x04 \x01(\v2\x1a.aiassistant.v1.TokenUsageR\x05usage\x12\x1b\n" +
+	"\trecord_id\x18\x05 \x01(\x03R\brecordId\x12\x1a\n" +
+	"\bwarnings\x18\x06 \x03(\tR\bwarnings\"\xa6\x01\n" +
+	"\n" +
+	"TokenUsage\x12#\n" +
+	"\rprompt_tokens\x18\x01 \x01(\x05R\fpromptTokens\x12+\n" +
+	"\x11completion_tokens\x18\x02 \x01(\x05R\x10completionTokens\x12!\n" +
+	"\ftotal_tokens\x18\x03 \x01(\x05R\vtotalTokens\x12#\n" +
+	"\rcached_tokens\x18\x04 \x01(\x05R\fcachedTokens\"\x13\n" +
+	"\x11ListModelsRequest\"L\n" +
+	"\x12ListModelsResponse\x12\x18\n" +
+	"\adefault\x18\x01 \x01(\tR\adefault\x12\x1c\n" +
+	"\tavailable\x18\x02 \x03(\tR\tavailable\"\xb3\x01\n" +
+	"\rKnowledgeItem\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x14\n" +
+	"\x05model\x18\x04 \x01(\tR\x05model\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\"(\n" +
+	"\x14ListKnowledgeRequest\x12\x10\n" +
+	"\x03tag\x18\x01 \x01(\tR\x03tag\"L\n" +
+	"\x15ListKnowledgeResponse\x123\n" +
+	"\x05items\x18\x01 \x03(\v2\x1d.aiassistant.v1.KnowledgeItemR\x05items\"%\n" +
+	"\x13GetKnowledgeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x8f\x01\n" +
+	"\x16CreateKnowledgeRequest\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x1b\n" +
+	"\trecord_id\x18\x03 \x01(\x03R\brecordId\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x12\x14\n" +
+	"\x05model\x18\x05 \x01(\tR\x05model\"(\n" +
+	"\x16DeleteKnowledgeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x19\n" +
+	"\x17DeleteKnowledgeResponse2\x92\x04\n" +
+	"\tAssistant\x12@\n" +
+	"\x04Chat\x12\x1b.aiassistant.v1.ChatRequest\x1a\x19.aiassistant.v1.ChatChunk0\x01\x12S\n" +
+	"\n" +
+	"ListModels\x12!.aiassistant.v1.ListModelsRequest\x1a\".aiassistant.v1.ListModelsResponse\x12\\\n" +
+	"\rListKnowledge\x12$.aiassistant.v1.ListKnowledgeRequest\x1a%.aiassistant.v1.ListKnowledgeResponse\x12R\n" +
+	"\fGetKnowledge\x12#.aiassistant.v1.GetKnowledgeRequest\x1a\x1d.aiassistant.v1.KnowledgeItem\x12X\n" +
+	"\x0fCreateKnowledge\x12&.aiassistant.v1.CreateKnowledgeRequest\x1a\x1d.aiassistant.v1.KnowledgeItem\x12b\n" +
+	"\x0fDeleteKnowledge\x12&.aiassistant.v1.DeleteKnowledgeRequest\x1a'.aiassistant.v1.DeleteKnowledgeResponseB Z\x1eai-assistant/proto;assistantpbb\x06proto3"
+
+var (
+	file_proto_assistant_proto_rawDescOnce sync.Once
+	file_proto_assistant_proto_rawDescData []byte
+)
+
+func file_proto_assistant_proto_rawDescGZIP() []byte {
+	file_proto_assistant_proto_rawDescOnce.Do(func() {
+		file_proto_assistant_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_assistant_proto_rawDesc), len(file_proto_assistant_proto_rawDesc)))
+	})
+	return file_proto_assistant_proto_rawDescData
+}
+
+var file_proto_assistant_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_proto_assistant_proto_goTypes = []any{
+	(*ChatRequest)(nil),             // 0: aiassistant.v1.ChatRequest
+	(*ChatChunk)(nil),               // 1: aiassistant.v1.ChatChunk
+	(*TokenUsage)(nil),              // 2: aiassistant.v1.TokenUsage
+	(*ListModelsRequest)(nil),       // 3: aiassistant.v1.ListModelsRequest
+	(*ListModelsResponse)(nil),      // 4: aiassistant.v1.ListModelsResponse
+	(*KnowledgeItem)(nil),           // 5: aiassistant.v1.KnowledgeItem
+	(*ListKnowledgeRequest)(nil),    // 6: aiassistant.v1.ListKnowledgeRequest
+	(*ListKnowledgeResponse)(nil),   // 7: aiassistant.v1.ListKnowledgeResponse
+	(*GetKnowledgeRequest)(nil),     // 8: aiassistant.v1.GetKnowledgeRequest
+	(*CreateKnowledgeRequest)(nil),  // 9: aiassistant.v1.CreateKnowledgeRequest
+	(*DeleteKnowledgeRequest)(nil),  // 10: aiassistant.v1.DeleteKnowledgeRequest
+	(*DeleteKnowledgeResponse)(nil), // 11: aiassistant.v1.DeleteKnowledgeResponse
+	(*timestamppb.Timestamp)(nil),   // 12: google.protobuf.Timestamp
+}
+var file_proto_assistant_proto_depIdxs = []int32{
+	2,  // 0: aiassistant.v1.ChatChunk.usage:type_name -> aiassistant.v1.TokenUsage
+	12, // 1: aiassistant.v1.KnowledgeItem.timestamp:type_name -> google.protobuf.Timestamp
+	5,  // 2: aiassistant.v1.ListKnowledgeResponse.items:type_name -> aiassistant.v1.KnowledgeItem
+	0,  // 3: aiassistant.v1.Assistant.Chat:input_type -> aiassistant.v1.ChatRequest
+	3,  // 4: aiassistant.v1.Assistant.ListModels:input_type -> aiassistant.v1.ListModelsRequest
+	6,  // 5: aiassistant.v1.Assistant.ListKnowledge:input_type -> aiassistant.v1.ListKnowledgeRequest
+	8,  // 6: aiassistant.v1.Assistant.GetKnowledge:input_type -> aiassistant.v1.GetKnowledgeRequest
+	9,  // 7: aiassistant.v1.Assistant.CreateKnowledge:input_type -> aiassistant.v1.CreateKnowledgeRequest
+	10, // 8: aiassistant.v1.Assistant.DeleteKnowledge:input_type -> aiassistant.v1.DeleteKnowledgeRequest
+	1,  // 9: aiassistant.v1.Assistant.Chat:output_type -> aiassistant.v1.ChatChunk
+	4,  // 10: aiassistant.v1.Assistant.ListModels:output_type -> aiassistant.v1.ListModelsResponse
+	7,  // 11: aiassistant.v1.Assistant.ListKnowledge:output_type -> aiassistant.v1.ListKnowledgeResponse
+	5,  // 12: aiassistant.v1.Assistant.GetKnowledge:output_type -> aiassistant.v1.KnowledgeItem
+	5,  // 13: aiassistant.v1.Assistant.CreateKnowledge:output_type -> aiassistant.v1.KnowledgeItem
+	11, // 14: aiassistant.v1.Assistant.DeleteKnowledge:output_type -> aiassistant.v1.DeleteKnowledgeResponse
+	9,  // [9:15] is the sub-list for method output_type
+	3,  // [3:9] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_proto_assistant_proto_init() }
+func file_proto_assistant_proto_init() {
+	if File_proto_assistant_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_assistant_proto_rawDesc), len(file_proto_assistant_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_assistant_proto_goTypes,
+		DependencyIndexes: file_proto_assistant_proto_depIdxs,
+		MessageInfos:      file_proto_assistant_proto_msgTypes,
+	}.Build()
+	File_proto_assistant_proto = out.File
+	file_proto_assistant_proto_goTypes = nil
+	file_proto_assistant_proto_depIdxs = nil
+}
@@ -0,0 +1,333 @@
+// AI 助手的 gRPC 接口，与 REST 接口共用存储和模型调用
+//
+// 修改后重新生成代码:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative proto/assistant.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: proto/assistant.proto
+
+package assistantpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Assistant_Chat_FullMethodName            = "/aiassistant.v1.Assistant/Chat"
+	Assistant_ListModels_FullMethodName      = "/aiassistant.v1.Assistant/ListModels"
+	Assistant_ListKnowledge_FullMethodName   = "/aiassistant.v1.Assistant/ListKnowledge"
+	Assistant_GetKnowledge_FullMethodName    = "/aiassistant.v1.Assistant/GetKnowledge"
+	Assistant_CreateKnowledge_FullMethodName = "/aiassistant.v1.Assistant/CreateKnowledge"
+	Assistant_DeleteKnowledge_FullMethodName = "/aiassistant.v1.Assistant/DeleteKnowledge"
+)
+
+// AssistantClient is the client API for Assistant service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AssistantClient interface {
+	// Chat 发送消息，以流的形式返回回答，最后一条消息的 done 为 true
+	Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatChunk], error)
+	// ListModels 返回可用模型
+	ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (*ListModelsResponse, error)
+	// ListKnowledge 返回知识库条目
+	ListKnowledge(ctx context.Context, in *ListKnowledgeRequest, opts ...grpc.CallOption) (*ListKnowledgeResponse, error)
+	// GetKnowledge 返回一条知识库条目
+	GetKnowledge(ctx context.Context, in *GetKnowledgeRequest, opts ...grpc.CallOption) (*KnowledgeItem, error)
+	// CreateKnowledge 添加知识库条目，可以直接提供内容，也可以引用一条问答记录
+	CreateKnowledge(ctx context.Context, in *CreateKnowledgeRequest, opts ...grpc.CallOption) (*KnowledgeItem, error)
+	// DeleteKnowledge 删除知识库条目
+	DeleteKnowledge(ctx context.Context, in *DeleteKnowledgeRequest, opts ...grpc.CallOption) (*DeleteKnowledgeResponse, error)
+}
+
+type assistantClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAssistantClient(cc grpc.ClientConnInterface) AssistantClient {
+	return &assistantClient{cc}
+}
+
+func (c *assistantClient) Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Assistant_ServiceDesc.Streams[0], Assistant_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChatRequest, ChatChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Assistant_ChatClient = grpc.ServerStreamingClient[ChatChunk]
+
+func (c *assistantClient) ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (*ListModelsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListModelsResponse)
+	err := c.cc.Invoke(ctx, Assistant_ListModels_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assistantClient) ListKnowledge(ctx context.Context, in *ListKnowledgeRequest, opts ...grpc.CallOption) (*ListKnowledgeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListKnowledgeResponse)
+	err := c.cc.Invoke(ctx, Assistant_ListKnowledge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assistantClient) GetKnowledge(ctx context.Context, in *GetKnowledgeRequest, opts ...grpc.CallOption) (*KnowledgeItem, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KnowledgeItem)
+	err := c.cc.Invoke(ctx, Assistant_GetKnowledge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assistantClient) CreateKnowledge(ctx context.Context, in *CreateKnowledgeRequest, opts ...grpc.CallOption) (*KnowledgeItem, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KnowledgeItem)
+	err := c.cc.Invoke(ctx, Assistant_CreateKnowledge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assistantClient) DeleteKnowledge(ctx context.Context, in *DeleteKnowledgeRequest, opts ...grpc.CallOption) (*DeleteKnowledgeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteKnowledgeResponse)
+	err := c.cc.Invoke(ctx, Assistant_DeleteKnowledge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AssistantServer is the server API for Assistant service.
+// All implementations must embed UnimplementedAssistantServer
+// for forward compatibility.
+type AssistantServer interface {
+	// Chat 发送消息，以流的形式返回回答，最后一条消息的 done 为 true
+	Chat(*ChatRequest, grpc.ServerStreamingServer[ChatChunk]) error
+	// ListModels 返回可用模型
+	ListModels(context.Context, *ListModelsRequest) (*ListModelsResponse, error)
+	// ListKnowledge 返回知识库条目
+	ListKnowledge(context.Context, *ListKnowledgeRequest) (*ListKnowledgeResponse, error)
+	// GetKnowledge 返回一条知识库条目
+	GetKnowledge(context.Context, *GetKnowledgeRequest) (*KnowledgeItem, error)
+	// CreateKnowledge 添加知识库条目，可以直接提供内容，也可以引用一条问答记录
+	CreateKnowledge(context.Context, *CreateKnowledgeRequest) (*KnowledgeItem, error)
+	// DeleteKnowledge 删除知识库条目
+	DeleteKnowledge(context.Context, *DeleteKnowledgeRequest) (*DeleteKnowledgeResponse, error)
+	mustEmbedUnimplementedAssistantServer()
+}
+
+// UnimplementedAssistantServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAssistantServer struct{}
+
+func (UnimplementedAssistantServer) Chat(*ChatRequest, grpc.ServerStreamingServer[ChatChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedAssistantServer) ListModels(context.Context, *ListModelsRequest) (*ListModelsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListModels not implemented")
+}
+func (UnimplementedAssistantServer) ListKnowledge(context.Context, *ListKnowledgeRequest) (*ListKnowledgeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKnowledge not implemented")
+}
+func (UnimplementedAssistantServer) GetKnowledge(context.Context, *GetKnowledgeRequest) (*KnowledgeItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetKnowledge not implemented")
+}
+func (UnimplementedAssistantServer) CreateKnowledge(context.Context, *CreateKnowledgeRequest) (*KnowledgeItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateKnowledge not implemented")
+}
+func (UnimplementedAssistantServer) DeleteKnowledge(context.Context, *DeleteKnowledgeRequest) (*DeleteKnowledgeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteKnowledge not implemented")
+}
+func (UnimplementedAssistantServer) mustEmbedUnimplementedAssistantServer() {}
+func (UnimplementedAssistantServer) testEmbeddedByValue()                   {}
+
+// UnsafeAssistantServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AssistantServer will
+// result in compilation errors.
+type UnsafeAssistantServer interface {
+	mustEmbedUnimplementedAssistantServer()
+}
+
+func RegisterAssistantServer(s grpc.ServiceRegistrar, srv AssistantServer) {
+	// If the following call pancis, it indicates UnimplementedAssistantServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Assistant_ServiceDesc, srv)
+}
+
+func _Assistant_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AssistantServer).Chat(m, &grpc.GenericServerStream[ChatRequest, ChatChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Assistant_ChatServer = grpc.ServerStreamingServer[ChatChunk]
+
+func _Assistant_ListModels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListModelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssistantServer).ListModels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Assistant_ListModels_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssistantServer).ListModels(ctx, req.(*ListModelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Assistant_ListKnowledge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKnowledgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssistantServer).ListKnowledge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Assistant_ListKnowledge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssistantServer).ListKnowledge(ctx, req.(*ListKnowledgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Assistant_GetKnowledge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetKnowledgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssistantServer).GetKnowledge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Assistant_GetKnowledge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssistantServer).GetKnowledge(ctx, req.(*GetKnowledgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Assistant_CreateKnowledge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateKnowledgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssistantServer).CreateKnowledge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Assistant_CreateKnowledge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssistantServer).CreateKnowledge(ctx, req.(*CreateKnowledgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Assistant_DeleteKnowledge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteKnowledgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssistantServer).DeleteKnowledge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Assistant_DeleteKnowledge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssistantServer).DeleteKnowledge(ctx, req.(*DeleteKnowledgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Assistant_ServiceDesc is the grpc.ServiceDesc for Assistant service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Assistant_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "aiassistant.v1.Assistant",
+	HandlerType: (*AssistantServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListModels",
+			Handler:    _Assistant_ListModels_Handler,
+		},
+		{
+			MethodName: "ListKnowledge",
+			Handler:    _Assistant_ListKnowledge_Handler,
+		},
+		{
+			MethodName: "GetKnowledge",
+			Handler:    _Assistant_GetKnowledge_Handler,
+		},
+		{
+			MethodName: "CreateKnowledge",
+			Handler:    _Assistant_CreateKnowledge_Handler,
+		},
+		{
+			MethodName: "DeleteKnowledge",
+			Handler:    _Assistant_DeleteKnowledge_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _Assistant_Chat_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/assistant.proto",
+}
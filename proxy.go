@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 默认从这些请求头读取真实客户端IP
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// setupTrustedProxies 配置受信任的反向代理
+// 只有来自受信任代理的请求才会使用 X-Forwarded-For/X-Real-IP 中的客户端IP，
+// 未配置时不信任任何代理，直接使用连接的对端地址，避免客户端伪造请求头冒充本机访问管理接口
+func setupTrustedProxies(r *gin.Engine, cfg *Config) error {
+	proxies, err := normalizeProxyCIDRs(cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("server.trusted_proxies 无效: %w", err)
+	}
+
+	headers := defaultRemoteIPHeaders
+	if len(cfg.Server.RemoteIPHeaders) > 0 {
+		headers = cfg.Server.RemoteIPHeaders
+	}
+	r.RemoteIPHeaders = nil
+	for _, header := range headers {
+		r.RemoteIPHeaders = append(r.RemoteIPHeaders, http.CanonicalHeaderKey(header))
+	}
+	return nil
+}
+
+// normalizeProxyCIDRs 校验代理地址，支持单个IP和 CIDR，"loopback" 和 "private" 表示本机地址和内网地址
+func normalizeProxyCIDRs(entries []string) ([]string, error) {
+	var cidrs []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch entry {
+		case "loopback":
+			cidrs = append(cidrs, "127.0.0.0/8", "::1/128")
+			continue
+		case "private":
+			cidrs = append(cidrs, "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("server.trusted_proxies 中的 %q 不是有效的 CIDR", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("server.trusted_proxies 中的 %q 不是有效的IP地址", entry)
+		}
+		cidrs = append(cidrs, entry)
+	}
+	return cidrs, nil
+}
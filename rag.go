@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 默认检索的知识条目数量
+const defaultRAGTopK = 3
+
+// 开启重排时默认取 top_k 的几倍作为候选
+const defaultRerankCandidateFactor = 4
+
+// 知识条目的词项索引缓存，键为条目ID，知识库变更后需要调用invalidateRAGIndex
+var (
+	ragIndexMu sync.Mutex
+	ragIndex   map[int]map[string]bool
+)
+
+// itemTerms 返回知识条目的词项集合，优先使用索引缓存
+func itemTerms(item KnowledgeItem) map[string]bool {
+	ragIndexMu.Lock()
+	defer ragIndexMu.Unlock()
+
+	if ragIndex == nil {
+		ragIndex = make(map[int]map[string]bool)
+	}
+	terms, ok := ragIndex[item.ID]
+	if !ok {
+		terms = tokenize(item.Title + " " + strings.Join(item.Tags, " ") + " " + item.Content)
+		ragIndex[item.ID] = terms
+	}
+	return terms
+}
+
+// invalidateRAGIndex 清空词项索引缓存
+func invalidateRAGIndex() {
+	ragIndexMu.Lock()
+	ragIndex = nil
+	ragIndexMu.Unlock()
+}
+
+// rebuildRAGIndex 重新为整个知识库建立词项索引，返回索引的条目数
+func rebuildRAGIndex() int {
+	invalidateRAGIndex()
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, item := range knowledgeBase {
+		itemTerms(item)
+	}
+	return len(knowledgeBase)
+}
+
+// retrieveKnowledge 根据问题从知识库中检索相关条目，并按条目之间的关联补充上下文
+func retrieveKnowledge(ctx context.Context, question string) []KnowledgeItem {
+	cfg := currentConfig()
+	if !cfg.RAG.Enabled || !featureEnabled(cfg, featureRAG) {
+		return nil
+	}
+	return expandLinkedKnowledge(rankKnowledge(ctx, cfg, question), ragLinks(cfg))
+}
+
+// rankKnowledge 返回与问题最相关的 top_k 个条目
+// 先按词项重合度取出候选，开启 rag.rerank 时再对候选重排，重排失败时保留原来的顺序
+func rankKnowledge(ctx context.Context, cfg *Config, question string) []KnowledgeItem {
+	topK := cfg.RAG.TopK
+	if topK <= 0 {
+		topK = defaultRAGTopK
+	}
+	if !cfg.RAG.Rerank.Enabled {
+		return lexicalCandidates(question, topK)
+	}
+
+	limit := cfg.RAG.Rerank.Candidates
+	if limit <= 0 {
+		limit = topK * defaultRerankCandidateFactor
+	}
+	candidates := lexicalCandidates(question, limit)
+	if len(candidates) <= 1 {
+		return candidates
+	}
+	documents := make([]string, len(candidates))
+	for i, item := range candidates {
+		documents[i] = item.Title + "\n" + item.Content
+	}
+	provider := rerankProvider(cfg)
+	scores, _, err := rerankDocuments(ctx, provider, rerankModel(cfg, provider), question, documents)
+	if err != nil {
+		slog.Warn("知识库检索结果重排失败，使用词项匹配的顺序", "error", err)
+		return candidates[:min(topK, len(candidates))]
+	}
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	items := make([]KnowledgeItem, 0, topK)
+	for _, i := range order[:min(topK, len(order))] {
+		items = append(items, candidates[i])
+	}
+	return items
+}
+
+// lexicalCandidates 按词项重合度返回最相关的 limit 个条目，草稿不参与检索
+// 使用简单的词项重合度打分：英文按单词切分，中文按相邻两字切分
+func lexicalCandidates(question string, limit int) []KnowledgeItem {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	if len(knowledgeBase) == 0 {
+		return nil
+	}
+
+	queryTerms := tokenize(question)
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	type scored struct {
+		item  KnowledgeItem
+		score int
+	}
+	var candidates []scored
+	for _, item := range knowledgeBase {
+		if item.Draft {
+			continue
+		}
+		terms := itemTerms(item)
+		score := 0
+		for term := range queryTerms {
+			if terms[term] {
+				score++
+			}
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{item: item, score: score})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var items []KnowledgeItem
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		items = append(items, candidates[i].item)
+	}
+	return items
+}
+
+// formatKnowledgeContext 将检索到的知识条目格式化为提示词上下文
+// 启用注入防护时，条目内容会先经过清洗并包裹在分隔符中
+func formatKnowledgeContext(items []KnowledgeItem) string {
+	var b strings.Builder
+	for i, item := range items {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, item.Title, item.Content)
+	}
+	block := b.String()
+
+	if currentConfig().InjectionGuard.Enabled {
+		sanitized, suspicious := sanitizeExternalContent(block)
+		if suspicious {
+			slog.Warn("知识库上下文中发现可疑指令，已移除")
+		}
+		block = wrapExternalContent(sanitized)
+	}
+
+	return "以下是知识库中可能相关的内容，请在回答时参考：\n" + block
+}
+
+// tokenize 将文本切分为检索用的词项集合
+func tokenize(text string) map[string]bool {
+	terms := make(map[string]bool)
+	var word []rune
+	var prevHan rune
+
+	flushWord := func() {
+		if len(word) > 1 {
+			terms[strings.ToLower(string(word))] = true
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			if prevHan != 0 {
+				terms[string([]rune{prevHan, r})] = true
+			}
+			prevHan = r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			prevHan = 0
+			word = append(word, r)
+		default:
+			prevHan = 0
+			flushWord()
+		}
+	}
+	flushWord()
+
+	return terms
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 录制模式：record 把上游的请求和响应保存到 api.recording.dir，replay 只从录制中返回响应，不访问上游
+const (
+	recordingModeRecord = "record"
+	recordingModeReplay = "replay"
+)
+
+// 未配置 api.recording.dir 时录制保存在数据目录下的子目录
+const defaultRecordingDir = "recordings"
+
+// Recording 一次上游调用的录制，每次调用保存为一个 JSON 文件，文件名为请求的哈希
+type Recording struct {
+	Key        string    `json:"key"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Request    struct {
+		Method string `json:"method"`
+		// 相对于上游地址的路径，不包含查询参数
+		Path string          `json:"path"`
+		Body json.RawMessage `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status      int    `json:"status"`
+		ContentType string `json:"content_type,omitempty"`
+		// 流式响应保存完整的 SSE 文本
+		Body string `json:"body"`
+	} `json:"response"`
+}
+
+// recordingDo 按 api.recording.mode 录制或回放一次上游调用，forward 负责真正发出请求
+func recordingDo(cfg *Config, req *http.Request, forward func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	path := recordingPath(cfg, req.URL)
+	key := recordingKey(req.Method, path, body)
+	file := filepath.Join(recordingDir(cfg), key+".json")
+
+	if cfg.API.Recording.Mode == recordingModeReplay {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("没有匹配的录制", "method", req.Method, "path", path, "key", key)
+			return mockErrorResponse(req, http.StatusNotFound, fmt.Sprintf("没有匹配的录制: %s %s（%s）", req.Method, path, key)), nil
+		}
+		if data, err = decryptData(data); err != nil {
+			return nil, fmt.Errorf("读取录制 %s 失败: %w", file, err)
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("读取录制 %s 失败: %w", file, err)
+		}
+		return &http.Response{
+			StatusCode:    rec.Response.Status,
+			Status:        fmt.Sprintf("%d %s", rec.Response.Status, http.StatusText(rec.Response.Status)),
+			Header:        http.Header{"Content-Type": []string{rec.Response.ContentType}},
+			Body:          io.NopCloser(strings.NewReader(rec.Response.Body)),
+			ContentLength: int64(len(rec.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := forward(req)
+	if err != nil {
+		return resp, err
+	}
+	rec := &Recording{Key: key, RecordedAt: time.Now()}
+	rec.Request.Method, rec.Request.Path = req.Method, path
+	if json.Valid(body) {
+		rec.Request.Body = body
+	}
+	rec.Response.Status, rec.Response.ContentType = resp.StatusCode, resp.Header.Get("Content-Type")
+	// 读完响应体后再保存，流式响应仍然边收边转发
+	resp.Body = &recordingBody{ReadCloser: resp.Body, rec: rec, file: file}
+	return resp, nil
+}
+
+// readRequestBody 读取请求体并恢复，使请求仍然可以发送和重试
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// recordingPath 返回请求相对于上游地址的路径，换用其他节点或服务商后录制仍然匹配
+func recordingPath(cfg *Config, u *url.URL) string {
+	if base, err := url.Parse(upstreamBaseURL(cfg)); err == nil {
+		if rest, ok := strings.CutPrefix(u.Path, strings.TrimRight(base.Path, "/")); ok {
+			return rest
+		}
+	}
+	return u.Path
+}
+
+// recordingKey 按方法、路径和请求体计算录制的键，JSON 请求体先规范化，字段顺序不影响匹配；
+// 防护提示词中的标记每个进程都不同，计算前替换为固定的值
+func recordingKey(method, path string, body []byte) string {
+	body = bytes.ReplaceAll(body, []byte(injectionCanary), []byte("CANARY"))
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	}
+	sum := sha256.Sum256([]byte(method + " " + path + "\n" + string(body)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// recordingDir 返回保存录制的目录
+func recordingDir(cfg *Config) string {
+	if cfg.API.Recording.Dir != "" {
+		return expandHome(cfg.API.Recording.Dir)
+	}
+	return dataPath(defaultRecordingDir)
+}
+
+// recordingBody 转发响应体的同时保存一份，读到末尾时写入录制文件；
+// 流式响应读到 [DONE] 后就会关闭，关闭时读完剩余的内容再保存，中途断开的响应不保存
+type recordingBody struct {
+	io.ReadCloser
+	rec   *Recording
+	file  string
+	buf   bytes.Buffer
+	saved bool
+}
+
+// Read 实现io.Reader接口
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.save()
+	}
+	return n, err
+}
+
+// Close 实现io.Closer接口
+func (b *recordingBody) Close() error {
+	if !b.saved {
+		if _, err := io.Copy(&b.buf, b.ReadCloser); err == nil {
+			b.save()
+		}
+	}
+	return b.ReadCloser.Close()
+}
+
+// save 把完整的响应写入录制文件，只写一次
+func (b *recordingBody) save() {
+	if b.saved {
+		return
+	}
+	b.saved = true
+	b.rec.Response.Body = b.buf.String()
+	if err := saveRecording(b.file, b.rec); err != nil {
+		slog.Warn("保存录制失败", "file", b.file, "error", err)
+	}
+}
+
+// saveRecording 写入录制文件，相同的请求覆盖之前的录制；录制中有对话内容，开启数据加密时加密后写入
+func saveRecording(file string, rec *Recording) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if data, err = encryptData(data); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配置文件变更检查间隔
+const configWatchInterval = 2 * time.Second
+
+const auditActionAdminReload = "admin.config.reload"
+
+var reloadMu sync.Mutex
+
+// reloadConfig 重新读取配置文件并整体替换当前配置
+// 进行中的请求继续使用旧配置，新请求使用新配置；返回需要重启才能生效的配置项
+func reloadConfig() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg, err := readConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	old := currentConfig()
+	activeConfig.Store(cfg)
+
+	var restartRequired []string
+	if !reflect.DeepEqual(old.Server, cfg.Server) {
+		restartRequired = append(restartRequired, "server")
+	}
+	if !reflect.DeepEqual(old.Logging, cfg.Logging) {
+		restartRequired = append(restartRequired, "logging")
+	}
+	if !reflect.DeepEqual(old.Pprof, cfg.Pprof) {
+		restartRequired = append(restartRequired, "pprof")
+	}
+	if old.Storage != cfg.Storage {
+		restartRequired = append(restartRequired, "storage")
+	}
+	if old.GRPC != cfg.GRPC {
+		restartRequired = append(restartRequired, "grpc")
+	}
+	if !reflect.DeepEqual(old.HTTPS, cfg.HTTPS) {
+		restartRequired = append(restartRequired, "https")
+	}
+	if old.Slack.Enabled != cfg.Slack.Enabled || old.Slack.Mode != cfg.Slack.Mode ||
+		old.Slack.BotToken != cfg.Slack.BotToken || old.Slack.AppToken != cfg.Slack.AppToken {
+		restartRequired = append(restartRequired, "slack")
+	}
+	if old.WeCom.Enabled != cfg.WeCom.Enabled {
+		restartRequired = append(restartRequired, "wecom")
+	}
+	if old.DingTalk.Enabled != cfg.DingTalk.Enabled || old.DingTalk.Mode != cfg.DingTalk.Mode ||
+		old.DingTalk.AppKey != cfg.DingTalk.AppKey {
+		restartRequired = append(restartRequired, "dingtalk")
+	}
+	if old.Email.Enabled != cfg.Email.Enabled {
+		restartRequired = append(restartRequired, "email")
+	}
+
+	if !reflect.DeepEqual(old.Schedules, cfg.Schedules) || !reflect.DeepEqual(old.Digest, cfg.Digest) {
+		reloadSchedules(cfg)
+	}
+
+	slog.Info("配置已重新加载", "restart_required", restartRequired)
+	return restartRequired, nil
+}
+
+// adminReloadHandler 手动触发配置热加载
+func adminReloadHandler(c *gin.Context) {
+	restartRequired, err := reloadConfig()
+	if err != nil {
+		recordAudit(c, auditActionAdminReload, configFile, err.Error(), http.StatusBadRequest)
+		respondError(c, http.StatusBadRequest, tr(c, "error.reload_failed", err))
+		return
+	}
+
+	recordAudit(c, auditActionAdminReload, configFile, "", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          tr(c, "message.config_reloaded"),
+		"restart_required": restartRequired,
+	})
+}
+
+// watchConfigFile 定期检查配置文件的修改时间，发生变化时自动重新加载
+func watchConfigFile() {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		slog.Error("无法监听配置文件", "path", configFile, "error", err)
+		return
+	}
+	lastMod := info.ModTime()
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(configFile)
+		if err != nil || info.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		entry := AuditEntry{Timestamp: time.Now(), User: "system", Action: auditActionAdminReload, Resource: configFile, Status: http.StatusOK}
+		if _, err := reloadConfig(); err != nil {
+			slog.Error("配置文件已修改但重新加载失败，继续使用旧配置", "error", err)
+			entry.Detail, entry.Status = err.Error(), http.StatusBadRequest
+		}
+		writeAudit(entry)
+	}
+}
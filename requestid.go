@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader     = "X-Request-ID"
+	requestIDContextKey = "request_id"
+)
+
+// 客户端传入的请求ID只接受这些字符，避免日志注入
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// newRequestID 生成随机请求ID
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware 为每个请求分配ID，沿用客户端传入的合法ID，并通过响应头返回
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDContextKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestID 返回当前请求的ID
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// respondError 返回统一格式的错误响应 {code, message, request_id}
+// 旧路径 /api 下的响应额外带有 error 字段，兼容旧客户端
+func respondError(c *gin.Context, status int, message string) {
+	body := gin.H{
+		"code":       errorCode(status),
+		"message":    message,
+		"request_id": requestID(c),
+	}
+	if c.GetBool(legacyAPIContextKey) {
+		body["error"] = message
+	}
+	c.AbortWithStatusJSON(status, body)
+}
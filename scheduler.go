@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+const scheduleRunLogFile = "schedule_runs.jsonl"
+
+// 触发方式
+const (
+	scheduleTriggerCron   = "cron"
+	scheduleTriggerManual = "manual"
+)
+
+// 定时任务完成后发送给 webhook 目标的事件
+const webhookEventScheduleCompleted = "schedule.completed"
+
+// 查询运行记录默认返回的条数
+const defaultScheduleRunLimit = 50
+
+const auditActionAdminScheduleRun = "admin.schedule.run"
+
+// 解析 cron 表达式：标准5段格式，支持 @daily、@weekly、@every 1h 等写法，可加 CRON_TZ= 前缀指定时区
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+var (
+	schedulerMu sync.Mutex
+	scheduler   *cron.Cron
+	// 各任务在 scheduler 中的ID，用于查询下次运行时间
+	scheduleEntries = map[string]cron.EntryID{}
+
+	// 正在运行的任务，同一任务不会同时运行多次
+	scheduleRunningMu sync.Mutex
+	scheduleRunning   = map[string]bool{}
+
+	scheduleRunLogMu sync.Mutex
+)
+
+// errScheduleRunning 任务正在运行
+var errScheduleRunning = errors.New("任务正在运行")
+
+// ScheduleConfig 定时执行的提示词
+type ScheduleConfig struct {
+	Name string `yaml:"name"`
+	Cron string `yaml:"cron"`
+	// 提示词模板（Go text/template），可使用 knowledgeSince、qaSince 读取一段时间内的数据
+	Prompt string `yaml:"prompt"`
+	// 结果标题模板，用作知识库条目标题和邮件主题，默认为“任务名 日期”
+	Title     string `yaml:"title"`
+	Model     string `yaml:"model"`
+	Workspace string `yaml:"workspace"`
+	// 结果的去向：保存到知识库、发送到 webhooks 中的某个接收地址、发送邮件
+	Save    bool     `yaml:"save"`
+	Tags    []string `yaml:"tags"`
+	Webhook string   `yaml:"webhook"`
+	Email   []string `yaml:"email"`
+}
+
+// ScheduleRun 一次运行的记录
+type ScheduleRun struct {
+	ID         string    `json:"id"`
+	Schedule   string    `json:"schedule"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	// 没有需要处理的内容，没有调用模型
+	Skipped     bool   `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Title       string `json:"title,omitempty"`
+	RecordID    int    `json:"record_id,omitempty"`
+	KnowledgeID int    `json:"knowledge_id,omitempty"`
+	// 各去向的投递结果，失败时为错误信息
+	Deliveries map[string]string `json:"deliveries,omitempty"`
+}
+
+// scheduleTemplateData 模板中可用的数据
+type scheduleTemplateData struct {
+	Name string
+	Now  time.Time
+}
+
+// scheduleTemplateFuncs 模板中可用的函数，时长支持 Go 时长格式和以 d 结尾的天数，例如 7d
+var scheduleTemplateFuncs = template.FuncMap{
+	"json": hookTemplateFuncs["json"],
+	"knowledgeSince": func(d string) ([]KnowledgeItem, error) {
+		since, err := scheduleSince(d)
+		if err != nil {
+			return nil, err
+		}
+		return knowledgeItemsSince(since), nil
+	},
+	"qaSince": func(d string) ([]QARecord, error) {
+		since, err := scheduleSince(d)
+		if err != nil {
+			return nil, err
+		}
+		return qaRecordsSince(since)
+	},
+}
+
+// parseScheduleDuration 解析时长，在 time.ParseDuration 的基础上支持天数
+func parseScheduleDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("无效的天数: %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// scheduleSince 返回当前时间往前推指定时长的时间点
+func scheduleSince(d string) (time.Time, error) {
+	dur, err := parseScheduleDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-dur), nil
+}
+
+// knowledgeItemsSince 返回指定时间之后添加的知识库条目
+func knowledgeItemsSince(since time.Time) []KnowledgeItem {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	var items []KnowledgeItem
+	for _, item := range knowledgeBase {
+		if !item.Timestamp.Before(since) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// qaRecordsSince 返回指定时间之后的问答记录
+func qaRecordsSince(since time.Time) ([]QARecord, error) {
+	records, err := allQARecords()
+	if err != nil {
+		return nil, err
+	}
+	var result []QARecord
+	for _, r := range records {
+		if !r.Timestamp.Before(since) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// scheduledJob 调度器中的一个任务，schedules 中的每一项和内置的摘要任务都是一个任务
+type scheduledJob struct {
+	Name string
+	Cron string
+	// 在列表接口中展示的信息
+	Info gin.H
+	Run  func(run *ScheduleRun) error
+}
+
+// scheduledJobs 返回配置中的全部任务
+func scheduledJobs(cfg *Config) []scheduledJob {
+	var jobs []scheduledJob
+	for _, s := range cfg.Schedules {
+		s := s
+		jobs = append(jobs, scheduledJob{
+			Name: s.Name,
+			Cron: s.Cron,
+			Info: gin.H{"model": s.Model, "save": s.Save, "webhook": s.Webhook, "email": s.Email},
+			Run:  func(run *ScheduleRun) error { return executeSchedule(s, run) },
+		})
+	}
+	if job, ok := digestJob(cfg); ok {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// findScheduledJob 按名称查找任务
+func findScheduledJob(cfg *Config, name string) (scheduledJob, bool) {
+	for _, job := range scheduledJobs(cfg) {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return scheduledJob{}, false
+}
+
+// parseScheduleTemplate 解析定时任务模板
+func parseScheduleTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(scheduleTemplateFuncs).Parse(text)
+}
+
+// renderScheduleTemplate 渲染模板，返回去掉首尾空白的结果
+func renderScheduleTemplate(name, text string, data scheduleTemplateData) (string, error) {
+	tmpl, err := parseScheduleTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// startScheduler 按配置启动定时任务
+func startScheduler(cfg *Config) {
+	schedulerMu.Lock()
+	scheduler = cron.New(cron.WithParser(cronParser))
+	scheduler.Start()
+	schedulerMu.Unlock()
+	reloadSchedules(cfg)
+}
+
+// reloadSchedules 配置变化后重新注册全部定时任务，未启动调度器时（例如命令行子命令）不做任何事
+func reloadSchedules(cfg *Config) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if scheduler == nil {
+		return
+	}
+
+	for name, id := range scheduleEntries {
+		scheduler.Remove(id)
+		delete(scheduleEntries, name)
+	}
+	jobs := scheduledJobs(cfg)
+	for _, job := range jobs {
+		name := job.Name
+		id, err := scheduler.AddFunc(job.Cron, func() {
+			if readOnly(currentConfig()) {
+				slog.Warn("服务处于只读模式，跳过定时任务", "schedule", name)
+				return
+			}
+			if _, err := runSchedule(name, scheduleTriggerCron); err != nil && !errors.Is(err, errScheduleRunning) {
+				slog.Error("定时任务运行失败", "schedule", name, "error", err)
+			}
+		})
+		if err != nil {
+			slog.Error("无法注册定时任务", "schedule", name, "error", err)
+			continue
+		}
+		scheduleEntries[name] = id
+	}
+	if len(jobs) > 0 {
+		slog.Info("定时任务已加载", "count", len(scheduleEntries))
+	}
+}
+
+// nextScheduleRun 返回任务的下次运行时间，未注册时返回零值
+func nextScheduleRun(name string) time.Time {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if scheduler == nil {
+		return time.Time{}
+	}
+	id, ok := scheduleEntries[name]
+	if !ok {
+		return time.Time{}
+	}
+	return scheduler.Entry(id).Next
+}
+
+// runSchedule 运行一次定时任务：渲染提示词、调用模型、把结果发送到各个去向，运行结果写入运行记录
+func runSchedule(name, trigger string) (ScheduleRun, error) {
+	job, ok := findScheduledJob(currentConfig(), name)
+	if !ok {
+		return ScheduleRun{}, fmt.Errorf("未找到定时任务: %s", name)
+	}
+
+	scheduleRunningMu.Lock()
+	if scheduleRunning[name] {
+		scheduleRunningMu.Unlock()
+		return ScheduleRun{}, errScheduleRunning
+	}
+	scheduleRunning[name] = true
+	scheduleRunningMu.Unlock()
+	defer func() {
+		scheduleRunningMu.Lock()
+		delete(scheduleRunning, name)
+		scheduleRunningMu.Unlock()
+	}()
+
+	run := ScheduleRun{ID: newEventID(), Schedule: name, Trigger: trigger, StartedAt: time.Now()}
+	err := job.Run(&run)
+	run.DurationMS = time.Since(run.StartedAt).Milliseconds()
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	scheduleRunLogMu.Lock()
+	if err := appendJSONLine(dataPath(scheduleRunLogFile), run); err != nil {
+		slog.Error("写入定时任务运行记录失败", "error", err)
+	}
+	scheduleRunLogMu.Unlock()
+	return run, err
+}
+
+// executeSchedule 执行任务并把结果填入运行记录
+func executeSchedule(s ScheduleConfig, run *ScheduleRun) error {
+	data := scheduleTemplateData{Name: s.Name, Now: run.StartedAt}
+	prompt, err := renderScheduleTemplate(s.Name, s.Prompt, data)
+	if err != nil {
+		return fmt.Errorf("渲染提示词失败: %w", err)
+	}
+	if prompt == "" {
+		return errors.New("提示词为空")
+	}
+	run.Title = s.Name + " " + run.StartedAt.Format("2006-01-02")
+	if s.Title != "" {
+		if title, err := renderScheduleTemplate(s.Name+".title", s.Title, data); err == nil && title != "" {
+			run.Title = title
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+	resp, record, chatErr := processChat(ctx, ChatRequest{Message: prompt, Model: s.Model, Workspace: s.Workspace}, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": s.Model, "source": "schedule", "schedule": s.Name})
+		}
+		return errors.New(chatErr.Message)
+	}
+	run.RecordID = record.ID
+
+	result := scheduleResult{Schedule: s.Name, Title: run.Title, Content: resp.Response, Model: resp.Model, RecordID: record.ID}
+	run.KnowledgeID, run.Deliveries = deliverScheduleResult(s.Save, s.Tags, s.Webhook, s.Email, result)
+	for target, status := range run.Deliveries {
+		if status != "ok" {
+			return fmt.Errorf("发送到 %s 失败: %s", target, status)
+		}
+	}
+	return nil
+}
+
+// scheduleResult 定时任务生成的内容，发送到 webhook 时作为事件数据
+type scheduleResult struct {
+	Schedule    string `json:"schedule"`
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	Model       string `json:"model"`
+	RecordID    int    `json:"record_id,omitempty"`
+	KnowledgeID int    `json:"knowledge_id,omitempty"`
+}
+
+// deliverScheduleResult 把结果保存到知识库并发送到 webhook 和邮件，返回知识库条目ID和各去向的结果
+func deliverScheduleResult(save bool, tags []string, webhook string, email []string, result scheduleResult) (int, map[string]string) {
+	deliveries := map[string]string{}
+	if save {
+		item, err := addKnowledgeItem(KnowledgeItem{
+			Title:     result.Title,
+			Content:   result.Content,
+			Model:     result.Model,
+			Timestamp: time.Now(),
+			Tags:      tags,
+		})
+		if err != nil {
+			deliveries["knowledge"] = err.Error()
+		} else {
+			result.KnowledgeID = item.ID
+			deliveries["knowledge"] = "ok"
+		}
+	}
+	if webhook != "" {
+		deliveries["webhook:"+webhook] = "ok"
+		if err := sendScheduleWebhook(webhook, result); err != nil {
+			deliveries["webhook:"+webhook] = err.Error()
+		}
+	}
+	if len(email) > 0 {
+		deliveries["email"] = "ok"
+		if err := sendEmail(email, result.Title, result.Content, mail.Header{}); err != nil {
+			deliveries["email"] = err.Error()
+		}
+	}
+	return result.KnowledgeID, deliveries
+}
+
+// sendScheduleWebhook 把结果发送到 webhooks 中指定名称的接收地址，不受其 events 筛选的限制
+func sendScheduleWebhook(name string, result scheduleResult) error {
+	var hook *WebhookConfig
+	for _, h := range currentConfig().Webhooks {
+		if h.Name == name {
+			hook = &h
+			break
+		}
+	}
+	if hook == nil {
+		return fmt.Errorf("未找到 webhook: %s", name)
+	}
+	payload, body, err := newWebhookPayload(webhookEventScheduleCompleted, result)
+	if err != nil {
+		return err
+	}
+	if delivery := deliverWebhook(*hook, payload, body); !delivery.Success {
+		return errors.New(delivery.Error)
+	}
+	return nil
+}
+
+// schedulesHandler 列出定时任务及下次运行时间
+func schedulesHandler(c *gin.Context) {
+	schedules := []gin.H{}
+	for _, job := range scheduledJobs(currentConfig()) {
+		item := gin.H{"name": job.Name, "cron": job.Cron}
+		for k, v := range job.Info {
+			item[k] = v
+		}
+		if next := nextScheduleRun(job.Name); !next.IsZero() {
+			item["next_run"] = next
+		}
+		schedules = append(schedules, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// scheduleRunHandler 立即运行一次定时任务，等待运行结束后返回运行记录
+func scheduleRunHandler(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := findScheduledJob(currentConfig(), name); !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.schedule_not_found", name))
+		return
+	}
+	run, err := runSchedule(name, scheduleTriggerManual)
+	if errors.Is(err, errScheduleRunning) {
+		respondError(c, http.StatusConflict, tr(c, "error.schedule_running"))
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	recordAudit(c, auditActionAdminScheduleRun, name, run.Error, status)
+	c.JSON(status, gin.H{"run": run})
+}
+
+// scheduleRunsHandler 查询定时任务的运行记录，最新的在前
+func scheduleRunsHandler(c *gin.Context) {
+	name := c.Param("name")
+	limit := defaultScheduleRunLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	runs := []ScheduleRun{}
+	scheduleRunLogMu.Lock()
+	err := readJSONLines(dataPath(scheduleRunLogFile), func(line []byte) {
+		var run ScheduleRun
+		if json.Unmarshal(line, &run) == nil && run.Schedule == name {
+			runs = append(runs, run)
+		}
+	})
+	scheduleRunLogMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_schedule_runs"))
+		return
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	total := len(runs)
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"runs":  runs,
+	})
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 访问密钥后端的HTTP超时
+const secretFetchTimeout = 10 * time.Second
+
+var secretHTTPClient = &http.Client{Timeout: secretFetchTimeout}
+
+// isSecretRef 判断配置值是否为密钥引用
+func isSecretRef(value string) bool {
+	for _, prefix := range []string{"vault://", "awssm://", "keyring://", encryptedKeyPrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret 解析密钥引用，普通值原样返回
+// 支持 vault://<路径>#<字段>、awssm://<名称>[#<字段>]、keyring://<服务名>/<账户名> 和 enc:v1: 加密值
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "keyring://"):
+		return readKeyring(parseKeyringRef(ref))
+	case strings.HasPrefix(ref, encryptedKeyPrefix):
+		return resolveEncryptedKey(ref)
+	case strings.HasPrefix(ref, "vault://"):
+		return resolveVaultSecret(strings.TrimPrefix(ref, "vault://"))
+	case strings.HasPrefix(ref, "awssm://"):
+		return resolveAWSSecret(strings.TrimPrefix(ref, "awssm://"))
+	}
+	return ref, nil
+}
+
+// resolveConfigSecrets 解析配置中的密钥引用，原始引用保存下来用于定期刷新
+func resolveConfigSecrets(cfg *Config) error {
+	fields := []struct {
+		name  string
+		value *string
+		ref   *string
+	}{
+		{"api.api_key", &cfg.API.APIKey, &cfg.API.APIKeyRef},
+		{"admin.token", &cfg.Admin.Token, &cfg.Admin.TokenRef},
+		{"storage.encryption_key", &cfg.Storage.EncryptionKey, &cfg.Storage.EncryptionKeyRef},
+		{"storage.dsn", &cfg.Storage.DSN, &cfg.Storage.DSNRef},
+		{"slack.bot_token", &cfg.Slack.BotToken, &cfg.Slack.BotTokenRef},
+		{"slack.signing_secret", &cfg.Slack.SigningSecret, &cfg.Slack.SigningSecretRef},
+		{"slack.app_token", &cfg.Slack.AppToken, &cfg.Slack.AppTokenRef},
+		{"wecom.secret", &cfg.WeCom.Secret, &cfg.WeCom.SecretRef},
+		{"wecom.token", &cfg.WeCom.Token, &cfg.WeCom.TokenRef},
+		{"wecom.encoding_aes_key", &cfg.WeCom.EncodingAESKey, &cfg.WeCom.EncodingAESKeyRef},
+		{"dingtalk.app_secret", &cfg.DingTalk.AppSecret, &cfg.DingTalk.AppSecretRef},
+		{"email.imap.password", &cfg.Email.IMAP.Password, &cfg.Email.IMAP.PasswordRef},
+		{"email.smtp.password", &cfg.Email.SMTP.Password, &cfg.Email.SMTP.PasswordRef},
+	}
+
+	for _, f := range fields {
+		if !isSecretRef(*f.value) {
+			continue
+		}
+		*f.ref = *f.value
+		secret, err := resolveSecret(*f.value)
+		if err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", f.name, err)
+		}
+		*f.value = secret
+	}
+
+	// 上游请求头中的令牌也可以写成密钥引用，只在加载配置时解析
+	headerSets := []map[string]string{cfg.API.Headers}
+	for _, e := range cfg.API.Endpoints {
+		headerSets = append(headerSets, e.Headers)
+	}
+	for _, headers := range headerSets {
+		for name, value := range headers {
+			if !isSecretRef(value) {
+				continue
+			}
+			secret, err := resolveSecret(value)
+			if err != nil {
+				return fmt.Errorf("解析请求头 %s 失败: %w", name, err)
+			}
+			headers[name] = secret
+		}
+	}
+	return nil
+}
+
+// refreshSecrets 定期重新解析密钥引用，以便密钥轮换后无需重启
+func refreshSecrets(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloadMu.Lock()
+		cfg := *currentConfig()
+		changed := false
+		for _, f := range []struct {
+			ref   string
+			value *string
+		}{
+			{cfg.API.APIKeyRef, &cfg.API.APIKey},
+			{cfg.Admin.TokenRef, &cfg.Admin.Token},
+		} {
+			if f.ref == "" {
+				continue
+			}
+			secret, err := resolveSecret(f.ref)
+			if err != nil {
+				slog.Warn("刷新密钥失败，继续使用旧值", "ref", f.ref, "error", err)
+				continue
+			}
+			if secret != *f.value {
+				*f.value = secret
+				changed = true
+			}
+		}
+		if changed {
+			activeConfig.Store(&cfg)
+			slog.Info("密钥已轮换")
+		}
+		reloadMu.Unlock()
+	}
+}
+
+// splitSecretField 拆分 路径#字段
+func splitSecretField(ref string) (string, string) {
+	path, field, _ := strings.Cut(ref, "#")
+	return path, field
+}
+
+// resolveVaultSecret 从HashiCorp Vault读取密钥，同时兼容KV v1和v2
+// 地址和令牌取自 VAULT_ADDR / VAULT_TOKEN 环境变量
+func resolveVaultSecret(ref string) (string, error) {
+	path, field := splitSecretField(ref)
+	if field == "" {
+		return "", fmt.Errorf("vault 引用需要指定字段，例如 vault://secret/data/app#api_key")
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("需要设置 VAULT_ADDR 和 VAULT_TOKEN 环境变量")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	body, err := doSecretRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("解析 vault 响应失败: %w", err)
+	}
+
+	// KV v2 的数据嵌套在 data.data 中
+	data := resp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault 路径 %s 中没有字段 %s", path, field)
+	}
+	return value, nil
+}
+
+// resolveAWSSecret 从AWS Secrets Manager读取密钥
+// 凭证和区域取自 AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN / AWS_REGION 环境变量
+func resolveAWSSecret(ref string) (string, error) {
+	name, field := splitSecretField(ref)
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", fmt.Errorf("需要设置 AWS_REGION、AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 环境变量")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"SecretId": name})
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if sessionToken := os.Getenv("AWS_SESSION_TOKEN"); sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signAWSRequest(req, payload, accessKey, secretKey, region, "secretsmanager", time.Now().UTC())
+
+	body, err := doSecretRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("解析 Secrets Manager 响应失败: %w", err)
+	}
+	if field == "" {
+		return resp.SecretString, nil
+	}
+
+	// 指定字段时密钥内容应为JSON对象
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("密钥 %s 不是 JSON 对象，无法读取字段 %s", name, field)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("密钥 %s 中没有字段 %s", name, field)
+	}
+	return value, nil
+}
+
+// doSecretRequest 发送请求并返回响应体
+func doSecretRequest(req *http.Request) ([]byte, error) {
+	resp, err := secretHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s 返回状态码 %d", req.URL.Host, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// signAWSRequest 使用AWS Signature Version 4为请求签名
+func signAWSRequest(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// 参与签名的请求头，按名称排序
+	signedHeaders := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+// canonicalQuery 按SigV4要求编码查询参数
+func canonicalQuery(values url.Values) string {
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 影子流量的对比记录文件
+const shadowLogFile = "shadow_log.jsonl"
+
+// 未配置 shadow 时的超时和同时进行的影子请求数
+const (
+	defaultShadowTimeout       = 2 * time.Minute
+	defaultShadowMaxConcurrent = 4
+)
+
+// 对比记录接口默认返回的条数
+const defaultShadowLimit = 100
+
+var (
+	shadowLogMu sync.Mutex
+	// 正在进行的影子请求数
+	shadowInFlight atomic.Int32
+)
+
+// ShadowAnswer 一个模型对问题的回答
+type ShadowAnswer struct {
+	Model     string      `json:"model"`
+	Answer    string      `json:"answer,omitempty"`
+	Usage     *TokenUsage `json:"usage,omitempty"`
+	LatencyMs int64       `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	// 开启 judge 时评审模型的评分
+	Judge *JudgeScore `json:"judge,omitempty"`
+}
+
+// ShadowComparison 同一个问题的正式回答和影子模型的回答，影子回答不会返回给用户
+type ShadowComparison struct {
+	RecordID  int          `json:"record_id"`
+	Timestamp time.Time    `json:"timestamp"`
+	Question  string       `json:"question"`
+	Primary   ShadowAnswer `json:"primary"`
+	Shadow    ShadowAnswer `json:"shadow"`
+}
+
+// ShadowSummary 一个影子模型的对比汇总，延迟和评分为平均值
+type ShadowSummary struct {
+	Model            string  `json:"model"`
+	Count            int     `json:"count"`
+	Errors           int     `json:"errors"`
+	PrimaryLatencyMs float64 `json:"primary_latency_ms"`
+	ShadowLatencyMs  float64 `json:"shadow_latency_ms"`
+	// 两个回答都有评分的对比数和平均分
+	Judged       int     `json:"judged,omitempty"`
+	PrimaryScore float64 `json:"primary_score,omitempty"`
+	ShadowScore  float64 `json:"shadow_score,omitempty"`
+}
+
+// startShadow 按 shadow.rate 抽样，在后台把问题再交给 shadow.model 回答并保存对比记录，不影响正式回答
+// 影子模型与正式回答的模型相同或同时进行的影子请求已满时跳过
+func startShadow(cfg *Config, req ChatRequest, message string, piiMapping PIIMapping, record QARecord, latency time.Duration) {
+	if !cfg.Shadow.Enabled || !featureEnabled(cfg, featureShadow) || rand.Float64() >= cfg.Shadow.Rate {
+		return
+	}
+	model := resolveModel(cfg, cfg.Shadow.Model)
+	if model == req.Model {
+		return
+	}
+	if shadowInFlight.Add(1) > int32(shadowMaxConcurrent(cfg)) {
+		shadowInFlight.Add(-1)
+		slog.Debug("影子请求已满，跳过", "model", model)
+		return
+	}
+
+	primary := ShadowAnswer{Model: record.Model, Answer: record.Answer, Usage: record.Usage, LatencyMs: latency.Milliseconds(), Judge: record.Judge}
+	go func() {
+		defer shadowInFlight.Add(-1)
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout(cfg))
+		defer cancel()
+
+		req.Model = model
+		shadow := ShadowAnswer{Model: model}
+		start := time.Now()
+		attempt, chatErr := answerChat(ctx, cfg, req, message, piiMapping, nil)
+		shadow.LatencyMs = time.Since(start).Milliseconds()
+		if attempt.Usage != nil {
+			recordFeatureUsage(usageFeatureShadow, model, attempt.Usage)
+		}
+		if chatErr != nil {
+			shadow.Error = chatErr.Message
+			slog.Warn("影子模型回答失败", "model", model, "error", chatErr.Message)
+		} else {
+			shadow.Answer, shadow.Usage = attempt.Answer, attempt.Usage
+			// 正式回答有评分时同样为影子回答打分，便于比较
+			if primary.Judge != nil {
+				if score, err := scoreAnswer(ctx, cfg, message, shadow.Answer); err == nil {
+					shadow.Judge = score
+				} else {
+					slog.Warn("影子回答评分失败", "model", model, "error", err)
+				}
+			}
+		}
+
+		appendShadowComparison(ShadowComparison{
+			RecordID:  record.ID,
+			Timestamp: time.Now(),
+			Question:  record.Question,
+			Primary:   primary,
+			Shadow:    shadow,
+		})
+	}()
+}
+
+// appendShadowComparison 追加一条对比记录，记录包含问题和回答，开启数据加密时加密后写入
+func appendShadowComparison(comparison ShadowComparison) {
+	shadowLogMu.Lock()
+	defer shadowLogMu.Unlock()
+
+	if err := appendSealedJSONLine(dataPath(shadowLogFile), comparison); err != nil {
+		slog.Error("写入影子流量对比记录失败", "error", err)
+	}
+}
+
+// shadowHandler 返回影子流量的对比记录和按影子模型的汇总，可以按 model 筛选
+func shadowHandler(c *gin.Context) {
+	model := c.Query("model")
+	limit := defaultShadowLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	comparisons := []ShadowComparison{}
+	shadowLogMu.Lock()
+	err := readSealedJSONLines(dataPath(shadowLogFile), func(line []byte) {
+		var comparison ShadowComparison
+		if json.Unmarshal(line, &comparison) == nil && (model == "" || comparison.Shadow.Model == model) {
+			comparisons = append(comparisons, comparison)
+		}
+	})
+	shadowLogMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_shadow_log"))
+		return
+	}
+
+	summary := summarizeShadow(comparisons)
+	sort.SliceStable(comparisons, func(i, j int) bool {
+		return comparisons[i].Timestamp.After(comparisons[j].Timestamp)
+	})
+	total := len(comparisons)
+	if len(comparisons) > limit {
+		comparisons = comparisons[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":       total,
+		"summary":     summary,
+		"comparisons": comparisons,
+	})
+}
+
+// summarizeShadow 按影子模型汇总对比记录，失败的影子请求不计入平均延迟和评分
+func summarizeShadow(comparisons []ShadowComparison) []ShadowSummary {
+	byModel := map[string]*ShadowSummary{}
+	var models []string
+	for _, comparison := range comparisons {
+		s, ok := byModel[comparison.Shadow.Model]
+		if !ok {
+			s = &ShadowSummary{Model: comparison.Shadow.Model}
+			byModel[s.Model] = s
+			models = append(models, s.Model)
+		}
+		s.Count++
+		if comparison.Shadow.Error != "" {
+			s.Errors++
+			continue
+		}
+		s.PrimaryLatencyMs += float64(comparison.Primary.LatencyMs)
+		s.ShadowLatencyMs += float64(comparison.Shadow.LatencyMs)
+		if comparison.Primary.Judge != nil && comparison.Shadow.Judge != nil {
+			s.Judged++
+			s.PrimaryScore += comparison.Primary.Judge.Score
+			s.ShadowScore += comparison.Shadow.Judge.Score
+		}
+	}
+
+	sort.Strings(models)
+	summary := make([]ShadowSummary, 0, len(models))
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	for _, model := range models {
+		s := byModel[model]
+		if n := s.Count - s.Errors; n > 0 {
+			s.PrimaryLatencyMs = round(s.PrimaryLatencyMs / float64(n))
+			s.ShadowLatencyMs = round(s.ShadowLatencyMs / float64(n))
+		}
+		if s.Judged > 0 {
+			s.PrimaryScore = round(s.PrimaryScore / float64(s.Judged))
+			s.ShadowScore = round(s.ShadowScore / float64(s.Judged))
+		}
+		summary = append(summary, *s)
+	}
+	return summary
+}
+
+// shadowTimeout 返回影子请求的超时
+func shadowTimeout(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Shadow.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultShadowTimeout
+}
+
+// shadowMaxConcurrent 返回同时进行的影子请求数上限
+func shadowMaxConcurrent(cfg *Config) int {
+	if cfg.Shadow.MaxConcurrent > 0 {
+		return cfg.Shadow.MaxConcurrent
+	}
+	return defaultShadowMaxConcurrent
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// Slack 机器人接收事件的方式
+const (
+	slackModeEvents = "events"
+	slackModeSocket = "socket"
+)
+
+// 默认的保存到知识库的表情（📌）
+const defaultSlackSaveReaction = "pushpin"
+
+// 最多记住多少条机器人回复，用于通过表情保存到知识库
+const maxSlackReplies = 1000
+
+// 审计日志中的 Slack 操作
+const (
+	auditActionSlackChat = "slack.chat"
+	auditActionSlackSave = "slack.knowledge.add"
+)
+
+// 提及机器人的标记，例如 <@U012AB3CD>
+var slackMentionPattern = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+var (
+	slackAPI *slack.Client
+
+	// 机器人回复及其提问消息对应的问答记录，键为 频道/消息时间戳
+	slackRepliesMu sync.Mutex
+	slackReplies   = map[string]QARecord{}
+	slackReplyKeys []string
+)
+
+// slackSaveReaction 返回保存到知识库使用的表情名称
+func slackSaveReaction(cfg *Config) string {
+	if cfg.Slack.SaveReaction != "" {
+		return strings.Trim(cfg.Slack.SaveReaction, ":")
+	}
+	return defaultSlackSaveReaction
+}
+
+// setupSlack 启用 Slack 机器人，Events API 模式下注册事件回调地址，Socket Mode 模式下建立长连接
+func setupSlack(r *gin.Engine, cfg *Config) {
+	if !cfg.Slack.Enabled {
+		return
+	}
+	slackAPI = slack.New(cfg.Slack.BotToken, slack.OptionAppLevelToken(cfg.Slack.AppToken))
+
+	if cfg.Slack.Mode == slackModeSocket {
+		go runSlackSocketMode()
+		slog.Info("Slack 机器人已启用", "mode", slackModeSocket)
+		return
+	}
+	r.POST("/slack/events", slackEventsHandler)
+	slog.Info("Slack 机器人已启用", "mode", slackModeEvents, "path", "/slack/events")
+}
+
+// slackEventsHandler 接收 Events API 回调，校验签名后立即返回，事件在后台处理
+// Slack 要求3秒内响应，否则会重试
+func slackEventsHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, tr(c, "error.read_request"))
+		return
+	}
+
+	verifier, err := slack.NewSecretsVerifier(c.Request.Header, currentConfig().Slack.SigningSecret)
+	if err == nil {
+		verifier.Write(body)
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "Slack 签名无效", http.StatusUnauthorized)
+		respondError(c, http.StatusUnauthorized, tr(c, "error.signature_invalid"))
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		respondError(c, http.StatusBadRequest, tr(c, "error.invalid_event", err))
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			respondError(c, http.StatusBadRequest, tr(c, "error.invalid_verification"))
+			return
+		}
+		c.String(http.StatusOK, challenge.Challenge)
+	case slackevents.CallbackEvent:
+		// 处理较慢时 Slack 会重试，已经在处理的事件不再重复处理
+		if c.GetHeader("X-Slack-Retry-Num") == "" {
+			go handleSlackEvent(event.InnerEvent)
+		}
+		c.Status(http.StatusOK)
+	default:
+		c.Status(http.StatusOK)
+	}
+}
+
+// runSlackSocketMode 通过 Socket Mode 接收事件，连接断开时由客户端自动重连
+func runSlackSocketMode() {
+	client := socketmode.New(slackAPI)
+	go func() {
+		for evt := range client.Events {
+			switch evt.Type {
+			case socketmode.EventTypeConnected:
+				slog.Info("已连接 Slack Socket Mode")
+			case socketmode.EventTypeConnectionError:
+				slog.Warn("连接 Slack Socket Mode 失败，稍后重试")
+			case socketmode.EventTypeEventsAPI:
+				event, ok := evt.Data.(slackevents.EventsAPIEvent)
+				if !ok {
+					continue
+				}
+				client.Ack(*evt.Request)
+				if event.Type == slackevents.CallbackEvent {
+					go handleSlackEvent(event.InnerEvent)
+				}
+			}
+		}
+	}()
+	if err := client.Run(); err != nil {
+		slog.Error("Slack Socket Mode 退出", "error", err)
+	}
+}
+
+// handleSlackEvent 处理提及机器人和添加表情两类事件
+func handleSlackEvent(event slackevents.EventsAPIInnerEvent) {
+	switch ev := event.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		if ev.BotID != "" {
+			return
+		}
+		handleSlackMention(ev)
+	case *slackevents.ReactionAddedEvent:
+		if ev.Reaction == slackSaveReaction(currentConfig()) && ev.Item.Type == "message" {
+			handleSlackSaveReaction(ev)
+		}
+	}
+}
+
+// handleSlackMention 把提及机器人的消息交给与 /api/v1/chat 相同的处理流程，并在消息串中回复
+func handleSlackMention(ev *slackevents.AppMentionEvent) {
+	cfg := currentConfig()
+	threadTS := ev.ThreadTimeStamp
+	if threadTS == "" {
+		threadTS = ev.TimeStamp
+	}
+
+	message := strings.TrimSpace(slackMentionPattern.ReplaceAllString(ev.Text, ""))
+	if message == "" {
+		postSlackReply(ev.Channel, threadTS, "请在提及我的同时输入问题。")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+
+	resp, record, chatErr := processChat(ctx, ChatRequest{Message: message, Model: cfg.Slack.Model, User: "slack:" + ev.User}, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			slog.Error("调用模型失败", "source", "slack", "error", chatErr.Err)
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": cfg.Slack.Model, "source": "slack"})
+		}
+		slackAudit(ev.User, auditActionSlackChat, ev.Channel, chatErr.Message, chatErr.Status)
+		postSlackReply(ev.Channel, threadTS, "抱歉，处理失败："+chatErr.Message)
+		return
+	}
+	slackAudit(ev.User, auditActionSlackChat, ev.Channel, fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+
+	text := resp.Response + fmt.Sprintf("\n\n_%s · 添加 :%s: 表情可保存到知识库_", resp.Model, slackSaveReaction(cfg))
+	replyTS := postSlackReply(ev.Channel, threadTS, text)
+	rememberSlackReply(ev.Channel, ev.TimeStamp, record)
+	if replyTS != "" {
+		rememberSlackReply(ev.Channel, replyTS, record)
+	}
+}
+
+// handleSlackSaveReaction 对机器人的回复（或对应的提问）添加表情时保存到知识库
+func handleSlackSaveReaction(ev *slackevents.ReactionAddedEvent) {
+	key := ev.Item.Channel + "/" + ev.Item.Timestamp
+	slackRepliesMu.Lock()
+	record, ok := slackReplies[key]
+	if ok {
+		// 同一条回答只保存一次
+		for _, k := range slackReplyKeys {
+			if slackReplies[k].ID == record.ID {
+				delete(slackReplies, k)
+			}
+		}
+	}
+	slackRepliesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     askDefaultTitle(record.Question),
+		Content:   record.Answer,
+		Model:     record.Model,
+		Timestamp: time.Now(),
+		Tags:      []string{"slack"},
+	})
+	if err != nil {
+		slackAudit(ev.User, auditActionSlackSave, "knowledge", err.Error(), http.StatusForbidden)
+		postSlackReply(ev.Item.Channel, ev.Item.Timestamp, "未能保存到知识库："+err.Error())
+		return
+	}
+	slackAudit(ev.User, auditActionSlackSave, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	postSlackReply(ev.Item.Channel, ev.Item.Timestamp, fmt.Sprintf("已保存到知识库（ID %d）", item.ID))
+}
+
+// rememberSlackReply 记住消息对应的问答记录，超过上限时丢弃最早的
+func rememberSlackReply(channel, ts string, record QARecord) {
+	slackRepliesMu.Lock()
+	defer slackRepliesMu.Unlock()
+
+	key := channel + "/" + ts
+	slackReplies[key] = record
+	slackReplyKeys = append(slackReplyKeys, key)
+	for len(slackReplyKeys) > maxSlackReplies {
+		delete(slackReplies, slackReplyKeys[0])
+		slackReplyKeys = slackReplyKeys[1:]
+	}
+}
+
+// postSlackReply 在消息串中回复，返回回复消息的时间戳
+func postSlackReply(channel, threadTS, text string) string {
+	_, ts, err := slackAPI.PostMessage(channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS))
+	if err != nil {
+		slog.Error("发送 Slack 消息失败", "channel", channel, "error", err)
+		return ""
+	}
+	return ts
+}
+
+// slackAudit 记录 Slack 操作的审计日志，用户为 slack:<用户ID>
+func slackAudit(user, action, resource, detail string, status int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      "slack:" + user,
+		Action:    action,
+		Resource:  resource,
+		Detail:    detail,
+		Status:    status,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未配置 gateway.heartbeat 时流式响应的心跳间隔，小于常见反向代理 60s 的读超时
+const defaultStreamHeartbeat = 15 * time.Second
+
+// heartbeat 流式响应的心跳计时，距离上次发送内容超过间隔时 C 触发；间隔为 0 时 C 为空，永远不会触发
+type heartbeat struct {
+	C        <-chan time.Time
+	ticker   *time.Ticker
+	interval time.Duration
+}
+
+// newHeartbeat 创建心跳计时
+func newHeartbeat(interval time.Duration) *heartbeat {
+	h := &heartbeat{interval: interval}
+	if interval > 0 {
+		h.ticker = time.NewTicker(interval)
+		h.C = h.ticker.C
+	}
+	return h
+}
+
+// reset 发送内容后重新计时
+func (h *heartbeat) reset() {
+	if h.ticker != nil {
+		h.ticker.Reset(h.interval)
+	}
+}
+
+// stop 停止计时
+func (h *heartbeat) stop() {
+	if h.ticker != nil {
+		h.ticker.Stop()
+	}
+}
+
+// startSSE 写入 SSE 响应头并立即发送，之后只能以事件的形式返回错误
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// writeSSEHeartbeat 发送一条 SSE 注释，客户端会忽略它，反向代理和浏览器因此不会认为连接空闲
+func writeSSEHeartbeat(c *gin.Context) {
+	fmt.Fprint(c.Writer, ": ping\n\n")
+	c.Writer.Flush()
+}
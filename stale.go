@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的手动检查链接操作
+const auditActionKnowledgeStaleCheck = "knowledge.stale.check"
+
+// 最近一次链接检查的结果保存在数据目录中的文件
+const staleReportFile = "stale_links.json"
+
+// 未配置 staleness 时的检查间隔、单个链接的超时和需要复查的条目年龄
+const (
+	defaultStaleInterval = 24 * time.Hour
+	defaultStaleTimeout  = 10 * time.Second
+	defaultStaleMaxAge   = 180 * 24 * time.Hour
+)
+
+// 同时检查的链接数
+const staleCheckConcurrency = 8
+
+// 需要复查的原因：包含失效链接、超过 max_age 没有更新、模型复核认为内容可能已经过时
+const (
+	staleReasonDeadLink      = "dead_link"
+	staleReasonOutdated      = "outdated"
+	staleReasonModelOutdated = "model_outdated"
+)
+
+// 条目内容中的 http(s) 链接，末尾的标点不算在链接内
+var (
+	contentURLPattern = regexp.MustCompile(`https?://[^\s<>()\[\]{}"'` + "`" + `，。；！？、）】》]+`)
+	urlTrailingPunct  = ".,;:!?*_~"
+)
+
+var (
+	staleMu     sync.Mutex
+	staleReport *StaleLinkReport
+	// 同一时间只进行一次检查
+	staleRunning atomic.Bool
+)
+
+// errStaleCheckRunning 链接检查正在进行
+var errStaleCheckRunning = errors.New("链接检查正在进行")
+
+// errNonPublicAddress 链接解析到本机、内网、链路本地（包括云服务器元数据）等非公网地址
+var errNonPublicAddress = errors.New("链接指向非公网地址，不检查")
+
+// 运营商级 NAT 地址段，部分云服务器的元数据服务（例如 100.100.100.200）位于其中
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// DeadLink 无法访问的链接
+type DeadLink struct {
+	URL string `json:"url"`
+	// 链接返回的状态码，连接失败时为空
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StaleLinkReport 一次链接检查的结果
+type StaleLinkReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// 检查的条目数和不同的链接数
+	Items int `json:"items"`
+	URLs  int `json:"urls"`
+	// 键为条目ID
+	DeadLinks map[int][]DeadLink `json:"dead_links"`
+}
+
+// StaleItem 需要复查的知识库条目
+type StaleItem struct {
+	ID        int        `json:"id"`
+	Title     string     `json:"title"`
+	Timestamp time.Time  `json:"timestamp"`
+	AgeDays   int        `json:"age_days"`
+	Reasons   []string   `json:"reasons"`
+	DeadLinks []DeadLink `json:"dead_links,omitempty"`
+	// 模型复核认为内容可能已经过时时为复核结果
+	Verification *KnowledgeVerification `json:"verification,omitempty"`
+}
+
+// loadStaleReport 启动时读取最近一次链接检查的结果
+func loadStaleReport() {
+	var report StaleLinkReport
+	if err := loadDataFile(staleReportFile, &report); err != nil {
+		if !isNotExist(err) {
+			slog.Error("读取链接检查结果失败", "error", err)
+		}
+		return
+	}
+	staleMu.Lock()
+	staleReport = &report
+	staleMu.Unlock()
+}
+
+// checkLinksPeriodically 开启 staleness.check_links 时按间隔检查知识库中的链接，每次都读取当前配置以支持热加载
+func checkLinksPeriodically() {
+	for {
+		cfg := currentConfig()
+		interval := staleInterval(cfg)
+		if cfg.Staleness.CheckLinks && !readOnly(cfg) {
+			staleMu.Lock()
+			due := staleReport == nil || time.Since(staleReport.CheckedAt) >= interval
+			staleMu.Unlock()
+			if due {
+				if _, err := checkKnowledgeLinks(context.Background(), cfg); err != nil && !errors.Is(err, errStaleCheckRunning) {
+					slog.Warn("检查知识库链接失败", "error", err)
+				}
+			}
+		}
+		time.Sleep(min(interval, time.Hour))
+	}
+}
+
+// checkKnowledgeLinks 检查知识库条目中的全部链接，保存并返回结果；同一个链接只检查一次
+func checkKnowledgeLinks(ctx context.Context, cfg *Config) (*StaleLinkReport, error) {
+	if !staleRunning.CompareAndSwap(false, true) {
+		return nil, errStaleCheckRunning
+	}
+	defer staleRunning.Store(false)
+
+	dataMu.RLock()
+	itemURLs := make(map[int][]string, len(knowledgeBase))
+	for _, item := range knowledgeBase {
+		if urls := extractURLs(item.Content); len(urls) > 0 {
+			itemURLs[item.ID] = urls
+		}
+	}
+	items := len(knowledgeBase)
+	dataMu.RUnlock()
+
+	var urls []string
+	seen := map[string]bool{}
+	for _, list := range itemURLs {
+		for _, u := range list {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	// 并发检查，结果按链接保存
+	client := publicHTTPClient(staleTimeout(cfg))
+	results := make(map[string]*DeadLink, len(urls))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < staleCheckConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				dead := checkURL(ctx, client, u)
+				mu.Lock()
+				results[u] = dead
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- u
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &StaleLinkReport{CheckedAt: time.Now(), Items: items, URLs: len(urls), DeadLinks: map[int][]DeadLink{}}
+	for id, list := range itemURLs {
+		for _, u := range list {
+			if dead := results[u]; dead != nil {
+				report.DeadLinks[id] = append(report.DeadLinks[id], *dead)
+			}
+		}
+	}
+
+	staleMu.Lock()
+	staleReport = report
+	staleMu.Unlock()
+	if err := saveDataFile(staleReportFile, report); err != nil {
+		slog.Error("保存链接检查结果失败", "error", err)
+	}
+	slog.Info("知识库链接检查完成", "items", items, "urls", len(urls), "items_with_dead_links", len(report.DeadLinks))
+	return report, nil
+}
+
+// checkURL 检查链接是否可以访问，先发送 HEAD 请求，失败时再用 GET 确认（有的服务器不支持 HEAD）；可以访问时返回 nil
+// 需要登录（401、403）或限流（429）的链接视为可以访问
+func checkURL(ctx context.Context, client *http.Client, url string) *DeadLink {
+	status, err := requestURL(ctx, client, http.MethodHead, url)
+	if err != nil || status >= 400 {
+		status, err = requestURL(ctx, client, http.MethodGet, url)
+	}
+	if errors.Is(err, errNonPublicAddress) {
+		return nil
+	}
+	if err != nil {
+		return &DeadLink{URL: url, Error: err.Error()}
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return nil
+	case status >= 400:
+		return &DeadLink{URL: url, Status: status}
+	}
+	return nil
+}
+
+// publicHTTPClient 返回只能连接公网地址的客户端，用于访问知识库内容中由用户提供的链接
+// 在建立连接时检查解析后的地址，重定向和 DNS 重绑定同样无法访问内网；不使用环境变量中的代理，避免绕过检查
+func publicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}
+}
+
+// isPublicIP 判断地址是否为公网地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// requestURL 发送一次请求并返回状态码，不读取响应内容
+func requestURL(ctx context.Context, client *http.Client, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "ai-assistant/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// extractURLs 返回内容中的 http(s) 链接，去掉重复的链接
+func extractURLs(content string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, u := range contentURLPattern.FindAllString(content, -1) {
+		u = strings.TrimRight(u, urlTrailingPunct)
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// staleItems 返回需要复查的条目：包含失效链接、超过 max_age 没有更新或者模型复核认为可能已经过时；有失效链接的在前，其余按从旧到新排列
+func staleItems(cfg *Config, now time.Time) ([]StaleItem, *StaleLinkReport) {
+	staleMu.Lock()
+	report := staleReport
+	staleMu.Unlock()
+	maxAge := staleMaxAge(cfg)
+
+	dataMu.RLock()
+	items := []StaleItem{}
+	for _, item := range knowledgeBase {
+		stale := StaleItem{ID: item.ID, Title: item.Title, Timestamp: item.Timestamp, AgeDays: int(now.Sub(item.Timestamp).Hours() / 24)}
+		if report != nil && len(report.DeadLinks[item.ID]) > 0 {
+			stale.Reasons = append(stale.Reasons, staleReasonDeadLink)
+			stale.DeadLinks = report.DeadLinks[item.ID]
+		}
+		if maxAge > 0 && now.Sub(item.Timestamp) > maxAge {
+			stale.Reasons = append(stale.Reasons, staleReasonOutdated)
+		}
+		if item.Verification != nil && item.Verification.Outdated {
+			stale.Reasons = append(stale.Reasons, staleReasonModelOutdated)
+			stale.Verification = item.Verification
+		}
+		if len(stale.Reasons) > 0 {
+			items = append(items, stale)
+		}
+	}
+	dataMu.RUnlock()
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if di, dj := len(items[i].DeadLinks) > 0, len(items[j].DeadLinks) > 0; di != dj {
+			return di
+		}
+		return items[i].Timestamp.Before(items[j].Timestamp)
+	})
+	return items, report
+}
+
+// staleKnowledgeHandler 返回需要复查的知识库条目
+func staleKnowledgeHandler(c *gin.Context) {
+	cfg := currentConfig()
+	items, report := staleItems(cfg, time.Now())
+	result := gin.H{
+		"max_age": staleMaxAge(cfg).String(),
+		"total":   len(items),
+		"items":   items,
+	}
+	if report != nil {
+		result["checked_at"] = report.CheckedAt
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// checkStaleLinksHandler 立即检查知识库中的链接，不需要开启 staleness.check_links
+func checkStaleLinksHandler(c *gin.Context) {
+	report, err := checkKnowledgeLinks(c.Request.Context(), currentConfig())
+	if err != nil {
+		if errors.Is(err, errStaleCheckRunning) {
+			respondError(c, http.StatusConflict, tr(c, "error.stale_check_running"))
+			return
+		}
+		if respondDisconnected(c, err) {
+			return
+		}
+		requestLogger(c).Error("检查知识库链接失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	recordAudit(c, auditActionKnowledgeStaleCheck, "knowledge", fmt.Sprintf("urls=%d dead_items=%d", report.URLs, len(report.DeadLinks)), http.StatusOK)
+	c.JSON(http.StatusOK, report)
+}
+
+// staleInterval 返回检查链接的间隔
+func staleInterval(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Staleness.Interval); err == nil && d > 0 {
+		return d
+	}
+	return defaultStaleInterval
+}
+
+// staleTimeout 返回检查单个链接的超时
+func staleTimeout(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Staleness.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultStaleTimeout
+}
+
+// staleMaxAge 返回需要复查的条目年龄，为 0 时不按年龄标记
+func staleMaxAge(cfg *Config) time.Duration {
+	if cfg.Staleness.MaxAge == "" {
+		return defaultStaleMaxAge
+	}
+	d, _ := time.ParseDuration(cfg.Staleness.MaxAge)
+	return max(d, 0)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 数据目录锁文件名
+const dataLockFile = ".lock"
+
+// 数据目录锁模式
+const (
+	storageLockExclusive = "exclusive"
+	storageLockNone      = "none"
+)
+
+// 数据目录已被其它实例锁定
+var errLocked = errors.New("已被锁定")
+
+// 持有数据目录锁的文件，进程退出时由系统释放
+var dataLock *os.File
+
+// 旧版本默认使用的数据目录，相对于当前工作目录
+const legacyDataDir = "data"
+
+// defaultDataDir 返回默认数据目录，遵循XDG规范
+// Linux 等系统为 $XDG_DATA_HOME/ai-assistant（默认 ~/.local/share/ai-assistant），Windows 为 %LOCALAPPDATA%\ai-assistant
+func defaultDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "ai-assistant")
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+			return filepath.Join(dir, "ai-assistant")
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "ai-assistant")
+	}
+	return legacyDataDir
+}
+
+// resolveDataDir 确定数据目录，优先级: -data-dir > AI_ASSISTANT_DATA_DIR > storage.data_dir > 默认目录
+// 未指定且当前目录下存在旧的 data/ 数据时继续使用它，避免升级后看不到原来的知识库
+func resolveDataDir(cfg *Config) string {
+	if dir := cfg.Storage.DataDir; dir != "" {
+		return expandHome(dir)
+	}
+
+	for _, name := range []string{knowledgeDataFile, qaDataFile} {
+		if _, err := os.Stat(filepath.Join(legacyDataDir, name)); err == nil {
+			slog.Warn("检测到当前目录下的旧数据目录，继续使用；建议通过 storage.data_dir 或 -data-dir 明确指定",
+				"data_dir", legacyDataDir, "default", defaultDataDir())
+			return legacyDataDir
+		}
+	}
+	return defaultDataDir()
+}
+
+// expandHome 展开路径开头的 ~
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// writeFileAtomic 原子地写入文件：先写临时文件并同步到磁盘，再重命名覆盖
+// 原文件保留为 .bak，写入中途崩溃或磁盘写满时原文件不受影响
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+
+	// 保留上一个版本
+	if _, err := os.Stat(path); err == nil {
+		bak := path + ".bak"
+		os.Remove(bak)
+		if err := os.Link(path, bak); err != nil {
+			if err := copyFile(path, bak); err != nil {
+				slog.Warn("保留备份文件失败", "path", bak, "error", err)
+			}
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir 同步目录，确保重命名操作落盘
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// dataFileCandidates 返回数据文件可能的路径，当前配置的压缩方式排在最前
+func dataFileCandidates(name string) []string {
+	preferred := compressionExt(currentConfig().Storage.Compression)
+	paths := []string{dataPath(name + preferred)}
+	for _, ext := range []string{"", ".gz", ".zst"} {
+		if ext != preferred {
+			paths = append(paths, dataPath(name+ext))
+		}
+	}
+	return paths
+}
+
+// findDataFile 返回数据目录中实际存在的数据文件路径，修改压缩方式后仍能读到原来的文件
+func findDataFile(name string) string {
+	paths := dataFileCandidates(name)
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return paths[0]
+}
+
+// saveDataFile 将数据序列化，按配置压缩后原子写入数据目录，并删除其它压缩方式的旧文件
+func saveDataFile(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+	data, err = compressData(data, currentConfig().Storage.Compression)
+	if err != nil {
+		return err
+	}
+	if data, err = encryptData(data); err != nil {
+		return err
+	}
+
+	paths := dataFileCandidates(name)
+	if err := writeFileAtomic(paths[0], data, 0644); err != nil {
+		return err
+	}
+	for _, stale := range paths[1:] {
+		if err := os.Remove(stale); err != nil && !isNotExist(err) {
+			slog.Warn("删除旧格式的数据文件失败", "path", stale, "error", err)
+		}
+	}
+	return nil
+}
+
+// loadDataFile 读取并解析数据目录中的数据文件，文件不存在时返回 os.ErrNotExist
+// 密钥缺失或不正确时直接退出，避免以空数据启动后覆盖原有的加密文件
+func loadDataFile(name string, v interface{}) error {
+	err := loadJSONFile(findDataFile(name), v)
+	if errors.Is(err, errDataKey) {
+		fatal("无法读取数据文件", "file", name, "error", err)
+	}
+	return err
+}
+
+// decodeJSONData 解密、解压（如果是加密或压缩数据）并解析JSON
+func decodeJSONData(data []byte, v interface{}) error {
+	data, err := decryptData(data)
+	if err != nil {
+		return err
+	}
+	if data, err = decompressData(data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// loadJSONFile 读取并解析JSON数据文件，支持压缩和加密的文件，文件不存在时返回 os.ErrNotExist
+// 文件损坏时改用 .bak 中的上一个版本，并把损坏的文件改名保留，避免下次保存时被覆盖
+func loadJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	mainErr := decodeJSONData(data, v)
+	if mainErr == nil {
+		return nil
+	}
+	// 没有配置密钥时无法判断文件是否损坏，保持原样
+	if dataKey == nil && errors.Is(mainErr, errDataKey) {
+		return mainErr
+	}
+	slog.Error("数据文件无法解析，尝试使用备份", "path", path, "error", mainErr)
+
+	bak, err := os.ReadFile(path + ".bak")
+	if err == nil {
+		err = decodeJSONData(bak, v)
+	}
+	// 主文件无法解密而备份也无法解密或者是启用加密前的明文，多半是密钥不正确，保持文件原样
+	if errors.Is(mainErr, errDataKey) && (err != nil || !bytes.HasPrefix(bak, encryptedDataMagic)) {
+		return mainErr
+	}
+
+	corrupt := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, corrupt); err != nil {
+		slog.Error("保留损坏的数据文件失败", "path", path, "error", err)
+	} else {
+		slog.Warn("损坏的数据文件已改名保留", "path", corrupt)
+	}
+
+	if isNotExist(err) {
+		return fmt.Errorf("数据文件已损坏且没有可用的备份: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("数据文件和备份都已损坏: %w", err)
+	}
+	slog.Warn("已从备份恢复数据文件", "path", path+".bak")
+	// 恢复后立即写回，使主文件重新可用
+	if err := writeFileAtomic(path, bak, 0644); err != nil {
+		slog.Error("写回恢复的数据文件失败", "path", path, "error", err)
+	}
+	return nil
+}
+
+// isNotExist 判断错误是否为文件不存在
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// lockDataDir 对数据目录加排他锁，防止多个实例同时写入相同的数据文件
+// storage.lock 为 none 时不加锁，用于不支持文件锁的共享存储（多个实例需自行保证不会同时写入）
+func lockDataDir(cfg *Config) error {
+	if cfg.Storage.Lock == storageLockNone {
+		slog.Warn("未对数据目录加锁，请确保没有其它实例使用相同的数据目录", "data_dir", dataDir)
+		return nil
+	}
+
+	path := dataPath(dataLockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("打开锁文件失败: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			owner, _ := os.ReadFile(path)
+			pid := strings.TrimSpace(string(owner))
+			if pid == "" {
+				pid = "未知"
+			}
+			return fmt.Errorf("数据目录 %s 正在被另一个实例使用（PID %s），请先停止该实例，或使用 -data-dir 指定其它数据目录",
+				dataDir, pid)
+		}
+		return fmt.Errorf("锁定数据目录失败: %w", err)
+	}
+
+	// 写入当前进程ID，便于定位占用数据目录的实例
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	dataLock = f
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 存储驱动
+const (
+	storageDriverJSON     = "json"
+	storageDriverPostgres = "postgres"
+	storageDriverSQLite   = "sqlite"
+	storageDriverBolt     = "bolt"
+)
+
+// errQAHistoryUnavailable 没有配置数据库存储时的错误，数据文件只保存最近的问答，无法分析更早的问答记录
+var errQAHistoryUnavailable = errors.New("分析问答历史需要数据库存储（storage.driver 为 bolt、sqlite 或 postgres），数据文件只保存最近的问答")
+
+// Store 数据库存储后端
+// 使用数据库时每条变更直接写入数据库，不再使用数据文件和变更日志
+type Store interface {
+	// Knowledge 返回全部知识库条目，包括回收站中的条目，按ID排序
+	Knowledge() ([]KnowledgeItem, error)
+	// RecentQAs 返回最近的问答记录，按ID倒序，limit<=0 表示全部
+	RecentQAs(limit int) ([]QARecord, error)
+	// Apply 持久化一条变更
+	Apply(entry JournalEntry) error
+	// Import 在一个事务中导入数据并保留原有ID，replace 为 true 时覆盖ID相同的记录
+	Import(knowledge []KnowledgeItem, qas []QARecord, replace bool) error
+	// Close 关闭连接
+	Close() error
+}
+
+// 当前使用的数据库后端，为空表示使用数据文件
+var store Store
+
+// usesDatabase 判断是否配置了数据库后端
+func usesDatabase(cfg *Config) bool {
+	return cfg.Storage.Driver != "" && cfg.Storage.Driver != storageDriverJSON
+}
+
+// openStore 按配置打开数据库后端
+func openStore(cfg *Config) (Store, error) {
+	switch cfg.Storage.Driver {
+	case storageDriverPostgres:
+		return openSQLStore("postgres", cfg.Storage.DSN)
+	case storageDriverBolt:
+		return openBoltStore(cfg.Storage.DSN)
+	case storageDriverSQLite:
+		return openSQLStore(storageDriverSQLite, cfg.Storage.DSN)
+	}
+	return nil, fmt.Errorf("不支持的存储驱动: %s", cfg.Storage.Driver)
+}
+
+// allQARecords 返回全部问答记录，使用数据库后端时从数据库读取，否则只有内存中的最近记录
+func allQARecords() ([]QARecord, error) {
+	if store != nil {
+		records, err := store.RecentQAs(0)
+		if err != nil {
+			return nil, fmt.Errorf("读取问答记录失败: %w", err)
+		}
+		return records, nil
+	}
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	return append([]QARecord(nil), recentQAs...), nil
+}
+
+// lookupQARecord 按ID查找问答记录，最近的记录中没有时再从全部记录中查找（使用数据库时包括更早的记录）
+func lookupQARecord(id int) (QARecord, bool, error) {
+	if record, ok := findQARecord(id); ok {
+		return record, true, nil
+	}
+	records, err := allQARecords()
+	if err != nil {
+		return QARecord{}, false, err
+	}
+	for _, record := range records {
+		if record.ID == id {
+			return record, true, nil
+		}
+	}
+	return QARecord{}, false, nil
+}
+
+// requireQAHistory 分析问答历史的接口没有配置数据库存储时返回 501 并返回 false
+func requireQAHistory(c *gin.Context) bool {
+	if store == nil {
+		respondError(c, http.StatusNotImplemented, tr(c, "error.qa_history_unavailable", maxRecentQAs))
+		return false
+	}
+	return true
+}
+
+// loadFromStore 从数据库加载知识库和最近问答
+func loadFromStore() error {
+	items, err := store.Knowledge()
+	if err != nil {
+		return fmt.Errorf("读取知识库失败: %w", err)
+	}
+	qas, err := store.RecentQAs(maxRecentQAs)
+	if err != nil {
+		return fmt.Errorf("读取问答记录失败: %w", err)
+	}
+
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	knowledgeBase, knowledgeTrash = splitKnowledgeTrash(items)
+	recentQAs = qas
+	for _, item := range items {
+		if item.ID >= nextKnowledgeID {
+			nextKnowledgeID = item.ID + 1
+		}
+	}
+	for _, qa := range recentQAs {
+		if qa.ID >= nextQAID {
+			nextQAID = qa.ID + 1
+		}
+	}
+
+	slog.Info("已从数据库加载数据", "driver", currentConfig().Storage.Driver, "knowledge", len(knowledgeBase), "trash", len(knowledgeTrash), "recent_qas", len(recentQAs))
+	return nil
+}
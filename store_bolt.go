@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bolt 数据库的默认文件名，位于数据目录下
+const boltDataFile = "ai-assistant.db"
+
+// bolt 中的桶名
+var (
+	boltKnowledgeBucket = []byte("knowledge")
+	boltQABucket        = []byte("qa_records")
+)
+
+// boltStore 基于 bbolt 的嵌入式存储后端：单个文件、支持事务、不依赖CGO
+// 记录以JSON保存，键为大端序的ID，启用数据加密时值也会加密
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBoltStore 打开 bolt 数据库文件，path 为空时使用数据目录下的默认文件
+func openBoltStore(path string) (*boltStore, error) {
+	if path == "" {
+		path = dataPath(boltDataFile)
+	}
+	db, err := bolt.Open(expandHome(path), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开 bolt 数据库失败: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltKnowledgeBucket, boltQABucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化 bolt 数据库失败: %w", err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+// boltKey 将ID编码为按数值排序的键
+func boltKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// Knowledge 返回全部知识库条目，包括回收站中的条目
+func (s *boltStore) Knowledge() ([]KnowledgeItem, error) {
+	items := []KnowledgeItem{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltKnowledgeBucket).ForEach(func(_, v []byte) error {
+			var item KnowledgeItem
+			if err := decodeBoltValue(v, &item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+// RecentQAs 返回最近的问答记录
+func (s *boltStore) RecentQAs(limit int) ([]QARecord, error) {
+	qas := []QARecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltQABucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(qas) < limit); k, v = c.Prev() {
+			var qa QARecord
+			if err := decodeBoltValue(v, &qa); err != nil {
+				return err
+			}
+			qas = append(qas, qa)
+		}
+		return nil
+	})
+	return qas, err
+}
+
+// Apply 持久化一条变更
+func (s *boltStore) Apply(entry JournalEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		switch entry.Op {
+		case journalOpQAAdd:
+			return putBoltValue(tx.Bucket(boltQABucket), entry.QA.ID, entry.QA, true)
+		case journalOpKnowledgeAdd, journalOpKnowledgeTrash, journalOpKnowledgeRestore, journalOpKnowledgeUpdate:
+			return putBoltValue(tx.Bucket(boltKnowledgeBucket), entry.Knowledge.ID, entry.Knowledge, true)
+		case journalOpKnowledgeDelete:
+			return tx.Bucket(boltKnowledgeBucket).Delete(boltKey(entry.ID))
+		}
+		return fmt.Errorf("未知的变更类型: %s", entry.Op)
+	})
+}
+
+// Import 在一个事务中导入数据并保留原有ID
+func (s *boltStore) Import(knowledge []KnowledgeItem, qas []QARecord, replace bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, item := range knowledge {
+			if err := putBoltValue(tx.Bucket(boltKnowledgeBucket), item.ID, item, replace); err != nil {
+				return fmt.Errorf("导入知识库条目 %d 失败: %w", item.ID, err)
+			}
+		}
+		for _, qa := range qas {
+			if err := putBoltValue(tx.Bucket(boltQABucket), qa.ID, qa, replace); err != nil {
+				return fmt.Errorf("导入问答记录 %d 失败: %w", qa.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Close 关闭数据库文件
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// putBoltValue 写入一条记录，replace 为 false 时ID已存在视为错误
+func putBoltValue(b *bolt.Bucket, id int, v interface{}, replace bool) error {
+	key := boltKey(id)
+	if !replace && b.Get(key) != nil {
+		return fmt.Errorf("ID %d 已存在", id)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if data, err = encryptData(data); err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// decodeBoltValue 解密（如果已加密）并解析一条记录
+func decodeBoltValue(data []byte, v interface{}) error {
+	data, err := decryptData(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
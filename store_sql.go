@@ -0,0 +1,286 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDataFile 未配置 storage.dsn 时数据目录下的 SQLite 数据库文件
+const sqliteDataFile = "ai-assistant.sqlite"
+
+// sqliteAddColumn 匹配建表语句中的补充列，SQLite 不支持 ADD COLUMN IF NOT EXISTS
+var sqliteAddColumn = regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+
+// 建表语句，ID由程序分配，不使用数据库自增
+var sqlStoreSchema = []string{
+	`CREATE TABLE IF NOT EXISTS knowledge_items (
+		id         INTEGER PRIMARY KEY,
+		title      TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		model      TEXT NOT NULL,
+		tags       TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS source_id INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS links TEXT NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS verification TEXT`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS quality TEXT`,
+	`ALTER TABLE knowledge_items ADD COLUMN IF NOT EXISTS draft BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS qa_records (
+		id         INTEGER PRIMARY KEY,
+		question   TEXT NOT NULL,
+		answer     TEXT NOT NULL,
+		model      TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		data       TEXT NOT NULL
+	)`,
+}
+
+// sqlStore 基于 database/sql 的存储后端
+type sqlStore struct {
+	db *sql.DB
+}
+
+// openSQLStore 连接数据库并建表，driver 为 postgres 或 sqlite
+func openSQLStore(driver, dsn string) (*sqlStore, error) {
+	if driver == storageDriverSQLite {
+		if dsn == "" {
+			dsn = dataPath(sqliteDataFile)
+		}
+		dsn = expandHome(dsn)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == storageDriverSQLite {
+		// SQLite 同一时间只允许一个写入，共用一个连接避免 database is locked
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+	for _, stmt := range sqlStoreSchema {
+		if driver == storageDriverSQLite {
+			if stmt, err = sqliteSchemaStatement(db, stmt); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("初始化数据库表失败: %w", err)
+			}
+			if stmt == "" {
+				continue
+			}
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("初始化数据库表失败: %w", err)
+		}
+	}
+	return &sqlStore{db: db}, nil
+}
+
+// sqliteSchemaStatement 把建表语句改写为 SQLite 的写法，列已经存在时返回空字符串
+// SQLite 只按声明类型 TIMESTAMP 把时间列读取为 time.Time，补充列需要先检查是否存在
+func sqliteSchemaStatement(db *sql.DB, stmt string) (string, error) {
+	stmt = strings.ReplaceAll(stmt, "TIMESTAMPTZ", "TIMESTAMP")
+	m := sqliteAddColumn.FindStringSubmatch(stmt)
+	if m == nil {
+		return stmt, nil
+	}
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`, m[1], m[2]).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists > 0 {
+		return "", nil
+	}
+	return strings.Replace(stmt, "ADD COLUMN IF NOT EXISTS", "ADD COLUMN", 1), nil
+}
+
+// Knowledge 返回全部知识库条目，包括回收站中的条目
+func (s *sqlStore) Knowledge() ([]KnowledgeItem, error) {
+	rows, err := s.db.Query(`SELECT id, title, content, model, tags, created_at, source_id, language, deleted_at, links, verification, quality, draft FROM knowledge_items ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []KnowledgeItem{}
+	for rows.Next() {
+		var item KnowledgeItem
+		var tags, links string
+		var deletedAt sql.NullTime
+		var verification, quality sql.NullString
+		if err := rows.Scan(&item.ID, &item.Title, &item.Content, &item.Model, &tags, &item.Timestamp, &item.SourceID, &item.Language,
+			&deletedAt, &links, &verification, &quality, &item.Draft); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(links), &item.Links); err != nil {
+			return nil, fmt.Errorf("知识库条目 %d 的关联格式错误: %w", item.ID, err)
+		}
+		if deletedAt.Valid {
+			item.DeletedAt = &deletedAt.Time
+		}
+		if verification.Valid {
+			if err := json.Unmarshal([]byte(verification.String), &item.Verification); err != nil {
+				return nil, fmt.Errorf("知识库条目 %d 的复核结果格式错误: %w", item.ID, err)
+			}
+		}
+		if quality.Valid {
+			if err := json.Unmarshal([]byte(quality.String), &item.Quality); err != nil {
+				return nil, fmt.Errorf("知识库条目 %d 的质量评分格式错误: %w", item.ID, err)
+			}
+		}
+		if err := json.Unmarshal([]byte(tags), &item.Tags); err != nil {
+			return nil, fmt.Errorf("知识库条目 %d 的标签格式错误: %w", item.ID, err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RecentQAs 返回最近的问答记录
+func (s *sqlStore) RecentQAs(limit int) ([]QARecord, error) {
+	query := `SELECT data FROM qa_records ORDER BY id DESC`
+	var args []interface{}
+	if limit > 0 {
+		query += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	qas := []QARecord{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var qa QARecord
+		if err := json.Unmarshal([]byte(data), &qa); err != nil {
+			return nil, fmt.Errorf("问答记录格式错误: %w", err)
+		}
+		qas = append(qas, qa)
+	}
+	return qas, rows.Err()
+}
+
+// Apply 持久化一条变更
+func (s *sqlStore) Apply(entry JournalEntry) error {
+	switch entry.Op {
+	case journalOpQAAdd:
+		return insertQARecord(s.db, *entry.QA, false)
+	case journalOpKnowledgeAdd:
+		return insertKnowledgeItem(s.db, *entry.Knowledge, false)
+	case journalOpKnowledgeDelete:
+		_, err := s.db.Exec(`DELETE FROM knowledge_items WHERE id = $1`, entry.ID)
+		return err
+	case journalOpKnowledgeUpdate:
+		return insertKnowledgeItem(s.db, *entry.Knowledge, true)
+	case journalOpKnowledgeTrash, journalOpKnowledgeRestore:
+		_, err := s.db.Exec(`UPDATE knowledge_items SET deleted_at = $2 WHERE id = $1`, entry.Knowledge.ID, entry.Knowledge.DeletedAt)
+		return err
+	}
+	return fmt.Errorf("未知的变更类型: %s", entry.Op)
+}
+
+// Import 在一个事务中导入数据并保留原有ID
+func (s *sqlStore) Import(knowledge []KnowledgeItem, qas []QARecord, replace bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range knowledge {
+		if err := insertKnowledgeItem(tx, item, replace); err != nil {
+			return fmt.Errorf("导入知识库条目 %d 失败: %w", item.ID, err)
+		}
+	}
+	for _, qa := range qas {
+		if err := insertQARecord(tx, qa, replace); err != nil {
+			return fmt.Errorf("导入问答记录 %d 失败: %w", qa.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Close 关闭数据库连接
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// sqlExecer 可以是 *sql.DB 或 *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertKnowledgeItem 写入一条知识库条目，replace 为 true 时覆盖ID相同的条目
+func insertKnowledgeItem(db sqlExecer, item KnowledgeItem, replace bool) error {
+	tags, err := json.Marshal(item.Tags)
+	if err != nil {
+		return err
+	}
+	links := []byte("[]")
+	if len(item.Links) > 0 {
+		if links, err = json.Marshal(item.Links); err != nil {
+			return err
+		}
+	}
+	verification, err := nullJSON(item.Verification)
+	if err != nil {
+		return err
+	}
+	quality, err := nullJSON(item.Quality)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO knowledge_items (id, title, content, model, tags, created_at, source_id, language, deleted_at, links, verification, quality, draft)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	if replace {
+		query += ` ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, content = EXCLUDED.content,
+			model = EXCLUDED.model, tags = EXCLUDED.tags, created_at = EXCLUDED.created_at,
+			source_id = EXCLUDED.source_id, language = EXCLUDED.language, deleted_at = EXCLUDED.deleted_at,
+			links = EXCLUDED.links, verification = EXCLUDED.verification, quality = EXCLUDED.quality, draft = EXCLUDED.draft`
+	}
+	_, err = db.Exec(query, item.ID, item.Title, item.Content, item.Model, string(tags), item.Timestamp, item.SourceID, item.Language, item.DeletedAt, string(links), verification, quality, item.Draft)
+	return err
+}
+
+// nullJSON 把可选的字段编码为 JSON，为空时写入 NULL
+func nullJSON[T any](v *T) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// insertQARecord 写入一条问答记录，replace 为 true 时覆盖ID相同的记录
+func insertQARecord(db sqlExecer, qa QARecord, replace bool) error {
+	data, err := json.Marshal(qa)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO qa_records (id, question, answer, model, created_at, data) VALUES ($1, $2, $3, $4, $5, $6)`
+	if replace {
+		query += ` ON CONFLICT (id) DO UPDATE SET question = EXCLUDED.question, answer = EXCLUDED.answer,
+			model = EXCLUDED.model, created_at = EXCLUDED.created_at, data = EXCLUDED.data`
+	}
+	_, err = db.Exec(query, qa.ID, qa.Question, qa.Answer, qa.Model, qa.Timestamp, string(data))
+	return err
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocert 证书缓存目录，位于数据目录下
+const autocertCacheDir = "autocert"
+
+// 收到退出信号后等待进行中的请求完成的最长时间
+const serverShutdownTimeout = 30 * time.Second
+
+// httpsEnabled 判断是否启用了内置 HTTPS
+func httpsEnabled(cfg *Config) bool {
+	return cfg.HTTPS.Enabled
+}
+
+// usesACME 判断是否通过 Let's Encrypt 自动申请证书
+func usesACME(cfg *Config) bool {
+	return len(cfg.HTTPS.ACME.Domains) > 0
+}
+
+// runServer 启动 HTTP 或 HTTPS 服务，收到 SIGINT 或 SIGTERM 时等待进行中的请求完成后返回
+// 监听 unix socket 时在退出前删除 socket 文件
+func runServer(handler http.Handler, cfg *Config) error {
+	ln, err := newListener(cfg)
+	if err != nil {
+		return err
+	}
+	if path, ok := unixSocketPath(listenAddress(cfg)); ok {
+		defer removeSocketFile(path)
+	}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		Protocols:         serverProtocols(cfg),
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		shutdownOnSignal(srv)
+	}()
+	if err := serve(srv, ln, cfg); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// shutdownOnSignal 收到退出信号后关闭服务，不再接受新的连接并等待进行中的请求完成
+func shutdownOnSignal(srv *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	signal.Stop(signals)
+	slog.Info("收到退出信号，等待进行中的请求完成", "signal", sig.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("等待请求完成超时，强制关闭连接", "error", err)
+		srv.Close()
+	}
+}
+
+// removeSocketFile 删除 unix socket 文件，文件已经不存在时忽略
+func removeSocketFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("删除 socket 文件失败", "path", path, "error", err)
+	}
+}
+
+// serve 在监听上提供 HTTP 或 HTTPS 服务，直到服务关闭
+func serve(srv *http.Server, ln net.Listener, cfg *Config) error {
+	if !httpsEnabled(cfg) {
+		slog.Info("服务器启动", "address", displayAddress(cfg, "http"), "version", version)
+		return srv.Serve(ln)
+	}
+
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if usesACME(cfg) {
+		cacheDir := expandHome(cfg.HTTPS.ACME.CacheDir)
+		if cacheDir == "" {
+			cacheDir = dataPath(autocertCacheDir)
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.HTTPS.ACME.Domains...),
+			Cache:      autocert.DirCache(filepath.Clean(cacheDir)),
+			Email:      cfg.HTTPS.ACME.Email,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+		// HTTP 端口用于 http-01 验证，其它请求跳转到 HTTPS
+		if cfg.HTTPS.HTTPPort != "" {
+			go serveHTTPRedirect(cfg, manager.HTTPHandler(nil))
+		}
+		slog.Info("服务器启动", "address", displayAddress(cfg, "https"), "domains", cfg.HTTPS.ACME.Domains, "cache_dir", cacheDir, "version", version)
+		return srv.ServeTLS(ln, "", "")
+	}
+
+	if cfg.HTTPS.HTTPPort != "" {
+		go serveHTTPRedirect(cfg, http.HandlerFunc(redirectToHTTPS))
+	}
+	slog.Info("服务器启动", "address", displayAddress(cfg, "https"), "cert_file", cfg.HTTPS.CertFile, "version", version)
+	return srv.ServeTLS(ln, cfg.HTTPS.CertFile, cfg.HTTPS.KeyFile)
+}
+
+// serverProtocols 返回服务支持的协议
+// HTTPS 默认同时支持 HTTP/1.1 和 HTTP/2；开启 server.h2c 后明文端口也接受 HTTP/2（需要客户端直接使用 HTTP/2，
+// 一般是反向代理），这样大量并发的流式请求可以复用同一个连接，不受浏览器每个主机 6 个连接的限制
+func serverProtocols(cfg *Config) *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(!cfg.Server.DisableHTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.Server.H2C && !cfg.Server.DisableHTTP2)
+	return protocols
+}
+
+// serveHTTPRedirect 在 https.http_port 上监听明文 HTTP
+func serveHTTPRedirect(cfg *Config, handler http.Handler) {
+	address := cfg.Server.Host + cfg.HTTPS.HTTPPort
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("HTTP 跳转服务启动", "address", "http://"+address)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP 跳转服务退出", "error", err)
+	}
+}
+
+// redirectToHTTPS 把明文请求跳转到 HTTPS 地址
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	target := "https://" + hostWithPort(r.Host, currentConfig().Server.Port) + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// hostWithPort 把请求中的主机名换成 HTTPS 端口，443 时省略端口
+func hostWithPort(host, port string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port == ":443" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strings.TrimPrefix(port, ":"))
+}
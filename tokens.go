@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// 无法确定模型的编码时使用的编码，此时结果只是估算
+const defaultTokenEncoding = tiktoken.MODEL_CL100K_BASE
+
+// 可以在 models.encodings 中配置的编码
+var tokenEncodings = []string{
+	tiktoken.MODEL_O200K_BASE,
+	tiktoken.MODEL_CL100K_BASE,
+	tiktoken.MODEL_P50K_BASE,
+	tiktoken.MODEL_P50K_EDIT,
+	tiktoken.MODEL_R50K_BASE,
+}
+
+// 按 OpenAI 的计算方式，每条消息额外占用的 token 数，以及回复开头占用的 token 数
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// 已加载的编码，首次加载需要解析词表，之后复用
+var (
+	tokenEncodersMu sync.Mutex
+	tokenEncoders   = map[string]*tiktoken.Tiktoken{}
+)
+
+func init() {
+	// 使用编译进程序的词表，不在运行时下载
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// TokenCountMessage 需要计算 token 数的一条消息
+type TokenCountMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// TokenCountRequest token 计数请求，text 和 messages 只能提供其中一个
+type TokenCountRequest struct {
+	Text     string              `json:"text"`
+	Messages []TokenCountMessage `json:"messages"`
+	// 为空时计算全部可用模型
+	Models []string `json:"models"`
+	// 为 true 时把服务端添加的系统提示词也计算在内
+	IncludeSystemPrompt bool `json:"include_system_prompt"`
+}
+
+// TokenCount 一个模型的 token 数
+type TokenCount struct {
+	Model    string `json:"model"`
+	Encoding string `json:"encoding"`
+	Tokens   int    `json:"tokens"`
+	// 模型不使用 tiktoken 编码时为 true，结果只是估算
+	Estimated bool `json:"estimated,omitempty"`
+	// 配置了 models.settings 中的 context_window 时返回上下文长度和是否放得下
+	ContextWindow int   `json:"context_window,omitempty"`
+	Fits          *bool `json:"fits,omitempty"`
+}
+
+// tokenCountHandler 按模型计算文本或消息列表的 token 数，便于客户端估算费用和检查上下文长度
+func tokenCountHandler(c *gin.Context) {
+	var req TokenCountRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if (req.Text == "") == (len(req.Messages) == 0) {
+		respondError(c, http.StatusBadRequest, tr(c, "error.token_count_source"))
+		return
+	}
+	cfg := currentConfig()
+	if len(req.Models) == 0 {
+		req.Models = availableModels(cfg)
+	}
+	for _, model := range req.Models {
+		if !isModelAvailable(cfg, model) && model != cfg.Embeddings.Model {
+			respondError(c, http.StatusBadRequest, tr(c, "error.model_unavailable", model))
+			return
+		}
+	}
+
+	messages := req.Messages
+	if req.IncludeSystemPrompt {
+		messages = append([]TokenCountMessage{{Role: "system", Content: systemPrompt()}}, messages...)
+		if req.Text != "" {
+			messages = append(messages, TokenCountMessage{Role: "user", Content: req.Text})
+		}
+	}
+
+	results := make([]TokenCount, 0, len(req.Models))
+	for _, model := range req.Models {
+		encoding, estimated := tokenEncodingFor(cfg, model)
+		enc, err := tokenEncoder(encoding)
+		if err != nil {
+			requestLogger(c).Error("加载 token 编码失败", "encoding", encoding, "error", err)
+			respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+			return
+		}
+		count := TokenCount{Model: model, Encoding: encoding, Estimated: estimated}
+		if len(messages) > 0 {
+			count.Tokens = countMessageTokens(enc, messages)
+		} else {
+			count.Tokens = len(enc.EncodeOrdinary(req.Text))
+		}
+		if window := cfg.Models.Settings[model].ContextWindow; window > 0 {
+			fits := count.Tokens <= window
+			count.ContextWindow, count.Fits = window, &fits
+		}
+		results = append(results, count)
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// countMessageTokens 按 OpenAI 的计算方式统计消息列表的 token 数，包括每条消息的格式开销和回复的开头
+func countMessageTokens(enc *tiktoken.Tiktoken, messages []TokenCountMessage) int {
+	total := tokensPerReply
+	for _, m := range messages {
+		total += tokensPerMessage + len(enc.EncodeOrdinary(m.Role)) + len(enc.EncodeOrdinary(m.Content))
+	}
+	return total
+}
+
+// tokenEncodingFor 返回模型使用的编码，优先使用 models.encodings 的配置
+// 模型名可以带有服务商前缀（如 openai/gpt-4o），无法识别时使用 cl100k_base 并标记为估算
+func tokenEncodingFor(cfg *Config, model string) (string, bool) {
+	if encoding, ok := cfg.Models.Encodings[model]; ok {
+		return encoding, false
+	}
+	name := model[strings.LastIndex(model, "/")+1:]
+	if encoding, ok := tiktoken.MODEL_TO_ENCODING[name]; ok {
+		return encoding, false
+	}
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(name, prefix) {
+			return encoding, false
+		}
+	}
+	return defaultTokenEncoding, true
+}
+
+// tokenEncoder 返回编码对应的分词器，首次使用时加载
+func tokenEncoder(encoding string) (*tiktoken.Tiktoken, error) {
+	tokenEncodersMu.Lock()
+	defer tokenEncodersMu.Unlock()
+	if enc, ok := tokenEncoders[encoding]; ok {
+		return enc, nil
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	tokenEncoders[encoding] = enc
+	return enc, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的回收站操作
+const (
+	auditActionKnowledgeRestore = "knowledge.restore"
+	auditActionKnowledgePurge   = "knowledge.purge"
+)
+
+// 未配置 storage.trash_days 时回收站中的条目保留的天数
+const defaultTrashDays = 30
+
+// 多久检查一次回收站中过期的条目
+const trashPurgeInterval = time.Hour
+
+// 回收站中的知识库条目，按ID排序，与 knowledgeBase 一起保存在知识库数据文件中
+var knowledgeTrash []KnowledgeItem
+
+// TrashItem 回收站中的条目和自动清除的时间
+type TrashItem struct {
+	KnowledgeItem
+	// 不会自动清除时为空
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// trashDays 返回回收站中的条目保留的天数，小于 0 表示不自动清除
+func trashDays(cfg *Config) int {
+	if cfg.Storage.TrashDays == 0 {
+		return defaultTrashDays
+	}
+	return cfg.Storage.TrashDays
+}
+
+// storedKnowledgeItems 返回需要保存的全部条目，包括回收站中的条目，调用方需持有 dataMu
+func storedKnowledgeItems() []KnowledgeItem {
+	items := make([]KnowledgeItem, 0, len(knowledgeBase)+len(knowledgeTrash))
+	items = append(items, knowledgeBase...)
+	return append(items, knowledgeTrash...)
+}
+
+// splitKnowledgeTrash 把读取的条目分为知识库和回收站
+func splitKnowledgeTrash(items []KnowledgeItem) (live, trash []KnowledgeItem) {
+	live = []KnowledgeItem{}
+	for _, item := range items {
+		if item.DeletedAt != nil {
+			trash = append(trash, item)
+		} else {
+			live = append(live, item)
+		}
+	}
+	sort.Slice(trash, func(i, j int) bool {
+		return trash[i].ID < trash[j].ID
+	})
+	return live, trash
+}
+
+// removeKnowledgeItem 从列表中移除ID对应的条目
+func removeKnowledgeItem(items []KnowledgeItem, id int) []KnowledgeItem {
+	for i, item := range items {
+		if item.ID == id {
+			return append(items[:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// insertKnowledgeItemSorted 按ID顺序插入条目，ID已存在时替换
+func insertKnowledgeItemSorted(items []KnowledgeItem, item KnowledgeItem) []KnowledgeItem {
+	i := sort.Search(len(items), func(i int) bool {
+		return items[i].ID >= item.ID
+	})
+	if i < len(items) && items[i].ID == item.ID {
+		items[i] = item
+		return items
+	}
+	items = append(items, KnowledgeItem{})
+	copy(items[i+1:], items[i:])
+	items[i] = item
+	return items
+}
+
+// trashKnowledgeItem 把知识库条目移到回收站，条目不存在时返回 errKnowledgeNotFound，只读模式下返回 errReadOnly
+func trashKnowledgeItem(id int) (KnowledgeItem, error) {
+	if readOnly(currentConfig()) {
+		return KnowledgeItem{}, errReadOnly
+	}
+	dataMu.Lock()
+	var trashed KnowledgeItem
+	found := false
+	for _, item := range knowledgeBase {
+		if item.ID == id {
+			trashed, found = item, true
+			break
+		}
+	}
+	if found {
+		now := time.Now()
+		trashed.DeletedAt = &now
+		commitJournalEntry(JournalEntry{Op: journalOpKnowledgeTrash, Knowledge: &trashed})
+	}
+	dataMu.Unlock()
+
+	if found {
+		invalidateRAGIndex()
+		maybeCompact()
+		publishEvent(eventKnowledgeDeleted, trashed)
+	}
+	if !found {
+		return trashed, errKnowledgeNotFound
+	}
+	return trashed, nil
+}
+
+// restoreKnowledgeItem 把回收站中的条目恢复到知识库，条目不在回收站中时返回 errKnowledgeNotFound，只读模式下返回 errReadOnly
+func restoreKnowledgeItem(id int) (KnowledgeItem, error) {
+	if readOnly(currentConfig()) {
+		return KnowledgeItem{}, errReadOnly
+	}
+	dataMu.Lock()
+	var restored KnowledgeItem
+	found := false
+	for _, item := range knowledgeTrash {
+		if item.ID == id {
+			restored, found = item, true
+			break
+		}
+	}
+	if found {
+		restored.DeletedAt = nil
+		commitJournalEntry(JournalEntry{Op: journalOpKnowledgeRestore, Knowledge: &restored})
+	}
+	dataMu.Unlock()
+
+	if found {
+		invalidateRAGIndex()
+		maybeCompact()
+		publishEvent(eventKnowledgeAdded, restored)
+	}
+	if !found {
+		return restored, errKnowledgeNotFound
+	}
+	return restored, nil
+}
+
+// purgeKnowledgeItem 永久删除回收站中的条目，条目不在回收站中时返回 errKnowledgeNotFound，只读模式下返回 errReadOnly
+// 移到回收站时已经发送过 knowledge.deleted 通知，这里不再发送
+func purgeKnowledgeItem(id int) (KnowledgeItem, error) {
+	if readOnly(currentConfig()) {
+		return KnowledgeItem{}, errReadOnly
+	}
+	dataMu.Lock()
+	var purged KnowledgeItem
+	found := false
+	for _, item := range knowledgeTrash {
+		if item.ID == id {
+			purged, found = item, true
+			break
+		}
+	}
+	if found {
+		commitJournalEntry(JournalEntry{Op: journalOpKnowledgeDelete, ID: id})
+	}
+	dataMu.Unlock()
+
+	if found {
+		maybeCompact()
+	}
+	if !found {
+		return purged, errKnowledgeNotFound
+	}
+	return purged, nil
+}
+
+// purgeExpiredTrash 永久删除在回收站中超过保留天数的条目，返回删除的条数
+func purgeExpiredTrash(cfg *Config) int {
+	days := trashDays(cfg)
+	if days < 0 {
+		return 0
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	var expired []int
+	dataMu.RLock()
+	for _, item := range knowledgeTrash {
+		if item.DeletedAt.Before(cutoff) {
+			expired = append(expired, item.ID)
+		}
+	}
+	dataMu.RUnlock()
+
+	count := 0
+	for _, id := range expired {
+		if _, err := purgeKnowledgeItem(id); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// purgeTrashPeriodically 定期清除回收站中过期的条目，只读模式下跳过
+func purgeTrashPeriodically() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if cfg := currentConfig(); !readOnly(cfg) {
+			if n := purgeExpiredTrash(cfg); n > 0 {
+				slog.Info("已清除回收站中过期的知识库条目", "count", n)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// knowledgeTrashHandler 返回回收站中的条目，最近删除的在前
+func knowledgeTrashHandler(c *gin.Context) {
+	days := trashDays(currentConfig())
+	dataMu.RLock()
+	items := make([]TrashItem, 0, len(knowledgeTrash))
+	for _, item := range knowledgeTrash {
+		trashItem := TrashItem{KnowledgeItem: item}
+		if days >= 0 {
+			purgeAt := item.DeletedAt.AddDate(0, 0, days)
+			trashItem.PurgeAt = &purgeAt
+		}
+		items = append(items, trashItem)
+	}
+	dataMu.RUnlock()
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(*items[j].DeletedAt)
+	})
+	c.JSON(http.StatusOK, gin.H{"trash": items})
+}
+
+// restoreKnowledgeHandler 把回收站中的条目恢复到知识库
+func restoreKnowledgeHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.trash_item_not_found"))
+		return
+	}
+	item, err := restoreKnowledgeItem(id)
+	if errors.Is(err, errKnowledgeNotFound) {
+		respondError(c, http.StatusNotFound, tr(c, "error.trash_item_not_found"))
+		return
+	}
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgeRestore, err)
+		return
+	}
+	recordAudit(c, auditActionKnowledgeRestore, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.knowledge_restored"),
+		"item":    item,
+	})
+}
+
+// purgeKnowledgeHandler 永久删除回收站中的条目，之后只能在撤销令牌的有效期内恢复
+func purgeKnowledgeHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.trash_item_not_found"))
+		return
+	}
+	item, err := purgeKnowledgeItem(id)
+	if errors.Is(err, errKnowledgeNotFound) {
+		respondError(c, http.StatusNotFound, tr(c, "error.trash_item_not_found"))
+		return
+	}
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgePurge, err)
+		return
+	}
+	target := fmt.Sprintf("knowledge/%d", item.ID)
+	recordAudit(c, auditActionKnowledgePurge, target, item.Title, http.StatusOK)
+	// 撤销时放回回收站
+	respondWithUndo(c, gin.H{"message": tr(c, "message.knowledge_purged")}, undoKindKnowledgePurge, target, func() error {
+		return unpurgeKnowledgeItem(item)
+	})
+}
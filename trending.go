@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定时统计的时间范围、返回的条数和最少的提问次数
+const (
+	defaultTrendingWindow   = 7 * 24 * time.Hour
+	defaultTrendingLimit    = 20
+	defaultTrendingMinCount = 2
+)
+
+// 每个热门问题最多返回的问答记录ID数
+const trendingRecordIDs = 20
+
+// TrendingQuestion 一段时间内反复出现的问题，忽略大小写、标点和空白后相同的问题算作同一个
+type TrendingQuestion struct {
+	// 规范化后的问题，发布为知识库条目时使用
+	Key string `json:"key"`
+	// 最近一次提问的原文
+	Question   string    `json:"question"`
+	Count      int       `json:"count"`
+	FirstAsked time.Time `json:"first_asked"`
+	LastAsked  time.Time `json:"last_asked"`
+	// 最近的问答记录ID，最新的在前
+	RecordIDs []int `json:"record_ids"`
+	// 最佳回答：优先使用标准数据集中审核过的回答，其次是评审模型评分最高、没有被标记、最近的回答
+	BestRecordID int    `json:"best_record_id"`
+	BestAnswer   string `json:"best_answer"`
+	// 最佳回答已经在知识库中时为对应条目的ID
+	KnowledgeID int `json:"knowledge_id,omitempty"`
+	// 最佳回答使用的模型，发布为知识库条目时使用
+	model string
+}
+
+// PublishTrendingRequest 把热门问题的最佳回答发布为知识库条目的请求
+type PublishTrendingRequest struct {
+	Key string `json:"key" binding:"required"`
+	// 统计的时间范围，应与查询热门问题时相同，默认 168h
+	Window string `json:"window"`
+	// 为空时使用问题作为标题
+	Title string `json:"title"`
+	Tags  string `json:"tags"`
+}
+
+// trendingHandler 返回时间范围内提问次数最多的问题，查询参数：window、limit、min_count
+func trendingHandler(c *gin.Context) {
+	if !requireQAHistory(c) {
+		return
+	}
+	window, ok := parseTrendingWindow(c, c.Query("window"))
+	if !ok {
+		return
+	}
+	limit := defaultTrendingLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+	minCount := defaultTrendingMinCount
+	if v := c.Query("min_count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.min_count_invalid"))
+			return
+		}
+		minCount = n
+	}
+
+	questions, err := trendingQuestions(time.Now().Add(-window), minCount)
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	total := len(questions)
+	if len(questions) > limit {
+		questions = questions[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"window":    window.String(),
+		"total":     total,
+		"questions": questions,
+	})
+}
+
+// publishTrendingHandler 把热门问题的最佳回答保存为知识库条目，最佳回答已经在知识库中时返回 409
+func publishTrendingHandler(c *gin.Context) {
+	var req PublishTrendingRequest
+	if !bindJSON(c, &req) || !requireQAHistory(c) {
+		return
+	}
+	window, ok := parseTrendingWindow(c, req.Window)
+	if !ok {
+		return
+	}
+	questions, err := trendingQuestions(time.Now().Add(-window), 1)
+	if err != nil {
+		requestLogger(c).Error("读取问答记录失败", "error", err)
+		respondError(c, http.StatusInternalServerError, tr(c, "error.internal"))
+		return
+	}
+	var trending *TrendingQuestion
+	for i := range questions {
+		if questions[i].Key == req.Key {
+			trending = &questions[i]
+			break
+		}
+	}
+	if trending == nil {
+		respondError(c, http.StatusNotFound, tr(c, "error.trending_not_found"))
+		return
+	}
+	if trending.KnowledgeID != 0 {
+		respondError(c, http.StatusConflict, tr(c, "error.trending_published", trending.KnowledgeID))
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = askDefaultTitle(trending.Question)
+	}
+	item, err := addKnowledgeItem(KnowledgeItem{
+		Title:     title,
+		Content:   trending.BestAnswer,
+		Model:     trending.model,
+		Timestamp: time.Now(),
+		Tags:      splitTags(req.Tags),
+	})
+	if err != nil {
+		respondKnowledgeWriteError(c, auditActionKnowledgeAdd, err)
+		return
+	}
+
+	recordAudit(c, auditActionKnowledgeAdd, fmt.Sprintf("knowledge/%d", item.ID), fmt.Sprintf("trending=%q record_id=%d", trending.Key, trending.BestRecordID), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.knowledge_added"),
+		"item":    item,
+	})
+}
+
+// parseTrendingWindow 解析统计的时间范围，为空时使用默认值，无效时返回错误响应
+func parseTrendingWindow(c *gin.Context, v string) (time.Duration, bool) {
+	if v == "" {
+		return defaultTrendingWindow, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		respondError(c, http.StatusBadRequest, tr(c, "error.window_invalid", v))
+		return 0, false
+	}
+	return d, true
+}
+
+// trendingQuestions 按规范化后的问题对 since 之后的问答记录分组，返回提问次数不少于 minCount 的问题，
+// 按次数从多到少排列，次数相同时最近提问的在前；需要数据库存储，数据文件只保存最近的问答
+func trendingQuestions(since time.Time, minCount int) ([]TrendingQuestion, error) {
+	if store == nil {
+		return nil, errQAHistoryUnavailable
+	}
+	records, err := allQARecords()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ID > records[j].ID
+	})
+
+	groups := map[string][]QARecord{}
+	var keys []string
+	for _, record := range records {
+		if record.Timestamp.Before(since) {
+			continue
+		}
+		key := normalizeQuestion(record.Question)
+		if key == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+
+	curatedAnswers := map[int]string{}
+	curationMu.Lock()
+	for _, example := range goldenDataset {
+		if example.curated() {
+			curatedAnswers[example.RecordID] = example.Answer
+		}
+	}
+	curationMu.Unlock()
+	knowledgeIDs := map[string]int{}
+	dataMu.RLock()
+	for _, item := range knowledgeBase {
+		knowledgeIDs[item.Content] = item.ID
+	}
+	dataMu.RUnlock()
+
+	questions := []TrendingQuestion{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < minCount {
+			continue
+		}
+		// 分组中的记录按ID从新到旧排列
+		trending := TrendingQuestion{
+			Key:        key,
+			Question:   group[0].Question,
+			Count:      len(group),
+			FirstAsked: group[len(group)-1].Timestamp,
+			LastAsked:  group[0].Timestamp,
+		}
+		for _, record := range group[:min(len(group), trendingRecordIDs)] {
+			trending.RecordIDs = append(trending.RecordIDs, record.ID)
+		}
+		best := bestTrendingAnswer(group, curatedAnswers)
+		trending.BestRecordID, trending.BestAnswer, trending.model = best.ID, best.Answer, best.Model
+		if answer, ok := curatedAnswers[best.ID]; ok {
+			trending.BestAnswer = answer
+		}
+		trending.KnowledgeID = knowledgeIDs[trending.BestAnswer]
+		questions = append(questions, trending)
+	}
+	sort.SliceStable(questions, func(i, j int) bool {
+		if questions[i].Count != questions[j].Count {
+			return questions[i].Count > questions[j].Count
+		}
+		return questions[i].LastAsked.After(questions[j].LastAsked)
+	})
+	return questions, nil
+}
+
+// bestTrendingAnswer 从同一问题的问答记录中选出最佳回答，records 按从新到旧排列
+func bestTrendingAnswer(records []QARecord, curatedAnswers map[int]string) QARecord {
+	rank := func(r QARecord) (int, float64) {
+		if _, ok := curatedAnswers[r.ID]; ok {
+			return 3, 0
+		}
+		if strings.TrimSpace(r.Answer) == "" {
+			return 0, 0
+		}
+		if r.Flagged {
+			return 1, 0
+		}
+		if r.Judge != nil {
+			return 2, r.Judge.Score
+		}
+		return 2, -1
+	}
+	best := records[0]
+	bestTier, bestScore := rank(best)
+	for _, record := range records[1:] {
+		if tier, score := rank(record); tier > bestTier || (tier == bestTier && score > bestScore) {
+			best, bestTier, bestScore = record, tier, score
+		}
+	}
+	return best
+}
+
+// normalizeQuestion 规范化问题用于去重：转为小写，去掉标点和符号，合并空白，汉字与相邻的字之间不保留空白
+func normalizeQuestion(question string) string {
+	var b strings.Builder
+	var last rune
+	space := false
+	for _, r := range strings.ToLower(question) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			space = true
+			continue
+		}
+		if space && last != 0 && !unicode.Is(unicode.Han, last) && !unicode.Is(unicode.Han, r) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		last, space = r, false
+	}
+	return b.String()
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tuiMode 终端界面当前的操作模式
+type tuiMode int
+
+const (
+	// 输入问题
+	tuiModeInput tuiMode = iota
+	// 浏览当前对话，可以保存回答、切换模型
+	tuiModeNormal
+	// 浏览历史问答记录
+	tuiModeHistory
+)
+
+// 标题栏、状态栏、输入框和帮助各占一行
+const tuiChromeLines = 4
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	tuiQuestionStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	tuiAnswerStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	tuiMutedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	tuiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+)
+
+// tuiTurn 当前会话中的一轮问答
+type tuiTurn struct {
+	Question string
+	Answer   string
+	Model    string
+	RecordID int
+	SavedID  int
+	Err      string
+}
+
+// tuiDeltaMsg 流式回答中的一段内容，seq 用于丢弃已取消的提问送回的内容
+type tuiDeltaMsg struct {
+	seq  int
+	text string
+}
+
+// tuiDoneMsg 一次提问结束
+type tuiDoneMsg struct {
+	seq    int
+	resp   *ChatResponse
+	record QARecord
+	err    *chatError
+}
+
+// tuiModel 终端聊天界面的状态
+type tuiModel struct {
+	mode     tuiMode
+	models   []string
+	modelIdx int
+
+	input    textinput.Model
+	view     viewport.Model
+	width    int
+	turns    []tuiTurn
+	records  map[int]QARecord
+	status   string
+	ready    bool
+	quitting bool
+
+	// 正在进行的提问
+	seq       int
+	streaming bool
+	cancel    context.CancelFunc
+	events    chan tea.Msg
+
+	history    []QARecord
+	historyIdx int
+}
+
+// tuiCommand 在终端中与模型对话，支持流式输出、切换模型、浏览历史记录和保存到知识库
+// 与服务端共用配置、存储和模型调用，需要独占数据目录
+//
+//	ai-assistant tui [-config config.yaml] [-data-dir ...] [-model ...]
+func tuiCommand(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	model := fs.String("model", "", "初始使用的模型，默认为配置中的 models.default")
+	fs.StringVar(&configFile, "config", configFile, "配置文件路径")
+	fs.StringVar(&dataDirFlag, "data-dir", "", "数据目录，默认使用配置文件中的 storage.data_dir")
+	fs.Parse(args)
+
+	cfg, closeData, err := openLocalData()
+	if err != nil {
+		exitWithError(err)
+	}
+	defer closeData()
+
+	// 日志会打乱界面，数据加载完成后不再输出
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	m := newTUIModel(cfg, *model)
+	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+		exitWithError(err)
+	}
+}
+
+// newTUIModel 创建界面状态，未指定模型或模型不可用时使用默认模型
+func newTUIModel(cfg *Config, model string) *tuiModel {
+	model = resolveModel(cfg, model)
+	if !containsString(cfg.Models.Available, model) {
+		model = cfg.Models.Default
+	}
+	m := &tuiModel{
+		models:  cfg.Models.Available,
+		records: map[int]QARecord{},
+		input:   textinput.New(),
+		view:    viewport.New(0, 0),
+	}
+	for i, name := range m.models {
+		if name == model {
+			m.modelIdx = i
+		}
+	}
+	m.input.Prompt = "> "
+	m.input.Placeholder = "输入问题，回车发送"
+	m.input.CharLimit = maxMessageChars(cfg)
+	m.input.Focus()
+	return m
+}
+
+// Init 实现 tea.Model
+func (m *tuiModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// Update 实现 tea.Model
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.view.Width = msg.Width
+		m.view.Height = max(msg.Height-tuiChromeLines, 1)
+		m.input.Width = max(msg.Width-len(m.input.Prompt)-1, 1)
+		m.ready = true
+		m.refresh()
+		return m, nil
+
+	case tuiDeltaMsg:
+		if msg.seq != m.seq || !m.streaming {
+			return m, nil
+		}
+		if n := len(m.turns); n > 0 {
+			m.turns[n-1].Answer += msg.text
+			m.refresh()
+		}
+		return m, waitTUIEvent(m.events)
+
+	case tuiDoneMsg:
+		if msg.seq == m.seq && m.streaming {
+			m.finishTurn(msg)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.stopStreaming()
+			m.quitting = true
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case tuiModeInput:
+			return m.updateInput(msg)
+		case tuiModeNormal:
+			return m.updateNormal(msg)
+		case tuiModeHistory:
+			return m.updateHistory(msg)
+		}
+	}
+	return m, nil
+}
+
+// updateInput 输入模式下的按键
+func (m *tuiModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		question := strings.TrimSpace(m.input.Value())
+		if question == "" || m.streaming {
+			return m, nil
+		}
+		m.input.Reset()
+		return m, m.ask(question)
+	case "esc":
+		if m.streaming {
+			m.stopStreaming()
+			m.status = "已取消"
+			return m, nil
+		}
+		m.setMode(tuiModeNormal)
+		return m, nil
+	case "tab":
+		m.nextModel()
+		return m, nil
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.view, cmd = m.view.Update(msg)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updateNormal 浏览模式下的按键
+func (m *tuiModel) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "i", "enter":
+		m.setMode(tuiModeInput)
+		return m, textinput.Blink
+	case "k":
+		m.saveLastTurn()
+		return m, nil
+	case "m", "tab":
+		m.nextModel()
+		return m, nil
+	case "h":
+		m.openHistory()
+		return m, nil
+	case "q":
+		m.stopStreaming()
+		m.quitting = true
+		return m, tea.Quit
+	}
+	var cmd tea.Cmd
+	m.view, cmd = m.view.Update(msg)
+	return m, cmd
+}
+
+// updateHistory 历史记录模式下的按键
+func (m *tuiModel) updateHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up":
+		m.historyIdx = max(m.historyIdx-1, 0)
+	case "down":
+		m.historyIdx = min(m.historyIdx+1, max(len(m.history)-1, 0))
+	case "enter":
+		// 把选中的记录放到当前对话中查看
+		if len(m.history) > 0 {
+			record := m.history[m.historyIdx]
+			m.records[record.ID] = record
+			m.turns = append(m.turns, tuiTurn{Question: record.Question, Answer: record.Answer, Model: record.Model, RecordID: record.ID})
+			m.setMode(tuiModeNormal)
+		}
+	case "k":
+		if len(m.history) > 0 {
+			record := m.history[m.historyIdx]
+			if item, err := saveRecordToKnowledge(record); err != nil {
+				m.status = "未能保存到知识库：" + err.Error()
+			} else {
+				m.status = fmt.Sprintf("问答记录 %d 已保存到知识库（ID %d）", record.ID, item.ID)
+			}
+		}
+	case "esc", "q", "h":
+		m.setMode(tuiModeNormal)
+	}
+	m.refresh()
+	return m, nil
+}
+
+// ask 在后台提问，回答通过 events 逐段送回界面
+func (m *tuiModel) ask(question string) tea.Cmd {
+	model := m.models[m.modelIdx]
+	m.turns = append(m.turns, tuiTurn{Question: question, Model: model})
+	m.status = "正在回答，Esc 取消"
+	m.streaming = true
+	m.refresh()
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	events := make(chan tea.Msg, 64)
+	m.seq++
+	seq := m.seq
+	m.cancel = cancel
+	m.events = events
+
+	go func() {
+		defer close(events)
+		resp, record, chatErr := processChatStream(ctx, ChatRequest{Message: question, Model: model}, "", func(delta string) {
+			select {
+			case events <- tuiDeltaMsg{seq: seq, text: delta}:
+			case <-ctx.Done():
+			}
+		})
+		select {
+		case events <- tuiDoneMsg{seq: seq, resp: resp, record: record, err: chatErr}:
+		case <-ctx.Done():
+		}
+	}()
+	return waitTUIEvent(events)
+}
+
+// waitTUIEvent 等待后台提问的下一个事件
+func waitTUIEvent(events chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// finishTurn 提问结束后用过滤后的最终回答替换流式内容
+func (m *tuiModel) finishTurn(msg tuiDoneMsg) {
+	m.stopStreaming()
+	n := len(m.turns)
+	if n == 0 {
+		return
+	}
+	turn := &m.turns[n-1]
+	if msg.err != nil {
+		turn.Err = msg.err.Message
+		m.status = "提问失败"
+	} else {
+		turn.Answer = msg.resp.Response
+		turn.RecordID = msg.record.ID
+		m.records[msg.record.ID] = msg.record
+		m.status = fmt.Sprintf("完成，%s；Esc 后按 k 保存到知识库", formatTUIUsage(msg.resp.Usage))
+		if len(msg.resp.Warnings) > 0 {
+			m.status += "；" + strings.Join(msg.resp.Warnings, "，")
+		}
+	}
+	m.refresh()
+}
+
+// stopStreaming 取消正在进行的提问
+func (m *tuiModel) stopStreaming() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.streaming = false
+}
+
+// saveLastTurn 把当前对话中最后一个成功的回答保存到知识库
+func (m *tuiModel) saveLastTurn() {
+	for i := len(m.turns) - 1; i >= 0; i-- {
+		turn := &m.turns[i]
+		if turn.RecordID == 0 {
+			continue
+		}
+		if turn.SavedID != 0 {
+			m.status = fmt.Sprintf("该回答已保存到知识库（ID %d）", turn.SavedID)
+			return
+		}
+		item, err := saveRecordToKnowledge(m.records[turn.RecordID])
+		if err != nil {
+			m.status = "未能保存到知识库：" + err.Error()
+			return
+		}
+		turn.SavedID = item.ID
+		m.status = fmt.Sprintf("已保存到知识库（ID %d）", item.ID)
+		m.refresh()
+		return
+	}
+	m.status = "没有可以保存的回答"
+}
+
+// saveRecordToKnowledge 把问答记录保存为知识库条目，标题取问题开头
+func saveRecordToKnowledge(record QARecord) (KnowledgeItem, error) {
+	return addKnowledgeItem(KnowledgeItem{
+		Title:     askDefaultTitle(record.Question),
+		Content:   record.Answer,
+		Model:     record.Model,
+		Timestamp: time.Now(),
+	})
+}
+
+// nextModel 切换到下一个可用模型
+func (m *tuiModel) nextModel() {
+	if len(m.models) == 0 {
+		return
+	}
+	m.modelIdx = (m.modelIdx + 1) % len(m.models)
+	m.status = "已切换到 " + m.models[m.modelIdx]
+}
+
+// openHistory 读取问答记录并进入历史记录模式，最新的记录在前
+func (m *tuiModel) openHistory() {
+	records, err := allQARecords()
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	m.history = records
+	m.historyIdx = 0
+	m.setMode(tuiModeHistory)
+	if len(records) == 0 {
+		m.status = "暂无问答记录"
+	}
+	m.refresh()
+}
+
+// setMode 切换操作模式，只有输入模式下输入框获得焦点
+func (m *tuiModel) setMode(mode tuiMode) {
+	m.mode = mode
+	if mode == tuiModeInput {
+		m.input.Focus()
+	} else {
+		m.input.Blur()
+	}
+	m.refresh()
+}
+
+// refresh 重新渲染主区域的内容
+func (m *tuiModel) refresh() {
+	if !m.ready {
+		return
+	}
+	if m.mode == tuiModeHistory {
+		m.view.SetContent(m.renderHistory())
+		return
+	}
+	m.view.SetContent(m.renderTurns())
+	m.view.GotoBottom()
+}
+
+// renderTurns 渲染当前会话
+func (m *tuiModel) renderTurns() string {
+	if len(m.turns) == 0 {
+		return tuiMutedStyle.Render("开始提问吧。Tab 切换模型，Esc 进入浏览模式（k 保存回答，h 查看历史，q 退出）。")
+	}
+	wrap := lipgloss.NewStyle().Width(max(m.width-2, 1))
+	var b strings.Builder
+	for _, turn := range m.turns {
+		b.WriteString(tuiQuestionStyle.Render("你: ") + wrap.Render(turn.Question) + "\n")
+		b.WriteString(tuiAnswerStyle.Render(turn.Model+": ") + "\n")
+		if turn.Answer != "" {
+			b.WriteString(wrap.Render(turn.Answer) + "\n")
+		}
+		if turn.Err != "" {
+			b.WriteString(tuiErrorStyle.Render("错误: "+turn.Err) + "\n")
+		}
+		if turn.SavedID != 0 {
+			b.WriteString(tuiMutedStyle.Render(fmt.Sprintf("[已保存到知识库 #%d]", turn.SavedID)) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderHistory 渲染问答记录列表，选中的记录始终可见并显示回答预览
+func (m *tuiModel) renderHistory() string {
+	if len(m.history) == 0 {
+		return tuiMutedStyle.Render("暂无问答记录")
+	}
+	listHeight := max(m.view.Height/2, 1)
+	start := max(m.historyIdx-listHeight+1, 0)
+	end := min(start+listHeight, len(m.history))
+
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		record := m.history[i]
+		line := fmt.Sprintf("#%-4d %s  %-20s %s", record.ID, record.Timestamp.Format("01-02 15:04"), record.Model, askDefaultTitle(record.Question))
+		line = truncateTUILine(line, m.width)
+		if i == m.historyIdx {
+			line = tuiSelectedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	selected := m.history[m.historyIdx]
+	b.WriteString("\n" + tuiQuestionStyle.Render("问: ") + selected.Question + "\n")
+	b.WriteString(lipgloss.NewStyle().Width(max(m.width-2, 1)).Render(selected.Answer))
+	return b.String()
+}
+
+// View 实现 tea.Model
+func (m *tuiModel) View() string {
+	if m.quitting {
+		return ""
+	}
+	if !m.ready {
+		return "正在加载..."
+	}
+
+	title := tuiTitleStyle.Render("AI 助手") + tuiMutedStyle.Render(" · 模型: ") + m.models[m.modelIdx]
+	status := tuiMutedStyle.Render(truncateTUILine(m.status, m.width))
+
+	var help string
+	switch m.mode {
+	case tuiModeInput:
+		help = "Enter 发送 · Tab 切换模型 · PgUp/PgDn 滚动 · Esc 浏览模式 · Ctrl+C 退出"
+	case tuiModeNormal:
+		help = "i 输入 · k 保存最后的回答 · m 切换模型 · h 历史记录 · ↑↓ 滚动 · q 退出"
+	case tuiModeHistory:
+		help = "↑↓ 选择 · Enter 查看 · k 保存到知识库 · Esc 返回"
+	}
+
+	return strings.Join([]string{
+		title,
+		m.view.View(),
+		status,
+		m.input.View(),
+		tuiMutedStyle.Render(truncateTUILine(help, m.width)),
+	}, "\n")
+}
+
+// formatTUIUsage 格式化 token 用量
+func formatTUIUsage(usage *TokenUsage) string {
+	if usage == nil {
+		return "用量未知"
+	}
+	return fmt.Sprintf("%d tokens", usage.TotalTokens)
+}
+
+// truncateTUILine 把一行截断到终端宽度
+func truncateTUILine(s string, width int) string {
+	if width <= 0 || lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes)) > width-1 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志中的撤销操作
+const auditActionUndo = "undo"
+
+// 撤销令牌的有效期，令牌只保存在内存中，重启后失效
+const undoWindow = 5 * time.Minute
+
+// 可以撤销的操作
+const (
+	undoKindKnowledgeDelete = "knowledge.delete"
+	undoKindKnowledgePurge  = "knowledge.purge"
+)
+
+// errUndoConflict 状态已经改变，无法撤销
+var errUndoConflict = errors.New("状态已经改变，无法撤销")
+
+// undoAction 一次可以撤销的操作，undo 恢复操作前的状态，状态已经改变无法恢复时返回 errUndoConflict
+type undoAction struct {
+	kind    string
+	target  string
+	expires time.Time
+	undo    func() error
+}
+
+var (
+	undoMu      sync.Mutex
+	undoActions = map[string]undoAction{}
+)
+
+// registerUndo 登记一次可以撤销的操作，返回撤销令牌和过期时间
+func registerUndo(kind, target string, undo func() error) (string, time.Time) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(undoWindow)
+
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	// 顺便清理过期的令牌
+	for t, action := range undoActions {
+		if time.Now().After(action.expires) {
+			delete(undoActions, t)
+		}
+	}
+	undoActions[token] = undoAction{kind: kind, target: target, expires: expires, undo: undo}
+	return token, expires
+}
+
+// takeUndo 取出撤销令牌对应的操作，令牌只能使用一次，不存在或已过期时返回false
+func takeUndo(token string) (undoAction, bool) {
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	action, ok := undoActions[token]
+	if !ok {
+		return undoAction{}, false
+	}
+	delete(undoActions, token)
+	return action, time.Now().Before(action.expires)
+}
+
+// respondWithUndo 在操作结果中附上撤销令牌
+func respondWithUndo(c *gin.Context, result gin.H, kind, target string, undo func() error) {
+	token, expires := registerUndo(kind, target, undo)
+	result["undo_token"] = token
+	result["undo_expires_at"] = expires
+	c.JSON(http.StatusOK, result)
+}
+
+// undoHandler 撤销令牌对应的操作，恢复操作前的状态；只读模式下拒绝，令牌仍然有效
+func undoHandler(c *gin.Context) {
+	if readOnly(currentConfig()) {
+		respondKnowledgeWriteError(c, auditActionUndo, errReadOnly)
+		return
+	}
+	action, ok := takeUndo(c.Param("token"))
+	if !ok {
+		respondError(c, http.StatusNotFound, tr(c, "error.undo_expired"))
+		return
+	}
+	if err := action.undo(); errors.Is(err, errReadOnly) {
+		respondKnowledgeWriteError(c, auditActionUndo, err)
+		return
+	} else if err != nil {
+		recordAudit(c, auditActionUndo, action.target, fmt.Sprintf("kind=%s conflict=true", action.kind), http.StatusConflict)
+		respondError(c, http.StatusConflict, tr(c, "error.undo_conflict"))
+		return
+	}
+	recordAudit(c, auditActionUndo, action.target, "kind="+action.kind, http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"message": tr(c, "message.undone"),
+		"kind":    action.kind,
+		"target":  action.target,
+	})
+}
+
+// unpurgeKnowledgeItem 把永久删除的条目放回回收站，ID已经被占用时返回 errUndoConflict，只读模式下返回 errReadOnly
+func unpurgeKnowledgeItem(item KnowledgeItem) error {
+	if readOnly(currentConfig()) {
+		return errReadOnly
+	}
+	dataMu.Lock()
+	for _, existing := range storedKnowledgeItems() {
+		if existing.ID == item.ID {
+			dataMu.Unlock()
+			return errUndoConflict
+		}
+	}
+	commitJournalEntry(JournalEntry{Op: journalOpKnowledgeTrash, Knowledge: &item})
+	dataMu.Unlock()
+
+	maybeCompact()
+	return nil
+}
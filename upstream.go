@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 未配置 api.ejection 时连续失败多少次后摘除节点，以及摘除多久后重新尝试
+const (
+	defaultEjectionFailures = 3
+	defaultEjectionCooldown = 30 * time.Second
+)
+
+// UpstreamEndpoint 上游的一个节点，例如一台 vLLM 服务器
+type UpstreamEndpoint struct {
+	BaseURL string `yaml:"base_url"`
+	// 为空时使用 api.api_key
+	APIKey string `yaml:"api_key"`
+	// 权重，默认 1，为 0 时不分配请求
+	Weight *int `yaml:"weight"`
+	// 只附加到该节点请求的请求头和查询参数，与 api.headers、api.query 同名时覆盖
+	Headers map[string]string `yaml:"headers"`
+	Query   map[string]string `yaml:"query"`
+}
+
+// weight 返回节点的权重
+func (e UpstreamEndpoint) weight() int {
+	if e.Weight == nil {
+		return 1
+	}
+	return *e.Weight
+}
+
+// endpointState 节点的负载均衡和健康状态，按 base_url 保存，配置热加载后保留
+type endpointState struct {
+	currentWeight int
+	failures      int
+	ejectedUntil  time.Time
+	requests      int
+	errors        int
+}
+
+// UpstreamStatus 节点的当前状态
+type UpstreamStatus struct {
+	BaseURL string `json:"base_url"`
+	Weight  int    `json:"weight"`
+	Healthy bool   `json:"healthy"`
+	// 连续失败的次数
+	Failures     int        `json:"failures,omitempty"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	Requests     int        `json:"requests"`
+	Errors       int        `json:"errors"`
+}
+
+var (
+	upstreamMu     sync.Mutex
+	upstreamStates = map[string]*endpointState{}
+)
+
+// upstreamDoer 所有发往上游的请求都经过它，附加 api.headers 和 api.query，配置了 api.endpoints 时在节点之间负载均衡
+// api.provider 为 mock 时交给 mockDoer 返回模拟的响应，配置了 api.recording 时录制或回放上游调用
+var upstreamDoer = &balancingDoer{next: http.DefaultClient}
+
+// balancingDoer 按加权轮询选择节点并改写请求地址，连接失败或返回 5xx 时计入节点的失败次数，
+// 连续失败达到 api.ejection.failures 次的节点在 cooldown 内不再分配请求；请求体可以重放时换下一个节点重试
+type balancingDoer struct {
+	next *http.Client
+}
+
+// Do 实现openai.HTTPDoer接口
+func (d *balancingDoer) Do(req *http.Request) (*http.Response, error) {
+	cfg := currentConfig()
+	if cfg.API.Recording.Mode != "" {
+		return recordingDo(cfg, req, func(req *http.Request) (*http.Response, error) {
+			return d.forward(cfg, req)
+		})
+	}
+	return d.forward(cfg, req)
+}
+
+// forward 把请求发往模拟服务商或选中的上游节点
+func (d *balancingDoer) forward(cfg *Config, req *http.Request) (*http.Response, error) {
+	if cfg.API.Provider == apiProviderMock {
+		return mockDoer{}.Do(req)
+	}
+	if len(cfg.API.Endpoints) == 0 {
+		if len(cfg.API.Headers) == 0 && len(cfg.API.Query) == 0 {
+			return d.next.Do(req)
+		}
+		attempt := req.Clone(req.Context())
+		applyUpstreamExtras(attempt, cfg.API.Headers, cfg.API.Query)
+		return d.next.Do(attempt)
+	}
+	eligible := 0
+	for _, e := range cfg.API.Endpoints {
+		if e.weight() > 0 {
+			eligible++
+		}
+	}
+
+	tried := map[string]bool{}
+	for {
+		endpoint, ok := pickEndpoint(cfg, tried)
+		if !ok {
+			return nil, fmt.Errorf("没有可用的上游节点")
+		}
+		tried[endpoint.BaseURL] = true
+
+		attempt, err := rewriteUpstreamRequest(cfg, req, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := d.next.Do(attempt)
+		if req.Context().Err() != nil {
+			// 请求被取消或超时不是节点的问题
+			return resp, err
+		}
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		reportEndpointResult(cfg, endpoint.BaseURL, failed)
+		if !failed {
+			return resp, nil
+		}
+
+		// 还有没试过的节点且请求体可以重放时重试
+		canRetry := len(tried) < eligible && (req.Body == nil || req.GetBody != nil)
+		if !canRetry {
+			return resp, err
+		}
+		if err != nil {
+			slog.Warn("上游节点请求失败，换下一个节点重试", "endpoint", endpoint.BaseURL, "error", err)
+		} else {
+			slog.Warn("上游节点返回错误，换下一个节点重试", "endpoint", endpoint.BaseURL, "status", resp.StatusCode)
+			resp.Body.Close()
+		}
+	}
+}
+
+// upstreamBaseURL 返回构造上游请求使用的地址，配置了 api.endpoints 时为第一个节点，实际发送时再改写为选中的节点
+func upstreamBaseURL(cfg *Config) string {
+	if cfg.API.Provider == apiProviderMock {
+		return mockBaseURL
+	}
+	if len(cfg.API.Endpoints) > 0 {
+		return cfg.API.Endpoints[0].BaseURL
+	}
+	return cfg.API.BaseURL
+}
+
+// rewriteUpstreamRequest 把请求改写为发往指定节点，节点配置了 api_key 时替换认证信息，并附加配置的请求头和查询参数
+func rewriteUpstreamRequest(cfg *Config, req *http.Request, endpoint UpstreamEndpoint) (*http.Request, error) {
+	base := strings.TrimRight(upstreamBaseURL(cfg), "/")
+	target, err := url.Parse(strings.TrimRight(endpoint.BaseURL, "/") + strings.TrimPrefix(req.URL.String(), base))
+	if err != nil {
+		return nil, err
+	}
+	attempt := req.Clone(req.Context())
+	attempt.URL, attempt.Host = target, ""
+	if req.GetBody != nil {
+		if attempt.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if endpoint.APIKey != "" {
+		attempt.Header.Set("Authorization", "Bearer "+endpoint.APIKey)
+	}
+	applyUpstreamExtras(attempt, cfg.API.Headers, cfg.API.Query)
+	applyUpstreamExtras(attempt, endpoint.Headers, endpoint.Query)
+	return attempt, nil
+}
+
+// applyUpstreamExtras 给请求加上配置的请求头和查询参数，同名时覆盖原有的值
+func applyUpstreamExtras(req *http.Request, headers, query map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if len(query) > 0 {
+		q := req.URL.Query()
+		for name, value := range query {
+			q.Set(name, value)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// pickEndpoint 用平滑加权轮询选择一个没有被摘除、也没有试过的节点；全部被摘除时选择最早恢复的节点
+func pickEndpoint(cfg *Config, tried map[string]bool) (UpstreamEndpoint, bool) {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+
+	now := time.Now()
+	var best, earliest *UpstreamEndpoint
+	var bestState, earliestState *endpointState
+	total := 0
+	for i := range cfg.API.Endpoints {
+		e := &cfg.API.Endpoints[i]
+		if tried[e.BaseURL] || e.weight() <= 0 {
+			continue
+		}
+		state := upstreamState(e.BaseURL)
+		if now.Before(state.ejectedUntil) {
+			if earliest == nil || state.ejectedUntil.Before(earliestState.ejectedUntil) {
+				earliest, earliestState = e, state
+			}
+			continue
+		}
+		state.currentWeight += e.weight()
+		total += e.weight()
+		if best == nil || state.currentWeight > bestState.currentWeight {
+			best, bestState = e, state
+		}
+	}
+	if best == nil {
+		if earliest == nil {
+			return UpstreamEndpoint{}, false
+		}
+		return *earliest, true
+	}
+	bestState.currentWeight -= total
+	return *best, true
+}
+
+// upstreamState 返回节点的状态，调用方需要持有 upstreamMu
+func upstreamState(baseURL string) *endpointState {
+	state, ok := upstreamStates[baseURL]
+	if !ok {
+		state = &endpointState{}
+		upstreamStates[baseURL] = state
+	}
+	return state
+}
+
+// reportEndpointResult 记录一次请求的结果，连续失败达到阈值时摘除节点
+func reportEndpointResult(cfg *Config, baseURL string, failed bool) {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	state := upstreamState(baseURL)
+	state.requests++
+	if !failed {
+		state.failures = 0
+		return
+	}
+	state.errors++
+	state.failures++
+	threshold := cfg.API.Ejection.Failures
+	if threshold <= 0 {
+		threshold = defaultEjectionFailures
+	}
+	if state.failures >= threshold {
+		cooldown := ejectionCooldown(cfg)
+		state.ejectedUntil = time.Now().Add(cooldown)
+		slog.Warn("上游节点连续失败，暂时摘除", "endpoint", baseURL, "failures", state.failures, "cooldown", cooldown)
+	}
+}
+
+// ejectionCooldown 返回节点被摘除后多久重新尝试
+func ejectionCooldown(cfg *Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.API.Ejection.Cooldown); err == nil && d > 0 {
+		return d
+	}
+	return defaultEjectionCooldown
+}
+
+// upstreamStatuses 返回各节点的当前状态，未配置 api.endpoints 时返回空
+func upstreamStatuses(cfg *Config) []UpstreamStatus {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	now := time.Now()
+	statuses := make([]UpstreamStatus, 0, len(cfg.API.Endpoints))
+	for _, e := range cfg.API.Endpoints {
+		state := upstreamState(e.BaseURL)
+		status := UpstreamStatus{
+			BaseURL:  e.BaseURL,
+			Weight:   e.weight(),
+			Healthy:  !now.Before(state.ejectedUntil),
+			Failures: state.failures,
+			Requests: state.requests,
+			Errors:   state.errors,
+		}
+		if !status.Healthy {
+			until := state.ejectedUntil
+			status.EjectedUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
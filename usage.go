@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TokenUsage 单次请求的token用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	CachedTokens     int `json:"cached_tokens"`
+}
+
+// UsageStats 累计token用量统计
+type UsageStats struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	CachedTokens     int `json:"cached_tokens"`
+}
+
+var (
+	usageMu      sync.Mutex
+	usageTotal   UsageStats
+	usageByModel = map[string]*UsageStats{}
+	// 翻译、摘要等工具接口单独统计，同时计入总用量
+	usageByFeature = map[string]*UsageStats{}
+)
+
+// 单独统计用量的工具接口
+const (
+	usageFeatureTranslate          = "translate"
+	usageFeatureSummarize          = "summarize"
+	usageFeatureKnowledgeTranslate = "knowledge.translate"
+	usageFeatureKnowledgeVerify    = "knowledge.verify"
+	usageFeatureKnowledgeQuality   = "knowledge.quality"
+	usageFeatureKnowledgeOCR       = "knowledge.ocr"
+	usageFeatureExtract            = "extract"
+	usageFeatureEmbeddings         = "embeddings"
+	usageFeatureRerank             = "rerank"
+	usageFeatureProbe              = "probe"
+	usageFeatureRouter             = "router"
+	usageFeatureJudge              = "judge"
+	usageFeatureShadow             = "shadow"
+	usageFeatureAnalytics          = "analytics"
+)
+
+// newTokenUsage 从上游返回的用量信息构造TokenUsage
+func newTokenUsage(u openai.Usage) *TokenUsage {
+	usage := &TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
+
+// add 累加一次请求的用量
+func (s *UsageStats) add(u *TokenUsage) {
+	s.Requests++
+	s.PromptTokens += u.PromptTokens
+	s.CompletionTokens += u.CompletionTokens
+	s.TotalTokens += u.TotalTokens
+	s.CachedTokens += u.CachedTokens
+}
+
+// cacheHitRatio 计算提示词缓存命中的token占比
+func (s UsageStats) cacheHitRatio() float64 {
+	if s.PromptTokens == 0 {
+		return 0
+	}
+	return float64(s.CachedTokens) / float64(s.PromptTokens)
+}
+
+// recordUsage 记录一次请求的token用量
+func recordUsage(model string, u *TokenUsage) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	usageTotal.add(u)
+	stats, ok := usageByModel[model]
+	if !ok {
+		stats = &UsageStats{}
+		usageByModel[model] = stats
+	}
+	stats.add(u)
+}
+
+// recordFeatureUsage 记录工具接口的用量，同时计入总用量和模型用量
+func recordFeatureUsage(feature, model string, u *TokenUsage) {
+	recordUsage(model, u)
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	stats, ok := usageByFeature[feature]
+	if !ok {
+		stats = &UsageStats{}
+		usageByFeature[feature] = stats
+	}
+	stats.add(u)
+}
+
+// usageHandler 返回token用量统计，包括提示词缓存节省的token、各工具接口的用量和估算的费用
+func usageHandler(c *gin.Context) {
+	cfg := currentConfig()
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	// 配置了价格的模型返回估算的费用，总费用只包括这些模型
+	models := make(gin.H, len(usageByModel))
+	totalCost, priced := 0.0, false
+	for model, stats := range usageByModel {
+		entry := gin.H{
+			"stats":           stats,
+			"cache_hit_ratio": stats.cacheHitRatio(),
+		}
+		if pricing := cfg.Models.Settings[model].Pricing; pricing != nil {
+			cost := pricing.cost(stats)
+			entry["cost"] = cost
+			totalCost, priced = totalCost+cost, true
+		}
+		models[model] = entry
+	}
+
+	features := make(gin.H, len(usageByFeature))
+	for feature, stats := range usageByFeature {
+		features[feature] = stats
+	}
+
+	result := gin.H{
+		"total":           usageTotal,
+		"cache_hit_ratio": usageTotal.cacheHitRatio(),
+		"models":          models,
+		"features":        features,
+	}
+	if priced {
+		result["cost"] = totalCost
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,815 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 请求头名称允许的字符（RFC 7230 token）
+var headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// 由 HTTP 客户端管理、不能通过 api.headers 覆盖的请求头
+var reservedUpstreamHeaders = []string{"Host", "Content-Length", "Content-Type", "Transfer-Encoding", "Connection"}
+
+// validateConfig 检查配置是否完整有效，返回所有发现的问题
+func validateConfig(cfg *Config) error {
+	var errs []error
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// 上游API，mock 服务商不访问网络，只检查模拟回答的配置
+	mock := cfg.API.Provider == apiProviderMock
+	switch cfg.API.Provider {
+	case "", apiProviderOpenAI:
+	case apiProviderMock:
+		for i, r := range cfg.API.Mock.Responses {
+			if _, err := regexp.Compile(r.Match); err != nil {
+				addf("api.mock.responses[%d].match 不是有效的正则表达式: %v", i, err)
+			}
+			if _, err := template.New("mock").Parse(r.Response); err != nil {
+				addf("api.mock.responses[%d].response 模板无效: %v", i, err)
+			}
+		}
+		if _, err := template.New("mock").Parse(cfg.API.Mock.Default); err != nil {
+			addf("api.mock.default 模板无效: %v", err)
+		}
+		for name, value := range map[string]string{"latency": cfg.API.Mock.Latency, "chunk_delay": cfg.API.Mock.ChunkDelay} {
+			if d, err := time.ParseDuration(value); value != "" && (err != nil || d < 0) {
+				addf("api.mock.%s 无效: %q", name, value)
+			}
+		}
+	default:
+		addf("api.provider 只能是 %s 或 %s，当前为 %q", apiProviderOpenAI, apiProviderMock, cfg.API.Provider)
+	}
+	switch cfg.API.Recording.Mode {
+	case "", recordingModeRecord, recordingModeReplay:
+	default:
+		addf("api.recording.mode 只能是 %s 或 %s，当前为 %q", recordingModeRecord, recordingModeReplay, cfg.API.Recording.Mode)
+	}
+	if len(cfg.API.Endpoints) == 0 && !mock {
+		if cfg.API.BaseURL == "" {
+			addf("api.base_url 不能为空")
+		} else if u, err := url.Parse(cfg.API.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("api.base_url 不是有效的 http(s) 地址: %q", cfg.API.BaseURL)
+		}
+	}
+	keyless := cfg.API.APIKey == ""
+	totalWeight := 0
+	seenEndpoints := map[string]bool{}
+	for i, e := range cfg.API.Endpoints {
+		if u, err := url.Parse(e.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("api.endpoints[%d].base_url 不是有效的 http(s) 地址: %q", i, e.BaseURL)
+		}
+		if seenEndpoints[e.BaseURL] {
+			addf("api.endpoints[%d].base_url 重复: %q", i, e.BaseURL)
+		}
+		seenEndpoints[e.BaseURL] = true
+		if e.weight() < 0 {
+			addf("api.endpoints[%d].weight 不能为负数", i)
+		}
+		totalWeight += max(e.weight(), 0)
+		if e.APIKey == "" && keyless && !mock {
+			addf("api.endpoints[%d] 没有配置 api_key，api.api_key 也为空", i)
+		}
+	}
+	if len(cfg.API.Endpoints) > 0 && totalWeight == 0 {
+		addf("api.endpoints 中至少需要一个权重大于 0 的节点")
+	}
+	if len(cfg.API.Endpoints) == 0 && keyless && !mock {
+		addf("api.api_key 不能为空")
+	}
+	checkUpstreamExtras := func(prefix string, headers, query map[string]string) {
+		for name := range headers {
+			if !headerNamePattern.MatchString(name) {
+				addf("%s.headers 中的请求头名称无效: %q", prefix, name)
+			} else if containsString(reservedUpstreamHeaders, http.CanonicalHeaderKey(name)) {
+				addf("%s.headers 不能设置 %s", prefix, name)
+			}
+		}
+		for name := range query {
+			if name == "" {
+				addf("%s.query 中的参数名不能为空", prefix)
+			}
+		}
+	}
+	checkUpstreamExtras("api", cfg.API.Headers, cfg.API.Query)
+	for i, e := range cfg.API.Endpoints {
+		checkUpstreamExtras(fmt.Sprintf("api.endpoints[%d]", i), e.Headers, e.Query)
+	}
+	if cfg.API.Ejection.Failures < 0 {
+		addf("api.ejection.failures 不能为负数")
+	}
+	if c := cfg.API.Ejection.Cooldown; c != "" {
+		if d, err := time.ParseDuration(c); err != nil || d <= 0 {
+			addf("api.ejection.cooldown 无效: %q", c)
+		}
+	}
+
+	// 监听地址
+	if port, ok := strings.CutPrefix(cfg.Server.Port, ":"); !ok {
+		addf("server.port 格式应为 \":8080\"，当前为 %q", cfg.Server.Port)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		addf("server.port 端口号无效: %q", cfg.Server.Port)
+	}
+
+	if _, isSocket := unixSocketPath(cfg.Server.Listen); isSocket {
+		if _, err := parseSocketMode(cfg.Server.SocketMode); err != nil {
+			addf("server.socket_mode %v", err)
+		}
+	} else if cfg.Server.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Server.Listen); err != nil {
+			addf("server.listen 应为 host:port 或 unix socket 路径，当前为 %q", cfg.Server.Listen)
+		}
+	}
+
+	if _, err := normalizeProxyCIDRs(cfg.Server.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+
+	if level := cfg.Server.Compression.Level; level < 0 || level > 9 {
+		addf("server.compression.level 应在 1-9 之间，当前为 %d", level)
+	}
+
+	// 请求大小
+	if cfg.Limits.MaxBodyKB < 0 || cfg.Limits.MaxMessageChars < 0 || cfg.Limits.MaxUploadMB < 0 {
+		addf("limits 中的大小限制不能为负数")
+	}
+	for route, kb := range cfg.Limits.Endpoints {
+		if kb <= 0 {
+			addf("limits.endpoints[%q] 应为正数", route)
+		}
+	}
+
+	// 跨域
+	if cfg.CORS.Enabled {
+		if len(cfg.CORS.AllowedOrigins) == 0 {
+			addf("启用 cors 时 cors.allowed_origins 不能为空")
+		}
+		for _, origin := range cfg.CORS.AllowedOrigins {
+			if _, err := path.Match(origin, ""); err != nil {
+				addf("cors.allowed_origins 中的 %q 格式无效", origin)
+			}
+		}
+		if cfg.CORS.MaxAge < 0 {
+			addf("cors.max_age 不能为负数")
+		}
+	}
+
+	// HTTPS
+	if cfg.HTTPS.Enabled {
+		hasCert := cfg.HTTPS.CertFile != "" || cfg.HTTPS.KeyFile != ""
+		switch {
+		case hasCert && usesACME(cfg):
+			addf("https.cert_file/key_file 与 https.acme.domains 只能配置其中一种")
+		case !hasCert && !usesACME(cfg):
+			addf("启用 https 时需要配置 https.cert_file 和 https.key_file，或 https.acme.domains")
+		case hasCert && (cfg.HTTPS.CertFile == "" || cfg.HTTPS.KeyFile == ""):
+			addf("https.cert_file 和 https.key_file 需要同时配置")
+		}
+		if cfg.HTTPS.HTTPPort != "" {
+			if port, ok := strings.CutPrefix(cfg.HTTPS.HTTPPort, ":"); !ok {
+				addf("https.http_port 格式应为 \":80\"，当前为 %q", cfg.HTTPS.HTTPPort)
+			} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				addf("https.http_port 端口号无效: %q", cfg.HTTPS.HTTPPort)
+			} else if cfg.HTTPS.HTTPPort == cfg.Server.Port {
+				addf("https.http_port 不能与 server.port 相同")
+			}
+		}
+	}
+
+	// Slack 机器人
+	if cfg.Slack.Enabled {
+		if cfg.Slack.BotToken == "" {
+			addf("启用 slack 时 slack.bot_token 不能为空")
+		}
+		switch cfg.Slack.Mode {
+		case "", slackModeEvents:
+			if cfg.Slack.SigningSecret == "" {
+				addf("slack.mode 为 events 时 slack.signing_secret 不能为空")
+			}
+		case slackModeSocket:
+			if !strings.HasPrefix(cfg.Slack.AppToken, "xapp-") {
+				addf("slack.mode 为 socket 时需要配置以 xapp- 开头的 slack.app_token")
+			}
+		default:
+			addf("slack.mode 无效: %q，可选 events 或 socket", cfg.Slack.Mode)
+		}
+		if cfg.Slack.Model != "" && !isChatModel(cfg, cfg.Slack.Model) {
+			addf("slack.model %q 不在 models.available 中", cfg.Slack.Model)
+		}
+	}
+
+	// 企业微信应用
+	if cfg.WeCom.Enabled {
+		if cfg.WeCom.CorpID == "" || cfg.WeCom.Secret == "" || cfg.WeCom.AgentID == 0 {
+			addf("启用 wecom 时 wecom.corp_id、wecom.agent_id 和 wecom.secret 不能为空")
+		}
+		if cfg.WeCom.Token == "" {
+			addf("启用 wecom 时 wecom.token 不能为空")
+		}
+		if _, err := wecomAESKey(cfg); err != nil {
+			addf("%v", err)
+		}
+		if cfg.WeCom.Model != "" && !isChatModel(cfg, cfg.WeCom.Model) {
+			addf("wecom.model %q 不在 models.available 中", cfg.WeCom.Model)
+		}
+	}
+
+	// 钉钉机器人
+	if cfg.DingTalk.Enabled {
+		if cfg.DingTalk.AppSecret == "" {
+			addf("启用 dingtalk 时 dingtalk.app_secret 不能为空")
+		}
+		switch cfg.DingTalk.Mode {
+		case "", dingtalkModeOutgoing:
+		case dingtalkModeStream:
+			if cfg.DingTalk.AppKey == "" {
+				addf("dingtalk.mode 为 stream 时 dingtalk.app_key 不能为空")
+			}
+		default:
+			addf("dingtalk.mode 无效: %q，可选 outgoing 或 stream", cfg.DingTalk.Mode)
+		}
+		if cfg.DingTalk.Model != "" && !isChatModel(cfg, cfg.DingTalk.Model) {
+			addf("dingtalk.model %q 不在 models.available 中", cfg.DingTalk.Model)
+		}
+	}
+
+	// 邮件网关
+	if cfg.Email.Enabled {
+		if !strings.Contains(cfg.Email.Address, "@") {
+			addf("启用 email 时 email.address 必须是有效的邮箱地址")
+		}
+		if cfg.Email.IMAP.Addr == "" || cfg.Email.SMTP.Addr == "" {
+			addf("启用 email 时 email.imap.addr 和 email.smtp.addr 不能为空")
+		}
+		if v := cfg.Email.PollInterval; v != "" {
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				addf("email.poll_interval 不是有效的时间间隔: %q", v)
+			}
+		}
+		if cfg.Email.Model != "" && !isChatModel(cfg, cfg.Email.Model) {
+			addf("email.model %q 不在 models.available 中", cfg.Email.Model)
+		}
+	}
+
+	// Webhook
+	webhookNames := map[string]bool{}
+	for i, hook := range cfg.Webhooks {
+		if hook.Name == "" {
+			addf("webhooks[%d].name 不能为空", i)
+		} else if webhookNames[hook.Name] {
+			addf("webhooks[%d].name %q 与其他接收地址重复", i, hook.Name)
+		}
+		webhookNames[hook.Name] = true
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("webhooks[%d].url 无效: %q", i, hook.URL)
+		}
+		for _, event := range hook.Events {
+			if !containsString(knownEvents, event) {
+				addf("webhooks[%d].events 包含未知事件 %q，可选 %s", i, event, strings.Join(knownEvents, "、"))
+			}
+		}
+	}
+
+	// 外部插件
+	pluginNames := map[string]bool{}
+	for i, plugin := range cfg.Plugins {
+		if plugin.Name == "" {
+			addf("plugins[%d].name 不能为空", i)
+		} else if pluginNames[plugin.Name] {
+			addf("plugins[%d].name %q 与其他插件重复", i, plugin.Name)
+		}
+		pluginNames[plugin.Name] = true
+		if u, err := url.Parse(plugin.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("plugins[%d].url 无效: %q", i, plugin.URL)
+		}
+		if len(plugin.Hooks) == 0 {
+			addf("plugins[%d].hooks 不能为空，可选 %s", i, strings.Join(pluginHooks, "、"))
+		}
+		for _, hook := range plugin.Hooks {
+			if !containsString(pluginHooks, hook) {
+				addf("plugins[%d].hooks 包含未知的挂载位置 %q，可选 %s", i, hook, strings.Join(pluginHooks, "、"))
+			}
+		}
+		if v := plugin.Timeout; v != "" {
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				addf("plugins[%d].timeout 不是有效的时间间隔: %q", i, v)
+			}
+		}
+		if plugin.OnError != "" && plugin.OnError != pluginOnErrorAllow && plugin.OnError != pluginOnErrorReject {
+			addf("plugins[%d].on_error 只能是 %s 或 %s", i, pluginOnErrorAllow, pluginOnErrorReject)
+		}
+	}
+
+	// 入站触发器
+	hookNames := map[string]bool{}
+	for i, hook := range cfg.Hooks {
+		if hook.Name == "" {
+			addf("hooks[%d].name 不能为空", i)
+		} else if hookNames[hook.Name] {
+			addf("hooks[%d].name %q 与其他触发器重复", i, hook.Name)
+		}
+		hookNames[hook.Name] = true
+		if strings.TrimSpace(hook.Template) == "" {
+			addf("hooks[%d].template 不能为空", i)
+		} else if _, err := parseHookTemplate(hook.Name, hook.Template); err != nil {
+			addf("hooks[%d].template 无效: %v", i, err)
+		}
+		if hook.Title != "" {
+			if _, err := parseHookTemplate(hook.Name, hook.Title); err != nil {
+				addf("hooks[%d].title 无效: %v", i, err)
+			}
+		}
+		if hook.Model != "" && !isChatModel(cfg, hook.Model) {
+			addf("hooks[%d].model %q 不在 models.available 中", i, hook.Model)
+		}
+	}
+
+	// 定时任务
+	scheduleNames := map[string]bool{}
+	for i, sch := range cfg.Schedules {
+		if sch.Name == "" {
+			addf("schedules[%d].name 不能为空", i)
+		} else if sch.Name == digestJobName {
+			addf("schedules[%d].name 不能为 %q，该名称用于 digest", i, digestJobName)
+		} else if scheduleNames[sch.Name] {
+			addf("schedules[%d].name %q 与其他定时任务重复", i, sch.Name)
+		}
+		scheduleNames[sch.Name] = true
+		if _, err := cronParser.Parse(sch.Cron); err != nil {
+			addf("schedules[%d].cron 无效: %q", i, sch.Cron)
+		}
+		if strings.TrimSpace(sch.Prompt) == "" {
+			addf("schedules[%d].prompt 不能为空", i)
+		} else if _, err := parseScheduleTemplate(sch.Name, sch.Prompt); err != nil {
+			addf("schedules[%d].prompt 无效: %v", i, err)
+		}
+		if sch.Title != "" {
+			if _, err := parseScheduleTemplate(sch.Name, sch.Title); err != nil {
+				addf("schedules[%d].title 无效: %v", i, err)
+			}
+		}
+		if sch.Model != "" && !isChatModel(cfg, sch.Model) {
+			addf("schedules[%d].model %q 不在 models.available 中", i, sch.Model)
+		}
+		if !sch.Save && sch.Webhook == "" && len(sch.Email) == 0 {
+			addf("schedules[%d] 至少需要配置 save、webhook 或 email 中的一个", i)
+		}
+		if sch.Webhook != "" && !webhookNames[sch.Webhook] {
+			addf("schedules[%d].webhook %q 不在 webhooks 中", i, sch.Webhook)
+		}
+		if len(sch.Email) > 0 && (cfg.Email.Address == "" || cfg.Email.SMTP.Addr == "") {
+			addf("schedules[%d] 发送邮件需要配置 email.address 和 email.smtp.addr", i)
+		}
+	}
+
+	// 语言
+	if cfg.I18n.DefaultLocale != "" && matchLocale(cfg.I18n.DefaultLocale) == "" {
+		addf("i18n.default_locale 不支持: %q，可选 %s", cfg.I18n.DefaultLocale, strings.Join(supportedLocales, "、"))
+	}
+
+	// 摘要
+	if cfg.Digest.Enabled {
+		switch cfg.Digest.Period {
+		case "", digestPeriodDaily, digestPeriodWeekly:
+		default:
+			addf("digest.period 无效: %q，可选 daily 或 weekly", cfg.Digest.Period)
+		}
+		if cfg.Digest.Cron != "" {
+			if _, err := cronParser.Parse(cfg.Digest.Cron); err != nil {
+				addf("digest.cron 无效: %q", cfg.Digest.Cron)
+			}
+		}
+		if cfg.Digest.Model != "" && !isChatModel(cfg, cfg.Digest.Model) {
+			addf("digest.model %q 不在 models.available 中", cfg.Digest.Model)
+		}
+		if cfg.Digest.Webhook != "" && !webhookNames[cfg.Digest.Webhook] {
+			addf("digest.webhook %q 不在 webhooks 中", cfg.Digest.Webhook)
+		}
+		if len(cfg.Digest.Email) > 0 && (cfg.Email.Address == "" || cfg.Email.SMTP.Addr == "") {
+			addf("digest 发送邮件需要配置 email.address 和 email.smtp.addr")
+		}
+	}
+
+	// 知识库检索重排
+	if r := cfg.RAG.Rerank; r.Enabled {
+		switch r.Provider {
+		case "", rerankProviderLLM:
+			if r.Model != "" && !isConfiguredModel(cfg, r.Model) {
+				addf("rag.rerank.model %q 不在 models.available 中", r.Model)
+			}
+		case rerankProviderModel:
+			if r.Model == "" {
+				addf("rag.rerank.provider 为 model 时 rag.rerank.model 不能为空")
+			}
+		default:
+			addf("rag.rerank.provider 无效: %q，可选 llm 或 model", r.Provider)
+		}
+		if r.Candidates < 0 {
+			addf("rag.rerank.candidates 不能为负数")
+		}
+	}
+
+	// 向量接口
+	if cfg.Embeddings.BatchSize < 0 || cfg.Embeddings.MaxInputs < 0 {
+		addf("embeddings.batch_size 和 embeddings.max_inputs 不能为负数")
+	}
+
+	// 批量对话
+	if cfg.Batch.Concurrency < 0 || cfg.Batch.RatePerMinute < 0 || cfg.Batch.MaxItems < 0 {
+		addf("batch.concurrency、batch.rate_per_minute 和 batch.max_items 不能为负数")
+	}
+
+	// OpenAI 兼容接口
+	if cfg.Gateway.Enabled {
+		if len(cfg.Gateway.Keys) == 0 {
+			addf("启用 gateway 时 gateway.keys 不能为空")
+		}
+		seen := map[string]bool{}
+		for i, key := range cfg.Gateway.Keys {
+			switch {
+			case key.Name == "":
+				addf("gateway.keys[%d].name 不能为空", i)
+			case key.Key == "":
+				addf("gateway.keys[%d].key 不能为空", i)
+			case seen[key.Key]:
+				addf("gateway.keys[%d].key 与其他密钥重复", i)
+			}
+			seen[key.Key] = true
+			if key.DailyTokens < 0 || key.DailyRequests < 0 {
+				addf("gateway.keys[%d] 的配额不能为负数", i)
+			}
+		}
+		if cfg.Gateway.CacheTTL != "" {
+			if _, err := time.ParseDuration(cfg.Gateway.CacheTTL); err != nil {
+				addf("gateway.cache_ttl 格式无效: %q", cfg.Gateway.CacheTTL)
+			}
+		}
+		if cfg.Gateway.Heartbeat != "" {
+			if d, err := time.ParseDuration(cfg.Gateway.Heartbeat); err != nil || d < 0 {
+				addf("gateway.heartbeat 格式无效: %q", cfg.Gateway.Heartbeat)
+			}
+		}
+	}
+
+	// 模型
+	if len(cfg.Models.Available) == 0 {
+		addf("models.available 至少需要一个模型")
+	}
+	if cfg.Models.Default == "" {
+		addf("models.default 不能为空")
+	} else if !containsString(cfg.Models.Available, cfg.Models.Default) {
+		addf("models.default %q 不在 models.available 列表中", cfg.Models.Default)
+	}
+	for alias, target := range cfg.Models.Aliases {
+		if containsString(cfg.Models.Available, alias) {
+			addf("models.aliases 中的别名 %q 与 models.available 中的模型重名", alias)
+		}
+		// 开启模型发现时别名可以指向上游返回的模型，启动时还无法检查
+		if !containsString(cfg.Models.Available, target) && !cfg.Models.Discover.Enabled {
+			addf("models.aliases[%q] 指向的模型 %q 不在 models.available 中", alias, target)
+		}
+	}
+	if d := cfg.Models.Discover; d.Enabled {
+		if d.Interval != "" {
+			if interval, err := time.ParseDuration(d.Interval); err != nil || interval <= 0 {
+				addf("models.discover.interval 无效: %q", d.Interval)
+			}
+		}
+		for _, pattern := range d.Include {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addf("models.discover.include 中的模式无效: %q", pattern)
+			}
+		}
+	}
+	if p := cfg.Models.Probe; p.Enabled {
+		for _, f := range []struct{ name, value string }{{"interval", p.Interval}, {"timeout", p.Timeout}} {
+			if f.value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+				addf("models.probe.%s 无效: %q", f.name, f.value)
+			}
+		}
+		switch p.Method {
+		case "", probeMethodCompletion, probeMethodModels:
+		default:
+			addf("models.probe.method 无效: %q，可选 %s、%s", p.Method, probeMethodCompletion, probeMethodModels)
+		}
+	}
+	for model, encoding := range cfg.Models.Encodings {
+		if !containsString(tokenEncodings, encoding) {
+			addf("models.encodings[%q] 无效: %q，可选 %s", model, encoding, strings.Join(tokenEncodings, "、"))
+		}
+	}
+	for model, settings := range cfg.Models.Settings {
+		if !containsString(cfg.Models.Available, model) && !cfg.Models.Discover.Enabled {
+			addf("models.settings 中的模型 %q 不在 models.available 中", model)
+		}
+		if settings.ContextWindow < 0 {
+			addf("models.settings[%q].context_window 不能为负数", model)
+		}
+		if settings.Tier < 0 {
+			addf("models.settings[%q].tier 不能为负数", model)
+		}
+		if settings.MaxTokens < 0 {
+			addf("models.settings[%q].max_tokens 不能为负数", model)
+		}
+		if settings.ContextWindow > 0 && settings.MaxTokens >= settings.ContextWindow {
+			addf("models.settings[%q].max_tokens 必须小于 context_window", model)
+		}
+		if t := settings.Temperature; t != nil && (*t < 0 || *t > 2) {
+			addf("models.settings[%q].temperature 必须在 0 到 2 之间", model)
+		}
+		if p := settings.Pricing; p != nil && (p.Input < 0 || p.Output < 0 || p.CachedInput < 0) {
+			addf("models.settings[%q].pricing 不能为负数", model)
+		}
+	}
+
+	// 智能路由
+	if r := cfg.Router; r.Enabled {
+		switch r.Mode {
+		case "", routerModeCategory:
+		case routerModeCost:
+			eligible := false
+			for _, model := range cfg.Models.Available {
+				eligible = eligible || cfg.Models.Settings[model].Tier >= r.MinTier
+			}
+			if !eligible {
+				addf("router.min_tier 为 %d，但 models.settings 中没有等级不低于它的可用模型", r.MinTier)
+			}
+		default:
+			addf("router.mode 无效: %q，可选 %s、%s", r.Mode, routerModeCategory, routerModeCost)
+		}
+		if r.MinTier < 0 || r.MaxEscalations < 0 {
+			addf("router.min_tier 和 router.max_escalations 不能为负数")
+		}
+		if r.Model != "" && !isConfiguredModel(cfg, r.Model) {
+			addf("router.model %q 不在 models.available 中", r.Model)
+		}
+		if _, ok := cfg.Models.Aliases[routerModelAuto]; ok {
+			addf("开启 router 时不能使用 %q 作为模型别名", routerModelAuto)
+		}
+		for category, model := range r.Routes {
+			if !containsString(routeCategories, category) {
+				addf("router.routes 中的类别无效: %q，可选 %s", category, strings.Join(routeCategories, "、"))
+			}
+			if !isConfiguredModel(cfg, model) {
+				addf("router.routes[%q] 的模型 %q 不在 models.available 中", category, model)
+			}
+		}
+	}
+
+	// 回答评分
+	if j := cfg.Judge; j.Enabled {
+		switch j.Action {
+		case "", judgeActionFlag, judgeActionRegenerate:
+		default:
+			addf("judge.action 无效: %q，可选 %s、%s", j.Action, judgeActionFlag, judgeActionRegenerate)
+		}
+		if j.Threshold < 0 || j.Threshold > 10 {
+			addf("judge.threshold 必须在 0 到 10 之间")
+		}
+		if j.MaxRegenerations < 0 {
+			addf("judge.max_regenerations 不能为负数")
+		}
+		if j.Model != "" && !isConfiguredModel(cfg, j.Model) {
+			addf("judge.model %q 不在 models.available 中", j.Model)
+		}
+		if d, err := time.ParseDuration(j.Timeout); j.Timeout != "" && (err != nil || d <= 0) {
+			addf("judge.timeout 无效: %q", j.Timeout)
+		}
+	}
+
+	// 图片文字识别
+	switch cfg.OCR.Engine {
+	case "", ocrEngineVision, ocrEngineTesseract:
+	default:
+		addf("ocr.engine 无效: %q，可选 %s、%s", cfg.OCR.Engine, ocrEngineVision, ocrEngineTesseract)
+	}
+	if cfg.OCR.Model != "" && !isConfiguredModel(cfg, cfg.OCR.Model) {
+		addf("ocr.model %q 不在 models.available 中", cfg.OCR.Model)
+	}
+	if d, err := time.ParseDuration(cfg.OCR.Timeout); cfg.OCR.Timeout != "" && (err != nil || d <= 0) {
+		addf("ocr.timeout 无效: %q", cfg.OCR.Timeout)
+	}
+
+	// 知识库条目质量评分
+	if q := cfg.Quality; q.Enabled {
+		if q.Threshold < 0 || q.Threshold > 10 {
+			addf("quality.threshold 必须在 0 到 10 之间")
+		}
+		if q.Model != "" && !isConfiguredModel(cfg, q.Model) {
+			addf("quality.model %q 不在 models.available 中", q.Model)
+		}
+		if d, err := time.ParseDuration(q.Timeout); q.Timeout != "" && (err != nil || d <= 0) {
+			addf("quality.timeout 无效: %q", q.Timeout)
+		}
+	}
+
+	// 影子流量
+	if sh := cfg.Shadow; sh.Enabled {
+		if sh.Model == "" {
+			addf("开启 shadow 时 shadow.model 不能为空")
+		} else if !isConfiguredModel(cfg, sh.Model) {
+			addf("shadow.model %q 不在 models.available 中", sh.Model)
+		}
+		if sh.Rate <= 0 || sh.Rate > 1 {
+			addf("shadow.rate 必须大于 0 且不超过 1")
+		}
+		if sh.MaxConcurrent < 0 {
+			addf("shadow.max_concurrent 不能为负数")
+		}
+		if d, err := time.ParseDuration(sh.Timeout); sh.Timeout != "" && (err != nil || d <= 0) {
+			addf("shadow.timeout 无效: %q", sh.Timeout)
+		}
+	}
+
+	if d, err := time.ParseDuration(cfg.Finetune.PollInterval); cfg.Finetune.PollInterval != "" && (err != nil || d <= 0) {
+		addf("finetune.poll_interval 无效: %q", cfg.Finetune.PollInterval)
+	}
+
+	// 主题分析
+	if t := cfg.Analytics.Topics; t.Enabled {
+		if cfg.Embeddings.Model == "" {
+			addf("开启 analytics.topics 时需要配置 embeddings.model")
+		}
+		if !usesDatabase(cfg) {
+			addf("开启 analytics.topics 时需要数据库存储（storage.driver 为 bolt、sqlite 或 postgres），数据文件只保存最近的问答")
+		}
+		if t.Model != "" && !isConfiguredModel(cfg, t.Model) {
+			addf("analytics.topics.model %q 不在 models.available 中", t.Model)
+		}
+		for name, v := range map[string]string{"interval": t.Interval, "window": t.Window} {
+			if d, err := time.ParseDuration(v); v != "" && (err != nil || d <= 0) {
+				addf("analytics.topics.%s 无效: %q", name, v)
+			}
+		}
+		if t.Clusters < 0 || t.MaxQuestions < 0 {
+			addf("analytics.topics.clusters 和 analytics.topics.max_questions 不能为负数")
+		}
+	}
+
+	// 提示词缓存
+	switch cfg.Prompt.Cache.Mode {
+	case "", cacheModeAuto, cacheModeAnthropic, cacheModeOpenAI, cacheModeOff:
+	default:
+		addf("prompt.cache.mode 无效: %q", cfg.Prompt.Cache.Mode)
+	}
+
+	// 回答语言
+	if cfg.Prompt.AnswerLanguage != "" && !isValidAnswerLanguage(cfg.Prompt.AnswerLanguage) {
+		addf("prompt.answer_language 无效: %q，应为语言标签（如 en、zh-CN）或 auto", cfg.Prompt.AnswerLanguage)
+	}
+	for user, language := range cfg.Prompt.UserLanguages {
+		if !isValidAnswerLanguage(language) {
+			addf("prompt.user_languages.%s 无效: %q，应为语言标签（如 en、zh-CN）或 auto", user, language)
+		}
+	}
+
+	// 知识库内容复查
+	for name, v := range map[string]string{
+		"interval":              cfg.Staleness.Interval,
+		"timeout":               cfg.Staleness.Timeout,
+		"verify.interval":       cfg.Staleness.Verify.Interval,
+		"verify.reverify_after": cfg.Staleness.Verify.ReverifyAfter,
+		"verify.timeout":        cfg.Staleness.Verify.Timeout,
+	} {
+		if d, err := time.ParseDuration(v); v != "" && (err != nil || d <= 0) {
+			addf("staleness.%s 无效: %q", name, v)
+		}
+	}
+	if d, err := time.ParseDuration(cfg.Staleness.MaxAge); cfg.Staleness.MaxAge != "" && (err != nil || d < 0) {
+		addf("staleness.max_age 无效: %q", cfg.Staleness.MaxAge)
+	}
+	if cfg.Staleness.Verify.MaxItems < 0 {
+		addf("staleness.verify.max_items 不能小于 0: %d", cfg.Staleness.Verify.MaxItems)
+	}
+
+	// 功能开关
+	for name := range cfg.Features {
+		if !containsString(knownFeatures, name) {
+			addf("features.%s 无效，可选 %s", name, strings.Join(knownFeatures, "、"))
+		}
+	}
+
+	// 内容审核
+	switch cfg.Moderation.Provider {
+	case "", moderationProviderKeywords, moderationProviderOpenAI:
+	default:
+		addf("moderation.provider 无效: %q", cfg.Moderation.Provider)
+	}
+	switch cfg.Moderation.Action {
+	case "", moderationActionBlock, moderationActionFlag, moderationActionAllow:
+	default:
+		addf("moderation.action 无效: %q", cfg.Moderation.Action)
+	}
+
+	// 输出过滤
+	validateRules := func(prefix string, rules []FilterRule) {
+		for i, rule := range rules {
+			switch rule.Action {
+			case "", filterActionRedact, filterActionReject, filterActionWarn:
+			default:
+				addf("%s[%d].action 无效: %q", prefix, i, rule.Action)
+			}
+			if rule.Regex {
+				if _, err := regexp.Compile(rule.Pattern); err != nil {
+					addf("%s[%d].pattern 不是有效的正则表达式: %v", prefix, i, err)
+				}
+			}
+		}
+	}
+	validateRules("filters.rules", cfg.Filters.Rules)
+	for name, rules := range cfg.Filters.Workspaces {
+		validateRules("filters.workspaces."+name, rules)
+	}
+
+	// 密钥刷新
+	if v := cfg.Secrets.RefreshInterval; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			addf("secrets.refresh_interval 不是有效的时间间隔: %q", v)
+		}
+	}
+
+	// 数据存储
+	switch cfg.Storage.Lock {
+	case "", storageLockExclusive, storageLockNone:
+	default:
+		addf("storage.lock 无效: %q", cfg.Storage.Lock)
+	}
+	switch cfg.Storage.Compression {
+	case "", compressionNone, compressionGzip, compressionZstd:
+	default:
+		addf("storage.compression 无效: %q", cfg.Storage.Compression)
+	}
+	switch cfg.Storage.Driver {
+	case "", storageDriverJSON, storageDriverBolt, storageDriverSQLite:
+	case storageDriverPostgres:
+		if cfg.Storage.DSN == "" {
+			addf("storage.dsn 不能为空（storage.driver 为 %s）", cfg.Storage.Driver)
+		}
+	default:
+		addf("storage.driver 无效: %q", cfg.Storage.Driver)
+	}
+	if cfg.Storage.EncryptionKey != "" {
+		if _, err := parseDataKey(cfg.Storage.EncryptionKey); err != nil {
+			addf("storage.encryption_key 无效: %v", err)
+		}
+	}
+	if v := cfg.Storage.CompactInterval; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			addf("storage.compact_interval 不是有效的时间间隔: %q", v)
+		}
+	}
+
+	// 日志
+	switch strings.ToLower(cfg.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		addf("logging.level 无效: %q", cfg.Logging.Level)
+	}
+	switch strings.ToLower(cfg.Logging.Format) {
+	case "", "text", "json":
+	default:
+		addf("logging.format 无效: %q", cfg.Logging.Format)
+	}
+
+	// 错误上报
+	if dsn := cfg.ErrorReporting.DSN; dsn != "" {
+		if u, err := url.Parse(dsn); err != nil || u.User == nil || u.Host == "" {
+			addf("error_reporting.dsn 不是有效的 Sentry DSN")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkConfig 校验配置文件并退出，校验失败时退出码为1
+func checkConfig() {
+	cfg, err := readConfigFile(configFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("配置文件 %s 检查通过（配置档 %s）\n", configFile, cfg.Profile)
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 构建信息，编译时通过 -ldflags "-X main.version=..." 注入
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildTime = ""
+)
+
+// buildInfo 返回构建信息，未通过ldflags注入时尝试读取Go自带的VCS信息
+func buildInfo() (commit, built string) {
+	commit, built = gitCommit, buildTime
+	if commit != "" && built != "" {
+		return commit, built
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			}
+		}
+	}
+
+	if commit == "" {
+		commit = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return commit, built
+}
+
+// versionHandler 返回版本和构建信息
+func versionHandler(c *gin.Context) {
+	commit, built := buildInfo()
+	c.JSON(http.StatusOK, gin.H{
+		"version":    version,
+		"git_commit": commit,
+		"build_time": built,
+		"go_version": runtime.Version(),
+		"profile":    currentConfig().Profile,
+	})
+}
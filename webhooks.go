@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const webhookDeliveryLogFile = "webhook_deliveries.jsonl"
+
+// 每次投递最多尝试的次数，失败后按 1s、2s、4s…… 的间隔重试
+const webhookMaxAttempts = 4
+
+// 查询投递记录默认返回的条数
+const defaultWebhookDeliveryLimit = 100
+
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+var webhookDeliveryMu sync.Mutex
+
+// WebhookConfig 事件通知的接收地址
+type WebhookConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// 用于签名的密钥，为空时不签名
+	Secret string `yaml:"secret"`
+	// 订阅的事件，为空时接收全部事件
+	Events []string `yaml:"events"`
+}
+
+// WebhookPayload 发送给接收地址的事件内容
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery 一次投递的结果，所有重试结束后记录
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	Webhook    string    `json:"webhook"`
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	Timestamp  time.Time `json:"timestamp"`
+	Attempts   int       `json:"attempts"`
+	Status     int       `json:"status,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// deliverWebhookEvent 事件总线的订阅者，把事件异步发送给订阅了该事件的全部接收地址
+func deliverWebhookEvent(e Event) {
+	hooks := currentConfig().Webhooks
+	if len(hooks) == 0 {
+		return
+	}
+	payload := WebhookPayload{ID: e.ID, Event: e.Name, Timestamp: e.Timestamp, Data: e.Data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("生成Webhook事件失败", "event", e.Name, "error", err)
+		return
+	}
+	for _, hook := range hooks {
+		if len(hook.Events) > 0 && !containsString(hook.Events, e.Name) {
+			continue
+		}
+		go deliverWebhook(hook, payload, body)
+	}
+}
+
+// newWebhookPayload 生成事件及其请求体
+func newWebhookPayload(event string, data interface{}) (WebhookPayload, []byte, error) {
+	payload := WebhookPayload{ID: newEventID(), Event: event, Timestamp: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(payload)
+	return payload, body, err
+}
+
+// deliverWebhook 投递事件，网络错误和非2xx响应都会重试，结果写入投递记录并返回
+func deliverWebhook(hook WebhookConfig, payload WebhookPayload, body []byte) WebhookDelivery {
+	start := time.Now()
+	delivery := WebhookDelivery{
+		ID:        payload.ID,
+		Webhook:   hook.Name,
+		Event:     payload.Event,
+		URL:       hook.URL,
+		Timestamp: start,
+	}
+
+	backoff := time.Second
+	for delivery.Attempts < webhookMaxAttempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+		status, err := sendWebhook(hook, payload, body)
+		delivery.Status = status
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+	}
+	delivery.DurationMS = time.Since(start).Milliseconds()
+
+	if !delivery.Success {
+		slog.Warn("Webhook投递失败", "webhook", hook.Name, "event", payload.Event, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+	webhookDeliveryMu.Lock()
+	defer webhookDeliveryMu.Unlock()
+	if err := appendJSONLine(dataPath(webhookDeliveryLogFile), delivery); err != nil {
+		slog.Error("写入Webhook投递记录失败", "error", err)
+	}
+	return delivery
+}
+
+// sendWebhook 发送一次请求，返回响应状态码
+// 配置了密钥时，X-Webhook-Signature 为 sha256=HEX(HMAC-SHA256(secret, 时间戳 + "." + 请求体))
+func sendWebhook(hook WebhookConfig, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ai-assistant/"+version)
+	req.Header.Set("X-Webhook-ID", payload.ID)
+	req.Header.Set("X-Webhook-Event", payload.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+webhookSignature(hook.Secret, timestamp, body))
+	}
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("接收地址返回状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookSignature 计算请求签名
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDeliveriesHandler 查询投递记录，可按接收地址名称、事件和是否成功筛选，最新的在前
+func webhookDeliveriesHandler(c *gin.Context) {
+	name := c.Query("webhook")
+	event := c.Query("event")
+	failedOnly := c.Query("failed") == "true"
+
+	limit := defaultWebhookDeliveryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, tr(c, "error.limit_invalid"))
+			return
+		}
+		limit = n
+	}
+
+	deliveries := []WebhookDelivery{}
+	webhookDeliveryMu.Lock()
+	err := readJSONLines(dataPath(webhookDeliveryLogFile), func(line []byte) {
+		var d WebhookDelivery
+		if json.Unmarshal(line, &d) != nil {
+			return
+		}
+		if (name != "" && d.Webhook != name) || (event != "" && d.Event != event) || (failedOnly && d.Success) {
+			return
+		}
+		deliveries = append(deliveries, d)
+	})
+	webhookDeliveryMu.Unlock()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, tr(c, "error.read_deliveries"))
+		return
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].Timestamp.After(deliveries[j].Timestamp)
+	})
+	total := len(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":      total,
+		"deliveries": deliveries,
+	})
+}
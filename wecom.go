@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 企业微信接口地址
+const wecomAPIBase = "https://qyapi.weixin.qq.com/cgi-bin"
+
+// 默认的保存到知识库指令
+const defaultWeComSaveCommand = "保存"
+
+// 企业微信 markdown 消息内容的最大字节数
+const wecomMaxMessageBytes = 2048
+
+// 审计日志中的企业微信操作
+const (
+	auditActionWeComChat = "wecom.chat"
+	auditActionWeComSave = "wecom.knowledge.add"
+)
+
+var wecomHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	// 应用的 access_token 及其过期时间
+	wecomTokenMu      sync.Mutex
+	wecomAccessToken  string
+	wecomTokenExpires time.Time
+
+	// 每个成员最近一次的问答，用于保存指令
+	wecomLastMu      sync.Mutex
+	wecomLastRecords = map[string]QARecord{}
+)
+
+// wecomEnvelope 回调请求体，消息内容加密在 Encrypt 中
+type wecomEnvelope struct {
+	ToUserName string `xml:"ToUserName"`
+	AgentID    string `xml:"AgentID"`
+	Encrypt    string `xml:"Encrypt"`
+}
+
+// wecomMessage 解密后的消息
+type wecomMessage struct {
+	ToUserName   string `xml:"ToUserName"`
+	FromUserName string `xml:"FromUserName"`
+	CreateTime   int64  `xml:"CreateTime"`
+	MsgType      string `xml:"MsgType"`
+	Content      string `xml:"Content"`
+	MsgID        string `xml:"MsgId"`
+	AgentID      int    `xml:"AgentID"`
+}
+
+// wecomSaveCommand 返回保存到知识库的指令
+func wecomSaveCommand(cfg *Config) string {
+	if cfg.WeCom.SaveCommand != "" {
+		return cfg.WeCom.SaveCommand
+	}
+	return defaultWeComSaveCommand
+}
+
+// setupWeCom 注册企业微信应用的回调地址
+func setupWeCom(r *gin.Engine, cfg *Config) {
+	if !cfg.WeCom.Enabled {
+		return
+	}
+	r.GET("/wecom/callback", wecomVerifyHandler)
+	r.POST("/wecom/callback", wecomCallbackHandler)
+	slog.Info("企业微信应用已启用", "path", "/wecom/callback")
+}
+
+// wecomVerifyHandler 配置回调地址时企业微信发起的验证，校验签名后返回解密的 echostr
+func wecomVerifyHandler(c *gin.Context) {
+	cfg := currentConfig()
+	echo := c.Query("echostr")
+	if !wecomSignatureValid(cfg, c.Query("msg_signature"), c.Query("timestamp"), c.Query("nonce"), echo) {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "企业微信签名无效", http.StatusUnauthorized)
+		respondError(c, http.StatusUnauthorized, tr(c, "error.signature_invalid"))
+		return
+	}
+	plain, err := wecomDecrypt(cfg, echo)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.String(http.StatusOK, string(plain))
+}
+
+// wecomCallbackHandler 接收成员发送的消息，校验签名并解密后立即返回，回答通过接口主动发送
+// 企业微信要求5秒内响应，模型调用通常超过这个时间
+func wecomCallbackHandler(c *gin.Context) {
+	cfg := currentConfig()
+	var envelope wecomEnvelope
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = xml.Unmarshal(body, &envelope)
+	}
+	if err != nil || envelope.Encrypt == "" {
+		respondError(c, http.StatusBadRequest, tr(c, "error.invalid_callback"))
+		return
+	}
+	if !wecomSignatureValid(cfg, c.Query("msg_signature"), c.Query("timestamp"), c.Query("nonce"), envelope.Encrypt) {
+		recordAudit(c, auditActionAuthFailed, c.FullPath(), "企业微信签名无效", http.StatusUnauthorized)
+		respondError(c, http.StatusUnauthorized, tr(c, "error.signature_invalid"))
+		return
+	}
+	plain, err := wecomDecrypt(cfg, envelope.Encrypt)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	var msg wecomMessage
+	if err := xml.Unmarshal(plain, &msg); err != nil {
+		respondError(c, http.StatusBadRequest, tr(c, "error.invalid_message"))
+		return
+	}
+
+	// 目前只处理文本消息，其它消息和事件直接忽略
+	if msg.MsgType == "text" && strings.TrimSpace(msg.Content) != "" {
+		go handleWeComMessage(msg)
+	}
+	c.String(http.StatusOK, "")
+}
+
+// handleWeComMessage 处理成员的文本消息：保存指令保存上一次的回答，其它内容交给与 /api/v1/chat 相同的处理流程
+func handleWeComMessage(msg wecomMessage) {
+	cfg := currentConfig()
+	content := strings.TrimSpace(msg.Content)
+
+	if content == wecomSaveCommand(cfg) {
+		wecomLastMu.Lock()
+		record, ok := wecomLastRecords[msg.FromUserName]
+		delete(wecomLastRecords, msg.FromUserName)
+		wecomLastMu.Unlock()
+		if !ok {
+			sendWeComMessage(msg.FromUserName, "没有可以保存的回答，请先提问。")
+			return
+		}
+		item, err := addKnowledgeItem(KnowledgeItem{
+			Title:     askDefaultTitle(record.Question),
+			Content:   record.Answer,
+			Model:     record.Model,
+			Timestamp: time.Now(),
+			Tags:      []string{"wecom"},
+		})
+		if err != nil {
+			wecomAudit(msg.FromUserName, auditActionWeComSave, "knowledge", err.Error(), http.StatusForbidden)
+			sendWeComMessage(msg.FromUserName, "未能保存到知识库："+err.Error())
+			return
+		}
+		wecomAudit(msg.FromUserName, auditActionWeComSave, fmt.Sprintf("knowledge/%d", item.ID), item.Title, http.StatusOK)
+		sendWeComMessage(msg.FromUserName, fmt.Sprintf("已保存到知识库（ID %d）", item.ID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), askTimeout)
+	defer cancel()
+
+	req := ChatRequest{Message: content, Model: cfg.WeCom.Model, Workspace: cfg.WeCom.Workspace, User: "wecom:" + msg.FromUserName}
+	resp, record, chatErr := processChat(ctx, req, "")
+	if chatErr != nil {
+		if chatErr.Err != nil {
+			slog.Error("调用模型失败", "source", "wecom", "error", chatErr.Err)
+			reportError(nil, "upstream", chatErr.Err, "", map[string]interface{}{"model": cfg.WeCom.Model, "source": "wecom"})
+		}
+		wecomAudit(msg.FromUserName, auditActionWeComChat, "chat", chatErr.Message, chatErr.Status)
+		sendWeComMessage(msg.FromUserName, "抱歉，处理失败："+chatErr.Message)
+		return
+	}
+	wecomAudit(msg.FromUserName, auditActionWeComChat, "chat", fmt.Sprintf("record_id=%d", record.ID), http.StatusOK)
+
+	wecomLastMu.Lock()
+	wecomLastRecords[msg.FromUserName] = record
+	wecomLastMu.Unlock()
+
+	sendWeComMessage(msg.FromUserName, resp.Response+
+		fmt.Sprintf("\n\n> %s · 回复“%s”保存到知识库", resp.Model, wecomSaveCommand(cfg)))
+}
+
+// wecomSignatureValid 校验消息签名：token、timestamp、nonce 和密文按字典序排序拼接后的 SHA1
+func wecomSignatureValid(cfg *Config, signature, timestamp, nonce, encrypted string) bool {
+	parts := []string{cfg.WeCom.Token, timestamp, nonce, encrypted}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	expected := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// wecomDecrypt 解密消息：AES-256-CBC，密钥为 EncodingAESKey 解码后的32字节，IV 为密钥前16字节
+// 明文格式为 16字节随机数 + 4字节消息长度 + 消息 + 企业ID
+func wecomDecrypt(cfg *Config, encrypted string) ([]byte, error) {
+	key, err := wecomAESKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("密文格式无效")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plain, data)
+
+	// PKCS#7 填充，块大小为32
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) {
+		return nil, errors.New("解密失败：填充无效")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, errors.New("解密失败：内容过短")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+msgLen > len(plain) {
+		return nil, errors.New("解密失败：消息长度无效")
+	}
+	if receiver := string(plain[20+msgLen:]); receiver != cfg.WeCom.CorpID {
+		return nil, fmt.Errorf("消息的企业ID不匹配: %s", receiver)
+	}
+	return plain[20 : 20+msgLen], nil
+}
+
+// wecomAESKey 解码 EncodingAESKey
+func wecomAESKey(cfg *Config) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(cfg.WeCom.EncodingAESKey + "=")
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("wecom.encoding_aes_key 无效，应为43个字符")
+	}
+	return key, nil
+}
+
+// wecomToken 返回应用的 access_token，过期前提前5分钟刷新
+func wecomToken() (string, error) {
+	wecomTokenMu.Lock()
+	defer wecomTokenMu.Unlock()
+	if wecomAccessToken != "" && time.Now().Before(wecomTokenExpires) {
+		return wecomAccessToken, nil
+	}
+
+	cfg := currentConfig()
+	query := url.Values{"corpid": {cfg.WeCom.CorpID}, "corpsecret": {cfg.WeCom.Secret}}
+	resp, err := wecomHTTPClient.Get(wecomAPIBase + "/gettoken?" + query.Encode())
+	if err != nil {
+		return "", fmt.Errorf("获取企业微信 access_token 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("解析企业微信 access_token 失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return "", fmt.Errorf("获取企业微信 access_token 失败: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	wecomAccessToken = result.AccessToken
+	wecomTokenExpires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - 5*time.Minute)
+	return wecomAccessToken, nil
+}
+
+// sendWeComMessage 以应用身份向成员发送 markdown 消息，超过长度限制时分多条发送
+func sendWeComMessage(user, content string) {
+	token, err := wecomToken()
+	if err != nil {
+		slog.Error("发送企业微信消息失败", "user", user, "error", err)
+		return
+	}
+	cfg := currentConfig()
+	for _, part := range splitByBytes(content, wecomMaxMessageBytes) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"touser":   user,
+			"msgtype":  "markdown",
+			"agentid":  cfg.WeCom.AgentID,
+			"markdown": map[string]string{"content": part},
+		})
+		resp, err := wecomHTTPClient.Post(wecomAPIBase+"/message/send?access_token="+url.QueryEscape(token), "application/json", bytes.NewReader(payload))
+		if err != nil {
+			slog.Error("发送企业微信消息失败", "user", user, "error", err)
+			return
+		}
+		var result struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if result.ErrCode != 0 {
+			slog.Error("发送企业微信消息失败", "user", user, "errcode", result.ErrCode, "errmsg", result.ErrMsg)
+			return
+		}
+	}
+}
+
+// splitByBytes 按字节数切分文本，不会切断多字节字符，尽量在换行处切分
+func splitByBytes(s string, limit int) []string {
+	var parts []string
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if i := strings.LastIndexByte(s[:cut], '\n'); i > limit/2 {
+			cut = i + 1
+		}
+		parts = append(parts, s[:cut])
+		s = s[cut:]
+	}
+	return append(parts, s)
+}
+
+// wecomAudit 记录企业微信操作的审计日志，用户为 wecom:<成员账号>
+func wecomAudit(user, action, resource, detail string, status int) {
+	writeAudit(AuditEntry{
+		Timestamp: time.Now(),
+		User:      "wecom:" + user,
+		Action:    action,
+		Resource:  resource,
+		Detail:    detail,
+		Status:    status,
+	})
+}